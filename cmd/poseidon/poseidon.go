@@ -17,16 +17,20 @@ limitations under the License.
 package main
 
 import (
+	"os"
 	"time"
 
 	"github.com/kubernetes-sigs/poseidon/pkg/config"
 	"github.com/kubernetes-sigs/poseidon/pkg/firmament"
 	k8sclient "github.com/kubernetes-sigs/poseidon/pkg/k8sclient"
+	"github.com/kubernetes-sigs/poseidon/pkg/leaderelection"
 	"github.com/kubernetes-sigs/poseidon/pkg/metrics"
 	"github.com/kubernetes-sigs/poseidon/pkg/poseidonhttp"
+	"github.com/kubernetes-sigs/poseidon/pkg/signals"
 	"github.com/kubernetes-sigs/poseidon/pkg/stats"
 
 	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
 
 	"github.com/golang/glog"
 )
@@ -36,12 +40,34 @@ const (
 	FirmamentHealthCheckTimeout  = 10 * time.Minute
 )
 
-func schedule(fc firmament.FirmamentSchedulerClient) {
+// preemptionsFirst orders the preemptions and migrations before the placements, so that the victims
+// are known when the pods placed on their nodes are bound.
+func preemptionsFirst(deltas []*firmament.SchedulingDelta) []*firmament.SchedulingDelta {
+	ordered := make([]*firmament.SchedulingDelta, 0, len(deltas))
+	for _, delta := range deltas {
+		if delta.GetType() == firmament.SchedulingDelta_PREEMPT || delta.GetType() == firmament.SchedulingDelta_MIGRATE {
+			ordered = append(ordered, delta)
+		}
+	}
+	for _, delta := range deltas {
+		if delta.GetType() != firmament.SchedulingDelta_PREEMPT && delta.GetType() != firmament.SchedulingDelta_MIGRATE {
+			ordered = append(ordered, delta)
+		}
+	}
+	return ordered
+}
+
+func schedule(fc firmament.FirmamentSchedulerClient, stopCh <-chan struct{}) {
 
-	stopCh := make(chan struct{})
 	// start the bond od wokers
 	go k8sclient.BindPodWorkers(stopCh, config.GetBurst())
 	for {
+		select {
+		case <-stopCh:
+			glog.Info("Stopping the scheduling loop")
+			return
+		default:
+		}
 		deltas := firmament.Schedule(fc)
 
 		glog.Infof("Scheduler returned %d deltas", len(deltas.GetDeltas()))
@@ -50,7 +76,7 @@ func schedule(fc firmament.FirmamentSchedulerClient) {
 				go k8sclient.NewPoseidonEvents(k8sclient.ClientSet).ProcessEvents(deltas)
 			}
 		}
-		for _, delta := range deltas.GetDeltas() {
+		for _, delta := range preemptionsFirst(deltas.GetDeltas()) {
 			switch delta.GetType() {
 			case firmament.SchedulingDelta_PLACE:
 				k8sclient.PodMux.RLock()
@@ -67,7 +93,12 @@ func schedule(fc firmament.FirmamentSchedulerClient) {
 				}
 				// TODO(jiaxuanzhou): Metric the latency of binding one node when client provided to get the desc of the task(pod)
 				// metrics.BindingLatency.Observe(metrics.SinceInMicroseconds(time.Time(task.SubmitTime)))
-				k8sclient.BindChannel <- k8sclient.BindInfo{Name: podIdentifier.Name, Namespace: podIdentifier.Namespace, Nodename: nodeName}
+				bindInfo := k8sclient.BindInfo{Name: podIdentifier.Name, Namespace: podIdentifier.Namespace, Nodename: nodeName}
+				if k8sclient.NominatePod(bindInfo) {
+					// The pod is bound once the victims preempted on the node are deleted.
+					continue
+				}
+				k8sclient.BindChannel <- bindInfo
 			case firmament.SchedulingDelta_PREEMPT, firmament.SchedulingDelta_MIGRATE:
 				k8sclient.PodMux.RLock()
 				preemptionStartTime := time.Now()
@@ -81,7 +112,7 @@ func schedule(fc firmament.FirmamentSchedulerClient) {
 				// However, preemption can be achieved by deleting the preempted pod
 				// and relying on the controller mechanism (e.g., job, replica set)
 				// to submit another instance of this pod.
-				k8sclient.DeletePod(podIdentifier.Name, podIdentifier.Namespace)
+				k8sclient.PreemptPod(podIdentifier)
 				metrics.SchedulingPremptionEvaluationDuration.Observe(metrics.SinceInMicroseconds(preemptionStartTime))
 			case firmament.SchedulingDelta_NOOP:
 			default:
@@ -89,7 +120,10 @@ func schedule(fc firmament.FirmamentSchedulerClient) {
 			}
 		}
 		// TODO(ionel): Temporary sleep statement because we currently call the scheduler even if there's no work do to.
-		time.Sleep(time.Duration(config.GetSchedulingInterval()) * time.Second)
+		select {
+		case <-stopCh:
+		case <-time.After(time.Duration(config.GetSchedulingInterval()) * time.Second):
+		}
 	}
 }
 
@@ -115,16 +149,93 @@ func WaitForFirmamentService(fc firmament.FirmamentSchedulerClient) {
 func main() {
 
 	glog.Infof("Starting Poseidon with firmament address %s.", config.GetFirmamentAddress())
+	if recordFile := config.GetFirmamentRecordFile(); recordFile != "" {
+		f, err := os.OpenFile(recordFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			glog.Fatalf("Failed to open the Firmament record file: %v", err)
+		}
+		defer f.Close()
+		glog.Infof("Recording the Firmament RPCs to %s", recordFile)
+		firmament.SetRecorder(firmament.NewRecorder(f))
+	}
+	firmament.SetClientOptions(firmament.ClientOptions{
+		KeepaliveTime:                config.GetFirmamentKeepaliveTime(),
+		KeepaliveTimeout:             config.GetFirmamentKeepaliveTimeout(),
+		KeepalivePermitWithoutStream: config.GetFirmamentKeepalivePermitWithoutStream(),
+	})
 	fc, conn, err := firmament.New(config.GetFirmamentAddress())
 	if err != nil {
 		panic(err)
 	}
 	defer conn.Close()
+	// The Firmament addresses listed in the config file can be changed without restarting Poseidon.
+	config.WatchFirmamentAddress(func(address string) {
+		if !firmament.UpdateAddresses(address) {
+			glog.Warningf("Ignoring the new Firmament address %s, no Firmament client was created", address)
+		}
+	})
 	// Check if firmament grpc service is available and then proceed
 	WaitForFirmamentService(fc)
-	go schedule(fc)
 	go stats.StartgRPCStatsServer(config.GetStatsServerAddress(), config.GetFirmamentAddress())
 	go poseidonhttp.Serve(fc)
+	// SIGTERM and SIGINT stop Poseidon cleanly, e.g. withdrawing its tasks with --removeTasksOnShutdown.
+	stopCh := signals.SetupSignalHandler()
+	if !config.GetLeaderElect() {
+		run(fc, stopCh)
+		return
+	}
+	runWithLeaderElection(fc, stopCh)
+}
+
+// run starts the scheduling loop and the Kubernetes watchers, it blocks until stopCh is closed.
+func run(fc firmament.FirmamentSchedulerClient, stopCh <-chan struct{}) {
+	go schedule(fc, stopCh)
 	kubeMajorVer, kubeMinorVer := config.GetKubeVersion()
-	k8sclient.New(config.GetSchedulerName(), config.GetKubeConfig(), kubeMajorVer, kubeMinorVer, config.GetFirmamentAddress())
+	k8sclient.New(config.GetSchedulerName(), config.GetKubeConfig(), kubeMajorVer, kubeMinorVer, config.GetFirmamentAddress(), stopCh)
+}
+
+// runWithLeaderElection only runs poseidon while this replica holds the leader lease.
+// Standby replicas block until they acquire the lease. It returns once stopCh is closed.
+func runWithLeaderElection(fc firmament.FirmamentSchedulerClient, stopCh <-chan struct{}) {
+	restConfig, err := k8sclient.GetClientConfig(config.GetKubeConfig())
+	if err != nil {
+		glog.Fatalf("Failed to load client config: %v", err)
+	}
+	client, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		glog.Fatalf("Failed to create connection: %v", err)
+	}
+	id, err := os.Hostname()
+	if err != nil {
+		glog.Fatalf("Failed to get the hostname for the leader election identity: %v", err)
+	}
+	le, err := leaderelection.NewLeaderElector(leaderelection.Config{
+		Client:        client,
+		Namespace:     config.GetLeaderElectNamespace(),
+		Name:          config.GetLeaderElectName(),
+		Identity:      id,
+		LeaseDuration: config.GetLeaderElectLeaseDuration(),
+		RenewDeadline: config.GetLeaderElectRenewDeadline(),
+		RetryPeriod:   config.GetLeaderElectRetryPeriod(),
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(stop <-chan struct{}) {
+				glog.Infof("%s became the leader", id)
+				run(fc, stop)
+			},
+			OnStoppedLeading: func() {
+				select {
+				case <-stopCh:
+					glog.Infof("%s stopped leading on shutdown", id)
+					return
+				default:
+				}
+				// The pod and task state is only valid for the leader, restart as a standby.
+				glog.Fatalf("%s lost the leader lease", id)
+			},
+		},
+	})
+	if err != nil {
+		glog.Fatalf("Failed to create the leader elector: %v", err)
+	}
+	le.Run(stopCh)
 }
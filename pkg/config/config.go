@@ -20,10 +20,14 @@ import (
 	"flag"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/fsnotify/fsnotify"
 	"github.com/golang/glog"
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
+	"k8s.io/apimachinery/pkg/api/resource"
 )
 
 var config poseidonConfig
@@ -43,6 +47,100 @@ type poseidonConfig struct {
 	HealthCheckAddress string  `json:"healthCheckAddress,omitempty"`
 	K8sBurst           int     `json:"k8sBurst,omitempty"`
 	K8sQPS             float32 `json:"k8sQPS,omitempty"`
+	// Leader election is required when running more than one Poseidon replica.
+	LeaderElect              bool   `json:"leaderElect,omitempty"`
+	LeaderElectNamespace     string `json:"leaderElectNamespace,omitempty"`
+	LeaderElectName          string `json:"leaderElectName,omitempty"`
+	LeaderElectLeaseDuration int    `json:"leaderElectLeaseDuration,omitempty"`
+	LeaderElectRenewDeadline int    `json:"leaderElectRenewDeadline,omitempty"`
+	LeaderElectRetryPeriod   int    `json:"leaderElectRetryPeriod,omitempty"`
+	FirmamentConcurrency     int    `json:"firmamentConcurrency,omitempty"`
+	// AnnotationLabelPrefixes holds annotationPrefix=labelPrefix pairs.
+	AnnotationLabelPrefixes []string `json:"annotationLabelPrefixes,omitempty"`
+	MemoryUnit              string   `json:"memoryUnit,omitempty"`
+	EnablePodDebug          bool     `json:"enablePodDebug,omitempty"`
+	EnableGangScheduling    bool     `json:"enableGangScheduling,omitempty"`
+	// Pods of the NamespaceDenylist namespaces, or of the namespaces missing from a non empty
+	// NamespaceAllowlist, are ignored.
+	NamespaceAllowlist []string `json:"namespaceAllowlist,omitempty"`
+	NamespaceDenylist  []string `json:"namespaceDenylist,omitempty"`
+	// BestEffort pods are sent to Firmament with these shadow requests.
+	BestEffortCPURequest string `json:"bestEffortCPURequest,omitempty"`
+	BestEffortMemRequest string `json:"bestEffortMemRequest,omitempty"`
+	PodQueueType         string `json:"podQueueType,omitempty"`
+	// Pods requesting more than MaxPodCPURequest or MaxPodMemRequest are rejected, 0 means no limit.
+	MaxPodCPURequest string `json:"maxPodCPURequest,omitempty"`
+	MaxPodMemRequest string `json:"maxPodMemRequest,omitempty"`
+	// TaskRemovalMaxRetries is the number of times the removal of a task from Firmament is retried.
+	TaskRemovalMaxRetries int `json:"taskRemovalMaxRetries,omitempty"`
+	// FirmamentLogThrottleWindow is the window, in seconds, over which the repeated Firmament errors are collapsed.
+	FirmamentLogThrottleWindow int `json:"firmamentLogThrottleWindow,omitempty"`
+	// UseNodeCapacity reports the node capacity to Firmament instead of the allocatable resources.
+	UseNodeCapacity bool `json:"useNodeCapacity,omitempty"`
+	// FirmamentRecordFile, if set, is the file the Firmament RPCs are recorded to.
+	FirmamentRecordFile string `json:"firmamentRecordFile,omitempty"`
+	// DefaultArch is the CPU architecture of the nodes without arch label.
+	DefaultArch string `json:"defaultArch,omitempty"`
+	// RemoveTasksOnShutdown withdraws all the tasks from Firmament when Poseidon is stopped.
+	RemoveTasksOnShutdown bool `json:"removeTasksOnShutdown,omitempty"`
+	// FieldManager is the field manager Poseidon writes the bindings and the pod statuses as.
+	FieldManager string `json:"fieldManager,omitempty"`
+	// NodeLabelPrefixes holds the prefixes of the node labels forwarded to Firmament, all of them if empty.
+	NodeLabelPrefixes []string `json:"nodeLabelPrefixes,omitempty"`
+	// PodSubmissionGracePeriod is the time, in seconds, a new pod has to stay unchanged before it's submitted.
+	PodSubmissionGracePeriod int `json:"podSubmissionGracePeriod,omitempty"`
+	// NodeResyncPeriod is the time, in seconds, between two reconciliations of the node resources with Firmament.
+	NodeResyncPeriod int `json:"nodeResyncPeriod,omitempty"`
+	// RetryBudgetQPS is the rate at which the retry budget shared by all the pods is refilled, unlimited if 0.
+	RetryBudgetQPS float32 `json:"retryBudgetQPS,omitempty"`
+	// RetryBudgetBurst is the number of retries the shared retry budget holds when full.
+	RetryBudgetBurst int `json:"retryBudgetBurst,omitempty"`
+	// NodeNotReadyThreshold is the time, in seconds, a node has to stay NotReady before its pods are rescheduled.
+	NodeNotReadyThreshold int `json:"nodeNotReadyThreshold,omitempty"`
+	// EnableAdminEndpoints serves the admin endpoints, e.g. to resubmit a pod, on the pprof address.
+	EnableAdminEndpoints bool `json:"enableAdminEndpoints,omitempty"`
+	// CrashLoopUpdateInterval is the minimum time, in seconds, between two task updates of a crash-looping pod.
+	CrashLoopUpdateInterval int `json:"crashLoopUpdateInterval,omitempty"`
+	// FirmamentKeepaliveTime is the time, in seconds, without activity after which the connections to Firmament are pinged.
+	FirmamentKeepaliveTime int `json:"firmamentKeepaliveTime,omitempty"`
+	// FirmamentKeepaliveTimeout is the time, in seconds, to wait for the ack of a ping before closing the connection.
+	FirmamentKeepaliveTimeout int `json:"firmamentKeepaliveTimeout,omitempty"`
+	// FirmamentKeepalivePermitWithoutStream pings the connections to Firmament without any RPC in flight too.
+	FirmamentKeepalivePermitWithoutStream bool `json:"firmamentKeepalivePermitWithoutStream,omitempty"`
+	// StarvationThreshold is the time, in seconds, after which a pod still pending is counted as starved.
+	StarvationThreshold int `json:"starvationThreshold,omitempty"`
+	// SkipMirrorPods keeps the mirror pods of the static kubelet manifests off Firmament.
+	SkipMirrorPods bool `json:"skipMirrorPods,omitempty"`
+	// RemoveRetriableJobFailures withdraws the failed Job pods the Job retries from Firmament instead of reporting them failed.
+	RemoveRetriableJobFailures bool `json:"removeRetriableJobFailures,omitempty"`
+	// MaxInFlightPodsPerOwner is the number of pods of an owner which can be submitted and not yet placed at once.
+	MaxInFlightPodsPerOwner int `json:"maxInFlightPodsPerOwner,omitempty"`
+	// BindConfirmationTimeout is the time, in seconds, a bind waits for the pod to be observed bound before it's retried.
+	BindConfirmationTimeout int `json:"bindConfirmationTimeout,omitempty"`
+	// ClusterID identifies the cluster of the pods when several clusters share Firmament.
+	ClusterID string `json:"clusterID,omitempty"`
+	// MemoryGranularity is the granularity, in the memory unit, the memory requests are rounded up to.
+	MemoryGranularity int64 `json:"memoryGranularity,omitempty"`
+	// RequeueOnFirmamentVersionChange re-evaluates all the pods once Firmament advertises another version.
+	// Upstream Firmament doesn't advertise its version yet, so it has no effect with it.
+	RequeueOnFirmamentVersionChange bool `json:"requeueOnFirmamentVersionChange,omitempty"`
+	// SubmittedAnnotation is the annotation the pods submitted to Firmament are stamped with, none if empty.
+	SubmittedAnnotation string `json:"submittedAnnotation,omitempty"`
+	// BinaryMemory makes the KB and MB memory units binary, of 1024 bytes and 1024 KB, rather than decimal.
+	BinaryMemory bool `json:"binaryMemory,omitempty"`
+	// TraceExporterEndpoint is the OTLP/HTTP endpoint the traces of the pod scheduling are exported to, none if empty.
+	TraceExporterEndpoint string `json:"traceExporterEndpoint,omitempty"`
+	// NominatePreemptors holds the binds of the pods placed on the nodes of preemption victims until the victims are deleted.
+	NominatePreemptors bool `json:"nominatePreemptors,omitempty"`
+	// ReportContainerResources forwards the requests and limits of each container of the pods to Firmament.
+	ReportContainerResources bool `json:"reportContainerResources,omitempty"`
+	// SkipAffinity ignores the preferred node affinity, pod affinity and pod anti-affinity of the pods.
+	SkipAffinity bool `json:"skipAffinity,omitempty"`
+	// PodLabelPrefixes holds the prefixes of the pod labels forwarded to Firmament, all of them if empty.
+	PodLabelPrefixes []string `json:"podLabelPrefixes,omitempty"`
+	// MaxUnschedulableAttempts is the number of scheduling rounds a pod may be left unscheduled in before
+	// it's reported as too large and held back.
+	MaxUnschedulableAttempts int `json:"maxUnschedulableAttempts,omitempty"`
 }
 
 // GetSchedulerName returns the SchedulerName from config
@@ -55,8 +153,40 @@ func GetFirmamentAddress() string {
 	// join the firmament address and port with a colon separator
 	// Passing the firmament address with port and colon separator throws an error
 	// for conversion from yaml to json
-	values := []string{config.FirmamentAddress, config.FirmamentPort}
-	return strings.Join(values, ":")
+	// A comma separated list of Firmament replicas is joined with the port one by one.
+	return joinFirmamentPort(config.FirmamentAddress, config.FirmamentPort)
+}
+
+func joinFirmamentPort(address, port string) string {
+	var addresses []string
+	for _, address := range strings.Split(address, ",") {
+		values := []string{strings.TrimSpace(address), port}
+		addresses = append(addresses, strings.Join(values, ":"))
+	}
+	return strings.Join(addresses, ",")
+}
+
+// WatchFirmamentAddress calls the handler with the new Firmament address, in the form
+// GetFirmamentAddress returns it, whenever the firmamentAddress of the config file changes. It does
+// nothing if no config file was read.
+func WatchFirmamentAddress(handler func(address string)) {
+	if viper.ConfigFileUsed() == "" {
+		return
+	}
+	var lock sync.Mutex
+	current := config.FirmamentAddress
+	viper.OnConfigChange(func(fsnotify.Event) {
+		lock.Lock()
+		defer lock.Unlock()
+		address := viper.GetString("firmamentAddress")
+		if address == "" || address == current {
+			return
+		}
+		current = address
+		glog.Infof("The Firmament address changed to %s", address)
+		handler(joinFirmamentPort(address, config.FirmamentPort))
+	})
+	viper.WatchConfig()
 }
 
 // GetKubeConfig returns the KubeConfig from config
@@ -109,6 +239,11 @@ func GetPprofAddress() string {
 	return config.PprofAddress
 }
 
+// GetEnablePodDebug returns whether the converted pods are served on the pprof address
+func GetEnablePodDebug() bool {
+	return config.EnablePodDebug
+}
+
 // GetMetricsBindAddress returns the port serving healthz and metrics
 func GetMetricsBindAddress() string {
 	return config.MetricsBindAddress
@@ -148,10 +283,286 @@ func GetBurst() int {
 	return config.K8sBurst
 }
 
+// GetLeaderElect returns true if leader election is enabled
+func GetLeaderElect() bool {
+	return config.LeaderElect
+}
+
+// GetLeaderElectNamespace returns the namespace of the leader election lock
+func GetLeaderElectNamespace() string {
+	return config.LeaderElectNamespace
+}
+
+// GetLeaderElectName returns the name of the leader election lock
+func GetLeaderElectName() string {
+	return config.LeaderElectName
+}
+
+// GetLeaderElectLeaseDuration returns the leader election lease duration
+func GetLeaderElectLeaseDuration() time.Duration {
+	return time.Duration(config.LeaderElectLeaseDuration) * time.Second
+}
+
+// GetLeaderElectRenewDeadline returns the time the leader retries renewing its lease
+func GetLeaderElectRenewDeadline() time.Duration {
+	return time.Duration(config.LeaderElectRenewDeadline) * time.Second
+}
+
+// GetLeaderElectRetryPeriod returns the time between leader election attempts
+func GetLeaderElectRetryPeriod() time.Duration {
+	return time.Duration(config.LeaderElectRetryPeriod) * time.Second
+}
+
+// GetFirmamentConcurrency returns the maximum number of concurrent calls the watchers issue to Firmament
+func GetFirmamentConcurrency() int {
+	return config.FirmamentConcurrency
+}
+
+// GetAnnotationLabelPrefixes returns the pod annotation key prefixes forwarded to Firmament as task labels,
+// mapped to the prefix replacing them in the label keys
+func GetAnnotationLabelPrefixes() map[string]string {
+	prefixes := make(map[string]string)
+	for _, mapping := range config.AnnotationLabelPrefixes {
+		values := strings.SplitN(mapping, "=", 2)
+		if len(values) != 2 || values[0] == "" {
+			glog.Fatalf("Incorrect content in --annotationLabelPrefixes %s, each mapping should be in the format of annotationPrefix=labelPrefix", mapping)
+		}
+		prefixes[values[0]] = values[1]
+	}
+	return prefixes
+}
+
+// GetNamespaceAllowlist returns the namespaces whose pods are scheduled, all of them if empty
+func GetNamespaceAllowlist() []string {
+	return config.NamespaceAllowlist
+}
+
+// GetNamespaceDenylist returns the namespaces whose pods are ignored
+func GetNamespaceDenylist() []string {
+	return config.NamespaceDenylist
+}
+
+// GetBestEffortCPURequest returns the cpu request sent to Firmament for the BestEffort pods
+func GetBestEffortCPURequest() resource.Quantity {
+	return parseQuantity("bestEffortCPURequest", config.BestEffortCPURequest)
+}
+
+// GetBestEffortMemRequest returns the memory request sent to Firmament for the BestEffort pods
+func GetBestEffortMemRequest() resource.Quantity {
+	return parseQuantity("bestEffortMemRequest", config.BestEffortMemRequest)
+}
+
+// GetMaxPodCPURequest returns the maximum cpu request of a pod, zero if there's no limit
+func GetMaxPodCPURequest() resource.Quantity {
+	return parseQuantity("maxPodCPURequest", config.MaxPodCPURequest)
+}
+
+// GetMaxPodMemRequest returns the maximum memory request of a pod, zero if there's no limit
+func GetMaxPodMemRequest() resource.Quantity {
+	return parseQuantity("maxPodMemRequest", config.MaxPodMemRequest)
+}
+
+// parseQuantity parses the quantity of the given flag, an empty value is a zero quantity
+func parseQuantity(flagName, value string) resource.Quantity {
+	if value == "" {
+		return resource.Quantity{}
+	}
+	quantity, err := resource.ParseQuantity(value)
+	if err != nil || quantity.Sign() < 0 {
+		glog.Fatalf("Incorrect content in --%s %s, it should be a non negative quantity", flagName, value)
+	}
+	return quantity
+}
+
+// GetPodQueueType returns the type of the queue of the pod events
+func GetPodQueueType() string {
+	return config.PodQueueType
+}
+
+// GetMemoryUnit returns the unit of the memory sent to Firmament
+func GetMemoryUnit() string {
+	return config.MemoryUnit
+}
+
+// GetEnableGangScheduling returns whether the pods sharing an owner are submitted to Firmament all together
+func GetEnableGangScheduling() bool {
+	return config.EnableGangScheduling
+}
+
+// GetFirmamentLogThrottleWindow returns the window over which the repeated Firmament errors are collapsed
+func GetFirmamentLogThrottleWindow() time.Duration {
+	return time.Duration(config.FirmamentLogThrottleWindow) * time.Second
+}
+
+// GetTaskRemovalMaxRetries returns the number of times the removal of a task from Firmament is retried
+func GetTaskRemovalMaxRetries() int {
+	return config.TaskRemovalMaxRetries
+}
+
+// GetUseNodeCapacity returns whether the node capacity rather than the allocatable resources is sent to Firmament
+func GetUseNodeCapacity() bool {
+	return config.UseNodeCapacity
+}
+
+// GetFirmamentRecordFile returns the file the Firmament RPCs are recorded to, empty if they aren't
+func GetFirmamentRecordFile() string {
+	return config.FirmamentRecordFile
+}
+
+// GetNodeLabelPrefixes returns the prefixes of the node labels forwarded to Firmament, all of them if empty
+func GetNodeLabelPrefixes() []string {
+	return config.NodeLabelPrefixes
+}
+
+// GetDefaultArch returns the CPU architecture of the nodes without arch label
+func GetDefaultArch() string {
+	return config.DefaultArch
+}
+
+// GetPodSubmissionGracePeriod returns the time a new pod has to stay unchanged before it's submitted to Firmament
+func GetPodSubmissionGracePeriod() time.Duration {
+	return time.Duration(config.PodSubmissionGracePeriod) * time.Second
+}
+
+// GetNodeResyncPeriod returns the time between two reconciliations of the node resources with Firmament
+func GetNodeResyncPeriod() time.Duration {
+	return time.Duration(config.NodeResyncPeriod) * time.Second
+}
+
+// GetRetryBudgetQPS returns the rate at which the retry budget shared by all the pods is refilled
+func GetRetryBudgetQPS() float32 {
+	return config.RetryBudgetQPS
+}
+
+// GetRetryBudgetBurst returns the number of retries the shared retry budget holds when full
+func GetRetryBudgetBurst() int {
+	return config.RetryBudgetBurst
+}
+
+// GetNodeNotReadyThreshold returns the time a node has to stay NotReady before its pods are rescheduled
+func GetNodeNotReadyThreshold() time.Duration {
+	return time.Duration(config.NodeNotReadyThreshold) * time.Second
+}
+
+// GetEnableAdminEndpoints returns whether the admin endpoints are served on the pprof address
+func GetEnableAdminEndpoints() bool {
+	return config.EnableAdminEndpoints
+}
+
+// GetCrashLoopUpdateInterval returns the minimum time between two task updates of a crash-looping pod
+func GetCrashLoopUpdateInterval() time.Duration {
+	return time.Duration(config.CrashLoopUpdateInterval) * time.Second
+}
+
+// GetFirmamentKeepaliveTime returns the time without activity after which the connections to Firmament are pinged
+func GetFirmamentKeepaliveTime() time.Duration {
+	return time.Duration(config.FirmamentKeepaliveTime) * time.Second
+}
+
+// GetFirmamentKeepaliveTimeout returns the time to wait for the ack of a ping before closing a connection to Firmament
+func GetFirmamentKeepaliveTimeout() time.Duration {
+	return time.Duration(config.FirmamentKeepaliveTimeout) * time.Second
+}
+
+// GetFirmamentKeepalivePermitWithoutStream returns whether the connections to Firmament without any RPC in flight are pinged
+func GetFirmamentKeepalivePermitWithoutStream() bool {
+	return config.FirmamentKeepalivePermitWithoutStream
+}
+
+// GetStarvationThreshold returns the time after which a pod still pending is counted as starved
+func GetStarvationThreshold() time.Duration {
+	return time.Duration(config.StarvationThreshold) * time.Second
+}
+
+// GetSkipMirrorPods returns whether the mirror pods of the static kubelet manifests are kept off Firmament
+func GetSkipMirrorPods() bool {
+	return config.SkipMirrorPods
+}
+
+// GetRemoveRetriableJobFailures returns whether the failed Job pods the Job retries are withdrawn instead of reported failed
+func GetRemoveRetriableJobFailures() bool {
+	return config.RemoveRetriableJobFailures
+}
+
+// GetMaxInFlightPodsPerOwner returns the number of pods of an owner which can be submitted and not yet placed at once, 0 if unlimited
+func GetMaxInFlightPodsPerOwner() int {
+	return config.MaxInFlightPodsPerOwner
+}
+
+// GetBindConfirmationTimeout returns the time a bind waits for the pod to be observed bound before it's retried, 0 if it doesn't wait
+func GetBindConfirmationTimeout() time.Duration {
+	return time.Duration(config.BindConfirmationTimeout) * time.Second
+}
+
+// GetClusterID returns the ID the pods' cluster is identified with in Firmament, empty if Firmament serves a single cluster
+func GetClusterID() string {
+	return config.ClusterID
+}
+
+// GetMemoryGranularity returns the granularity, in the memory unit, the memory requests are rounded up to
+func GetMemoryGranularity() int64 {
+	return config.MemoryGranularity
+}
+
+// GetRequeueOnFirmamentVersionChange returns whether all the pods are re-evaluated once Firmament advertises another version
+func GetRequeueOnFirmamentVersionChange() bool {
+	return config.RequeueOnFirmamentVersionChange
+}
+
+// GetSubmittedAnnotation returns the annotation the pods submitted to Firmament are stamped with, empty if they aren't
+func GetSubmittedAnnotation() string {
+	return config.SubmittedAnnotation
+}
+
+// GetBinaryMemory returns whether the KB and MB memory units are binary, of 1024 bytes and 1024 KB, or decimal
+func GetBinaryMemory() bool {
+	return config.BinaryMemory
+}
+
+// GetTraceExporterEndpoint returns the OTLP/HTTP endpoint the traces are exported to, empty if tracing is disabled
+func GetTraceExporterEndpoint() string {
+	return config.TraceExporterEndpoint
+}
+
+// GetNominatePreemptors returns whether the pods placed on the nodes of preemption victims wait for the victims to be deleted
+func GetNominatePreemptors() bool {
+	return config.NominatePreemptors
+}
+
+// GetReportContainerResources returns whether the requests and limits of each container are forwarded to Firmament
+func GetReportContainerResources() bool {
+	return config.ReportContainerResources
+}
+
+// GetSkipAffinity returns whether the pod (anti-)affinity and the preferred node affinity of the pods are ignored rather than converted for Firmament
+func GetSkipAffinity() bool {
+	return config.SkipAffinity
+}
+
+// GetPodLabelPrefixes returns the prefixes of the pod labels forwarded to Firmament, all of them if empty
+func GetPodLabelPrefixes() []string {
+	return config.PodLabelPrefixes
+}
+
+// GetMaxUnschedulableAttempts returns the number of scheduling rounds a pod may be left unscheduled in before it's held back, 0 if unlimited
+func GetMaxUnschedulableAttempts() int {
+	return config.MaxUnschedulableAttempts
+}
+
+// GetRemoveTasksOnShutdown returns whether all the tasks are withdrawn from Firmament on a clean shutdown
+func GetRemoveTasksOnShutdown() bool {
+	return config.RemoveTasksOnShutdown
+}
+
+// GetFieldManager returns the field manager Poseidon identifies itself with on its write operations
+func GetFieldManager() string {
+	return config.FieldManager
+}
+
 // ReadFromCommandLineFlags reads command line flags and these will override poseidonConfig file flags.
 func ReadFromCommandLineFlags() {
 	pflag.StringVar(&config.SchedulerName, "schedulerName", "poseidon", "The scheduler name with which pods are labeled")
-	pflag.StringVar(&config.FirmamentAddress, "firmamentAddress", "firmament-service.kube-system", "Firmament scheduler service address")
+	pflag.StringVar(&config.FirmamentAddress, "firmamentAddress", "firmament-service.kube-system", "Firmament scheduler service address, a comma separated list of replicas is load balanced in a round robin fashion")
 	pflag.StringVar(&config.FirmamentPort, "firmamentPort", "9090", "Firmament scheduler service port")
 	pflag.StringVar(&config.KubeConfig, "kubeConfig", "kubeconfig.cfg", "Path to the kubeconfig file")
 	pflag.StringVar(&config.KubeVersion, "kubeVersion", "1.6", "Kubernetes version")
@@ -161,10 +572,65 @@ func ReadFromCommandLineFlags() {
 		"The path to the config file (i.e poseidon_cfg) without filename or extension, supported extensions/formats are Yaml, Json")
 	flag.BoolVar(&config.EnablePprof, "enablePprof", false, "Enable runtime profiling data via HTTP server. Address is at client URL + \"/debug/pprof/\"")
 	flag.StringVar(&config.PprofAddress, "pprofAddress", "0.0.0.0:8989", "Address on which to collect runtime profiling data,default to set for all interfaces ")
+	pflag.BoolVar(&config.EnablePodDebug, "enablePodDebug", false, "Serve the pods as sent to Firmament via HTTP on the pprof address. Address is at client URL + \"/debug/pods/{namespace}/{name}\"")
 	pflag.StringVar(&config.MetricsBindAddress, "metricsBindAddress", "0.0.0.0:8989", "Address on which to collect prometheus metrics, default to set for all interfaces")
 	pflag.StringVar(&config.HealthCheckAddress, "healthCheckAddress", "0.0.0.0:8989", "Address on which to check the health status of poseidon")
 	pflag.Float32Var(&config.K8sQPS, "k8sQPS", 1000, "k8s Client QPS to configure")
 	pflag.IntVar(&config.K8sBurst, "k8sBurst", 500, "k8s clinet burst rate to configure")
+	pflag.BoolVar(&config.LeaderElect, "leaderElect", false, "Enable leader election, required when running more than one replica of poseidon")
+	pflag.StringVar(&config.LeaderElectNamespace, "leaderElectNamespace", "kube-system", "Namespace of the leader election lock")
+	pflag.StringVar(&config.LeaderElectName, "leaderElectName", "poseidon", "Name of the leader election lock")
+	pflag.IntVar(&config.LeaderElectLeaseDuration, "leaderElectLeaseDuration", 15, "Time non-leader replicas wait before trying to take over leadership (in seconds)")
+	pflag.IntVar(&config.LeaderElectRenewDeadline, "leaderElectRenewDeadline", 10, "Time the leader retries renewing its lease before giving up (in seconds)")
+	pflag.IntVar(&config.LeaderElectRetryPeriod, "leaderElectRetryPeriod", 2, "Time between leader election attempts (in seconds)")
+	pflag.IntVar(&config.FirmamentConcurrency, "firmamentConcurrency", 100, "Maximum number of concurrent calls the pod and node watchers issue to Firmament, 0 means no limit")
+	pflag.StringSliceVar(&config.AnnotationLabelPrefixes, "annotationLabelPrefixes", nil,
+		"Comma separated annotationPrefix=labelPrefix pairs, pod annotations starting with annotationPrefix are sent to Firmament as task labels with the prefix replaced by labelPrefix")
+	pflag.StringVar(&config.MemoryUnit, "memoryUnit", "KB", "Unit of the memory sent to Firmament, one of Bytes, KB or MB")
+	pflag.IntVar(&config.FirmamentLogThrottleWindow, "firmamentLogThrottleWindow", 30, "Time over which the repeated errors returned by Firmament are collapsed into a single summary line (in seconds), 0 logs all of them")
+	pflag.IntVar(&config.TaskRemovalMaxRetries, "taskRemovalMaxRetries", 5, "Number of times the removal of the task of a deleted pod is retried with an exponential backoff when Firmament fails to remove it")
+	pflag.StringVar(&config.FirmamentRecordFile, "firmamentRecordFile", "", "File the Firmament RPCs are appended to, one JSON object per line, to reproduce a session offline; nothing is recorded if empty")
+	pflag.StringVar(&config.DefaultArch, "defaultArch", "amd64", "CPU architecture of the nodes without kubernetes.io/arch label, so that the pods selecting an arch aren't placed on them by mistake")
+	pflag.StringSliceVar(&config.NodeLabelPrefixes, "nodeLabelPrefixes", nil,
+		"Comma separated prefixes of the node labels sent to Firmament, e.g. topology.kubernetes.io/; all the labels are sent if empty. The pods selecting other labels can't be placed")
+	pflag.IntVar(&config.PodSubmissionGracePeriod, "podSubmissionGracePeriod", 0, "Time a new pod has to stay unchanged before it's submitted to Firmament (in seconds), e.g. to let the mutating webhooks and the sidecar injectors finish; 0 submits the pods right away")
+	pflag.IntVar(&config.NodeResyncPeriod, "nodeResyncPeriod", 0, "Time between two reconciliations of the resources of the nodes known to Firmament with their current allocatable resources (in seconds), 0 disables them")
+	pflag.Float32Var(&config.RetryBudgetQPS, "retryBudgetQPS", 0, "Number of retries per second, across all the pods, the shared retry budget is refilled with; once it's exhausted the requeued pods are delayed. 0 doesn't limit the retries")
+	pflag.IntVar(&config.RetryBudgetBurst, "retryBudgetBurst", 10, "Number of retries the shared retry budget holds when full, i.e. the burst of retries allowed before they're spread at retryBudgetQPS")
+	pflag.IntVar(&config.NodeNotReadyThreshold, "nodeNotReadyThreshold", 0, "Time a node has to stay NotReady before the tasks of its pods are reported evicted to Firmament for rescheduling (in seconds), 0 leaves them on the node")
+	pflag.BoolVar(&config.EnableAdminEndpoints, "enableAdminEndpoints", false, "Serve the admin endpoints via HTTP on the pprof address, e.g. a POST to client URL + \"/admin/resubmit/{namespace}/{name}\" makes Firmament evaluate the pod again")
+	pflag.IntVar(&config.CrashLoopUpdateInterval, "crashLoopUpdateInterval", 0, "Minimum time between two task updates sent to Firmament for a pod whose containers are in CrashLoopBackOff (in seconds), the updates within the interval are coalesced and the latest one is sent when it expires; 0 sends all of them")
+	pflag.IntVar(&config.FirmamentKeepaliveTime, "firmamentKeepaliveTime", 0, "Time without activity after which the connections to Firmament are pinged, so that the idle connections dropped by a load balancer are noticed (in seconds), 0 disables the pings")
+	pflag.IntVar(&config.FirmamentKeepaliveTimeout, "firmamentKeepaliveTimeout", 20, "Time to wait for the ack of a keepalive ping before closing the connection to Firmament (in seconds)")
+	pflag.BoolVar(&config.FirmamentKeepalivePermitWithoutStream, "firmamentKeepalivePermitWithoutStream", false, "Ping the connections to Firmament even when no RPC is in flight; Firmament has to permit it or it closes the connections")
+	pflag.IntVar(&config.StarvationThreshold, "starvationThreshold", 300, "Time after which a pod still pending is counted in the poseidon_total_starved_pods metric (in seconds), 0 doesn't count any")
+	pflag.BoolVar(&config.SkipMirrorPods, "skipMirrorPods", true, "Don't submit the mirror pods of the static kubelet manifests to Firmament, the kubelet runs them on its node")
+	pflag.BoolVar(&config.RemoveRetriableJobFailures, "removeRetriableJobFailures", true, "Remove the task of a failed Job pod from Firmament when the Job retries it within its backoff limit, only report the terminal failures as failed")
+	pflag.IntVar(&config.MaxInFlightPodsPerOwner, "maxInFlightPodsPerOwner", 0, "Maximum number of pods of an owner, e.g. a Job, submitted to Firmament and not yet placed at once; the next pods are submitted as the previous ones are placed, 0 is unlimited")
+	pflag.IntVar(&config.BindConfirmationTimeout, "bindConfirmationTimeout", 0, "Time a pod bind waits for the pod to be observed with its node name before the bind is retried (in seconds), 0 considers the pod bound as soon as the bind request succeeds")
+	pflag.StringVar(&config.ClusterID, "clusterID", "", "ID of the cluster, part of the IDs of the jobs and the tasks so that several clusters can share Firmament; empty if Firmament serves this cluster only")
+	pflag.BoolVar(&config.BinaryMemory, "binaryMemory", true, "Convert the memory to the KB and MB units of --memoryUnit in multiples of 1024, or of 1000 if false")
+	pflag.Int64Var(&config.MemoryGranularity, "memoryGranularity", 1, "Granularity the memory requests sent to Firmament are rounded up to, in the unit of --memoryUnit, e.g. 4 to page-align them in KB; 1 doesn't round")
+	pflag.BoolVar(&config.RequeueOnFirmamentVersionChange, "requeueOnFirmamentVersionChange", false, "Re-evaluate all the pods once Firmament advertises another version in its health checks, e.g. after a rolling upgrade, so that they benefit from its new scheduling constraints. Only takes effect with a Firmament which sends the firmament-version header, which upstream Firmament doesn't send yet: with it, this flag does nothing")
+	pflag.StringVar(&config.SubmittedAnnotation, "submittedAnnotation", "", "Annotation, e.g. poseidon.io/submitted, the pods are stamped with once submitted to Firmament, set to the submission time; empty doesn't stamp them")
+	pflag.StringVar(&config.TraceExporterEndpoint, "traceExporterEndpoint", "", "OTLP/HTTP endpoint, e.g. http://otel-collector:4318/v1/traces, the OpenTelemetry traces of the pod conversions, the calls to Firmament and the binds are exported to; empty disables tracing")
+	pflag.BoolVar(&config.NominatePreemptors, "nominatePreemptors", true, "Nominate the pods placed on the nodes of preemption victims, setting their nominatedNodeName, and bind them once the victims are deleted after their termination grace period; if false they're bound right away")
+	pflag.BoolVar(&config.ReportContainerResources, "reportContainerResources", false, "Forward the requests and limits of each container of the pods to Firmament as the poseidon.kubernetes.io/container-resources task label, alongside the pod-level requests, for a finer bin-packing")
+	pflag.BoolVar(&config.SkipAffinity, "skipAffinity", false, "Ignore the preferred node affinity, pod affinity and pod anti-affinity of the pods rather than converting them for Firmament, for throughput in the clusters which don't use affinity; the node selectors, the required node affinity and the topology of the bound volumes are still honored")
+	pflag.StringSliceVar(&config.PodLabelPrefixes, "podLabelPrefixes", nil,
+		"Comma separated prefixes of the pod labels sent to Firmament as task labels, e.g. app.kubernetes.io/; all the labels are sent if empty. The labels selected by the pod affinity of a pod are sent too, from the first such pod on")
+	pflag.IntVar(&config.MaxUnschedulableAttempts, "maxUnschedulableAttempts", 0, "Number of scheduling rounds Firmament may leave a pod unscheduled in before Poseidon reports it as too large and withdraws it until it changes or a node is added; 0 only withdraws the pods which request more than any node provides")
+	pflag.BoolVar(&config.RemoveTasksOnShutdown, "removeTasksOnShutdown", false, "Remove all the tasks from Firmament when Poseidon is stopped cleanly, so that another scheduler can take over")
+	pflag.StringVar(&config.FieldManager, "fieldManager", "poseidon", "Field manager Poseidon identifies itself with when it creates bindings and updates pod statuses, so that conflicting writes can be attributed")
+	pflag.BoolVar(&config.UseNodeCapacity, "useNodeCapacity", false, "Send the node capacity to Firmament instead of the allocatable resources, which exclude the resources reserved for the system; for testing only")
+	pflag.BoolVar(&config.EnableGangScheduling, "enableGangScheduling", false, "Hold back the pods of a controller until as many pods as its replica count are pending, then submit them to Firmament together")
+	pflag.StringSliceVar(&config.NamespaceAllowlist, "namespaceAllowlist", nil, "Comma separated namespaces whose pods are scheduled by Poseidon, all the namespaces if empty")
+	pflag.StringSliceVar(&config.NamespaceDenylist, "namespaceDenylist", nil, "Comma separated namespaces whose pods are ignored by Poseidon, even if they name it as their scheduler")
+	pflag.StringVar(&config.BestEffortCPURequest, "bestEffortCPURequest", "0", "Shadow cpu request sent to Firmament for the BestEffort pods, so that they consume a small budget of the nodes")
+	pflag.StringVar(&config.BestEffortMemRequest, "bestEffortMemRequest", "0", "Shadow memory request sent to Firmament for the BestEffort pods, so that they consume a small budget of the nodes")
+	pflag.StringVar(&config.MaxPodCPURequest, "maxPodCPURequest", "0", "Pods requesting more cpu are rejected instead of being submitted to Firmament, 0 means no limit")
+	pflag.StringVar(&config.MaxPodMemRequest, "maxPodMemRequest", "0", "Pods requesting more memory are rejected instead of being submitted to Firmament, 0 means no limit")
+	pflag.StringVar(&config.PodQueueType, "podQueueType", "simple", "Type of the queue of the pod events, one of simple, delaying or rateLimiting. The pods which fail to be processed are requeued at once, after a fixed delay or after an exponential backoff respectively")
 
 	pflag.CommandLine.AddGoFlagSet(flag.CommandLine)
 	pflag.Parse()
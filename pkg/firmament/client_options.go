@@ -0,0 +1,74 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package firmament
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/keepalive"
+)
+
+// ClientOptions tune the connections of the Firmament clients created by New and NewBalanced.
+type ClientOptions struct {
+	// KeepaliveTime is the time without activity after which the connection is pinged, so that the
+	// idle connections dropped by a load balancer are noticed before the next RPC. 0 disables the pings.
+	KeepaliveTime time.Duration
+	// KeepaliveTimeout is the time to wait for the ack of a ping before closing the connection.
+	KeepaliveTimeout time.Duration
+	// KeepalivePermitWithoutStream pings the connections without any RPC in flight too.
+	KeepalivePermitWithoutStream bool
+	// Dialer, if set, creates the connections to Firmament instead of the default dialer.
+	Dialer func(address string, timeout time.Duration) (net.Conn, error)
+}
+
+// dialOptions returns the gRPC dial options applying the client options.
+func (o ClientOptions) dialOptions() []grpc.DialOption {
+	var opts []grpc.DialOption
+	if o.KeepaliveTime > 0 {
+		opts = append(opts, grpc.WithKeepaliveParams(keepalive.ClientParameters{
+			Time:                o.KeepaliveTime,
+			Timeout:             o.KeepaliveTimeout,
+			PermitWithoutStream: o.KeepalivePermitWithoutStream,
+		}))
+	}
+	if o.Dialer != nil {
+		opts = append(opts, grpc.WithDialer(o.Dialer))
+	}
+	return opts
+}
+
+var (
+	clientOptionsLock sync.RWMutex
+	clientOptions     ClientOptions
+)
+
+// SetClientOptions sets the options of the Firmament clients created from now on.
+func SetClientOptions(opts ClientOptions) {
+	clientOptionsLock.Lock()
+	defer clientOptionsLock.Unlock()
+	clientOptions = opts
+}
+
+// getClientOptions returns the options of the Firmament clients.
+func getClientOptions() ClientOptions {
+	clientOptionsLock.RLock()
+	defer clientOptionsLock.RUnlock()
+	return clientOptions
+}
@@ -0,0 +1,98 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package firmament
+
+import (
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+)
+
+// startSilentListener accepts connections and never answers on them, like an idle connection silently
+// dropped by a load balancer. The returned channel is signaled when the client closes a connection.
+func startSilentListener(t *testing.T) (string, <-chan struct{}, func()) {
+	listen, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	closed := make(chan struct{}, 10)
+	go func() {
+		for {
+			conn, err := listen.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				io.Copy(ioutil.Discard, conn)
+				conn.Close()
+				closed <- struct{}{}
+			}()
+		}
+	}()
+	return listen.Addr().String(), closed, func() { listen.Close() }
+}
+
+func Test_ClientOptionsKeepalive(t *testing.T) {
+	defer SetClientOptions(ClientOptions{})
+	var testData = []struct {
+		keepaliveTime  time.Duration
+		expectedClosed bool
+	}{
+		{keepaliveTime: 0, expectedClosed: false},
+		{keepaliveTime: 50 * time.Millisecond, expectedClosed: true},
+	}
+	for _, data := range testData {
+		address, closed, stop := startSilentListener(t)
+		dialed := make(chan string, 10)
+		SetClientOptions(ClientOptions{
+			KeepaliveTime:                data.keepaliveTime,
+			KeepaliveTimeout:             50 * time.Millisecond,
+			KeepalivePermitWithoutStream: true,
+			Dialer: func(address string, timeout time.Duration) (net.Conn, error) {
+				dialed <- address
+				return net.DialTimeout("tcp", address, timeout)
+			},
+		})
+		_, conn, err := New(address)
+		if err != nil {
+			t.Fatalf("keepalive %v: failed to start the client: %v", data.keepaliveTime, err)
+		}
+		select {
+		case got := <-dialed:
+			if got != address {
+				t.Errorf("keepalive %v: expected the custom dialer to dial %s, got %s", data.keepaliveTime, address, got)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("keepalive %v: expected the custom dialer to be used", data.keepaliveTime)
+		}
+		// The unanswered keepalive ping closes the connection, which stays open otherwise.
+		select {
+		case <-closed:
+			if !data.expectedClosed {
+				t.Errorf("keepalive %v: expected the idle connection to stay open", data.keepaliveTime)
+			}
+		case <-time.After(time.Second):
+			if data.expectedClosed {
+				t.Errorf("keepalive %v: expected the unanswered keepalive ping to close the connection", data.keepaliveTime)
+			}
+		}
+		conn.Close()
+		stop()
+	}
+}
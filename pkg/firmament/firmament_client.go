@@ -18,61 +18,87 @@ package firmament
 
 import (
 	"fmt"
+	"strings"
+	"sync"
 
 	"github.com/golang/glog"
 	"golang.org/x/net/context"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/grpclog"
+	"google.golang.org/grpc/balancer/roundrobin"
+	"google.golang.org/grpc/metadata"
 )
 
+// logRPCError logs the error of a call to Firmament. While Firmament is unavailable every call fails,
+// one per pod and node event, so the errors are throttled per method. The FirmamentMonitor submits the
+// nodes and tasks again once Firmament is serving.
+func logRPCError(method string, client FirmamentSchedulerClient, err error) {
+	rpcErrorLogThrottle.Logf(method, "%v.%s(_) = _, %v", client, method, err)
+}
+
 // Schedule sends a schedule request to firmament server.
+// It returns nil if the call failed.
 func Schedule(client FirmamentSchedulerClient) *SchedulingDeltas {
 	scheduleResp, err := client.Schedule(context.Background(), &ScheduleRequest{})
 	if err != nil {
-		grpclog.Fatalf("%v.Schedule(_) = _, %v: ", client, err)
+		logRPCError("Schedule", client, err)
+		return nil
 	}
 	return scheduleResp
 }
 
+// TODO: batch the task operations issued within a short window into a single call, for the high churn
+// clusters, once the Firmament service offers a batch or streaming RPC. All its task RPCs are unary.
+
 // TaskCompleted tells firmament server the given task is completed.
-func TaskCompleted(client FirmamentSchedulerClient, tuid *TaskUID) {
+// It returns false if firmament doesn't know the task or its job, e.g. because it restarted.
+func TaskCompleted(client FirmamentSchedulerClient, tuid *TaskUID) bool {
 	tCompletedResp, err := client.TaskCompleted(context.Background(), tuid)
 	if err != nil {
-		grpclog.Fatalf("%v.TaskCompleted(_) = _, %v: ", client, err)
+		logRPCError("TaskCompleted", client, err)
+		return true
 	}
 	switch tCompletedResp.Type {
 	case TaskReplyType_TASK_NOT_FOUND:
-		glog.Fatalf("Task %d not found", tuid.TaskUid)
+		errorLogThrottle.Logf("TaskCompleted", "Task %d not found", tuid.TaskUid)
+		return false
 	case TaskReplyType_TASK_JOB_NOT_FOUND:
-		glog.Fatalf("Task's %d job not found", tuid.TaskUid)
+		errorLogThrottle.Logf("TaskCompleted", "Task's %d job not found", tuid.TaskUid)
+		return false
 	case TaskReplyType_TASK_COMPLETED_OK:
 	default:
 		panic(fmt.Sprintf("Unexpected TaskCompleted response %v for task %v", tCompletedResp, tuid.TaskUid))
 	}
+	return true
 }
 
 // TaskFailed tells firmament server the given task is failed.
-func TaskFailed(client FirmamentSchedulerClient, tuid *TaskUID) {
+// It returns false if firmament doesn't know the task or its job, e.g. because it restarted.
+func TaskFailed(client FirmamentSchedulerClient, tuid *TaskUID) bool {
 	tFailedResp, err := client.TaskFailed(context.Background(), tuid)
 	if err != nil {
-		grpclog.Fatalf("%v.TaskFailed(_) = _, %v: ", client, err)
+		logRPCError("TaskFailed", client, err)
+		return true
 	}
 	switch tFailedResp.Type {
 	case TaskReplyType_TASK_NOT_FOUND:
-		glog.Fatalf("Task %d not found", tuid.TaskUid)
+		errorLogThrottle.Logf("TaskFailed", "Task %d not found", tuid.TaskUid)
+		return false
 	case TaskReplyType_TASK_JOB_NOT_FOUND:
-		glog.Fatalf("Task's %d job not found", tuid.TaskUid)
+		errorLogThrottle.Logf("TaskFailed", "Task's %d job not found", tuid.TaskUid)
+		return false
 	case TaskReplyType_TASK_FAILED_OK:
 	default:
 		panic(fmt.Sprintf("Unexpected TaskFailed response %v for task %v", tFailedResp, tuid.TaskUid))
 	}
+	return true
 }
 
 // TaskRemoved tells firmament server the given task is removed.
-func TaskRemoved(client FirmamentSchedulerClient, tuid *TaskUID) {
+// It returns the error of the call, the removal has to be retried then.
+func TaskRemoved(client FirmamentSchedulerClient, tuid *TaskUID) error {
 	tRemovedResp, err := client.TaskRemoved(context.Background(), tuid)
 	if err != nil {
-		grpclog.Fatalf("%v.TaskRemoved(_) = _, %v: ", client, err)
+		return fmt.Errorf("%v.TaskRemoved(_) = _, %v", client, err)
 	}
 	switch tRemovedResp.Type {
 	case TaskReplyType_TASK_NOT_FOUND:
@@ -83,13 +109,20 @@ func TaskRemoved(client FirmamentSchedulerClient, tuid *TaskUID) {
 	default:
 		panic(fmt.Sprintf("Unexpected TaskRemoved response %v for task %v", tRemovedResp, tuid.TaskUid))
 	}
+	return nil
 }
 
 // TaskSubmitted tells firmament server the given task is submitted.
 func TaskSubmitted(client FirmamentSchedulerClient, td *TaskDescription) {
-	tSubmittedResp, err := client.TaskSubmitted(context.Background(), td)
+	TaskSubmittedContext(context.Background(), client, td)
+}
+
+// TaskSubmittedContext is TaskSubmitted issued with the given context, e.g. to propagate its trace.
+func TaskSubmittedContext(ctx context.Context, client FirmamentSchedulerClient, td *TaskDescription) {
+	tSubmittedResp, err := client.TaskSubmitted(ctx, td)
 	if err != nil {
-		grpclog.Fatalf("%v.TaskSubmitted(_) = _, %v: ", client, err)
+		logRPCError("TaskSubmitted", client, err)
+		return
 	}
 	switch tSubmittedResp.Type {
 	case TaskReplyType_TASK_ALREADY_SUBMITTED:
@@ -102,28 +135,54 @@ func TaskSubmitted(client FirmamentSchedulerClient, td *TaskDescription) {
 	}
 }
 
+// TaskResubmitted submits again a task which firmament may have lost, e.g. after a restart.
+// Unlike TaskSubmitted, a task firmament still knows about is not an error.
+func TaskResubmitted(client FirmamentSchedulerClient, td *TaskDescription) {
+	tSubmittedResp, err := client.TaskSubmitted(context.Background(), td)
+	if err != nil {
+		logRPCError("TaskSubmitted", client, err)
+		return
+	}
+	switch tSubmittedResp.Type {
+	case TaskReplyType_TASK_ALREADY_SUBMITTED:
+		glog.Infof("Task (%s,%d) already submitted", td.JobDescriptor.Uuid, td.TaskDescriptor.Uid)
+	case TaskReplyType_TASK_STATE_NOT_CREATED:
+		glog.Infof("Task (%s,%d) not in created state", td.JobDescriptor.Uuid, td.TaskDescriptor.Uid)
+	case TaskReplyType_TASK_SUBMITTED_OK:
+	default:
+		panic(fmt.Sprintf("Unexpected TaskSubmitted response %v for task (%v,%v)", tSubmittedResp, td.JobDescriptor.Uuid, td.TaskDescriptor.Uid))
+	}
+}
+
 // TaskUpdated tells firmament server the given task is updated.
-func TaskUpdated(client FirmamentSchedulerClient, td *TaskDescription) {
+// It returns false if firmament doesn't know the task or its job, the task has to be submitted again then.
+// A failed call returns true, the task is submitted again with the others once Firmament is serving.
+func TaskUpdated(client FirmamentSchedulerClient, td *TaskDescription) bool {
 	tUpdatedResp, err := client.TaskUpdated(context.Background(), td)
 	if err != nil {
-		grpclog.Fatalf("%v.TaskUpdated(_) = _, %v: ", client, err)
+		logRPCError("TaskUpdated", client, err)
+		return true
 	}
 	switch tUpdatedResp.Type {
 	case TaskReplyType_TASK_NOT_FOUND:
-		glog.Fatalf("Task (%s,%d) not found", td.JobDescriptor.Uuid, td.TaskDescriptor.Uid)
+		errorLogThrottle.Logf("TaskUpdated", "Task (%s,%d) not found", td.JobDescriptor.Uuid, td.TaskDescriptor.Uid)
+		return false
 	case TaskReplyType_TASK_JOB_NOT_FOUND:
-		glog.Fatalf("Task's (%s,%d) job not found", td.JobDescriptor.Uuid, td.TaskDescriptor.Uid)
+		errorLogThrottle.Logf("TaskUpdated", "Task's (%s,%d) job not found", td.JobDescriptor.Uuid, td.TaskDescriptor.Uid)
+		return false
 	case TaskReplyType_TASK_UPDATED_OK:
 	default:
 		panic(fmt.Sprintf("Unexpected TaskUpdated response %v for task (%v,%v)", tUpdatedResp, td.JobDescriptor.Uuid, td.TaskDescriptor.Uid))
 	}
+	return true
 }
 
 // NodeAdded tells firmament server the given node is added.
 func NodeAdded(client FirmamentSchedulerClient, rtnd *ResourceTopologyNodeDescriptor) {
 	nAddedResp, err := client.NodeAdded(context.Background(), rtnd)
 	if err != nil {
-		grpclog.Fatalf("%v.NodeAdded(_) = _, %v: ", client, err)
+		logRPCError("NodeAdded", client, err)
+		return
 	}
 	switch nAddedResp.Type {
 	case NodeReplyType_NODE_ALREADY_EXISTS:
@@ -138,7 +197,8 @@ func NodeAdded(client FirmamentSchedulerClient, rtnd *ResourceTopologyNodeDescri
 func NodeFailed(client FirmamentSchedulerClient, ruid *ResourceUID) {
 	nFailedResp, err := client.NodeFailed(context.Background(), ruid)
 	if err != nil {
-		grpclog.Fatalf("%v.NodeFailed(_) = _, %v: ", client, err)
+		logRPCError("NodeFailed", client, err)
+		return
 	}
 	switch nFailedResp.Type {
 	case NodeReplyType_NODE_NOT_FOUND:
@@ -153,7 +213,8 @@ func NodeFailed(client FirmamentSchedulerClient, ruid *ResourceUID) {
 func NodeRemoved(client FirmamentSchedulerClient, ruid *ResourceUID) {
 	nRemovedResp, err := client.NodeRemoved(context.Background(), ruid)
 	if err != nil {
-		grpclog.Fatalf("%v.NodeRemoved(_) = _, %v: ", client, err)
+		logRPCError("NodeRemoved", client, err)
+		return
 	}
 	switch nRemovedResp.Type {
 	case NodeReplyType_NODE_NOT_FOUND:
@@ -168,7 +229,8 @@ func NodeRemoved(client FirmamentSchedulerClient, ruid *ResourceUID) {
 func NodeUpdated(client FirmamentSchedulerClient, rtnd *ResourceTopologyNodeDescriptor) {
 	nUpdatedResp, err := client.NodeUpdated(context.Background(), rtnd)
 	if err != nil {
-		grpclog.Fatalf("%v.NodeUpdated(_) = _, %v: ", client, err)
+		logRPCError("NodeUpdated", client, err)
+		return
 	}
 	switch nUpdatedResp.Type {
 	case NodeReplyType_NODE_NOT_FOUND:
@@ -183,7 +245,7 @@ func NodeUpdated(client FirmamentSchedulerClient, rtnd *ResourceTopologyNodeDesc
 func AddTaskStats(client FirmamentSchedulerClient, ts *TaskStats) {
 	_, err := client.AddTaskStats(context.Background(), ts)
 	if err != nil {
-		grpclog.Fatalf("%v.AddTaskStats(_) = _, %v: ", client, err)
+		logRPCError("AddTaskStats", client, err)
 	}
 }
 
@@ -191,7 +253,7 @@ func AddTaskStats(client FirmamentSchedulerClient, ts *TaskStats) {
 func AddNodeStats(client FirmamentSchedulerClient, rs *ResourceStats) {
 	_, err := client.AddNodeStats(context.Background(), rs)
 	if err != nil {
-		grpclog.Fatalf("%v.AddNodeStats(_) = _, %v: ", client, err)
+		logRPCError("AddNodeStats", client, err)
 	}
 }
 
@@ -206,16 +268,81 @@ func Check(client FirmamentSchedulerClient, req_service *HealthCheckRequest) (bo
 	return false, err
 }
 
+// VersionHeader is the response header Firmament is expected to advertise its version or capabilities
+// with. The health check responses have no field for it, so it would be sent as gRPC metadata.
+// TODO: upstream Firmament doesn't send this header yet, so CheckVersion always returns an empty
+// version and no version change is ever detected. Switch to the field of the health check or
+// capabilities response once the Firmament service offers one.
+const VersionHeader = "firmament-version"
+
+// CheckVersion tests if firmament server is health like Check, and also returns the version it
+// advertises in the VersionHeader, empty if it doesn't advertise any.
+func CheckVersion(client FirmamentSchedulerClient, req_service *HealthCheckRequest) (bool, string, error) {
+	var header metadata.MD
+	res, err := client.Check(context.Background(), req_service, grpc.Header(&header))
+	if err != nil {
+		return false, "", err
+	}
+	var version string
+	if values := header[VersionHeader]; len(values) > 0 {
+		version = values[0]
+	}
+	return res.GetStatus() == ServingStatus_SERVING, version, nil
+}
+
+var (
+	resolversLock sync.Mutex
+	// resolvers holds the resolvers of the clients created by New, see UpdateAddresses.
+	resolvers []*AddressResolver
+)
+
+// UpdateAddresses replaces the Firmament replicas of all the clients created by New with a comma
+// separated list of addresses. It returns false if New created no client.
+func UpdateAddresses(address string) bool {
+	resolversLock.Lock()
+	defer resolversLock.Unlock()
+	if len(resolvers) == 0 {
+		return false
+	}
+	addresses := strings.Split(address, ",")
+	for _, r := range resolvers {
+		r.UpdateAddresses(addresses)
+	}
+	glog.Infof("Updated the Firmament replicas to %v", addresses)
+	return true
+}
+
 // New creates a firmament scheduler client by a remote server address.
+// A comma separated list of addresses is balanced in a round robin fashion, see NewBalanced. The
+// client always dials through an AddressResolver, so that its addresses, a single one included, can be
+// replaced at runtime with UpdateAddresses.
+// The connection is tuned by the options set with SetClientOptions.
 // NOTE: it's an insecure connection.
 func New(address string) (FirmamentSchedulerClient, *grpc.ClientConn, error) {
-	var opts []grpc.DialOption
-	opts = append(opts, grpc.WithInsecure())
-	conn, err := grpc.Dial(address, opts...)
+	fc, conn, r, err := NewBalanced(strings.Split(address, ","))
 	if err != nil {
-		glog.Errorf("Did not connect to Firmament scheduler: %v", err)
 		return nil, nil, err
 	}
-	fc := NewFirmamentSchedulerClient(conn)
+	resolversLock.Lock()
+	resolvers = append(resolvers, r)
+	resolversLock.Unlock()
 	return fc, conn, nil
 }
+
+// NewBalanced creates a firmament scheduler client which spreads the calls over all the given
+// Firmament replicas in a round robin fashion. The addresses can be changed at runtime through
+// the returned AddressResolver.
+// NOTE: it's an insecure connection.
+func NewBalanced(addresses []string) (FirmamentSchedulerClient, *grpc.ClientConn, *AddressResolver, error) {
+	r := NewAddressResolver(addresses)
+	var opts []grpc.DialOption
+	opts = append(opts, grpc.WithInsecure(), grpc.WithBalancerName(roundrobin.Name))
+	opts = append(opts, getClientOptions().dialOptions()...)
+	conn, err := grpc.Dial(r.Target(), opts...)
+	if err != nil {
+		glog.Errorf("Did not connect to Firmament scheduler replicas %v: %v", addresses, err)
+		return nil, nil, nil, err
+	}
+	fc := withRecorder(NewFirmamentSchedulerClient(conn))
+	return fc, conn, r, nil
+}
@@ -17,7 +17,11 @@ limitations under the License.
 package firmament
 
 import (
+	"errors"
+
 	"github.com/golang/mock/gomock"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
 
 	"testing"
 )
@@ -90,7 +94,24 @@ func Test_TaskUpdated(t *testing.T) {
 	firmamentClient := NewMockFirmamentSchedulerClient(mockCtrl)
 	firmamentClient.EXPECT().TaskUpdated(gomock.Any(), gomock.Any()).Return(
 		&TaskUpdatedResponse{Type: TaskReplyType_TASK_UPDATED_OK}, nil)
-	TaskUpdated(firmamentClient, nil)
+	if !TaskUpdated(firmamentClient, nil) {
+		t.Error("expected the task to be found")
+	}
+}
+
+func Test_TaskUpdatedNotFound(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	firmamentClient := NewMockFirmamentSchedulerClient(mockCtrl)
+	firmamentClient.EXPECT().TaskUpdated(gomock.Any(), gomock.Any()).Return(
+		&TaskUpdatedResponse{Type: TaskReplyType_TASK_NOT_FOUND}, nil)
+	td := &TaskDescription{
+		TaskDescriptor: &TaskDescriptor{Uid: 1},
+		JobDescriptor:  &JobDescriptor{Uuid: "job"},
+	}
+	if TaskUpdated(firmamentClient, td) {
+		t.Error("expected the task not to be found")
+	}
 }
 
 func Test_TaskSubmitted(t *testing.T) {
@@ -108,7 +129,19 @@ func Test_TaskRemoved(t *testing.T) {
 	firmamentClient := NewMockFirmamentSchedulerClient(mockCtrl)
 	firmamentClient.EXPECT().TaskRemoved(gomock.Any(), gomock.Any()).Return(
 		&TaskRemovedResponse{Type: TaskReplyType_TASK_REMOVED_OK}, nil)
-	TaskRemoved(firmamentClient, nil)
+	if err := TaskRemoved(firmamentClient, nil); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func Test_TaskRemovedError(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	firmamentClient := NewMockFirmamentSchedulerClient(mockCtrl)
+	firmamentClient.EXPECT().TaskRemoved(gomock.Any(), gomock.Any()).Return(nil, errors.New("unavailable"))
+	if err := TaskRemoved(firmamentClient, &TaskUID{TaskUid: 1}); err == nil {
+		t.Error("expected the error of the call")
+	}
 }
 
 func Test_TaskFailed(t *testing.T) {
@@ -129,6 +162,22 @@ func Test_TaskCompleted(t *testing.T) {
 	TaskCompleted(firmamentClient, nil)
 }
 
+func Test_TaskCompletedNotFound(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	firmamentClient := NewMockFirmamentSchedulerClient(mockCtrl)
+	firmamentClient.EXPECT().TaskCompleted(gomock.Any(), gomock.Any()).Return(
+		&TaskCompletedResponse{Type: TaskReplyType_TASK_NOT_FOUND}, nil)
+	firmamentClient.EXPECT().TaskFailed(gomock.Any(), gomock.Any()).Return(
+		&TaskFailedResponse{Type: TaskReplyType_TASK_JOB_NOT_FOUND}, nil)
+	if TaskCompleted(firmamentClient, &TaskUID{TaskUid: 1}) {
+		t.Error("expected the completed task not to be found")
+	}
+	if TaskFailed(firmamentClient, &TaskUID{TaskUid: 1}) {
+		t.Error("expected the job of the failed task not to be found")
+	}
+}
+
 func Test_Schedule(t *testing.T) {
 	mockCtrl := gomock.NewController(t)
 	defer mockCtrl.Finish()
@@ -137,3 +186,24 @@ func Test_Schedule(t *testing.T) {
 		&SchedulingDeltas{}, nil)
 	Schedule(firmamentClient)
 }
+
+func Test_CheckVersion(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	firmamentClient := NewMockFirmamentSchedulerClient(mockCtrl)
+	firmamentClient.EXPECT().Check(gomock.Any(), gomock.Any(), gomock.Any()).Do(
+		func(_ interface{}, _ interface{}, opts ...grpc.CallOption) {
+			*opts[0].(grpc.HeaderCallOption).HeaderAddr = metadata.Pairs(VersionHeader, "v2")
+		}).Return(&HealthCheckResponse{Status: ServingStatus_SERVING}, nil)
+	ok, version, err := CheckVersion(firmamentClient, &HealthCheckRequest{})
+	if !ok || version != "v2" || err != nil {
+		t.Errorf("expected a serving Firmament of version v2, got %v, %q, %v", ok, version, err)
+	}
+
+	firmamentClient.EXPECT().Check(gomock.Any(), gomock.Any(), gomock.Any()).Return(
+		&HealthCheckResponse{Status: ServingStatus_SERVING}, nil)
+	ok, version, err = CheckVersion(firmamentClient, &HealthCheckRequest{})
+	if !ok || version != "" || err != nil {
+		t.Errorf("expected a serving Firmament without a version, got %v, %q, %v", ok, version, err)
+	}
+}
@@ -0,0 +1,125 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package firmament
+
+import (
+	"fmt"
+
+	"github.com/kubernetes-sigs/poseidon/pkg/metrics"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// instrumentedClient is a FirmamentSchedulerClient which counts the calls to Firmament by RPC,
+// reply type and gRPC status code.
+type instrumentedClient struct {
+	client FirmamentSchedulerClient
+}
+
+// NewInstrumentedClient returns a client which records the outcome of the calls issued through the
+// given client in metrics.FirmamentRPCs.
+func NewInstrumentedClient(client FirmamentSchedulerClient) FirmamentSchedulerClient {
+	return &instrumentedClient{client: client}
+}
+
+// observe counts a call, the reply type is only known for the calls which succeeded.
+func observe(rpc string, reply fmt.Stringer, err error) {
+	replyType := ""
+	if err == nil && reply != nil {
+		replyType = reply.String()
+	}
+	metrics.FirmamentRPCs.WithLabelValues(rpc, replyType, status.Code(err).String()).Inc()
+}
+
+func (c *instrumentedClient) Schedule(ctx context.Context, in *ScheduleRequest, opts ...grpc.CallOption) (*SchedulingDeltas, error) {
+	resp, err := c.client.Schedule(ctx, in, opts...)
+	observe("Schedule", nil, err)
+	return resp, err
+}
+
+func (c *instrumentedClient) TaskCompleted(ctx context.Context, in *TaskUID, opts ...grpc.CallOption) (*TaskCompletedResponse, error) {
+	resp, err := c.client.TaskCompleted(ctx, in, opts...)
+	observe("TaskCompleted", resp.GetType(), err)
+	return resp, err
+}
+
+func (c *instrumentedClient) TaskFailed(ctx context.Context, in *TaskUID, opts ...grpc.CallOption) (*TaskFailedResponse, error) {
+	resp, err := c.client.TaskFailed(ctx, in, opts...)
+	observe("TaskFailed", resp.GetType(), err)
+	return resp, err
+}
+
+func (c *instrumentedClient) TaskRemoved(ctx context.Context, in *TaskUID, opts ...grpc.CallOption) (*TaskRemovedResponse, error) {
+	resp, err := c.client.TaskRemoved(ctx, in, opts...)
+	observe("TaskRemoved", resp.GetType(), err)
+	return resp, err
+}
+
+func (c *instrumentedClient) TaskSubmitted(ctx context.Context, in *TaskDescription, opts ...grpc.CallOption) (*TaskSubmittedResponse, error) {
+	resp, err := c.client.TaskSubmitted(ctx, in, opts...)
+	observe("TaskSubmitted", resp.GetType(), err)
+	return resp, err
+}
+
+func (c *instrumentedClient) TaskUpdated(ctx context.Context, in *TaskDescription, opts ...grpc.CallOption) (*TaskUpdatedResponse, error) {
+	resp, err := c.client.TaskUpdated(ctx, in, opts...)
+	observe("TaskUpdated", resp.GetType(), err)
+	return resp, err
+}
+
+func (c *instrumentedClient) NodeAdded(ctx context.Context, in *ResourceTopologyNodeDescriptor, opts ...grpc.CallOption) (*NodeAddedResponse, error) {
+	resp, err := c.client.NodeAdded(ctx, in, opts...)
+	observe("NodeAdded", resp.GetType(), err)
+	return resp, err
+}
+
+func (c *instrumentedClient) NodeFailed(ctx context.Context, in *ResourceUID, opts ...grpc.CallOption) (*NodeFailedResponse, error) {
+	resp, err := c.client.NodeFailed(ctx, in, opts...)
+	observe("NodeFailed", resp.GetType(), err)
+	return resp, err
+}
+
+func (c *instrumentedClient) NodeRemoved(ctx context.Context, in *ResourceUID, opts ...grpc.CallOption) (*NodeRemovedResponse, error) {
+	resp, err := c.client.NodeRemoved(ctx, in, opts...)
+	observe("NodeRemoved", resp.GetType(), err)
+	return resp, err
+}
+
+func (c *instrumentedClient) NodeUpdated(ctx context.Context, in *ResourceTopologyNodeDescriptor, opts ...grpc.CallOption) (*NodeUpdatedResponse, error) {
+	resp, err := c.client.NodeUpdated(ctx, in, opts...)
+	observe("NodeUpdated", resp.GetType(), err)
+	return resp, err
+}
+
+func (c *instrumentedClient) AddTaskStats(ctx context.Context, in *TaskStats, opts ...grpc.CallOption) (*TaskStatsResponse, error) {
+	resp, err := c.client.AddTaskStats(ctx, in, opts...)
+	observe("AddTaskStats", resp.GetType(), err)
+	return resp, err
+}
+
+func (c *instrumentedClient) AddNodeStats(ctx context.Context, in *ResourceStats, opts ...grpc.CallOption) (*ResourceStatsResponse, error) {
+	resp, err := c.client.AddNodeStats(ctx, in, opts...)
+	observe("AddNodeStats", resp.GetType(), err)
+	return resp, err
+}
+
+func (c *instrumentedClient) Check(ctx context.Context, in *HealthCheckRequest, opts ...grpc.CallOption) (*HealthCheckResponse, error) {
+	resp, err := c.client.Check(ctx, in, opts...)
+	observe("Check", resp.GetStatus(), err)
+	return resp, err
+}
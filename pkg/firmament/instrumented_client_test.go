@@ -0,0 +1,87 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package firmament
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/kubernetes-sigs/poseidon/pkg/metrics"
+	dto "github.com/prometheus/client_model/go"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func firmamentRPCCount(t *testing.T, rpc, reply, code string) float64 {
+	var metric dto.Metric
+	if err := metrics.FirmamentRPCs.WithLabelValues(rpc, reply, code).Write(&metric); err != nil {
+		t.Fatalf("Failed to read the counter of %s: %v", rpc, err)
+	}
+	return metric.GetCounter().GetValue()
+}
+
+func Test_InstrumentedClient(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockClient := NewMockFirmamentSchedulerClient(mockCtrl)
+	metrics.FirmamentRPCs.Reset()
+
+	gomock.InOrder(
+		mockClient.EXPECT().TaskSubmitted(gomock.Any(), gomock.Any()).Return(&TaskSubmittedResponse{Type: TaskReplyType_TASK_SUBMITTED_OK}, nil),
+		mockClient.EXPECT().TaskSubmitted(gomock.Any(), gomock.Any()).Return(&TaskSubmittedResponse{Type: TaskReplyType_TASK_SUBMITTED_OK}, nil),
+		mockClient.EXPECT().TaskSubmitted(gomock.Any(), gomock.Any()).Return(&TaskSubmittedResponse{Type: TaskReplyType_TASK_ALREADY_SUBMITTED}, nil),
+		mockClient.EXPECT().TaskSubmitted(gomock.Any(), gomock.Any()).Return(nil, status.Error(codes.Unavailable, "firmament is down")),
+		mockClient.EXPECT().TaskRemoved(gomock.Any(), gomock.Any()).Return(&TaskRemovedResponse{Type: TaskReplyType_TASK_NOT_FOUND}, nil),
+		mockClient.EXPECT().TaskRemoved(gomock.Any(), gomock.Any()).Return(nil, errors.New("connection reset")),
+		mockClient.EXPECT().Schedule(gomock.Any(), gomock.Any()).Return(&SchedulingDeltas{}, nil),
+		mockClient.EXPECT().Check(gomock.Any(), gomock.Any()).Return(&HealthCheckResponse{Status: ServingStatus_SERVING}, nil),
+	)
+
+	client := NewInstrumentedClient(mockClient)
+	ctx := context.Background()
+	for i := 0; i < 4; i++ {
+		client.TaskSubmitted(ctx, &TaskDescription{})
+	}
+	for i := 0; i < 2; i++ {
+		client.TaskRemoved(ctx, &TaskUID{})
+	}
+	client.Schedule(ctx, &ScheduleRequest{})
+	client.Check(ctx, &HealthCheckRequest{})
+
+	testData := []struct {
+		rpc      string
+		reply    string
+		code     string
+		expected float64
+	}{
+		{"TaskSubmitted", TaskReplyType_TASK_SUBMITTED_OK.String(), codes.OK.String(), 2},
+		{"TaskSubmitted", TaskReplyType_TASK_ALREADY_SUBMITTED.String(), codes.OK.String(), 1},
+		{"TaskSubmitted", "", codes.Unavailable.String(), 1},
+		{"TaskRemoved", TaskReplyType_TASK_NOT_FOUND.String(), codes.OK.String(), 1},
+		{"TaskRemoved", "", codes.Unknown.String(), 1},
+		{"Schedule", "", codes.OK.String(), 1},
+		{"Check", ServingStatus_SERVING.String(), codes.OK.String(), 1},
+		{"TaskUpdated", "", codes.OK.String(), 0},
+	}
+	for _, data := range testData {
+		if count := firmamentRPCCount(t, data.rpc, data.reply, data.code); count != data.expected {
+			t.Errorf("%s{reply=%q, code=%q}: expected %v calls, got %v", data.rpc, data.reply, data.code, data.expected, count)
+		}
+	}
+}
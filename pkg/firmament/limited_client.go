@@ -0,0 +1,127 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package firmament
+
+import (
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+)
+
+// limitedClient is a FirmamentSchedulerClient which bounds the number of concurrent calls to Firmament.
+// Callers block until a call slot is available.
+type limitedClient struct {
+	client    FirmamentSchedulerClient
+	semaphore chan struct{}
+}
+
+// NewLimitedClient returns a client which issues at most limit concurrent calls through the given client.
+// A limit lower than 1 means no limit, the given client is returned as is.
+func NewLimitedClient(client FirmamentSchedulerClient, limit int) FirmamentSchedulerClient {
+	if limit < 1 {
+		return client
+	}
+	return &limitedClient{
+		client:    client,
+		semaphore: make(chan struct{}, limit),
+	}
+}
+
+func (c *limitedClient) acquire() {
+	c.semaphore <- struct{}{}
+}
+
+func (c *limitedClient) release() {
+	<-c.semaphore
+}
+
+func (c *limitedClient) Schedule(ctx context.Context, in *ScheduleRequest, opts ...grpc.CallOption) (*SchedulingDeltas, error) {
+	c.acquire()
+	defer c.release()
+	return c.client.Schedule(ctx, in, opts...)
+}
+
+func (c *limitedClient) TaskCompleted(ctx context.Context, in *TaskUID, opts ...grpc.CallOption) (*TaskCompletedResponse, error) {
+	c.acquire()
+	defer c.release()
+	return c.client.TaskCompleted(ctx, in, opts...)
+}
+
+func (c *limitedClient) TaskFailed(ctx context.Context, in *TaskUID, opts ...grpc.CallOption) (*TaskFailedResponse, error) {
+	c.acquire()
+	defer c.release()
+	return c.client.TaskFailed(ctx, in, opts...)
+}
+
+func (c *limitedClient) TaskRemoved(ctx context.Context, in *TaskUID, opts ...grpc.CallOption) (*TaskRemovedResponse, error) {
+	c.acquire()
+	defer c.release()
+	return c.client.TaskRemoved(ctx, in, opts...)
+}
+
+func (c *limitedClient) TaskSubmitted(ctx context.Context, in *TaskDescription, opts ...grpc.CallOption) (*TaskSubmittedResponse, error) {
+	c.acquire()
+	defer c.release()
+	return c.client.TaskSubmitted(ctx, in, opts...)
+}
+
+func (c *limitedClient) TaskUpdated(ctx context.Context, in *TaskDescription, opts ...grpc.CallOption) (*TaskUpdatedResponse, error) {
+	c.acquire()
+	defer c.release()
+	return c.client.TaskUpdated(ctx, in, opts...)
+}
+
+func (c *limitedClient) NodeAdded(ctx context.Context, in *ResourceTopologyNodeDescriptor, opts ...grpc.CallOption) (*NodeAddedResponse, error) {
+	c.acquire()
+	defer c.release()
+	return c.client.NodeAdded(ctx, in, opts...)
+}
+
+func (c *limitedClient) NodeFailed(ctx context.Context, in *ResourceUID, opts ...grpc.CallOption) (*NodeFailedResponse, error) {
+	c.acquire()
+	defer c.release()
+	return c.client.NodeFailed(ctx, in, opts...)
+}
+
+func (c *limitedClient) NodeRemoved(ctx context.Context, in *ResourceUID, opts ...grpc.CallOption) (*NodeRemovedResponse, error) {
+	c.acquire()
+	defer c.release()
+	return c.client.NodeRemoved(ctx, in, opts...)
+}
+
+func (c *limitedClient) NodeUpdated(ctx context.Context, in *ResourceTopologyNodeDescriptor, opts ...grpc.CallOption) (*NodeUpdatedResponse, error) {
+	c.acquire()
+	defer c.release()
+	return c.client.NodeUpdated(ctx, in, opts...)
+}
+
+func (c *limitedClient) AddTaskStats(ctx context.Context, in *TaskStats, opts ...grpc.CallOption) (*TaskStatsResponse, error) {
+	c.acquire()
+	defer c.release()
+	return c.client.AddTaskStats(ctx, in, opts...)
+}
+
+func (c *limitedClient) AddNodeStats(ctx context.Context, in *ResourceStats, opts ...grpc.CallOption) (*ResourceStatsResponse, error) {
+	c.acquire()
+	defer c.release()
+	return c.client.AddNodeStats(ctx, in, opts...)
+}
+
+func (c *limitedClient) Check(ctx context.Context, in *HealthCheckRequest, opts ...grpc.CallOption) (*HealthCheckResponse, error) {
+	c.acquire()
+	defer c.release()
+	return c.client.Check(ctx, in, opts...)
+}
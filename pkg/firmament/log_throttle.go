@@ -0,0 +1,96 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package firmament
+
+import (
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// DefaultLogThrottleWindow is the default window over which the repeated Firmament errors are collapsed.
+const DefaultLogThrottleWindow = 30 * time.Second
+
+// LogThrottle collapses repeated log lines of the same kind, e.g. one failure per task while Firmament
+// is unavailable. The first line of a kind is logged as is, the following ones are counted until the
+// window has passed and then logged as a single summary line.
+type LogThrottle struct {
+	mu     sync.Mutex
+	window time.Duration
+	// suppressed maps the kinds logged during the current window to the number of lines dropped since.
+	suppressed map[string]int
+	logf       func(format string, args ...interface{})
+}
+
+// NewLogThrottle returns a LogThrottle which logs through logf. A window of 0 disables the throttling.
+func NewLogThrottle(window time.Duration, logf func(format string, args ...interface{})) *LogThrottle {
+	return &LogThrottle{
+		window:     window,
+		suppressed: make(map[string]int),
+		logf:       logf,
+	}
+}
+
+// SetWindow changes the window, the kinds being throttled keep their current window.
+func (lt *LogThrottle) SetWindow(window time.Duration) {
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+	lt.window = window
+}
+
+// Logf logs the line unless a line of the same kind was already logged in the current window.
+func (lt *LogThrottle) Logf(kind string, format string, args ...interface{}) {
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+	if lt.window <= 0 {
+		lt.logf(format, args...)
+		return
+	}
+	if _, ok := lt.suppressed[kind]; ok {
+		lt.suppressed[kind]++
+		return
+	}
+	lt.suppressed[kind] = 0
+	lt.logf(format, args...)
+	window := lt.window
+	time.AfterFunc(window, func() {
+		lt.flush(kind, window)
+	})
+}
+
+// flush logs the summary of the lines of a kind dropped during the window which just ended.
+func (lt *LogThrottle) flush(kind string, window time.Duration) {
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+	if count := lt.suppressed[kind]; count > 0 {
+		lt.logf("%d more %s failures in last %v", count, kind, window)
+	}
+	delete(lt.suppressed, kind)
+}
+
+// errorLogThrottle throttles the errors returned by Firmament for the tasks and nodes.
+var errorLogThrottle = NewLogThrottle(DefaultLogThrottleWindow, glog.Warningf)
+
+// rpcErrorLogThrottle throttles the failures of the calls to Firmament.
+var rpcErrorLogThrottle = NewLogThrottle(DefaultLogThrottleWindow, glog.Errorf)
+
+// SetLogThrottleWindow sets the window over which the repeated Firmament errors are collapsed.
+func SetLogThrottleWindow(window time.Duration) {
+	errorLogThrottle.SetWindow(window)
+	rpcErrorLogThrottle.SetWindow(window)
+}
@@ -0,0 +1,97 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package firmament
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+)
+
+func Test_LogThrottle(t *testing.T) {
+	var mu sync.Mutex
+	var lines []string
+	logf := func(format string, args ...interface{}) {
+		mu.Lock()
+		defer mu.Unlock()
+		lines = append(lines, fmt.Sprintf(format, args...))
+	}
+	window := 50 * time.Millisecond
+	throttle := NewLogThrottle(window, logf)
+	for i := 0; i < 100; i++ {
+		throttle.Logf("TaskSubmitted", "Task %d not submitted", i)
+	}
+	throttle.Logf("TaskUpdated", "Task %d not found", 0)
+	mu.Lock()
+	if len(lines) != 2 {
+		t.Errorf("expected the first line of each kind to be logged during the window, got %v", lines)
+	}
+	mu.Unlock()
+
+	time.Sleep(4 * window)
+	mu.Lock()
+	defer mu.Unlock()
+	if len(lines) != 3 {
+		t.Fatalf("expected a single summary line after the window, got %v", lines)
+	}
+	if !strings.HasPrefix(lines[2], "99 more TaskSubmitted failures") {
+		t.Errorf("expected the summary of the 99 dropped lines, got %q", lines[2])
+	}
+}
+
+func Test_LogThrottleDisabled(t *testing.T) {
+	count := 0
+	throttle := NewLogThrottle(0, func(format string, args ...interface{}) {
+		count++
+	})
+	for i := 0; i < 10; i++ {
+		throttle.Logf("TaskSubmitted", "Task %d not submitted", i)
+	}
+	if count != 10 {
+		t.Errorf("expected all the lines to be logged without a window, got %d", count)
+	}
+}
+
+func Test_LogThrottleRPCErrors(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	firmamentClient := NewMockFirmamentSchedulerClient(mockCtrl)
+	firmamentClient.EXPECT().TaskSubmitted(gomock.Any(), gomock.Any()).Return(nil, errors.New("unavailable")).Times(100)
+	firmamentClient.EXPECT().NodeUpdated(gomock.Any(), gomock.Any()).Return(nil, errors.New("unavailable")).Times(10)
+
+	var lines []string
+	defer func(throttle *LogThrottle) {
+		rpcErrorLogThrottle = throttle
+	}(rpcErrorLogThrottle)
+	rpcErrorLogThrottle = NewLogThrottle(time.Minute, func(format string, args ...interface{}) {
+		lines = append(lines, fmt.Sprintf(format, args...))
+	})
+	for i := 0; i < 100; i++ {
+		TaskSubmitted(firmamentClient, &TaskDescription{})
+	}
+	for i := 0; i < 10; i++ {
+		NodeUpdated(firmamentClient, &ResourceTopologyNodeDescriptor{})
+	}
+	if len(lines) != 2 {
+		t.Errorf("expected the first failure of each call to be logged, got %v", lines)
+	}
+}
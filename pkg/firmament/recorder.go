@@ -0,0 +1,252 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package firmament
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/golang/protobuf/proto"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+)
+
+// RPCRecord is a Firmament RPC as written by a Recorder, one JSON object per line.
+type RPCRecord struct {
+	Time   time.Time `json:"time"`
+	Method string    `json:"method"`
+	// Request is the request of the RPC in the protobuf text format.
+	Request string `json:"request"`
+}
+
+// Recorder writes the outbound Firmament RPCs of the clients it wraps, so that a session can be
+// replayed offline with Replay, e.g. to reproduce an issue against a local Firmament.
+type Recorder struct {
+	mu      sync.Mutex
+	encoder *json.Encoder
+	now     func() time.Time
+}
+
+// NewRecorder returns a Recorder writing the RPCs to w.
+func NewRecorder(w io.Writer) *Recorder {
+	return &Recorder{
+		encoder: json.NewEncoder(w),
+		now:     time.Now,
+	}
+}
+
+// Wrap returns a client recording the RPCs issued through the given client.
+func (r *Recorder) Wrap(client FirmamentSchedulerClient) FirmamentSchedulerClient {
+	return &recordingClient{client: client, recorder: r}
+}
+
+func (r *Recorder) record(method string, request proto.Message) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	record := &RPCRecord{
+		Time:    r.now(),
+		Method:  method,
+		Request: proto.CompactTextString(request),
+	}
+	if err := r.encoder.Encode(record); err != nil {
+		glog.Errorf("Failed to record the %s RPC: %v", method, err)
+	}
+}
+
+var (
+	recorderLock sync.RWMutex
+	// recorder, if set, records the RPCs of the clients returned by New and NewBalanced.
+	recorder *Recorder
+)
+
+// SetRecorder makes the clients created from now on record their RPCs, nil stops recording.
+func SetRecorder(r *Recorder) {
+	recorderLock.Lock()
+	defer recorderLock.Unlock()
+	recorder = r
+}
+
+// withRecorder wraps the client with the recorder, if any.
+func withRecorder(client FirmamentSchedulerClient) FirmamentSchedulerClient {
+	recorderLock.RLock()
+	defer recorderLock.RUnlock()
+	if recorder == nil {
+		return client
+	}
+	return recorder.Wrap(client)
+}
+
+// newRequest returns an empty request of the given RPC.
+func newRequest(method string) (proto.Message, error) {
+	switch method {
+	case "Schedule":
+		return &ScheduleRequest{}, nil
+	case "TaskCompleted", "TaskFailed", "TaskRemoved":
+		return &TaskUID{}, nil
+	case "TaskSubmitted", "TaskUpdated":
+		return &TaskDescription{}, nil
+	case "NodeAdded", "NodeUpdated":
+		return &ResourceTopologyNodeDescriptor{}, nil
+	case "NodeFailed", "NodeRemoved":
+		return &ResourceUID{}, nil
+	case "AddTaskStats":
+		return &TaskStats{}, nil
+	case "AddNodeStats":
+		return &ResourceStats{}, nil
+	case "Check":
+		return &HealthCheckRequest{}, nil
+	}
+	return nil, fmt.Errorf("unknown RPC %q", method)
+}
+
+// invoke issues the RPC of the given method.
+func invoke(ctx context.Context, client FirmamentSchedulerClient, method string, request proto.Message) error {
+	var err error
+	switch method {
+	case "Schedule":
+		_, err = client.Schedule(ctx, request.(*ScheduleRequest))
+	case "TaskCompleted":
+		_, err = client.TaskCompleted(ctx, request.(*TaskUID))
+	case "TaskFailed":
+		_, err = client.TaskFailed(ctx, request.(*TaskUID))
+	case "TaskRemoved":
+		_, err = client.TaskRemoved(ctx, request.(*TaskUID))
+	case "TaskSubmitted":
+		_, err = client.TaskSubmitted(ctx, request.(*TaskDescription))
+	case "TaskUpdated":
+		_, err = client.TaskUpdated(ctx, request.(*TaskDescription))
+	case "NodeAdded":
+		_, err = client.NodeAdded(ctx, request.(*ResourceTopologyNodeDescriptor))
+	case "NodeUpdated":
+		_, err = client.NodeUpdated(ctx, request.(*ResourceTopologyNodeDescriptor))
+	case "NodeFailed":
+		_, err = client.NodeFailed(ctx, request.(*ResourceUID))
+	case "NodeRemoved":
+		_, err = client.NodeRemoved(ctx, request.(*ResourceUID))
+	case "AddTaskStats":
+		_, err = client.AddTaskStats(ctx, request.(*TaskStats))
+	case "AddNodeStats":
+		_, err = client.AddNodeStats(ctx, request.(*ResourceStats))
+	case "Check":
+		_, err = client.Check(ctx, request.(*HealthCheckRequest))
+	default:
+		err = fmt.Errorf("unknown RPC %q", method)
+	}
+	return err
+}
+
+// Replay issues the RPCs recorded by a Recorder through the given client, in the recorded order and
+// without waiting between them. The errors returned by the RPCs are logged and the replay goes on.
+// It returns the number of replayed RPCs.
+func Replay(r io.Reader, client FirmamentSchedulerClient) (int, error) {
+	decoder := json.NewDecoder(r)
+	replayed := 0
+	for {
+		var record RPCRecord
+		if err := decoder.Decode(&record); err == io.EOF {
+			return replayed, nil
+		} else if err != nil {
+			return replayed, fmt.Errorf("failed to read RPC %d: %v", replayed+1, err)
+		}
+		request, err := newRequest(record.Method)
+		if err != nil {
+			return replayed, fmt.Errorf("RPC %d: %v", replayed+1, err)
+		}
+		if err := proto.UnmarshalText(record.Request, request); err != nil {
+			return replayed, fmt.Errorf("RPC %d: failed to parse the %s request: %v", replayed+1, record.Method, err)
+		}
+		if err := invoke(context.Background(), client, record.Method, request); err != nil {
+			glog.Warningf("Replayed %s RPC recorded at %v failed: %v", record.Method, record.Time, err)
+		}
+		replayed++
+	}
+}
+
+// recordingClient is a FirmamentSchedulerClient recording the RPCs before issuing them.
+type recordingClient struct {
+	client   FirmamentSchedulerClient
+	recorder *Recorder
+}
+
+func (c *recordingClient) Schedule(ctx context.Context, in *ScheduleRequest, opts ...grpc.CallOption) (*SchedulingDeltas, error) {
+	c.recorder.record("Schedule", in)
+	return c.client.Schedule(ctx, in, opts...)
+}
+
+func (c *recordingClient) TaskCompleted(ctx context.Context, in *TaskUID, opts ...grpc.CallOption) (*TaskCompletedResponse, error) {
+	c.recorder.record("TaskCompleted", in)
+	return c.client.TaskCompleted(ctx, in, opts...)
+}
+
+func (c *recordingClient) TaskFailed(ctx context.Context, in *TaskUID, opts ...grpc.CallOption) (*TaskFailedResponse, error) {
+	c.recorder.record("TaskFailed", in)
+	return c.client.TaskFailed(ctx, in, opts...)
+}
+
+func (c *recordingClient) TaskRemoved(ctx context.Context, in *TaskUID, opts ...grpc.CallOption) (*TaskRemovedResponse, error) {
+	c.recorder.record("TaskRemoved", in)
+	return c.client.TaskRemoved(ctx, in, opts...)
+}
+
+func (c *recordingClient) TaskSubmitted(ctx context.Context, in *TaskDescription, opts ...grpc.CallOption) (*TaskSubmittedResponse, error) {
+	c.recorder.record("TaskSubmitted", in)
+	return c.client.TaskSubmitted(ctx, in, opts...)
+}
+
+func (c *recordingClient) TaskUpdated(ctx context.Context, in *TaskDescription, opts ...grpc.CallOption) (*TaskUpdatedResponse, error) {
+	c.recorder.record("TaskUpdated", in)
+	return c.client.TaskUpdated(ctx, in, opts...)
+}
+
+func (c *recordingClient) NodeAdded(ctx context.Context, in *ResourceTopologyNodeDescriptor, opts ...grpc.CallOption) (*NodeAddedResponse, error) {
+	c.recorder.record("NodeAdded", in)
+	return c.client.NodeAdded(ctx, in, opts...)
+}
+
+func (c *recordingClient) NodeFailed(ctx context.Context, in *ResourceUID, opts ...grpc.CallOption) (*NodeFailedResponse, error) {
+	c.recorder.record("NodeFailed", in)
+	return c.client.NodeFailed(ctx, in, opts...)
+}
+
+func (c *recordingClient) NodeRemoved(ctx context.Context, in *ResourceUID, opts ...grpc.CallOption) (*NodeRemovedResponse, error) {
+	c.recorder.record("NodeRemoved", in)
+	return c.client.NodeRemoved(ctx, in, opts...)
+}
+
+func (c *recordingClient) NodeUpdated(ctx context.Context, in *ResourceTopologyNodeDescriptor, opts ...grpc.CallOption) (*NodeUpdatedResponse, error) {
+	c.recorder.record("NodeUpdated", in)
+	return c.client.NodeUpdated(ctx, in, opts...)
+}
+
+func (c *recordingClient) AddTaskStats(ctx context.Context, in *TaskStats, opts ...grpc.CallOption) (*TaskStatsResponse, error) {
+	c.recorder.record("AddTaskStats", in)
+	return c.client.AddTaskStats(ctx, in, opts...)
+}
+
+func (c *recordingClient) AddNodeStats(ctx context.Context, in *ResourceStats, opts ...grpc.CallOption) (*ResourceStatsResponse, error) {
+	c.recorder.record("AddNodeStats", in)
+	return c.client.AddNodeStats(ctx, in, opts...)
+}
+
+func (c *recordingClient) Check(ctx context.Context, in *HealthCheckRequest, opts ...grpc.CallOption) (*HealthCheckResponse, error) {
+	c.recorder.record("Check", in)
+	return c.client.Check(ctx, in, opts...)
+}
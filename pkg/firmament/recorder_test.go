@@ -0,0 +1,116 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package firmament
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/golang/protobuf/proto"
+	"golang.org/x/net/context"
+)
+
+// protoMatcher matches the protobuf messages equal to the expected one.
+type protoMatcher struct {
+	expected proto.Message
+}
+
+func (m protoMatcher) Matches(x interface{}) bool {
+	msg, ok := x.(proto.Message)
+	return ok && proto.Equal(m.expected, msg)
+}
+
+func (m protoMatcher) String() string {
+	return fmt.Sprintf("is equal to %v", m.expected)
+}
+
+func Test_RecordAndReplay(t *testing.T) {
+	task := &TaskDescription{
+		TaskDescriptor: &TaskDescriptor{Uid: 1, Name: "default/pod1", JobId: "job1"},
+		JobDescriptor:  &JobDescriptor{Uuid: "job1", Name: "job1"},
+	}
+	node := &ResourceTopologyNodeDescriptor{
+		ResourceDesc: &ResourceDescriptor{Uuid: "node1", FriendlyName: "node1"},
+	}
+	taskUID := &TaskUID{TaskUid: 1}
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	recordedClient := NewMockFirmamentSchedulerClient(mockCtrl)
+	recordedClient.EXPECT().TaskSubmitted(gomock.Any(), gomock.Any()).Return(&TaskSubmittedResponse{}, nil)
+	recordedClient.EXPECT().NodeAdded(gomock.Any(), gomock.Any()).Return(&NodeAddedResponse{}, nil)
+	recordedClient.EXPECT().Schedule(gomock.Any(), gomock.Any()).Return(&SchedulingDeltas{}, nil)
+	recordedClient.EXPECT().TaskRemoved(gomock.Any(), gomock.Any()).Return(&TaskRemovedResponse{}, nil)
+
+	var session bytes.Buffer
+	recorder := NewRecorder(&session)
+	recorder.now = func() time.Time {
+		return time.Unix(0, 0).UTC()
+	}
+	client := recorder.Wrap(recordedClient)
+	ctx := context.Background()
+	client.TaskSubmitted(ctx, task)
+	client.NodeAdded(ctx, node)
+	client.Schedule(ctx, &ScheduleRequest{})
+	client.TaskRemoved(ctx, taskUID)
+	if lines := strings.Count(session.String(), "\n"); lines != 4 {
+		t.Fatalf("Expected 4 recorded RPCs, got %d:\n%s", lines, session.String())
+	}
+
+	// Replaying the session twice has to issue the same RPCs in the same order.
+	recording := session.Bytes()
+	for i := 0; i < 2; i++ {
+		replayCtrl := gomock.NewController(t)
+		replayClient := NewMockFirmamentSchedulerClient(replayCtrl)
+		gomock.InOrder(
+			replayClient.EXPECT().TaskSubmitted(gomock.Any(), protoMatcher{task}).Return(&TaskSubmittedResponse{}, nil),
+			replayClient.EXPECT().NodeAdded(gomock.Any(), protoMatcher{node}).Return(&NodeAddedResponse{}, nil),
+			replayClient.EXPECT().Schedule(gomock.Any(), protoMatcher{&ScheduleRequest{}}).Return(&SchedulingDeltas{}, nil),
+			replayClient.EXPECT().TaskRemoved(gomock.Any(), protoMatcher{taskUID}).Return(&TaskRemovedResponse{}, nil),
+		)
+		replayed, err := Replay(bytes.NewReader(recording), replayClient)
+		if err != nil {
+			t.Fatalf("Replay %d failed: %v", i, err)
+		}
+		if replayed != 4 {
+			t.Errorf("Replay %d: expected 4 replayed RPCs, got %d", i, replayed)
+		}
+		replayCtrl.Finish()
+	}
+}
+
+func Test_ReplayUnknownRPC(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	replayClient := NewMockFirmamentSchedulerClient(mockCtrl)
+	replayClient.EXPECT().Schedule(gomock.Any(), gomock.Any()).Return(&SchedulingDeltas{}, nil)
+
+	recording := `{"time":"1970-01-01T00:00:00Z","method":"Schedule","request":""}
+{"time":"1970-01-01T00:00:00Z","method":"Unknown","request":""}
+`
+	replayed, err := Replay(strings.NewReader(recording), replayClient)
+	if err == nil {
+		t.Fatalf("Expected the replay of an unknown RPC to fail")
+	}
+	if replayed != 1 {
+		t.Errorf("Expected 1 replayed RPC before the failure, got %d", replayed)
+	}
+}
@@ -0,0 +1,96 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package firmament
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"google.golang.org/grpc/resolver"
+)
+
+// resolverCount makes the scheme of every AddressResolver unique, the gRPC resolver registry is global.
+var resolverCount uint64
+
+// AddressResolver is a gRPC resolver serving a list of Firmament addresses which can be updated at runtime.
+type AddressResolver struct {
+	scheme    string
+	mu        sync.Mutex
+	addresses []string
+	cc        resolver.ClientConn
+}
+
+// NewAddressResolver creates and registers a resolver for the given Firmament addresses.
+func NewAddressResolver(addresses []string) *AddressResolver {
+	r := &AddressResolver{
+		scheme:    fmt.Sprintf("firmament%d", atomic.AddUint64(&resolverCount, 1)),
+		addresses: addresses,
+	}
+	resolver.Register(r)
+	return r
+}
+
+// Target returns the dial target which is resolved by this resolver.
+func (r *AddressResolver) Target() string {
+	return r.scheme + ":///firmament"
+}
+
+// Build implements resolver.Builder.
+func (r *AddressResolver) Build(target resolver.Target, cc resolver.ClientConn, opts resolver.BuildOption) (resolver.Resolver, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cc = cc
+	r.cc.NewAddress(r.resolvedAddresses())
+	return r, nil
+}
+
+// Scheme implements resolver.Builder.
+func (r *AddressResolver) Scheme() string {
+	return r.scheme
+}
+
+// ResolveNow implements resolver.Resolver, the addresses are static until UpdateAddresses is called.
+func (r *AddressResolver) ResolveNow(o resolver.ResolveNowOption) {}
+
+// Close implements resolver.Resolver.
+func (r *AddressResolver) Close() {}
+
+// Addresses returns the current Firmament addresses.
+func (r *AddressResolver) Addresses() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.addresses...)
+}
+
+// UpdateAddresses replaces the Firmament addresses, connections to removed addresses are closed by gRPC.
+func (r *AddressResolver) UpdateAddresses(addresses []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.addresses = addresses
+	if r.cc != nil {
+		r.cc.NewAddress(r.resolvedAddresses())
+	}
+}
+
+func (r *AddressResolver) resolvedAddresses() []resolver.Address {
+	var addrs []resolver.Address
+	for _, address := range r.addresses {
+		addrs = append(addrs, resolver.Address{Addr: address})
+	}
+	return addrs
+}
@@ -0,0 +1,135 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package firmament
+
+import (
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+)
+
+// fakeFirmamentServer only implements the health check, it counts the calls it serves.
+type fakeFirmamentServer struct {
+	FirmamentSchedulerServer
+	checks int32
+}
+
+func (s *fakeFirmamentServer) Check(ctx context.Context, req *HealthCheckRequest) (*HealthCheckResponse, error) {
+	atomic.AddInt32(&s.checks, 1)
+	return &HealthCheckResponse{Status: ServingStatus_SERVING}, nil
+}
+
+func startFakeFirmamentServer(t *testing.T) (*fakeFirmamentServer, string, func()) {
+	listen, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	fakeServer := &fakeFirmamentServer{}
+	grpcServer := grpc.NewServer()
+	RegisterFirmamentSchedulerServer(grpcServer, fakeServer)
+	go grpcServer.Serve(listen)
+	return fakeServer, listen.Addr().String(), grpcServer.Stop
+}
+
+func Test_NewBalanced(t *testing.T) {
+	first, firstAddr, stopFirst := startFakeFirmamentServer(t)
+	defer stopFirst()
+	second, secondAddr, stopSecond := startFakeFirmamentServer(t)
+	defer stopSecond()
+
+	fc, conn, r, err := NewBalanced([]string{firstAddr, secondAddr})
+	if err != nil {
+		t.Fatalf("Failed to start the client: %v", err)
+	}
+	defer conn.Close()
+
+	check := func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if _, err := fc.Check(ctx, &HealthCheckRequest{}, grpc.FailFast(false)); err != nil {
+			t.Fatalf("Check failed: %v", err)
+		}
+	}
+	// Wait until both backends are connected, the round robin picker only uses ready connections.
+	deadline := time.Now().Add(5 * time.Second)
+	for atomic.LoadInt32(&first.checks) == 0 || atomic.LoadInt32(&second.checks) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("calls were not distributed across both backends, got %d and %d",
+				atomic.LoadInt32(&first.checks), atomic.LoadInt32(&second.checks))
+		}
+		check()
+	}
+
+	// Drop the second backend at runtime, all the calls must go to the first one.
+	r.UpdateAddresses([]string{firstAddr})
+	time.Sleep(500 * time.Millisecond)
+	secondChecks := atomic.LoadInt32(&second.checks)
+	for i := 0; i < 10; i++ {
+		check()
+	}
+	if atomic.LoadInt32(&second.checks) != secondChecks {
+		t.Errorf("expected no more calls on the removed backend, got %d", atomic.LoadInt32(&second.checks)-secondChecks)
+	}
+}
+
+func Test_UpdateAddresses(t *testing.T) {
+	first, firstAddr, stopFirst := startFakeFirmamentServer(t)
+	defer stopFirst()
+	_, secondAddr, stopSecond := startFakeFirmamentServer(t)
+	defer stopSecond()
+
+	defer func() {
+		resolversLock.Lock()
+		resolvers = nil
+		resolversLock.Unlock()
+	}()
+	// Both a balanced client and a client of a single replica can be moved.
+	for _, address := range []string{secondAddr + "," + secondAddr, secondAddr} {
+		atomic.StoreInt32(&first.checks, 0)
+		testUpdateAddresses(t, address, first, firstAddr)
+	}
+}
+
+// testUpdateAddresses checks a client created by New with address is moved over to the first backend
+// at runtime.
+func testUpdateAddresses(t *testing.T, address string, first *fakeFirmamentServer, firstAddr string) {
+	fc, conn, err := New(address)
+	if err != nil {
+		t.Fatalf("Failed to start the client: %v", err)
+	}
+	defer conn.Close()
+
+	if !UpdateAddresses(firstAddr) {
+		t.Fatalf("expected the client of %s to be updated", address)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for atomic.LoadInt32(&first.checks) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the calls to reach the new backend")
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		_, err := fc.Check(ctx, &HealthCheckRequest{}, grpc.FailFast(false))
+		cancel()
+		if err != nil {
+			t.Fatalf("Check failed: %v", err)
+		}
+	}
+}
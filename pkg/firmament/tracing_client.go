@@ -0,0 +1,142 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package firmament
+
+import (
+	"github.com/kubernetes-sigs/poseidon/pkg/tracing"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// tracingClient is a FirmamentSchedulerClient which records a span per call to Firmament, child of the
+// span of the context if any, and propagates the trace to Firmament in the traceparent header.
+type tracingClient struct {
+	client FirmamentSchedulerClient
+}
+
+// NewTracingClient returns a client which traces the calls issued through the given client. The
+// health checks aren't traced.
+func NewTracingClient(client FirmamentSchedulerClient) FirmamentSchedulerClient {
+	return &tracingClient{client: client}
+}
+
+// startRPC starts the span of a call and returns the context the call is issued with, which
+// propagates the span to Firmament.
+func startRPC(ctx context.Context, rpc string) (context.Context, *tracing.Span) {
+	ctx, span := tracing.Start(ctx, "firmament."+rpc)
+	if span == nil {
+		return ctx, nil
+	}
+	md, _ := metadata.FromOutgoingContext(ctx)
+	md = metadata.Join(md, metadata.Pairs(tracing.TraceparentHeader, span.Traceparent()))
+	return metadata.NewOutgoingContext(ctx, md), span
+}
+
+// finishRPC ends the span of a call.
+func finishRPC(span *tracing.Span, err error) {
+	span.SetError(err)
+	span.Finish()
+}
+
+func (c *tracingClient) Schedule(ctx context.Context, in *ScheduleRequest, opts ...grpc.CallOption) (*SchedulingDeltas, error) {
+	ctx, span := startRPC(ctx, "Schedule")
+	resp, err := c.client.Schedule(ctx, in, opts...)
+	finishRPC(span, err)
+	return resp, err
+}
+
+func (c *tracingClient) TaskCompleted(ctx context.Context, in *TaskUID, opts ...grpc.CallOption) (*TaskCompletedResponse, error) {
+	ctx, span := startRPC(ctx, "TaskCompleted")
+	resp, err := c.client.TaskCompleted(ctx, in, opts...)
+	finishRPC(span, err)
+	return resp, err
+}
+
+func (c *tracingClient) TaskFailed(ctx context.Context, in *TaskUID, opts ...grpc.CallOption) (*TaskFailedResponse, error) {
+	ctx, span := startRPC(ctx, "TaskFailed")
+	resp, err := c.client.TaskFailed(ctx, in, opts...)
+	finishRPC(span, err)
+	return resp, err
+}
+
+func (c *tracingClient) TaskRemoved(ctx context.Context, in *TaskUID, opts ...grpc.CallOption) (*TaskRemovedResponse, error) {
+	ctx, span := startRPC(ctx, "TaskRemoved")
+	resp, err := c.client.TaskRemoved(ctx, in, opts...)
+	finishRPC(span, err)
+	return resp, err
+}
+
+func (c *tracingClient) TaskSubmitted(ctx context.Context, in *TaskDescription, opts ...grpc.CallOption) (*TaskSubmittedResponse, error) {
+	ctx, span := startRPC(ctx, "TaskSubmitted")
+	resp, err := c.client.TaskSubmitted(ctx, in, opts...)
+	finishRPC(span, err)
+	return resp, err
+}
+
+func (c *tracingClient) TaskUpdated(ctx context.Context, in *TaskDescription, opts ...grpc.CallOption) (*TaskUpdatedResponse, error) {
+	ctx, span := startRPC(ctx, "TaskUpdated")
+	resp, err := c.client.TaskUpdated(ctx, in, opts...)
+	finishRPC(span, err)
+	return resp, err
+}
+
+func (c *tracingClient) NodeAdded(ctx context.Context, in *ResourceTopologyNodeDescriptor, opts ...grpc.CallOption) (*NodeAddedResponse, error) {
+	ctx, span := startRPC(ctx, "NodeAdded")
+	resp, err := c.client.NodeAdded(ctx, in, opts...)
+	finishRPC(span, err)
+	return resp, err
+}
+
+func (c *tracingClient) NodeFailed(ctx context.Context, in *ResourceUID, opts ...grpc.CallOption) (*NodeFailedResponse, error) {
+	ctx, span := startRPC(ctx, "NodeFailed")
+	resp, err := c.client.NodeFailed(ctx, in, opts...)
+	finishRPC(span, err)
+	return resp, err
+}
+
+func (c *tracingClient) NodeRemoved(ctx context.Context, in *ResourceUID, opts ...grpc.CallOption) (*NodeRemovedResponse, error) {
+	ctx, span := startRPC(ctx, "NodeRemoved")
+	resp, err := c.client.NodeRemoved(ctx, in, opts...)
+	finishRPC(span, err)
+	return resp, err
+}
+
+func (c *tracingClient) NodeUpdated(ctx context.Context, in *ResourceTopologyNodeDescriptor, opts ...grpc.CallOption) (*NodeUpdatedResponse, error) {
+	ctx, span := startRPC(ctx, "NodeUpdated")
+	resp, err := c.client.NodeUpdated(ctx, in, opts...)
+	finishRPC(span, err)
+	return resp, err
+}
+
+func (c *tracingClient) AddTaskStats(ctx context.Context, in *TaskStats, opts ...grpc.CallOption) (*TaskStatsResponse, error) {
+	ctx, span := startRPC(ctx, "AddTaskStats")
+	resp, err := c.client.AddTaskStats(ctx, in, opts...)
+	finishRPC(span, err)
+	return resp, err
+}
+
+func (c *tracingClient) AddNodeStats(ctx context.Context, in *ResourceStats, opts ...grpc.CallOption) (*ResourceStatsResponse, error) {
+	ctx, span := startRPC(ctx, "AddNodeStats")
+	resp, err := c.client.AddNodeStats(ctx, in, opts...)
+	finishRPC(span, err)
+	return resp, err
+}
+
+func (c *tracingClient) Check(ctx context.Context, in *HealthCheckRequest, opts ...grpc.CallOption) (*HealthCheckResponse, error) {
+	return c.client.Check(ctx, in, opts...)
+}
@@ -0,0 +1,70 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package firmament
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/kubernetes-sigs/poseidon/pkg/tracing"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/metadata"
+)
+
+func Test_TracingClient(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockClient := NewMockFirmamentSchedulerClient(mockCtrl)
+	recorder := &tracing.InMemoryRecorder{}
+	tracing.SetRecorder(recorder)
+	defer tracing.SetRecorder(nil)
+
+	var traceparent string
+	gomock.InOrder(
+		mockClient.EXPECT().TaskSubmitted(gomock.Any(), gomock.Any()).Do(func(ctx context.Context, _ interface{}) {
+			md, _ := metadata.FromOutgoingContext(ctx)
+			if values := md[tracing.TraceparentHeader]; len(values) == 1 {
+				traceparent = values[0]
+			}
+		}).Return(&TaskSubmittedResponse{Type: TaskReplyType_TASK_SUBMITTED_OK}, nil),
+		mockClient.EXPECT().TaskRemoved(gomock.Any(), gomock.Any()).Return(nil, errors.New("connection reset")),
+		mockClient.EXPECT().Check(gomock.Any(), gomock.Any()).Return(&HealthCheckResponse{Status: ServingStatus_SERVING}, nil),
+	)
+
+	client := NewTracingClient(mockClient)
+	ctx, parent := tracing.Start(context.Background(), "parent")
+	client.TaskSubmitted(ctx, &TaskDescription{})
+	client.TaskRemoved(context.Background(), &TaskUID{})
+	client.Check(context.Background(), &HealthCheckRequest{})
+	parent.Finish()
+
+	spans := recorder.Spans()
+	if len(spans) != 3 {
+		t.Fatalf("expected a span per traced call and the parent span, got %+v", spans)
+	}
+	submitted, removed := spans[0], spans[1]
+	if submitted.Name != "firmament.TaskSubmitted" || submitted.Parent != parent.SpanContext {
+		t.Errorf("expected the TaskSubmitted span to be a child of the parent span, got %+v", submitted)
+	}
+	if traceparent != submitted.Traceparent() {
+		t.Errorf("expected the traceparent %q to be propagated to Firmament, got %q", submitted.Traceparent(), traceparent)
+	}
+	if removed.Name != "firmament.TaskRemoved" || removed.Parent.IsValid() || removed.Err != "connection reset" {
+		t.Errorf("expected a failed root TaskRemoved span, got %+v", removed)
+	}
+}
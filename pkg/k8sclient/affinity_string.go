@@ -0,0 +1,122 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8sclient
+
+import (
+	"fmt"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// String renders the affinity compactly for the logs, e.g.
+// "node{required=[(zone In [a b])] preferred=[10:(disk Exists)]} anti{required=[app=web@hostname]}".
+func (a *Affinity) String() string {
+	if a == nil {
+		return "<none>"
+	}
+	var parts []string
+	if a.NodeAffinity != nil {
+		parts = append(parts, "node{"+a.NodeAffinity.String()+"}")
+	}
+	if a.PodAffinity != nil {
+		parts = append(parts, "pod{"+a.PodAffinity.String()+"}")
+	}
+	if a.PodAntiAffinity != nil {
+		parts = append(parts, "anti{"+a.PodAntiAffinity.String()+"}")
+	}
+	if len(parts) == 0 {
+		return "<none>"
+	}
+	return strings.Join(parts, " ")
+}
+
+// String renders the node affinity compactly for the logs. The required terms are ORed, the
+// requirements of a term are ANDed.
+func (na *NodeAffinity) String() string {
+	if na == nil {
+		return "<none>"
+	}
+	var parts []string
+	if na.HardScheduling != nil {
+		terms := make([]string, 0, len(na.HardScheduling.NodeSelectorTerms))
+		for _, term := range na.HardScheduling.NodeSelectorTerms {
+			terms = append(terms, nodeSelectorTermString(term))
+		}
+		parts = append(parts, "required=["+strings.Join(terms, " || ")+"]")
+	}
+	if len(na.SoftScheduling) > 0 {
+		terms := make([]string, 0, len(na.SoftScheduling))
+		for _, term := range na.SoftScheduling {
+			terms = append(terms, fmt.Sprintf("%d:%s", term.Weight, nodeSelectorTermString(term.Preference)))
+		}
+		parts = append(parts, "preferred=["+strings.Join(terms, " ")+"]")
+	}
+	if len(parts) == 0 {
+		return "<none>"
+	}
+	return strings.Join(parts, " ")
+}
+
+// String renders the pod (anti-)affinity compactly for the logs. A term is rendered as its label
+// selector followed by its topology key, and by its namespaces if it has some.
+func (pa *PodAffinity) String() string {
+	if pa == nil {
+		return "<none>"
+	}
+	var parts []string
+	if len(pa.HardScheduling) > 0 {
+		terms := make([]string, 0, len(pa.HardScheduling))
+		for _, term := range pa.HardScheduling {
+			terms = append(terms, podAffinityTermString(term))
+		}
+		parts = append(parts, "required=["+strings.Join(terms, " ")+"]")
+	}
+	if len(pa.SoftScheduling) > 0 {
+		terms := make([]string, 0, len(pa.SoftScheduling))
+		for _, term := range pa.SoftScheduling {
+			terms = append(terms, fmt.Sprintf("%d:%s", term.Weight, podAffinityTermString(term.PodAffinityTerm)))
+		}
+		parts = append(parts, "preferred=["+strings.Join(terms, " ")+"]")
+	}
+	if len(parts) == 0 {
+		return "<none>"
+	}
+	return strings.Join(parts, " ")
+}
+
+// nodeSelectorTermString renders the requirements of a node selector term, e.g. "(zone In [a b], disk Exists)".
+func nodeSelectorTermString(term NodeSelectorTerm) string {
+	requirements := make([]string, 0, len(term.MatchExpressions))
+	for _, requirement := range term.MatchExpressions {
+		if len(requirement.Values) == 0 {
+			requirements = append(requirements, requirement.Key+" "+requirement.Operator)
+			continue
+		}
+		requirements = append(requirements, fmt.Sprintf("%s %s [%s]", requirement.Key, requirement.Operator, strings.Join(requirement.Values, " ")))
+	}
+	return "(" + strings.Join(requirements, ", ") + ")"
+}
+
+// podAffinityTermString renders a pod affinity term, e.g. "app=web@kubernetes.io/hostname".
+func podAffinityTermString(term PodAffinityTerm) string {
+	s := metav1.FormatLabelSelector(term.LabelSelector) + "@" + term.TopologyKey
+	if len(term.Namespaces) > 0 {
+		s += " ns=[" + strings.Join(term.Namespaces, " ") + "]"
+	}
+	return s
+}
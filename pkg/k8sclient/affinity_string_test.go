@@ -0,0 +1,77 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8sclient
+
+import (
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestAffinity_String(t *testing.T) {
+	affinity := &Affinity{
+		NodeAffinity: &NodeAffinity{
+			HardScheduling: &NodeSelector{
+				NodeSelectorTerms: []NodeSelectorTerm{
+					{MatchExpressions: []NodeSelectorRequirement{
+						{Key: "zone", Operator: "In", Values: []string{"a", "b"}},
+						{Key: "gpu", Operator: "Exists"},
+					}},
+					{MatchExpressions: []NodeSelectorRequirement{
+						{Key: "mem-type", Operator: "NotIn", Values: []string{"DDR"}},
+					}},
+				},
+			},
+			SoftScheduling: []PreferredSchedulingTerm{
+				{Weight: 10, Preference: NodeSelectorTerm{MatchExpressions: []NodeSelectorRequirement{
+					{Key: "disk", Operator: "In", Values: []string{"ssd"}},
+				}}},
+			},
+		},
+		PodAffinity: &PodAffinity{
+			SoftScheduling: []WeightedPodAffinityTerm{
+				{Weight: 50, PodAffinityTerm: PodAffinityTerm{
+					LabelSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "cache"}},
+					TopologyKey:   "zone",
+				}},
+			},
+		},
+		PodAntiAffinity: &PodAffinity{
+			HardScheduling: []PodAffinityTerm{
+				{
+					LabelSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}},
+					Namespaces:    []string{"default", "prod"},
+					TopologyKey:   "kubernetes.io/hostname",
+				},
+			},
+		},
+	}
+	want := "node{required=[(zone In [a b], gpu Exists) || (mem-type NotIn [DDR])] preferred=[10:(disk In [ssd])]} " +
+		"pod{preferred=[50:app=cache@zone]} " +
+		"anti{required=[app=web@kubernetes.io/hostname ns=[default prod]]}"
+	if got := affinity.String(); got != want {
+		t.Errorf("Affinity.String() = %q, want %q", got, want)
+	}
+
+	var noAffinity *Affinity
+	if got := noAffinity.String(); got != "<none>" {
+		t.Errorf("nil Affinity.String() = %q, want %q", got, "<none>")
+	}
+	if got := (&Affinity{}).String(); got != "<none>" {
+		t.Errorf("empty Affinity.String() = %q, want %q", got, "<none>")
+	}
+}
@@ -0,0 +1,89 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8sclient
+
+import (
+	"github.com/golang/glog"
+	"github.com/kubernetes-sigs/poseidon/pkg/firmament"
+	"golang.org/x/net/context"
+)
+
+// SchedulerBackend is the scheduler the pod watcher hands the tasks of the pods to. Firmament is the
+// default backend, another one can be plugged behind the same watcher, e.g. to compare them.
+type SchedulerBackend interface {
+	// SubmitTask submits the task of a new pod. The context carries the trace of the submission.
+	SubmitTask(ctx context.Context, td *firmament.TaskDescription)
+	// UpdateTask updates the task of a pod which changed. A task the backend doesn't know, e.g.
+	// because it restarted, is submitted afresh.
+	UpdateTask(td *firmament.TaskDescription)
+	// RemoveTask removes the task of a deleted pod. An error means the removal has to be retried.
+	RemoveTask(uid uint64) error
+	// CompleteTask tells the backend the task of a pod is completed.
+	CompleteTask(uid uint64)
+	// FailTask tells the backend the task of a pod failed.
+	FailTask(uid uint64)
+	// EvictTask tells the backend the task of a pod was evicted from its node.
+	EvictTask(uid uint64)
+}
+
+// firmamentBackend is the SchedulerBackend submitting the tasks to Firmament.
+type firmamentBackend struct {
+	fc firmament.FirmamentSchedulerClient
+}
+
+// NewFirmamentBackend returns a SchedulerBackend submitting the tasks through the given Firmament client.
+func NewFirmamentBackend(fc firmament.FirmamentSchedulerClient) SchedulerBackend {
+	return &firmamentBackend{fc: fc}
+}
+
+func (b *firmamentBackend) SubmitTask(ctx context.Context, td *firmament.TaskDescription) {
+	firmament.TaskSubmittedContext(ctx, b.fc, td)
+}
+
+func (b *firmamentBackend) UpdateTask(td *firmament.TaskDescription) {
+	if !firmament.TaskUpdated(b.fc, td) {
+		// Firmament lost the task, e.g. it restarted, so submit it afresh instead of dropping the update.
+		glog.Infof("Resubmitting task %d unknown to Firmament", td.TaskDescriptor.Uid)
+		firmament.TaskResubmitted(b.fc, td)
+		notifyFirmamentStateLost()
+	}
+}
+
+func (b *firmamentBackend) RemoveTask(uid uint64) error {
+	return firmament.TaskRemoved(b.fc, &firmament.TaskUID{TaskUid: uid})
+}
+
+// CompleteTask reports the task completed. Firmament not knowing the task means it lost its state,
+// e.g. it restarted, so the other tasks are resubmitted.
+func (b *firmamentBackend) CompleteTask(uid uint64) {
+	if !firmament.TaskCompleted(b.fc, &firmament.TaskUID{TaskUid: uid}) {
+		notifyFirmamentStateLost()
+	}
+}
+
+// FailTask reports the task failed, a task Firmament doesn't know is handled as in CompleteTask.
+func (b *firmamentBackend) FailTask(uid uint64) {
+	if !firmament.TaskFailed(b.fc, &firmament.TaskUID{TaskUid: uid}) {
+		notifyFirmamentStateLost()
+	}
+}
+
+// EvictTask reports the task of an evicted pod as failed: Firmament has no eviction RPC.
+// TODO: report the evictions distinctly once upstream Firmament tells them from the failures.
+func (b *firmamentBackend) EvictTask(uid uint64) {
+	b.FailTask(uid)
+}
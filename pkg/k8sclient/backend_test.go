@@ -0,0 +1,216 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8sclient
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/kubernetes-sigs/poseidon/pkg/firmament"
+	"golang.org/x/net/context"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// fakeBackend records the calls of the pod worker.
+type fakeBackend struct {
+	mu    sync.Mutex
+	calls []string
+	uids  map[uint64]struct{}
+	// called receives the name of each call.
+	called chan string
+}
+
+func newFakeBackend() *fakeBackend {
+	return &fakeBackend{
+		uids:   make(map[uint64]struct{}),
+		called: make(chan string, 10),
+	}
+}
+
+func (b *fakeBackend) record(call string, uid uint64) {
+	b.mu.Lock()
+	b.calls = append(b.calls, call)
+	b.uids[uid] = struct{}{}
+	b.mu.Unlock()
+	b.called <- call
+}
+
+func (b *fakeBackend) SubmitTask(ctx context.Context, td *firmament.TaskDescription) {
+	b.record("SubmitTask", td.TaskDescriptor.Uid)
+}
+
+func (b *fakeBackend) UpdateTask(td *firmament.TaskDescription) {
+	b.record("UpdateTask", td.TaskDescriptor.Uid)
+}
+
+func (b *fakeBackend) RemoveTask(uid uint64) error {
+	b.record("RemoveTask", uid)
+	return nil
+}
+
+func (b *fakeBackend) CompleteTask(uid uint64) {
+	b.record("CompleteTask", uid)
+}
+
+func (b *fakeBackend) FailTask(uid uint64) {
+	b.record("FailTask", uid)
+}
+
+func (b *fakeBackend) EvictTask(uid uint64) {
+	b.record("EvictTask", uid)
+}
+
+func TestPodWatcher_SchedulerBackend(t *testing.T) {
+	var empty map[string]string
+	fakeNow := metav1.Now()
+	pod := BuildPod("Poseidon-Namespace", "Pod1", empty, GetPodPhase("Pending"), "1", "1024", &fakeNow, "abcdfe12345")
+	relabeledPod := pod.DeepCopy()
+	relabeledPod.Labels = map[string]string{"app": "backend"}
+	failedPod := relabeledPod.DeepCopy()
+	failedPod.Status.Phase = v1.PodFailed
+
+	testObj := initializePodObj(t)
+	defer testObj.mockCtrl.Finish()
+	podWatch := NewPodWatcher(testObj.kubeVerMajor, testObj.kubeVerMinor, testObj.schedulerName, testObj.kubeClient, testObj.firmamentClient)
+	backend := newFakeBackend()
+	podWatch.backend = backend
+	go podWatch.podWorker()
+	defer podWatch.podWorkQueue.ShutDown()
+
+	key := GetKey(pod, t)
+	steps := []struct {
+		enqueue  func()
+		expected string
+	}{
+		{func() { podWatch.enqueuePodAddition(key, pod) }, "SubmitTask"},
+		{func() { podWatch.enqueuePodUpdate(key, pod, relabeledPod) }, "UpdateTask"},
+		{func() { podWatch.enqueuePodUpdate(key, relabeledPod, failedPod) }, "FailTask"},
+		{func() { podWatch.enqueuePodDeletion(key, failedPod) }, "RemoveTask"},
+	}
+	var expectedCalls []string
+	for _, step := range steps {
+		step.enqueue()
+		select {
+		case call := <-backend.called:
+			if call != step.expected {
+				t.Errorf("expected the worker to call %s, got %s", step.expected, call)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for the worker to call %s", step.expected)
+		}
+		expectedCalls = append(expectedCalls, step.expected)
+	}
+
+	backend.mu.Lock()
+	defer backend.mu.Unlock()
+	if !reflect.DeepEqual(backend.calls, expectedCalls) {
+		t.Errorf("expected the calls %v, got %v", expectedCalls, backend.calls)
+	}
+	if len(backend.uids) != 1 {
+		t.Errorf("expected all the calls to be about the task of the pod, got the tasks %v", backend.uids)
+	}
+}
+
+// TestPodWatcher_RecordAndReplay records the Firmament RPCs the pod worker issues for the life of a
+// pod, and checks replaying the recording against a mock Firmament issues the same RPCs in order.
+func TestPodWatcher_RecordAndReplay(t *testing.T) {
+	var empty map[string]string
+	fakeNow := metav1.Now()
+	pod := BuildPod("Poseidon-Namespace", "RecordedPod", empty, GetPodPhase("Pending"), "1", "1024", &fakeNow, "abcdfe12345")
+	relabeledPod := pod.DeepCopy()
+	relabeledPod.Labels = map[string]string{"app": "backend"}
+	failedPod := relabeledPod.DeepCopy()
+	failedPod.Status.Phase = v1.PodFailed
+
+	testObj := initializePodObj(t)
+	defer testObj.mockCtrl.Finish()
+	called := make(chan string, 10)
+	testObj.firmamentClient.EXPECT().TaskSubmitted(gomock.Any(), gomock.Any()).Do(func(_, _ interface{}) { called <- "TaskSubmitted" }).
+		Return(&firmament.TaskSubmittedResponse{Type: firmament.TaskReplyType_TASK_SUBMITTED_OK}, nil)
+	testObj.firmamentClient.EXPECT().TaskUpdated(gomock.Any(), gomock.Any()).Do(func(_, _ interface{}) { called <- "TaskUpdated" }).
+		Return(&firmament.TaskUpdatedResponse{Type: firmament.TaskReplyType_TASK_UPDATED_OK}, nil)
+	testObj.firmamentClient.EXPECT().TaskFailed(gomock.Any(), gomock.Any()).Do(func(_, _ interface{}) { called <- "TaskFailed" }).
+		Return(&firmament.TaskFailedResponse{Type: firmament.TaskReplyType_TASK_FAILED_OK}, nil)
+	testObj.firmamentClient.EXPECT().TaskRemoved(gomock.Any(), gomock.Any()).Do(func(_, _ interface{}) { called <- "TaskRemoved" }).
+		Return(&firmament.TaskRemovedResponse{Type: firmament.TaskReplyType_TASK_REMOVED_OK}, nil)
+	var session bytes.Buffer
+	fc := firmament.NewRecorder(&session).Wrap(testObj.firmamentClient)
+	podWatch := NewPodWatcher(testObj.kubeVerMajor, testObj.kubeVerMinor, testObj.schedulerName, testObj.kubeClient, fc)
+	go podWatch.podWorker()
+	defer podWatch.podWorkQueue.ShutDown()
+
+	key := GetKey(pod, t)
+	steps := []struct {
+		enqueue  func()
+		expected string
+	}{
+		{func() { podWatch.enqueuePodAddition(key, pod) }, "TaskSubmitted"},
+		{func() { podWatch.enqueuePodUpdate(key, pod, relabeledPod) }, "TaskUpdated"},
+		{func() { podWatch.enqueuePodUpdate(key, relabeledPod, failedPod) }, "TaskFailed"},
+		{func() { podWatch.enqueuePodDeletion(key, failedPod) }, "TaskRemoved"},
+	}
+	for _, step := range steps {
+		step.enqueue()
+		select {
+		case call := <-called:
+			if call != step.expected {
+				t.Fatalf("expected the worker to call %s, got %s", step.expected, call)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for the worker to call %s", step.expected)
+		}
+	}
+
+	// The replay is recorded too, so that its RPCs can be compared with the recorded ones.
+	replayCtrl := gomock.NewController(t)
+	defer replayCtrl.Finish()
+	replayClient := firmament.NewMockFirmamentSchedulerClient(replayCtrl)
+	gomock.InOrder(
+		replayClient.EXPECT().TaskSubmitted(gomock.Any(), gomock.Any()).Return(&firmament.TaskSubmittedResponse{}, nil),
+		replayClient.EXPECT().TaskUpdated(gomock.Any(), gomock.Any()).Return(&firmament.TaskUpdatedResponse{}, nil),
+		replayClient.EXPECT().TaskFailed(gomock.Any(), gomock.Any()).Return(&firmament.TaskFailedResponse{}, nil),
+		replayClient.EXPECT().TaskRemoved(gomock.Any(), gomock.Any()).Return(&firmament.TaskRemovedResponse{}, nil),
+	)
+	var replayedSession bytes.Buffer
+	replayed, err := firmament.Replay(bytes.NewReader(session.Bytes()), firmament.NewRecorder(&replayedSession).Wrap(replayClient))
+	if err != nil {
+		t.Fatalf("replay failed: %v", err)
+	}
+	if replayed != len(steps) {
+		t.Errorf("expected %d replayed RPCs, got %d", len(steps), replayed)
+	}
+	rpcs := func(session *bytes.Buffer) []string {
+		var rpcs []string
+		decoder := json.NewDecoder(bytes.NewReader(session.Bytes()))
+		for {
+			var record firmament.RPCRecord
+			if err := decoder.Decode(&record); err != nil {
+				return rpcs
+			}
+			rpcs = append(rpcs, record.Method+" "+record.Request)
+		}
+	}
+	if recorded, replayedRPCs := rpcs(&session), rpcs(&replayedSession); !reflect.DeepEqual(recorded, replayedRPCs) {
+		t.Errorf("expected the replay to issue the recorded RPCs %v, got %v", recorded, replayedRPCs)
+	}
+}
@@ -0,0 +1,94 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8sclient
+
+import (
+	"fmt"
+
+	"github.com/golang/glog"
+	"github.com/kubernetes-sigs/poseidon/pkg/firmament"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// The pod annotations holding the bandwidth limits enforced by the bandwidth CNI plugin, in bits per
+// second, e.g. "10M".
+const (
+	IngressBandwidthAnnotation = "kubernetes.io/ingress-bandwidth"
+	EgressBandwidthAnnotation  = "kubernetes.io/egress-bandwidth"
+)
+
+// BandwidthRequest is the network bandwidth requested by a pod, in bits per second. 0 means the pod
+// requests no bandwidth in that direction.
+type BandwidthRequest struct {
+	Ingress int64 `json:"ingress,omitempty"`
+	Egress  int64 `json:"egress,omitempty"`
+}
+
+// parseBandwidth parses a bandwidth annotation, which has to be a positive quantity.
+func parseBandwidth(value string) (int64, error) {
+	quantity, err := resource.ParseQuantity(value)
+	if err != nil {
+		return 0, err
+	}
+	if quantity.Sign() <= 0 {
+		return 0, fmt.Errorf("bandwidth %s isn't positive", value)
+	}
+	return quantity.Value(), nil
+}
+
+// getBandwidthRequest returns the bandwidth requested by the annotations of the pod, nil if it has
+// none. An invalid annotation is ignored.
+func getBandwidthRequest(pod *v1.Pod) *BandwidthRequest {
+	request := &BandwidthRequest{}
+	for annotation, bandwidth := range map[string]*int64{
+		IngressBandwidthAnnotation: &request.Ingress,
+		EgressBandwidthAnnotation:  &request.Egress,
+	} {
+		value, ok := pod.Annotations[annotation]
+		if !ok {
+			continue
+		}
+		parsed, err := parseBandwidth(value)
+		if err != nil {
+			glog.Errorf("Ignoring the invalid %s annotation of pod %s/%s: %v", annotation, pod.Namespace, pod.Name, err)
+			continue
+		}
+		*bandwidth = parsed
+	}
+	if request.Ingress == 0 && request.Egress == 0 {
+		return nil
+	}
+	return request
+}
+
+// bandwidthToKb converts a bandwidth in bits per second to the KB per second Firmament expects.
+func bandwidthToKb(bandwidth int64) uint64 {
+	return uint64(bandwidth / 8 / bytesToKb)
+}
+
+// setTaskBandwidthRequest forwards the bandwidth requested by the pod: the ingress bandwidth is
+// received by the pod, the egress bandwidth transmitted.
+func setTaskBandwidthRequest(td *firmament.TaskDescriptor, pod *Pod) {
+	td.ResourceRequest.NetRxBw = 0
+	td.ResourceRequest.NetTxBw = 0
+	if pod.BandwidthRequest == nil {
+		return
+	}
+	td.ResourceRequest.NetRxBw = bandwidthToKb(pod.BandwidthRequest.Ingress)
+	td.ResourceRequest.NetTxBw = bandwidthToKb(pod.BandwidthRequest.Egress)
+}
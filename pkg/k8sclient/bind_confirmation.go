@@ -0,0 +1,115 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8sclient
+
+import (
+	"sync"
+	"time"
+
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+var (
+	bindConfirmationLock sync.Mutex
+	// bindConfirmationTimeout is the time a bind waits for the pod to be observed with its node name,
+	// 0 if the pod is deemed bound as soon as the bind request succeeds.
+	bindConfirmationTimeout time.Duration
+	// pendingBindConfirmations holds, for the pods being bound, the channels closed once the pods are
+	// observed with their node name.
+	pendingBindConfirmations = make(map[PodIdentifier]chan struct{})
+)
+
+// requeueBind sends a bind again to the bind workers. They consume the channel, so the bind is sent
+// asynchronously.
+var requeueBind = func(bindInfo BindInfo) {
+	go func() {
+		BindChannel <- bindInfo
+	}()
+}
+
+// SetBindConfirmationTimeout sets the time a bind waits for the pod to be observed bound before it's
+// retried, 0 doesn't wait.
+func SetBindConfirmationTimeout(timeout time.Duration) {
+	bindConfirmationLock.Lock()
+	defer bindConfirmationLock.Unlock()
+	bindConfirmationTimeout = timeout
+}
+
+// getBindConfirmationTimeout returns the time a bind waits for the pod to be observed bound.
+func getBindConfirmationTimeout() time.Duration {
+	bindConfirmationLock.Lock()
+	defer bindConfirmationLock.Unlock()
+	return bindConfirmationTimeout
+}
+
+// expectBindConfirmation registers a pod about to be bound, the returned channel is closed once the
+// pod is observed with its node name. It's registered before the bind request is sent so that a
+// watch event arriving before the request returns isn't missed.
+func expectBindConfirmation(identifier PodIdentifier) <-chan struct{} {
+	bindConfirmationLock.Lock()
+	defer bindConfirmationLock.Unlock()
+	confirmed, ok := pendingBindConfirmations[identifier]
+	if !ok {
+		confirmed = make(chan struct{})
+		pendingBindConfirmations[identifier] = confirmed
+	}
+	return confirmed
+}
+
+// forgetBindConfirmation stops waiting for the confirmation of the bind of a pod.
+func forgetBindConfirmation(identifier PodIdentifier) {
+	bindConfirmationLock.Lock()
+	defer bindConfirmationLock.Unlock()
+	delete(pendingBindConfirmations, identifier)
+}
+
+// confirmBind confirms the pending bind of a pod observed with its node name.
+func confirmBind(pod *v1.Pod) {
+	if pod.Spec.NodeName == "" {
+		return
+	}
+	identifier := NewPodIdentifier(pod.Namespace, pod.Name)
+	bindConfirmationLock.Lock()
+	defer bindConfirmationLock.Unlock()
+	if confirmed, ok := pendingBindConfirmations[identifier]; ok {
+		close(confirmed)
+		delete(pendingBindConfirmations, identifier)
+	}
+}
+
+// awaitBindConfirmation returns true if the pod is observed bound within the timeout.
+func awaitBindConfirmation(identifier PodIdentifier, confirmed <-chan struct{}, timeout time.Duration) bool {
+	select {
+	case <-confirmed:
+		return true
+	case <-time.After(timeout):
+		forgetBindConfirmation(identifier)
+		return false
+	}
+}
+
+// getBoundNode returns the node a pod is bound to, read from the API server rather than the informer
+// cache, which may not have observed the bind yet.
+func getBoundNode(client kubernetes.Interface, namespace, name string) (string, error) {
+	pod, err := client.CoreV1().Pods(namespace).Get(name, metav1.GetOptions{})
+	if err != nil {
+		return "", err
+	}
+	return pod.Spec.NodeName, nil
+}
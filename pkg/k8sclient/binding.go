@@ -0,0 +1,29 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8sclient
+
+import (
+	"k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// bindPod binds a pod to a node by creating a pods/binding subresource, as the default scheduler does.
+// The pods can't be bound by patching their spec.nodeName instead: the API server rejects the pod
+// updates changing it.
+func bindPod(client kubernetes.Interface, namespace string, binding *v1.Binding) error {
+	return createBinding(client, namespace, binding)
+}
@@ -0,0 +1,197 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8sclient
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+	core "k8s.io/client-go/testing"
+)
+
+// newBindingClient returns a fake clientset holding an unbound pod. The bindings are accepted, unless
+// rejectBindings is set, in which case the API server behaves as if it didn't serve the subresource.
+func newBindingClient(rejectBindings bool) *fake.Clientset {
+	client := fake.NewSimpleClientset(&v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "Pod1", Namespace: "Poseidon-Namespace"},
+	})
+	client.PrependReactor("create", "pods", func(action core.Action) (bool, runtime.Object, error) {
+		if action.GetSubresource() != "bindings" {
+			return false, nil, nil
+		}
+		if rejectBindings {
+			return true, nil, errors.NewMethodNotSupported(schema.GroupResource{Resource: "pods/binding"}, "create")
+		}
+		return true, nil, nil
+	})
+	return client
+}
+
+// bindingVerbs returns the verbs of the requests writing the pods issued through the fake clientset.
+func bindingVerbs(client *fake.Clientset) []string {
+	var verbs []string
+	for _, action := range client.Actions() {
+		if action.GetResource().Resource != "pods" {
+			continue
+		}
+		switch {
+		case action.GetVerb() == "create" && action.GetSubresource() == "bindings":
+			verbs = append(verbs, "bind")
+		case action.GetVerb() == "patch", action.GetVerb() == "update":
+			verbs = append(verbs, action.GetVerb())
+		}
+	}
+	return verbs
+}
+
+// TestBindPod checks the pods are bound through the binding subresource, and that a rejected binding
+// fails rather than falling back to updating the node of the pod, which the API server rejects too.
+func TestBindPod(t *testing.T) {
+	binding := &v1.Binding{
+		ObjectMeta: metav1.ObjectMeta{Name: "Pod1"},
+		Target:     v1.ObjectReference{Namespace: "Poseidon-Namespace", Name: "Node1"},
+	}
+	client := newBindingClient(false)
+	if err := bindPod(client, "Poseidon-Namespace", binding); err != nil {
+		t.Fatalf("failed to bind the pod: %v", err)
+	}
+	if verbs := bindingVerbs(client); len(verbs) != 1 || verbs[0] != "bind" {
+		t.Errorf("expected a single binding, got the requests %v", verbs)
+	}
+
+	client = newBindingClient(true)
+	if err := bindPod(client, "Poseidon-Namespace", binding); !errors.IsMethodNotSupported(err) {
+		t.Errorf("expected the rejected binding to fail, got %v", err)
+	}
+	if verbs := bindingVerbs(client); len(verbs) != 1 || verbs[0] != "bind" {
+		t.Errorf("expected only the binding to be issued, got the requests %v", verbs)
+	}
+}
+
+// TestProcessBind_Confirmation checks a bind waiting for its confirmation places the pod once it's
+// observed bound, and is requeued if it isn't within the timeout.
+func TestProcessBind_Confirmation(t *testing.T) {
+	testObj := initializePodObj(t)
+	defer testObj.mockCtrl.Finish()
+	podWatch := NewPodWatcher(testObj.kubeVerMajor, testObj.kubeVerMinor, testObj.schedulerName, testObj.kubeClient, testObj.firmamentClient)
+	ClientSet = newBindingClient(false)
+	SetBindConfirmationTimeout(100 * time.Millisecond)
+	requeued := make(chan BindInfo, 1)
+	defaultRequeueBind := requeueBind
+	requeueBind = func(bindInfo BindInfo) {
+		requeued <- bindInfo
+	}
+	defer func() {
+		ClientSet = nil
+		SetBindConfirmationTimeout(0)
+		requeueBind = defaultRequeueBind
+	}()
+	bindInfo := BindInfo{Name: "Pod1", Namespace: "Poseidon-Namespace", Nodename: "Node1"}
+	identifier := PodIdentifier{Name: "Pod1", Namespace: "Poseidon-Namespace"}
+
+	// The bind never confirms: the pod isn't placed and the bind is requeued.
+	processBind(bindInfo)
+	select {
+	case requeuedBind := <-requeued:
+		if requeuedBind != bindInfo {
+			t.Errorf("expected the bind %v to be requeued, got %v", bindInfo, requeuedBind)
+		}
+	default:
+		t.Fatalf("expected the unconfirmed bind to be requeued")
+	}
+	if assignments := podWatch.Assignments(); len(assignments) != 0 {
+		t.Fatalf("expected the pod not to be placed before its bind is confirmed, got %v", assignments)
+	}
+
+	// The pod is observed bound while the bind waits: the pod is placed.
+	boundPod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "Pod1", Namespace: "Poseidon-Namespace"},
+		Spec:       v1.PodSpec{NodeName: "Node1"},
+	}
+	go func() {
+		for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+			bindConfirmationLock.Lock()
+			_, pending := pendingBindConfirmations[identifier]
+			bindConfirmationLock.Unlock()
+			if pending {
+				confirmBind(boundPod)
+				return
+			}
+		}
+	}()
+	SetBindConfirmationTimeout(5 * time.Second)
+	processBind(bindInfo)
+	select {
+	case requeuedBind := <-requeued:
+		t.Fatalf("expected the confirmed bind not to be requeued, got %v", requeuedBind)
+	default:
+	}
+	if node := podWatch.Assignments()[identifier]; node != "Node1" {
+		t.Errorf("expected the pod to be placed on Node1 once its bind is confirmed, got %q", node)
+	}
+}
+
+// TestProcessBind_AlreadyBound checks a requeued bind rejected because its first attempt bound the pod
+// places the pod on its node, so that the in-flight slot of its owner is released.
+func TestProcessBind_AlreadyBound(t *testing.T) {
+	testObj := initializePodObj(t)
+	defer testObj.mockCtrl.Finish()
+	podWatch := NewPodWatcher(testObj.kubeVerMajor, testObj.kubeVerMinor, testObj.schedulerName, testObj.kubeClient, testObj.firmamentClient)
+	client := fake.NewSimpleClientset(&v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "BoundPod", Namespace: "Poseidon-Namespace"},
+		Spec:       v1.PodSpec{NodeName: "Node1"},
+	})
+	client.PrependReactor("create", "pods", func(action core.Action) (bool, runtime.Object, error) {
+		if action.GetSubresource() != "bindings" {
+			return false, nil, nil
+		}
+		return true, nil, errors.NewConflict(schema.GroupResource{Resource: "pods/binding"}, "BoundPod",
+			fmt.Errorf("pod BoundPod is already assigned to node %q", "Node1"))
+	})
+	ClientSet = client
+	SetBindConfirmationTimeout(5 * time.Second)
+	placed := make(chan PodIdentifier, 1)
+	setPodPlacedHandler(func(identifier PodIdentifier) {
+		placed <- identifier
+	})
+	defer func() {
+		ClientSet = nil
+		SetBindConfirmationTimeout(0)
+		setPodPlacedHandler(nil)
+	}()
+	identifier := PodIdentifier{Name: "BoundPod", Namespace: "Poseidon-Namespace"}
+
+	processBind(BindInfo{Name: "BoundPod", Namespace: "Poseidon-Namespace", Nodename: "Node1"})
+	select {
+	case placedPod := <-placed:
+		if placedPod != identifier {
+			t.Errorf("expected the pod %v to be placed, got %v", identifier, placedPod)
+		}
+	default:
+		t.Fatalf("expected the already bound pod to be placed")
+	}
+	if node := podWatch.Assignments()[identifier]; node != "Node1" {
+		t.Errorf("expected the pod to be placed on Node1, got %q", node)
+	}
+}
@@ -0,0 +1,57 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8sclient
+
+import (
+	"sync"
+)
+
+var (
+	clusterIDLock sync.RWMutex
+	// clusterID identifies the cluster of the pods when several clusters share Firmament, it's empty
+	// if Firmament serves this cluster only.
+	clusterID string
+)
+
+// SetClusterID sets the cluster the pods are identified with. It's part of the IDs of the jobs, the
+// tasks and the node resources, so that the same pod or node of two clusters is a different task or
+// resource of a shared Firmament. It has to be set before the watchers are started.
+func SetClusterID(id string) {
+	clusterIDLock.Lock()
+	defer clusterIDLock.Unlock()
+	clusterID = id
+}
+
+// getClusterID returns the cluster the pods are identified with, empty if none.
+func getClusterID() string {
+	clusterIDLock.RLock()
+	defer clusterIDLock.RUnlock()
+	return clusterID
+}
+
+// NewPodIdentifier returns the identifier of a pod of this cluster.
+func NewPodIdentifier(namespace, name string) PodIdentifier {
+	return PodIdentifier{Name: name, Namespace: namespace, ClusterID: getClusterID()}
+}
+
+// withClusterID prefixes the seed of a job, task or resource ID with the cluster ID, if any.
+func withClusterID(seed string) string {
+	if id := getClusterID(); id != "" {
+		return id + "/" + seed
+	}
+	return seed
+}
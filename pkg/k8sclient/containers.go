@@ -0,0 +1,76 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8sclient
+
+import (
+	"encoding/json"
+
+	"k8s.io/api/core/v1"
+)
+
+// ContainerResourcesLabel is the task label telling Firmament the requests and limits of each
+// container of the pod, as a JSON list, for a bin-packing finer than the pod-level requests. The
+// Firmament task descriptor has no containers, so they're forwarded as a label.
+const ContainerResourcesLabel = "poseidon.kubernetes.io/container-resources"
+
+// ContainerResources holds the requests and limits of a container of a pod. The cpu is in millicores
+// and the memory in the unit of the memory requests.
+type ContainerResources struct {
+	Name string `json:"name"`
+	// Init is true for an init container, which runs before the app containers.
+	Init           bool  `json:"init,omitempty"`
+	CPURequest     int64 `json:"cpuRequest,omitempty"`
+	MemRequestKb   int64 `json:"memRequestKb,omitempty"`
+	EphemeralReqKb int64 `json:"ephemeralReqKb,omitempty"`
+	CPULimit       int64 `json:"cpuLimit,omitempty"`
+	MemLimitKb     int64 `json:"memLimitKb,omitempty"`
+}
+
+// getContainerResources returns the requests and limits of the init and app containers of the pod,
+// in the order of the pod spec.
+func getContainerResources(pod *v1.Pod) []ContainerResources {
+	var containers []ContainerResources
+	for _, container := range pod.Spec.InitContainers {
+		containers = append(containers, newContainerResources(&container, true))
+	}
+	for _, container := range pod.Spec.Containers {
+		containers = append(containers, newContainerResources(&container, false))
+	}
+	return containers
+}
+
+func newContainerResources(container *v1.Container, init bool) ContainerResources {
+	cpuReq, memReq, ephemeralReq := getContainerRequest(container)
+	cpuLimit := container.Resources.Limits[v1.ResourceCPU]
+	memLimit := container.Resources.Limits[v1.ResourceMemory]
+	return ContainerResources{
+		Name:           container.Name,
+		Init:           init,
+		CPURequest:     cpuReq,
+		MemRequestKb:   memoryUnit.FromBytes(memReq),
+		EphemeralReqKb: ephemeralReq / bytesToKb,
+		CPULimit:       cpuLimit.MilliValue(),
+		MemLimitKb:     memoryUnit.FromBytes(memLimit.Value()),
+	}
+}
+
+// containerResourcesLabelValue encodes the container resources of a pod as the value of the
+// ContainerResourcesLabel.
+func containerResourcesLabelValue(containers []ContainerResources) string {
+	value, _ := json.Marshal(containers)
+	return string(value)
+}
@@ -0,0 +1,118 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8sclient
+
+import (
+	"sync"
+
+	"github.com/golang/glog"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// ControllerUIDLabel is the task label holding the UID of the top-level controller of the pod, so
+// that Firmament can associate the pods of the successive ReplicaSets of a Deployment.
+const ControllerUIDLabel = "poseidon.kubernetes.io/controller-uid"
+
+// ControllerRef identifies the top-level controller of a pod.
+type ControllerRef struct {
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+	UID  string `json:"uid"`
+}
+
+// controllerRefCache maps the UIDs of the intermediate controllers, e.g. the ReplicaSets, to the
+// top-level controller they resolve to, so that the owner chain isn't fetched for every pod.
+type controllerRefCache struct {
+	sync.Mutex
+	refs map[types.UID]*ControllerRef
+}
+
+func (c *controllerRefCache) get(uid types.UID) (*ControllerRef, bool) {
+	c.Lock()
+	defer c.Unlock()
+	ref, ok := c.refs[uid]
+	return ref, ok
+}
+
+func (c *controllerRefCache) set(uid types.UID, ref *ControllerRef) {
+	c.Lock()
+	defer c.Unlock()
+	if c.refs == nil {
+		c.refs = make(map[types.UID]*ControllerRef)
+	}
+	c.refs[uid] = ref
+}
+
+func toControllerRef(ownerRef *metav1.OwnerReference) *ControllerRef {
+	return &ControllerRef{
+		Kind: ownerRef.Kind,
+		Name: ownerRef.Name,
+		UID:  string(ownerRef.UID),
+	}
+}
+
+// getOwnerController returns the controller of the given owner of the pod, nil if the owner has
+// none. It returns false if the owner isn't known, e.g. the informer cache hasn't observed it yet.
+func (pw *PodWatcher) getOwnerController(namespace string, ownerRef *metav1.OwnerReference) (*metav1.OwnerReference, bool) {
+	switch ownerRef.Kind {
+	case "ReplicaSet", "Job":
+	default:
+		return nil, true
+	}
+	owner := pw.owners.getOwner(ownerRef.Kind, namespace, ownerRef.Name)
+	if owner == nil {
+		glog.V(2).Infof("The %s %s/%s owning a pod isn't known", ownerRef.Kind, namespace, ownerRef.Name)
+		return nil, false
+	}
+	if owner.GetUID() != ownerRef.UID {
+		// The owner was replaced by a namesake since the pod was created.
+		return nil, true
+	}
+	return metav1.GetControllerOf(owner), true
+}
+
+// resolveControllerRef returns the top-level controller of the pod, following the owner chain
+// through the ReplicaSets and Jobs, e.g. to the Deployment of the pod. It returns nil if the pod
+// has no controller. The owners are read from the informer cache, and the chains going through an
+// owner it doesn't know yet aren't cached, so that they're resolved again once it's observed.
+func (pw *PodWatcher) resolveControllerRef(pod *v1.Pod) *ControllerRef {
+	ownerRef := metav1.GetControllerOf(pod)
+	if ownerRef == nil {
+		return nil
+	}
+	if ref, ok := pw.controllerRefs.get(ownerRef.UID); ok {
+		return ref
+	}
+	ref := toControllerRef(ownerRef)
+	parentRef := ownerRef
+	resolved := true
+	// A Deployment or a CronJob is at most two levels above the pod, the depth bounds the lookups
+	// should the owner references form a cycle.
+	for depth := 0; depth < 2; depth++ {
+		parentRef, resolved = pw.getOwnerController(pod.Namespace, parentRef)
+		if parentRef == nil {
+			break
+		}
+		ref = toControllerRef(parentRef)
+	}
+	if resolved {
+		pw.controllerRefs.set(ownerRef.UID, ref)
+	}
+	return ref
+}
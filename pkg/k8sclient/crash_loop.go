@@ -0,0 +1,108 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8sclient
+
+import (
+	"time"
+
+	"github.com/golang/glog"
+	"k8s.io/api/core/v1"
+)
+
+// crashLoopBackOffReason is the waiting reason of the containers the kubelet backs off restarting.
+const crashLoopBackOffReason = "CrashLoopBackOff"
+
+// isCrashLooping returns true if one of the containers of the pod is in CrashLoopBackOff.
+func isCrashLooping(pod *v1.Pod) bool {
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.State.Waiting != nil && status.State.Waiting.Reason == crashLoopBackOffReason {
+			return true
+		}
+	}
+	return false
+}
+
+// crashLoopUpdate is the last update of a crash-looping pod, and the latest update throttled since.
+type crashLoopUpdate struct {
+	sent time.Time
+	// pending is the latest update received within the interval, sent once it expires.
+	pending *Pod
+	timer   *time.Timer
+}
+
+// throttleCrashLoopUpdate returns true if the update of a crash-looping pod is held, since one was
+// sent less than crashLoopUpdateInterval ago. Such a pod churns an update at each restart: the updates
+// held within the interval are coalesced, and only the latest one is sent once the interval expires.
+// The updates of the other pods aren't throttled.
+func (pw *PodWatcher) throttleCrashLoopUpdate(pod *Pod, k8sPod *v1.Pod, now time.Time) bool {
+	if pw.crashLoopUpdateInterval <= 0 {
+		return false
+	}
+	pw.crashLoopUpdatesMux.Lock()
+	defer pw.crashLoopUpdatesMux.Unlock()
+	last, ok := pw.crashLoopUpdates[pod.Identifier]
+	if !isCrashLooping(k8sPod) {
+		// This update supersedes the one held, if any.
+		if ok && last.timer != nil {
+			last.timer.Stop()
+		}
+		delete(pw.crashLoopUpdates, pod.Identifier)
+		return false
+	}
+	if pw.crashLoopUpdates == nil {
+		pw.crashLoopUpdates = make(map[PodIdentifier]*crashLoopUpdate)
+	}
+	if !ok || now.Sub(last.sent) >= pw.crashLoopUpdateInterval {
+		if ok && last.timer != nil {
+			last.timer.Stop()
+		}
+		pw.crashLoopUpdates[pod.Identifier] = &crashLoopUpdate{sent: now}
+		return false
+	}
+	last.pending = pod
+	if last.timer == nil {
+		last.timer = time.AfterFunc(last.sent.Add(pw.crashLoopUpdateInterval).Sub(now), func() {
+			pw.sendCrashLoopUpdate(pod.Identifier, last)
+		})
+	}
+	return true
+}
+
+// sendCrashLoopUpdate enqueues the latest update held for a crash-looping pod once the interval expired,
+// unless the pod was updated or deleted since.
+func (pw *PodWatcher) sendCrashLoopUpdate(identifier PodIdentifier, update *crashLoopUpdate) {
+	pw.crashLoopUpdatesMux.Lock()
+	if pw.crashLoopUpdates[identifier] != update || update.pending == nil {
+		pw.crashLoopUpdatesMux.Unlock()
+		return
+	}
+	pod := update.pending
+	update.sent, update.pending, update.timer = time.Now(), nil, nil
+	pw.crashLoopUpdatesMux.Unlock()
+	pw.podWorkQueue.Add(identifier.UniqueName(), pod)
+	glog.V(2).Info("sendCrashLoopUpdate: Sent the latest update of crash-looping pod ", identifier)
+}
+
+// forgetCrashLoop forgets the last update of a deleted pod, and drops the update held, if any.
+func (pw *PodWatcher) forgetCrashLoop(identifier PodIdentifier) {
+	pw.crashLoopUpdatesMux.Lock()
+	defer pw.crashLoopUpdatesMux.Unlock()
+	if last, ok := pw.crashLoopUpdates[identifier]; ok && last.timer != nil {
+		last.timer.Stop()
+	}
+	delete(pw.crashLoopUpdates, identifier)
+}
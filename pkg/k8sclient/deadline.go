@@ -0,0 +1,124 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8sclient
+
+import (
+	"time"
+
+	"github.com/golang/glog"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ScheduleDeadlineAnnotation is the pod annotation holding the RFC3339 time by which the pod has to
+// be placed. Past it, Poseidon abandons the pod: it's removed from Firmament and no longer requeued.
+const ScheduleDeadlineAnnotation = "poseidon.kubernetes.io/schedule-deadline"
+
+// scheduleDeadlineCheckInterval is the time between two checks of the deadlines of the pods.
+const scheduleDeadlineCheckInterval = time.Second
+
+// abandonedPods holds the pods abandoned because they weren't placed by their deadline.
+var abandonedPods map[PodIdentifier]struct{}
+
+// parseScheduleDeadline returns the scheduling deadline of the pod, the zero time if it has none.
+func parseScheduleDeadline(pod *v1.Pod) (metav1.Time, error) {
+	value, ok := pod.Annotations[ScheduleDeadlineAnnotation]
+	if !ok {
+		return metav1.Time{}, nil
+	}
+	deadline, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return metav1.Time{}, err
+	}
+	return metav1.NewTime(deadline), nil
+}
+
+// getScheduleDeadline returns the scheduling deadline of the pod, an invalid deadline is ignored.
+func getScheduleDeadline(pod *v1.Pod) metav1.Time {
+	deadline, err := parseScheduleDeadline(pod)
+	if err != nil {
+		glog.Errorf("Ignoring the invalid %s annotation of pod %s/%s: %v", ScheduleDeadlineAnnotation, pod.Namespace, pod.Name, err)
+	}
+	return deadline
+}
+
+// deadlineExceeded returns true if the pod has a scheduling deadline and it has passed.
+func deadlineExceeded(deadline metav1.Time, now time.Time) bool {
+	return !deadline.IsZero() && now.After(deadline.Time)
+}
+
+// abandonPod gives up on a pod which wasn't placed by its deadline. A failure event is sent and the
+// pod is removed from Firmament, if it was submitted.
+func (pw *PodWatcher) abandonPod(pod *Pod) {
+	PodMux.Lock()
+	if _, ok := abandonedPods[pod.Identifier]; ok {
+		PodMux.Unlock()
+		return
+	}
+	abandonedPods[pod.Identifier] = struct{}{}
+	PodMux.Unlock()
+	glog.Infof("Abandoning pod %v which wasn't scheduled by its deadline %v", pod.Identifier, pod.ScheduleDeadline)
+	if pw.clientset != nil {
+		NewPoseidonEvents(pw.clientset).ProcessDeadlineExceededEvent(pod)
+	}
+	pw.podWorkQueue.Add(pod.Identifier.UniqueName(), &Pod{
+		Identifier: pod.Identifier,
+		State:      PodDeleted,
+		OwnerRef:   pod.OwnerRef,
+	})
+}
+
+// isAbandoned returns true if the pod was abandoned because of its deadline.
+func isAbandoned(identifier PodIdentifier) bool {
+	PodMux.RLock()
+	defer PodMux.RUnlock()
+	_, ok := abandonedPods[identifier]
+	return ok
+}
+
+// abandonExpiredPods abandons the pending pods which haven't been placed by their deadline.
+func (pw *PodWatcher) abandonExpiredPods() {
+	now := time.Now()
+	var expiredPods []*Pod
+	PodMux.RLock()
+	PodToK8sPodLock.Lock()
+	for identifier, k8sPod := range PodToK8sPod {
+		if k8sPod.Status.Phase != v1.PodPending {
+			continue
+		}
+		if _, ok := podToNode[identifier]; ok {
+			continue
+		}
+		if _, ok := abandonedPods[identifier]; ok {
+			continue
+		}
+		deadline, err := parseScheduleDeadline(k8sPod)
+		if err != nil || !deadlineExceeded(deadline, now) {
+			continue
+		}
+		expiredPods = append(expiredPods, &Pod{
+			Identifier:       identifier,
+			OwnerRef:         GetOwnerReference(k8sPod),
+			ScheduleDeadline: deadline,
+		})
+	}
+	PodToK8sPodLock.Unlock()
+	PodMux.RUnlock()
+	for _, pod := range expiredPods {
+		pw.abandonPod(pod)
+	}
+}
@@ -0,0 +1,98 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8sclient
+
+import (
+	"fmt"
+
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// ResourceParseError is returned when a resource request of a pod can't be converted for Firmament.
+type ResourceParseError struct {
+	PodKey       string
+	ResourceName v1.ResourceName
+	cause        error
+}
+
+func (e *ResourceParseError) Error() string {
+	return fmt.Sprintf("pod %s: unable to convert the %s request: %v", e.PodKey, e.ResourceName, e.cause)
+}
+
+// Cause returns the underlying error.
+func (e *ResourceParseError) Cause() error {
+	return e.cause
+}
+
+// UnsupportedAffinityError is returned when the affinity of a pod can't be expressed in Firmament.
+type UnsupportedAffinityError struct {
+	PodKey string
+	Detail string
+}
+
+func (e *UnsupportedAffinityError) Error() string {
+	return fmt.Sprintf("pod %s: unsupported affinity: %s", e.PodKey, e.Detail)
+}
+
+// InvalidAffinityError is returned when the affinity of a pod is invalid, e.g. a pod affinity term
+// without topology key, and Firmament would place the pod arbitrarily.
+type InvalidAffinityError struct {
+	PodKey string
+	Detail string
+}
+
+func (e *InvalidAffinityError) Error() string {
+	return fmt.Sprintf("pod %s: invalid affinity: %s", e.PodKey, e.Detail)
+}
+
+// RequestTooLargeError is returned when a pod requests more than the configured maximum of a resource.
+type RequestTooLargeError struct {
+	PodKey       string
+	ResourceName v1.ResourceName
+	Request      resource.Quantity
+	Limit        resource.Quantity
+}
+
+func (e *RequestTooLargeError) Error() string {
+	return fmt.Sprintf("pod %s: the %s request %s exceeds the maximum %s", e.PodKey, e.ResourceName, e.Request.String(), e.Limit.String())
+}
+
+// PodMutationError is returned when a registered PodMutator rejects a pod.
+type PodMutationError struct {
+	PodKey string
+	cause  error
+}
+
+func (e *PodMutationError) Error() string {
+	return fmt.Sprintf("pod %s: rejected by a mutator: %v", e.PodKey, e.cause)
+}
+
+// Cause returns the underlying error.
+func (e *PodMutationError) Cause() error {
+	return e.cause
+}
+
+// PodPredicateError is returned when a pod fails the PodPredicate.
+type PodPredicateError struct {
+	PodKey string
+	Reason string
+}
+
+func (e *PodPredicateError) Error() string {
+	return fmt.Sprintf("pod %s: rejected by the predicate: %s", e.PodKey, e.Reason)
+}
@@ -26,6 +26,7 @@ import (
 	"k8s.io/client-go/tools/record"
 	"k8s.io/kubernetes/pkg/api/legacyscheme"
 	"sync"
+	"time"
 )
 
 type PodEvents struct {
@@ -104,6 +105,7 @@ func (posiedonEvents *PoseidonEvents) ProcessFailureEvents(unscheduledTasks []ui
 			glog.Error("Task id to Pod mapping not found ", taskId)
 			continue
 		}
+		notifyPodUnschedulable(podIdentifier)
 
 		ProcessedPodEventsLock.Lock()
 		if _, ok := ProcessedPodEvents[podIdentifier]; !ok {
@@ -113,12 +115,15 @@ func (posiedonEvents *PoseidonEvents) ProcessFailureEvents(unscheduledTasks []ui
 				ProcessedPodEvents[podIdentifier] = poseidonToK8sPod
 				// send the failure event and update the pods status
 				posiedonEvents.podEvents.Recorder.Eventf(poseidonToK8sPod, corev1.EventTypeWarning, "FailedScheduling", "Firmament failed to schedule the pod %s in %s namespace", podIdentifier.Name, podIdentifier.Namespace)
-				Update(posiedonEvents.k8sClient, poseidonToK8sPod, &corev1.PodCondition{
+				err := Update(posiedonEvents.k8sClient, poseidonToK8sPod, &corev1.PodCondition{
 					Type:    corev1.PodScheduled,
 					Status:  corev1.ConditionFalse,
 					Reason:  corev1.PodReasonUnschedulable,
 					Message: "Firmament unable to schedule the pod",
 				})
+				if err != nil {
+					glog.Errorf("Failed to update the scheduled condition of pod %v: %v", podIdentifier, err)
+				}
 			} else {
 				glog.Error("k8s pod mapping for ", podIdentifier, " pod not found ")
 			}
@@ -130,6 +135,64 @@ func (posiedonEvents *PoseidonEvents) ProcessFailureEvents(unscheduledTasks []ui
 	}
 }
 
+// ProcessOversizedPodEvent sends a failure event for a pod which is too large to be placed, for the given reason
+func (posiedonEvents *PoseidonEvents) ProcessOversizedPodEvent(pod *Pod, reason string) {
+	PodToK8sPodLock.Lock()
+	defer PodToK8sPodLock.Unlock()
+	poseidonToK8sPod, ok := PodToK8sPod[pod.Identifier]
+	if !ok {
+		glog.Error("k8s pod mapping for ", pod.Identifier, " pod not found ")
+		return
+	}
+	posiedonEvents.podEvents.Recorder.Eventf(poseidonToK8sPod, corev1.EventTypeWarning, "FailedScheduling", "Pod %s in %s namespace is too large, %s; it's not considered again until it changes", pod.Identifier.Name, pod.Identifier.Namespace, reason)
+	err := Update(posiedonEvents.k8sClient, poseidonToK8sPod, &corev1.PodCondition{
+		Type:    corev1.PodScheduled,
+		Status:  corev1.ConditionFalse,
+		Reason:  corev1.PodReasonUnschedulable,
+		Message: "Pod is too large, " + reason,
+	})
+	if err != nil {
+		glog.Errorf("Failed to update the scheduled condition of pod %v: %v", pod.Identifier, err)
+	}
+}
+
+// ProcessDeadlineExceededEvent sends a failure event for a pod which wasn't placed by its scheduling deadline
+func (posiedonEvents *PoseidonEvents) ProcessDeadlineExceededEvent(pod *Pod) {
+	PodToK8sPodLock.Lock()
+	defer PodToK8sPodLock.Unlock()
+	poseidonToK8sPod, ok := PodToK8sPod[pod.Identifier]
+	if !ok {
+		glog.Error("k8s pod mapping for ", pod.Identifier, " pod not found ")
+		return
+	}
+	posiedonEvents.podEvents.Recorder.Eventf(poseidonToK8sPod, corev1.EventTypeWarning, "FailedScheduling", "Pod %s in %s namespace wasn't scheduled by its deadline %s, Poseidon gave up on it", pod.Identifier.Name, pod.Identifier.Namespace, pod.ScheduleDeadline.Format(time.RFC3339))
+	err := Update(posiedonEvents.k8sClient, poseidonToK8sPod, &corev1.PodCondition{
+		Type:    corev1.PodScheduled,
+		Status:  corev1.ConditionFalse,
+		Reason:  corev1.PodReasonUnschedulable,
+		Message: "Pod wasn't scheduled by its deadline",
+	})
+	if err != nil {
+		glog.Errorf("Failed to update the scheduled condition of pod %v: %v", pod.Identifier, err)
+	}
+}
+
+// ProcessConversionErrorEvent sends a failure event for a pod which can't be converted for Firmament
+func (posiedonEvents *PoseidonEvents) ProcessConversionErrorEvent(pod *corev1.Pod, err error) {
+	reason := "FailedScheduling"
+	switch err.(type) {
+	case *ResourceParseError:
+		reason = "InvalidResourceRequest"
+	case *UnsupportedAffinityError:
+		reason = "UnsupportedAffinity"
+	case *InvalidAffinityError:
+		reason = "InvalidAffinity"
+	case *PodMutationError:
+		reason = "MutationFailed"
+	}
+	posiedonEvents.podEvents.Recorder.Eventf(pod, corev1.EventTypeWarning, reason, "Poseidon can't schedule the pod: %v", err)
+}
+
 // ProcessSuccessEvents send success event to api-server
 func (posiedonEvents *PoseidonEvents) ProcessSuccessEvents(scheduledTasks []*firmament.SchedulingDelta) {
 	//get the pod name from the unscheduled_tasks id
@@ -159,6 +222,7 @@ func (posiedonEvents *PoseidonEvents) ProcessSuccessEvents(scheduledTasks []*fir
 				NodeMux.RUnlock()
 				if ok {
 					posiedonEvents.podEvents.Recorder.Eventf(poseidonToK8sPod, corev1.EventTypeNormal, "Scheduled", "Successfully assigned %v/%v to %v", podIdentifier.Name, podIdentifier.Namespace, nodeName)
+					posiedonEvents.clearUnschedulableCondition(poseidonToK8sPod)
 				} else {
 					glog.Error("Node not found in Node to Resource Id mapping", taskId.GetResourceId())
 				}
@@ -169,3 +233,18 @@ func (posiedonEvents *PoseidonEvents) ProcessSuccessEvents(scheduledTasks []*fir
 		}
 	}
 }
+
+// clearUnschedulableCondition marks a placed pod as scheduled if it was reported as unschedulable before.
+func (posiedonEvents *PoseidonEvents) clearUnschedulableCondition(pod *corev1.Pod) {
+	_, condition := GetPodCondition(&pod.Status, corev1.PodScheduled)
+	if condition == nil || condition.Status != corev1.ConditionFalse {
+		return
+	}
+	err := Update(posiedonEvents.k8sClient, pod, &corev1.PodCondition{
+		Type:   corev1.PodScheduled,
+		Status: corev1.ConditionTrue,
+	})
+	if err != nil {
+		glog.Errorf("Failed to clear the unschedulable condition of pod %s/%s: %v", pod.Namespace, pod.Name, err)
+	}
+}
@@ -0,0 +1,31 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8sclient
+
+import (
+	"k8s.io/api/core/v1"
+)
+
+// podEvictedReason is the status reason the kubelet sets on the pods it evicts.
+const podEvictedReason = "Evicted"
+
+// isEvictedPod returns true if the pod was evicted from its node by the kubelet rather than completed or
+// failed. The taint based evictions of the node controller aren't told from the other deletions: the
+// vendored API has no DisruptionTarget condition.
+func isEvictedPod(pod *v1.Pod) bool {
+	return pod.Status.Reason == podEvictedReason
+}
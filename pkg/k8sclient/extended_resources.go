@@ -0,0 +1,77 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8sclient
+
+import (
+	"sort"
+	"strconv"
+
+	"github.com/kubernetes-sigs/poseidon/pkg/firmament"
+	"k8s.io/api/core/v1"
+	v1helper "k8s.io/kubernetes/pkg/apis/core/v1/helper"
+)
+
+// getExtendedRequests returns the extended resources requested by the pod, e.g. example.com/fpga,
+// aggregated as the cpu and memory requests are. Nil if it requests none.
+func getExtendedRequests(pod *v1.Pod) map[string]int64 {
+	var requests map[string]int64
+	add := func(name v1.ResourceName, value int64, initContainer bool) {
+		if !v1helper.IsExtendedResourceName(name) {
+			return
+		}
+		if requests == nil {
+			requests = make(map[string]int64)
+		}
+		if !initContainer {
+			requests[string(name)] += value
+		} else if value > requests[string(name)] {
+			requests[string(name)] = value
+		}
+	}
+	for _, container := range pod.Spec.Containers {
+		for name, quantity := range container.Resources.Requests {
+			add(name, quantity.Value(), false)
+		}
+	}
+	for _, container := range pod.Spec.InitContainers {
+		for name, quantity := range container.Resources.Requests {
+			add(name, quantity.Value(), true)
+		}
+	}
+	return requests
+}
+
+// getExtendedResourceSelectors returns the label selectors restricting the pod to the nodes whose
+// allocatable amount of each of its extended resources, forwarded with ScalarResourceLabelPrefix,
+// covers its request. Firmament doesn't account for the resources the labels stand for, so it may
+// still place more pods on a node than its extended resources can hold.
+func getExtendedResourceSelectors(pod *Pod) []*firmament.LabelSelector {
+	var names []string
+	for name := range pod.ExtendedRequests {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var selectors []*firmament.LabelSelector
+	for _, name := range names {
+		selectors = append(selectors, &firmament.LabelSelector{
+			Type:   firmament.LabelSelector_GREATER_THAN,
+			Key:    ScalarResourceLabelPrefix + name,
+			Values: []string{strconv.FormatInt(pod.ExtendedRequests[name]-1, 10)},
+		})
+	}
+	return selectors
+}
@@ -0,0 +1,157 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8sclient
+
+import (
+	"encoding/json"
+	"sync"
+
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// DefaultFieldManager is the field manager Poseidon writes as unless configured otherwise.
+const DefaultFieldManager = "poseidon"
+
+// fieldManagerParam is the query parameter naming the field manager of a write request.
+const fieldManagerParam = "fieldManager"
+
+var (
+	fieldManagerLock sync.RWMutex
+	// fieldManager is the field manager Poseidon identifies itself with when it creates bindings and
+	// updates pod statuses, so that conflicting writes are attributable to it.
+	fieldManager = DefaultFieldManager
+)
+
+// SetFieldManager sets the field manager of the write operations, an empty name restores the default.
+func SetFieldManager(name string) {
+	if name == "" {
+		name = DefaultFieldManager
+	}
+	fieldManagerLock.Lock()
+	defer fieldManagerLock.Unlock()
+	fieldManager = name
+}
+
+func getFieldManager() string {
+	fieldManagerLock.RLock()
+	defer fieldManagerLock.RUnlock()
+	return fieldManager
+}
+
+// restClient returns the REST client of the core API group, nil if the client has none, e.g. the fake
+// clientset used by the tests.
+func restClient(client kubernetes.Interface) rest.Interface {
+	rc := client.CoreV1().RESTClient()
+	if c, ok := rc.(*rest.RESTClient); ok && c == nil {
+		return nil
+	}
+	return rc
+}
+
+// createBinding binds a pod to a node through the binding subresource as the configured field manager.
+// The typed client doesn't take write options in this client-go version, so the request is built by
+// hand like the typed client does.
+func createBinding(client kubernetes.Interface, namespace string, binding *v1.Binding) error {
+	rc := restClient(client)
+	if rc == nil {
+		return client.CoreV1().Pods(namespace).Bind(binding)
+	}
+	return rc.Post().
+		Namespace(namespace).
+		Resource("pods").
+		Name(binding.Name).
+		SubResource("binding").
+		Param(fieldManagerParam, getFieldManager()).
+		Body(binding).
+		Do().
+		Error()
+}
+
+// patchPodAnnotations sets annotations of a pod by patching its metadata as the configured field manager.
+func patchPodAnnotations(client kubernetes.Interface, namespace, name string, annotations map[string]string) error {
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": annotations,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	rc := restClient(client)
+	if rc == nil {
+		_, err := client.CoreV1().Pods(namespace).Patch(name, types.StrategicMergePatchType, patch)
+		return err
+	}
+	return rc.Patch(types.StrategicMergePatchType).
+		Namespace(namespace).
+		Resource("pods").
+		Name(name).
+		Param(fieldManagerParam, getFieldManager()).
+		Body(patch).
+		Do().
+		Error()
+}
+
+// patchPodNominatedNode sets the nominated node of a pod by patching its status as the configured field
+// manager. Unlike an update, the patch doesn't conflict with the changes made to the pod since it was
+// last observed.
+func patchPodNominatedNode(client kubernetes.Interface, namespace, name, nodeName string) error {
+	patch, err := json.Marshal(map[string]interface{}{
+		"status": map[string]interface{}{
+			"nominatedNodeName": nodeName,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	rc := restClient(client)
+	if rc == nil {
+		_, err := client.CoreV1().Pods(namespace).Patch(name, types.StrategicMergePatchType, patch, "status")
+		return err
+	}
+	return rc.Patch(types.StrategicMergePatchType).
+		Namespace(namespace).
+		Resource("pods").
+		Name(name).
+		SubResource("status").
+		Param(fieldManagerParam, getFieldManager()).
+		Body(patch).
+		Do().
+		Error()
+}
+
+// updatePodStatus updates the status of a pod as the configured field manager.
+func updatePodStatus(client kubernetes.Interface, pod *v1.Pod) (*v1.Pod, error) {
+	rc := restClient(client)
+	if rc == nil {
+		return client.CoreV1().Pods(pod.Namespace).UpdateStatus(pod)
+	}
+	result := &v1.Pod{}
+	err := rc.Put().
+		Namespace(pod.Namespace).
+		Resource("pods").
+		Name(pod.Name).
+		SubResource("status").
+		Param(fieldManagerParam, getFieldManager()).
+		Body(pod).
+		Do().
+		Into(result)
+	return result, err
+}
@@ -0,0 +1,84 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8sclient
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+func TestFieldManager(t *testing.T) {
+	var mu sync.Mutex
+	fieldManagers := make(map[string]string)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		fieldManagers[r.Method+" "+r.URL.Path] = r.URL.Query().Get(fieldManagerParam)
+		mu.Unlock()
+		// Echo the written object back, as the API server does.
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(body)
+	}))
+	defer server.Close()
+	client, err := kubernetes.NewForConfig(&rest.Config{Host: server.URL})
+	if err != nil {
+		t.Fatalf("Failed to create the client: %v", err)
+	}
+
+	testData := []struct {
+		fieldManager string
+		expected     string
+	}{
+		{"", DefaultFieldManager},
+		{"poseidon-replica-1", "poseidon-replica-1"},
+	}
+	defer SetFieldManager("")
+	for _, data := range testData {
+		SetFieldManager(data.fieldManager)
+		err := bindPod(client, "Poseidon-Namespace", &v1.Binding{
+			ObjectMeta: metav1.ObjectMeta{Name: "Pod1"},
+			Target:     v1.ObjectReference{Namespace: "Poseidon-Namespace", Name: "Node1"},
+		})
+		if err != nil {
+			t.Fatalf("Failed to bind the pod: %v", err)
+		}
+		pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "Pod1", Namespace: "Poseidon-Namespace"}}
+		if _, err := updatePodStatus(client, pod); err != nil {
+			t.Fatalf("Failed to update the pod status: %v", err)
+		}
+		mu.Lock()
+		for _, request := range []string{
+			"POST /api/v1/namespaces/Poseidon-Namespace/pods/Pod1/binding",
+			"PUT /api/v1/namespaces/Poseidon-Namespace/pods/Pod1/status",
+		} {
+			if fieldManager, ok := fieldManagers[request]; !ok {
+				t.Errorf("expected a %s request", request)
+			} else if fieldManager != data.expected {
+				t.Errorf("%s: expected the field manager %q, got %q", request, data.expected, fieldManager)
+			}
+		}
+		mu.Unlock()
+	}
+}
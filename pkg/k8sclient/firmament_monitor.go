@@ -0,0 +1,185 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8sclient
+
+import (
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/kubernetes-sigs/poseidon/pkg/firmament"
+	"k8s.io/api/core/v1"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// FirmamentMonitorInterval is the time between two health checks of Firmament.
+const FirmamentMonitorInterval = 5 * time.Second
+
+// FirmamentMonitor health checks Firmament. Firmament keeps its nodes and tasks in memory, so once it
+// is serving again after being unavailable the monitor assumes it restarted and submits them again.
+type FirmamentMonitor struct {
+	fc firmament.FirmamentSchedulerClient
+	// healthy is false while Firmament is unavailable.
+	healthy bool
+	// versionChangedHandler is called when the version Firmament advertises changes, e.g. to
+	// re-evaluate the pods with its new scheduling constraints. The version isn't checked if nil.
+	versionChangedHandler func()
+	// version is the version Firmament last advertised, versionKnown is false until it's checked.
+	version      string
+	versionKnown bool
+	// stateLost is signaled once a call shows Firmament lost the tasks, e.g. it restarted between two
+	// health checks. The nodes and tasks are resubmitted at the next health check.
+	stateLost chan struct{}
+}
+
+// NewFirmamentMonitor initializes a FirmamentMonitor, Firmament is expected to be serving.
+func NewFirmamentMonitor(fc firmament.FirmamentSchedulerClient) *FirmamentMonitor {
+	return &FirmamentMonitor{
+		fc:        fc,
+		healthy:   true,
+		stateLost: make(chan struct{}, 1),
+	}
+}
+
+// firmamentStateLostHandler is called when Firmament doesn't know a task Poseidon submitted, it's nil
+// until the monitor is started.
+var firmamentStateLostHandler func()
+var firmamentStateLostHandlerLock = new(sync.RWMutex)
+
+// setFirmamentStateLostHandler sets the function called when Firmament doesn't know a submitted task.
+func setFirmamentStateLostHandler(handler func()) {
+	firmamentStateLostHandlerLock.Lock()
+	defer firmamentStateLostHandlerLock.Unlock()
+	firmamentStateLostHandler = handler
+}
+
+// notifyFirmamentStateLost tells the monitor Firmament doesn't know a submitted task.
+func notifyFirmamentStateLost() {
+	firmamentStateLostHandlerLock.RLock()
+	handler := firmamentStateLostHandler
+	firmamentStateLostHandlerLock.RUnlock()
+	if handler != nil {
+		handler()
+	}
+}
+
+// setStateLost records that Firmament lost its tasks. The signals received before the next health
+// check are coalesced into a single resubmission.
+func (fm *FirmamentMonitor) setStateLost() {
+	select {
+	case fm.stateLost <- struct{}{}:
+	default:
+	}
+}
+
+// Run health checks Firmament until stopCh is closed.
+func (fm *FirmamentMonitor) Run(stopCh <-chan struct{}) {
+	defer utilruntime.HandleCrash()
+	wait.Until(fm.check, FirmamentMonitorInterval, stopCh)
+}
+
+func (fm *FirmamentMonitor) check() {
+	var ok bool
+	var version string
+	var err error
+	if fm.versionChangedHandler != nil {
+		ok, version, err = firmament.CheckVersion(fm.fc, &firmament.HealthCheckRequest{})
+	} else {
+		ok, err = firmament.Check(fm.fc, &firmament.HealthCheckRequest{})
+	}
+	if err != nil || !ok {
+		if fm.healthy {
+			glog.Errorf("Firmament is unavailable: %v", err)
+			fm.healthy = false
+		}
+		return
+	}
+	if !fm.healthy {
+		glog.Info("Firmament is serving again, resubmitting the nodes and tasks")
+		fm.healthy = true
+		// The loss of the tasks seen during the outage is handled by this resubmission.
+		select {
+		case <-fm.stateLost:
+		default:
+		}
+		fm.resubmit()
+	}
+	select {
+	case <-fm.stateLost:
+		// Firmament restarted between two health checks.
+		glog.Info("Firmament lost the submitted tasks, resubmitting the nodes and tasks")
+		fm.resubmit()
+	default:
+	}
+	if fm.versionChangedHandler != nil {
+		fm.checkVersion(version)
+	}
+}
+
+// checkVersion calls the versionChangedHandler if the version Firmament advertises isn't the one it
+// advertised before. The first version checked is only recorded.
+func (fm *FirmamentMonitor) checkVersion(version string) {
+	if !fm.versionKnown {
+		fm.version, fm.versionKnown = version, true
+		return
+	}
+	if version == fm.version {
+		return
+	}
+	glog.Infof("Firmament version changed from %q to %q, re-evaluating the pods", fm.version, version)
+	fm.version = version
+	fm.versionChangedHandler()
+}
+
+// resubmit adds all the known nodes and submits the tasks of the pods which haven't terminated.
+func (fm *FirmamentMonitor) resubmit() {
+	NodeMux.RLock()
+	rtnds := make([]*firmament.ResourceTopologyNodeDescriptor, 0, len(NodeToRTND))
+	for _, rtnd := range NodeToRTND {
+		rtnds = append(rtnds, rtnd)
+	}
+	NodeMux.RUnlock()
+	for _, rtnd := range rtnds {
+		firmament.NodeAdded(fm.fc, rtnd)
+	}
+
+	var taskDescriptions []*firmament.TaskDescription
+	PodMux.RLock()
+	PodToK8sPodLock.Lock()
+	for podIdentifier, td := range PodToTD {
+		if pod, ok := PodToK8sPod[podIdentifier]; ok &&
+			(pod.Status.Phase == v1.PodSucceeded || pod.Status.Phase == v1.PodFailed) {
+			continue
+		}
+		jd, ok := jobIDToJD[td.JobId]
+		if !ok {
+			glog.Errorf("Job %s of pod %v does not exist", td.JobId, podIdentifier)
+			continue
+		}
+		taskDescriptions = append(taskDescriptions, &firmament.TaskDescription{
+			TaskDescriptor: td,
+			JobDescriptor:  jd,
+		})
+	}
+	PodToK8sPodLock.Unlock()
+	PodMux.RUnlock()
+	for _, taskDescription := range taskDescriptions {
+		firmament.TaskResubmitted(fm.fc, taskDescription)
+	}
+	glog.Infof("Resubmitted %d nodes and %d tasks to Firmament", len(rtnds), len(taskDescriptions))
+}
@@ -0,0 +1,216 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8sclient
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/kubernetes-sigs/poseidon/pkg/firmament"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Checks the live tasks and the nodes are resubmitted once Firmament is back after an outage
+func TestFirmamentMonitor_check(t *testing.T) {
+	var empty map[string]string
+	fakeNow := metav1.Now()
+
+	testObj := initializePodObj(t)
+	defer testObj.mockCtrl.Finish()
+	podWatch := NewPodWatcher(testObj.kubeVerMajor, testObj.kubeVerMinor, testObj.schedulerName, testObj.kubeClient, testObj.firmamentClient)
+	resetNodes()
+	NodeToRTND["Node1"] = &firmament.ResourceTopologyNodeDescriptor{
+		ResourceDesc: &firmament.ResourceDescriptor{Uuid: "Node1-uuid"},
+	}
+
+	testObj.firmamentClient.EXPECT().TaskSubmitted(gomock.Any(), gomock.Any()).Times(3).Return(
+		&firmament.TaskSubmittedResponse{Type: firmament.TaskReplyType_TASK_SUBMITTED_OK}, nil)
+	for i, phase := range []string{"Pending", "Running", "Succeeded"} {
+		k8sPod := BuildPod("Poseidon-Namespace", fmt.Sprintf("Pod%d", i), empty, GetPodPhase(phase), "2", "1024", &fakeNow, "abcdfe12345")
+		pod := podWatch.parsePod(k8sPod)
+		PodToK8sPodLock.Lock()
+		PodToK8sPod[pod.Identifier] = k8sPod
+		PodToK8sPodLock.Unlock()
+		podWatch.submitPod(pod)
+	}
+	defer func() {
+		PodToK8sPodLock.Lock()
+		PodToK8sPod = make(map[PodIdentifier]*v1.Pod)
+		PodToK8sPodLock.Unlock()
+	}()
+
+	fm := NewFirmamentMonitor(testObj.firmamentClient)
+	serving := &firmament.HealthCheckResponse{Status: firmament.ServingStatus_SERVING}
+	resubmitted := make(map[string]bool)
+	gomock.InOrder(
+		testObj.firmamentClient.EXPECT().Check(gomock.Any(), gomock.Any()).Return(nil, errors.New("connection refused")),
+		testObj.firmamentClient.EXPECT().Check(gomock.Any(), gomock.Any()).Return(serving, nil),
+		testObj.firmamentClient.EXPECT().NodeAdded(gomock.Any(), gomock.Any()).Return(
+			&firmament.NodeAddedResponse{Type: firmament.NodeReplyType_NODE_ADDED_OK}, nil),
+		testObj.firmamentClient.EXPECT().TaskSubmitted(gomock.Any(), gomock.Any()).Times(2).Do(func(_ interface{}, td interface{}) {
+			resubmitted[td.(*firmament.TaskDescription).TaskDescriptor.Name] = true
+		}).Return(&firmament.TaskSubmittedResponse{Type: firmament.TaskReplyType_TASK_SUBMITTED_OK}, nil),
+		// Nothing is resubmitted while Firmament stays healthy.
+		testObj.firmamentClient.EXPECT().Check(gomock.Any(), gomock.Any()).Return(serving, nil),
+	)
+	// Firmament goes away and comes back without its state.
+	fm.check()
+	fm.check()
+	fm.check()
+
+	expected := map[string]bool{
+		"Poseidon-Namespace/Pod0": true,
+		"Poseidon-Namespace/Pod1": true,
+	}
+	if !reflect.DeepEqual(resubmitted, expected) {
+		t.Errorf("expected the tasks %v to be resubmitted, got %v", expected, resubmitted)
+	}
+}
+
+// Checks the live tasks and the nodes are resubmitted once Firmament reports a task it doesn't know,
+// i.e. it restarted without any health check failing
+func TestFirmamentMonitor_stateLost(t *testing.T) {
+	var empty map[string]string
+	fakeNow := metav1.Now()
+
+	testObj := initializePodObj(t)
+	defer testObj.mockCtrl.Finish()
+	podWatch := NewPodWatcher(testObj.kubeVerMajor, testObj.kubeVerMinor, testObj.schedulerName, testObj.kubeClient, testObj.firmamentClient)
+	resetNodes()
+	NodeToRTND["Node1"] = &firmament.ResourceTopologyNodeDescriptor{
+		ResourceDesc: &firmament.ResourceDescriptor{Uuid: "Node1-uuid"},
+	}
+
+	testObj.firmamentClient.EXPECT().TaskSubmitted(gomock.Any(), gomock.Any()).Times(2).Return(
+		&firmament.TaskSubmittedResponse{Type: firmament.TaskReplyType_TASK_SUBMITTED_OK}, nil)
+	var completedPod *Pod
+	for i, phase := range []string{"Running", "Succeeded"} {
+		k8sPod := BuildPod("Poseidon-Namespace", fmt.Sprintf("Pod%d", i), empty, GetPodPhase(phase), "2", "1024", &fakeNow, "abcdfe12345")
+		pod := podWatch.parsePod(k8sPod)
+		PodToK8sPodLock.Lock()
+		PodToK8sPod[pod.Identifier] = k8sPod
+		PodToK8sPodLock.Unlock()
+		podWatch.submitPod(pod)
+		completedPod = pod
+	}
+	defer func() {
+		PodToK8sPodLock.Lock()
+		PodToK8sPod = make(map[PodIdentifier]*v1.Pod)
+		PodToK8sPodLock.Unlock()
+	}()
+
+	fm := NewFirmamentMonitor(testObj.firmamentClient)
+	setFirmamentStateLostHandler(fm.setStateLost)
+	defer setFirmamentStateLostHandler(nil)
+	serving := &firmament.HealthCheckResponse{Status: firmament.ServingStatus_SERVING}
+	resubmitted := make(map[string]bool)
+	gomock.InOrder(
+		testObj.firmamentClient.EXPECT().Check(gomock.Any(), gomock.Any()).Return(serving, nil),
+		// Firmament restarted between two health checks: it doesn't know the completed task.
+		testObj.firmamentClient.EXPECT().TaskCompleted(gomock.Any(), gomock.Any()).Return(
+			&firmament.TaskCompletedResponse{Type: firmament.TaskReplyType_TASK_NOT_FOUND}, nil),
+		testObj.firmamentClient.EXPECT().Check(gomock.Any(), gomock.Any()).Return(serving, nil),
+		testObj.firmamentClient.EXPECT().NodeAdded(gomock.Any(), gomock.Any()).Return(
+			&firmament.NodeAddedResponse{Type: firmament.NodeReplyType_NODE_ADDED_OK}, nil),
+		testObj.firmamentClient.EXPECT().TaskSubmitted(gomock.Any(), gomock.Any()).Do(func(_ interface{}, td interface{}) {
+			resubmitted[td.(*firmament.TaskDescription).TaskDescriptor.Name] = true
+		}).Return(&firmament.TaskSubmittedResponse{Type: firmament.TaskReplyType_TASK_SUBMITTED_OK}, nil),
+		// The loss is only handled once.
+		testObj.firmamentClient.EXPECT().Check(gomock.Any(), gomock.Any()).Return(serving, nil),
+	)
+	fm.check()
+	PodMux.RLock()
+	uid := PodToTD[completedPod.Identifier].Uid
+	PodMux.RUnlock()
+	NewFirmamentBackend(testObj.firmamentClient).CompleteTask(uid)
+	fm.check()
+	fm.check()
+
+	expected := map[string]bool{"Poseidon-Namespace/Pod0": true}
+	if !reflect.DeepEqual(resubmitted, expected) {
+		t.Errorf("expected the tasks %v to be resubmitted, got %v", expected, resubmitted)
+	}
+}
+
+// Checks the submitted live pods are re-evaluated once Firmament advertises another version
+func TestFirmamentMonitor_versionChange(t *testing.T) {
+	var empty map[string]string
+	fakeNow := metav1.Now()
+
+	testObj := initializePodObj(t)
+	defer testObj.mockCtrl.Finish()
+	podWatch := NewPodWatcher(testObj.kubeVerMajor, testObj.kubeVerMinor, testObj.schedulerName, testObj.kubeClient, testObj.firmamentClient)
+
+	testObj.firmamentClient.EXPECT().TaskSubmitted(gomock.Any(), gomock.Any()).Times(3).Return(
+		&firmament.TaskSubmittedResponse{Type: firmament.TaskReplyType_TASK_SUBMITTED_OK}, nil)
+	for i, phase := range []string{"Pending", "Running", "Succeeded"} {
+		k8sPod := BuildPod("Poseidon-Namespace", fmt.Sprintf("Pod%d", i), empty, GetPodPhase(phase), "2", "1024", &fakeNow, "abcdfe12345")
+		pod := podWatch.parsePod(k8sPod)
+		PodToK8sPodLock.Lock()
+		PodToK8sPod[pod.Identifier] = k8sPod
+		PodToK8sPodLock.Unlock()
+		podWatch.submitPod(pod)
+	}
+	defer func() {
+		PodToK8sPodLock.Lock()
+		PodToK8sPod = make(map[PodIdentifier]*v1.Pod)
+		PodToK8sPodLock.Unlock()
+	}()
+
+	fm := NewFirmamentMonitor(testObj.firmamentClient)
+	fm.versionChangedHandler = podWatch.requeueSubmittedPods
+	serving := &firmament.HealthCheckResponse{Status: firmament.ServingStatus_SERVING}
+	checkVersion := func(version string) *gomock.Call {
+		return testObj.firmamentClient.EXPECT().Check(gomock.Any(), gomock.Any(), gomock.Any()).Do(
+			func(_ interface{}, _ interface{}, opts ...grpc.CallOption) {
+				*opts[0].(grpc.HeaderCallOption).HeaderAddr = metadata.Pairs(firmament.VersionHeader, version)
+			}).Return(serving, nil)
+	}
+	gomock.InOrder(checkVersion("v1"), checkVersion("v1"), checkVersion("v2"))
+
+	// The first version is only recorded, and nothing is re-evaluated while it doesn't change.
+	fm.check()
+	fm.check()
+	if podWatch.podWorkQueue.Len() != 0 {
+		t.Fatalf("expected no pod to be re-evaluated, got %d", podWatch.podWorkQueue.Len())
+	}
+
+	fm.check()
+	requeued := make(map[string]bool)
+	for podWatch.podWorkQueue.Len() > 0 {
+		key, items, _ := podWatch.podWorkQueue.Get()
+		for _, item := range items {
+			if pod := item.(*Pod); pod.State == PodUpdated {
+				requeued[pod.Identifier.UniqueName()] = true
+			}
+		}
+		podWatch.podWorkQueue.Done(key)
+	}
+	expected := map[string]bool{
+		"Poseidon-Namespace/Pod0": true,
+		"Poseidon-Namespace/Pod1": true,
+	}
+	if !reflect.DeepEqual(requeued, expected) {
+		t.Errorf("expected the pods %v to be re-evaluated, got %v", expected, requeued)
+	}
+}
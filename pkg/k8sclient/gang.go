@@ -0,0 +1,161 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8sclient
+
+import (
+	"github.com/golang/glog"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// GangSizeLabel is the task label telling Firmament the number of tasks of the job which are
+// submitted together. The Firmament API has no notion of gang, so the tasks of a gang are
+// only guaranteed to be submitted at the same time.
+const GangSizeLabel = "poseidon.kubernetes.io/gang-size"
+
+// recordGangSize looks up the replica count of the controller owning the pod the first time
+// one of its pods is added, it's used as the gang size of all the pods of the controller until the
+// controller changes. Nothing is recorded while the controller isn't known, so that the next pod
+// looks it up again.
+func (pw *PodWatcher) recordGangSize(pod *v1.Pod) {
+	jobID := pw.generateJobID(GetOwnerReference(pod))
+	PodMux.RLock()
+	_, ok := jobGangSizes[jobID]
+	PodMux.RUnlock()
+	if ok {
+		return
+	}
+	gangSize, ok := pw.getOwnerReplicas(pod)
+	if !ok {
+		return
+	}
+	PodMux.Lock()
+	jobGangSizes[jobID] = gangSize
+	PodMux.Unlock()
+}
+
+// forgetGangSize forgets the gang size recorded for a controller which was updated or deleted, e.g.
+// scaled, so that it's looked up again.
+func (pw *PodWatcher) forgetGangSize(uid types.UID) {
+	jobID := pw.generateJobID(string(uid))
+	PodMux.Lock()
+	defer PodMux.Unlock()
+	delete(jobGangSizes, jobID)
+}
+
+// getGangSize returns the gang size recorded for the owner, 0 if there's none.
+func (pw *PodWatcher) getGangSize(ownerRef string) int32 {
+	if !pw.gangScheduling || ownerRef == "" {
+		return 0
+	}
+	jobID := pw.generateJobID(ownerRef)
+	PodMux.RLock()
+	defer PodMux.RUnlock()
+	return jobGangSizes[jobID]
+}
+
+// getOwnerReplicas returns the number of pods the controller of the pod runs at once, read from the
+// informer cache. It returns 1 for the pods without a controller or with an unknown kind of controller,
+// and false if the controller isn't known.
+func (pw *PodWatcher) getOwnerReplicas(pod *v1.Pod) (int32, bool) {
+	owner := metav1.GetControllerOf(pod)
+	if owner == nil {
+		return 1, true
+	}
+	var replicas *int32
+	switch controller := pw.owners.getOwner(owner.Kind, pod.Namespace, owner.Name).(type) {
+	case *appsv1.ReplicaSet:
+		replicas = controller.Spec.Replicas
+	case *appsv1.StatefulSet:
+		replicas = controller.Spec.Replicas
+	case *v1.ReplicationController:
+		replicas = controller.Spec.Replicas
+	case *batchv1.Job:
+		replicas = controller.Spec.Parallelism
+	case nil:
+		if _, watched := pw.owners.stores[owner.Kind]; !watched {
+			return 1, true
+		}
+		glog.V(2).Infof("The %s %s/%s owning pod %s isn't known", owner.Kind, pod.Namespace, owner.Name, pod.Name)
+		return 1, false
+	}
+	if replicas == nil {
+		// All these controllers default to a single replica.
+		return 1, true
+	}
+	return *replicas, true
+}
+
+// submitGangMember holds back a pending pod until all the pods of its gang are pending, then submits
+// the whole gang. The pods of a gang which already has tasks in Firmament are submitted right away,
+// they replace members which went away.
+func (pw *PodWatcher) submitGangMember(pod *Pod) {
+	jobID := pw.generateJobID(pod.OwnerRef)
+	PodMux.Lock()
+	if jobNumTasksToRemove[jobID] > 0 {
+		PodMux.Unlock()
+		pw.submitPod(pod)
+		return
+	}
+	members := pendingGangs[jobID]
+	pending := false
+	for i, member := range members {
+		if member.Identifier == pod.Identifier {
+			members[i] = pod
+			pending = true
+		}
+	}
+	if !pending {
+		members = append(members, pod)
+	}
+	if int32(len(members)) < pod.GangSize {
+		pendingGangs[jobID] = members
+		PodMux.Unlock()
+		glog.V(2).Infof("Pod %v waits for %d more pods of its gang", pod.Identifier, pod.GangSize-int32(len(members)))
+		return
+	}
+	delete(pendingGangs, jobID)
+	PodMux.Unlock()
+	glog.V(2).Infof("Submitting the gang of %d pods of job %s", len(members), jobID)
+	for _, member := range members {
+		pw.submitPod(member)
+	}
+}
+
+// forgetGangMember removes a deleted pod from the pods waiting for their gang.
+// The caller must hold PodMux.
+func (pw *PodWatcher) forgetGangMember(pod *Pod) {
+	if pod.OwnerRef == "" {
+		return
+	}
+	jobID := pw.generateJobID(pod.OwnerRef)
+	members := pendingGangs[jobID]
+	for i, member := range members {
+		if member.Identifier == pod.Identifier {
+			members = append(members[:i], members[i+1:]...)
+			break
+		}
+	}
+	if len(members) == 0 {
+		delete(pendingGangs, jobID)
+	} else {
+		pendingGangs[jobID] = members
+	}
+}
@@ -0,0 +1,152 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8sclient
+
+import (
+	"sync"
+
+	"github.com/golang/glog"
+)
+
+// inFlightPods holds, per owner, the pods submitted to Firmament and not yet placed, or released
+// from throttledPods and about to be submitted.
+var inFlightPods map[string]map[PodIdentifier]struct{}
+
+// inFlightOwners holds the owner of each pod of inFlightPods.
+var inFlightOwners map[PodIdentifier]string
+
+// throttledPods holds, per owner, the pods held back because the owner has the maximum number of
+// pods in flight, in the order they're released.
+var throttledPods map[string][]*Pod
+
+// podPlacedHandler releases the in-flight slot of a placed pod, it's nil until the pod watcher is started.
+var podPlacedHandler func(identifier PodIdentifier)
+var podPlacedHandlerLock = new(sync.RWMutex)
+
+// setPodPlacedHandler sets the function called once a pod is bound to its node.
+func setPodPlacedHandler(handler func(identifier PodIdentifier)) {
+	podPlacedHandlerLock.Lock()
+	defer podPlacedHandlerLock.Unlock()
+	podPlacedHandler = handler
+}
+
+// notifyPodPlaced calls the podPlacedHandler, if any, for a pod bound to its node.
+func notifyPodPlaced(identifier PodIdentifier) {
+	podPlacedHandlerLock.RLock()
+	handler := podPlacedHandler
+	podPlacedHandlerLock.RUnlock()
+	if handler != nil {
+		handler(identifier)
+	}
+}
+
+// throttleOwnerPod returns true if the pod's owner already has the maximum number of pods in flight,
+// the pod is then held until one of them is placed. Otherwise the pod is counted in flight.
+func (pw *PodWatcher) throttleOwnerPod(pod *Pod) bool {
+	if pw.maxInFlightPerOwner <= 0 || pod.OwnerRef == "" {
+		return false
+	}
+	PodMux.Lock()
+	defer PodMux.Unlock()
+	owned := inFlightPods[pod.OwnerRef]
+	if _, ok := owned[pod.Identifier]; ok {
+		return false
+	}
+	if len(owned) >= pw.maxInFlightPerOwner {
+		for i, throttledPod := range throttledPods[pod.OwnerRef] {
+			if throttledPod.Identifier == pod.Identifier {
+				// Keep the pod's place in the queue, with its latest version.
+				throttledPods[pod.OwnerRef][i] = pod
+				return true
+			}
+		}
+		throttledPods[pod.OwnerRef] = append(throttledPods[pod.OwnerRef], pod)
+		glog.V(2).Infof("Holding pod %v, its owner %s has %d pods in flight", pod.Identifier, pod.OwnerRef, len(owned))
+		return true
+	}
+	if owned == nil {
+		owned = make(map[PodIdentifier]struct{})
+		inFlightPods[pod.OwnerRef] = owned
+	}
+	owned[pod.Identifier] = struct{}{}
+	inFlightOwners[pod.Identifier] = pod.OwnerRef
+	return false
+}
+
+// releaseInFlightPod forgets a pod which is no longer in flight, because it was placed or deleted,
+// and enqueues the next pod its owner holds back, if any.
+func (pw *PodWatcher) releaseInFlightPod(identifier PodIdentifier) {
+	PodMux.Lock()
+	ownerRef, ok := inFlightOwners[identifier]
+	if !ok {
+		PodMux.Unlock()
+		return
+	}
+	delete(inFlightOwners, identifier)
+	delete(inFlightPods[ownerRef], identifier)
+	var next *Pod
+	if queue := throttledPods[ownerRef]; len(queue) > 0 {
+		next = queue[0]
+		if len(queue) == 1 {
+			delete(throttledPods, ownerRef)
+		} else {
+			throttledPods[ownerRef] = queue[1:]
+		}
+		// The slot is taken right away, so that no other pod of the owner overtakes the released one.
+		inFlightPods[ownerRef][next.Identifier] = struct{}{}
+		inFlightOwners[next.Identifier] = ownerRef
+	}
+	if len(inFlightPods[ownerRef]) == 0 {
+		delete(inFlightPods, ownerRef)
+	}
+	PodMux.Unlock()
+	if next != nil {
+		pw.podWorkQueue.Add(next.Identifier.UniqueName(), next)
+		glog.V(2).Info("releaseInFlightPod: Released pod ", next.Identifier)
+	}
+}
+
+// replaceThrottledPod replaces the held version of an updated pod, it returns false if the pod
+// isn't held back. The caller must hold PodMux.
+func replaceThrottledPod(pod *Pod) bool {
+	for i, throttledPod := range throttledPods[pod.OwnerRef] {
+		if throttledPod.Identifier == pod.Identifier {
+			updatedPod := *pod
+			updatedPod.State = PodPending
+			throttledPods[pod.OwnerRef][i] = &updatedPod
+			return true
+		}
+	}
+	return false
+}
+
+// forgetThrottledPod removes a deleted pod from the pods held back for its owner.
+// The caller must hold PodMux.
+func forgetThrottledPod(pod *Pod) {
+	queue := throttledPods[pod.OwnerRef]
+	for i, throttledPod := range queue {
+		if throttledPod.Identifier == pod.Identifier {
+			queue = append(queue[:i], queue[i+1:]...)
+			break
+		}
+	}
+	if len(queue) == 0 {
+		delete(throttledPods, pod.OwnerRef)
+	} else {
+		throttledPods[pod.OwnerRef] = queue
+	}
+}
@@ -0,0 +1,62 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8sclient
+
+import (
+	"github.com/golang/glog"
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// defaultJobBackoffLimit is the number of retries of a Job which doesn't set its backoff limit.
+const defaultJobBackoffLimit = 6
+
+// isJobFailed returns true if the Job has given up on its pods.
+func isJobFailed(job *batchv1.Job) bool {
+	for _, condition := range job.Status.Conditions {
+		if condition.Type == batchv1.JobFailed && condition.Status == v1.ConditionTrue {
+			return true
+		}
+	}
+	return false
+}
+
+// isRetriableJobFailure returns true if the failed pod is owned by a Job which will create a replacement
+// for it, i.e. the Job hasn't failed and its backoff limit isn't exhausted. The status of the Job may
+// not count the failure of the pod yet, so the failure is counted on top of it: when in doubt, the
+// failure is deemed terminal. The Job is read from the informer cache, the pod update handlers don't
+// wait on the API server.
+func (pw *PodWatcher) isRetriableJobFailure(pod *v1.Pod) bool {
+	ownerRef := metav1.GetControllerOf(pod)
+	if ownerRef == nil || ownerRef.Kind != "Job" {
+		return false
+	}
+	job := pw.owners.getJob(pod.Namespace, ownerRef.Name)
+	if job == nil {
+		glog.V(2).Infof("The Job %s/%s owning pod %s isn't known", pod.Namespace, ownerRef.Name, pod.Name)
+		return false
+	}
+	if job.UID != ownerRef.UID || isJobFailed(job) {
+		return false
+	}
+	backoffLimit := int32(defaultJobBackoffLimit)
+	if job.Spec.BackoffLimit != nil {
+		backoffLimit = *job.Spec.BackoffLimit
+	}
+	return job.Status.Failed+1 <= backoffLimit
+}
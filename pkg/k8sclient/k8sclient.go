@@ -19,6 +19,7 @@ package k8sclient
 import (
 	"github.com/kubernetes-sigs/poseidon/pkg/firmament"
 	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
 	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
@@ -26,6 +27,7 @@ import (
 
 	"github.com/golang/glog"
 	config2 "github.com/kubernetes-sigs/poseidon/pkg/config"
+	"github.com/kubernetes-sigs/poseidon/pkg/tracing"
 	"k8s.io/apimachinery/pkg/util/wait"
 	"sync"
 	"time"
@@ -36,20 +38,57 @@ var ClientSet kubernetes.Interface
 // BindPodToNode call Kubernetes API to place a pod on a node.
 func BindPodToNode() {
 	for {
-		bindInfo := <-BindChannel
-		err := ClientSet.CoreV1().Pods(bindInfo.Namespace).Bind(&v1.Binding{
-			TypeMeta: meta_v1.TypeMeta{},
-			ObjectMeta: meta_v1.ObjectMeta{
-				Name: bindInfo.Name,
-			},
-			Target: v1.ObjectReference{
-				Namespace: bindInfo.Namespace,
-				Name:      bindInfo.Nodename,
-			}})
-		if err != nil {
-			glog.Errorf("Could not bind pod:%s to nodeName:%s, error: %v", bindInfo.Name, bindInfo.Nodename, err)
+		processBind(<-BindChannel)
+	}
+}
+
+// processBind binds a pod to the node Firmament placed it on. With a bind confirmation timeout, the
+// pod is only deemed bound once it's observed with its node name, the bind is requeued if it isn't
+// within the timeout. A bind rejected because the pod is already bound places the pod on its node.
+func processBind(bindInfo BindInfo) {
+	identifier := NewPodIdentifier(bindInfo.Namespace, bindInfo.Name)
+	span := startPodSpan(tracing.SpanContext{}, "poseidon.BindPod", identifier)
+	span.SetAttribute(spanAttributeNode, bindInfo.Nodename)
+	defer span.Finish()
+	timeout := getBindConfirmationTimeout()
+	var confirmed <-chan struct{}
+	if timeout > 0 {
+		confirmed = expectBindConfirmation(identifier)
+	}
+	err := bindPod(ClientSet, bindInfo.Namespace, &v1.Binding{
+		TypeMeta: meta_v1.TypeMeta{},
+		ObjectMeta: meta_v1.ObjectMeta{
+			Name: bindInfo.Name,
+		},
+		Target: v1.ObjectReference{
+			Namespace: bindInfo.Namespace,
+			Name:      bindInfo.Nodename,
+		}})
+	nodeName := bindInfo.Nodename
+	if errors.IsConflict(err) || errors.IsAlreadyExists(err) {
+		// The pod is already bound, e.g. by a previous attempt whose confirmation timed out: it's placed
+		// on the node it's bound to rather than left out of the placements.
+		if boundNode, getErr := getBoundNode(ClientSet, bindInfo.Namespace, bindInfo.Name); getErr == nil && boundNode != "" {
+			glog.V(2).Infof("Pod %v is already bound to node %s", identifier, boundNode)
+			forgetBindConfirmation(identifier)
+			nodeName, err, timeout = boundNode, nil, 0
 		}
 	}
+	if err != nil {
+		forgetBindConfirmation(identifier)
+		glog.Errorf("Could not bind pod:%s to nodeName:%s, error: %v", bindInfo.Name, bindInfo.Nodename, err)
+		span.SetError(err)
+		return
+	}
+	if timeout > 0 && !awaitBindConfirmation(identifier, confirmed, timeout) {
+		glog.Warningf("The bind of pod %v to node %s wasn't confirmed within %v, requeuing it", identifier, bindInfo.Nodename, timeout)
+		requeueBind(bindInfo)
+		return
+	}
+	PodMux.Lock()
+	podToNode[identifier] = nodeName
+	PodMux.Unlock()
+	notifyPodPlaced(identifier)
 }
 
 // DeletePod calls Kubernetes API to delete a Pod by its namespace and name.
@@ -69,7 +108,8 @@ func GetClientConfig(kubeconfig string) (*rest.Config, error) {
 }
 
 // New initializes a firmament and Kubernetes client and starts watching Pod and Node.
-func New(schedulerName string, kubeConfig string, kubeVersionMajor, kubeVersionMinor int, firmamentAddress string) {
+// It blocks until stopCh is closed and the watchers have drained their queues.
+func New(schedulerName string, kubeConfig string, kubeVersionMajor, kubeVersionMinor int, firmamentAddress string, stopCh <-chan struct{}) {
 
 	config, err := GetClientConfig(kubeConfig)
 	if err != nil {
@@ -77,6 +117,13 @@ func New(schedulerName string, kubeConfig string, kubeVersionMajor, kubeVersionM
 	}
 	//
 
+	memoryUnit, err = ParseMemoryUnit(config2.GetMemoryUnit())
+	if err != nil {
+		glog.Fatalf("Incorrect content in --memoryUnit: %v", err)
+	}
+	binaryMemory = config2.GetBinaryMemory()
+	SetBindConfirmationTimeout(config2.GetBindConfirmationTimeout())
+
 	config.QPS = config2.GetQPS()
 	config.Burst = config2.GetBurst()
 
@@ -89,13 +136,60 @@ func New(schedulerName string, kubeConfig string, kubeVersionMajor, kubeVersionM
 		glog.Fatalf("Failed to connect to Firmament: %v", err)
 	}
 	defer conn.Close()
+	// Count the calls to Firmament by outcome, and bound the calls issued by the watcher workers so that
+	// bursts of pod events don't overwhelm Firmament.
+	fc = firmament.NewLimitedClient(firmament.NewInstrumentedClient(fc), config2.GetFirmamentConcurrency())
+	if endpoint := config2.GetTraceExporterEndpoint(); endpoint != "" {
+		// Trace the scheduling of the pods, the calls to Firmament propagate the trace to it.
+		exporter := tracing.NewOTLPExporter(endpoint)
+		tracing.SetRecorder(exporter)
+		go exporter.Run(stopCh)
+		fc = firmament.NewTracingClient(fc)
+	}
+	firmament.SetLogThrottleWindow(config2.GetFirmamentLogThrottleWindow())
+	SetFieldManager(config2.GetFieldManager())
+	SetClusterID(config2.GetClusterID())
+	SetSubmittedAnnotation(config2.GetSubmittedAnnotation())
+	SetNominatePreemptors(config2.GetNominatePreemptors())
 	glog.Info("k8s newclient called")
-	stopCh := make(chan struct{})
-	go NewPodWatcher(kubeVersionMajor, kubeVersionMinor, schedulerName, ClientSet, fc).Run(stopCh, 10)
-	go NewNodeWatcher(ClientSet, fc).Run(stopCh, 10)
+	firmamentMonitor := NewFirmamentMonitor(fc)
+	podWatcher := NewPodWatcher(kubeVersionMajor, kubeVersionMinor, schedulerName, ClientSet, fc)
+	if config2.GetRequeueOnFirmamentVersionChange() {
+		// A new Firmament version may express constraints the tasks were submitted without.
+		firmamentMonitor.versionChangedHandler = podWatcher.requeueSubmittedPods
+	}
+	// Firmament not knowing a submitted task means it restarted, even if no health check failed.
+	setFirmamentStateLostHandler(firmamentMonitor.setStateLost)
+	go firmamentMonitor.Run(stopCh)
+	setPodResubmitter(podWatcher.resubmitPod)
+	setPodPlacedHandler(podWatcher.releaseInFlightPod)
+	setPodUnschedulableHandler(podWatcher.handleUnschedulablePod)
+	nodeWatcher := NewNodeWatcher(ClientSet, fc)
+	// The pods which didn't fit on any node may fit on the new nodes.
+	nodeWatcher.nodeAddedHandler = podWatcher.requeueUnschedulablePods
+	// The pods of the nodes which stay NotReady are rescheduled.
+	nodeWatcher.nodeNotReadyHandler = podWatcher.rescheduleNodePods
+	// The tasks of the pods evicted from the cordoned nodes are removed as soon as they start terminating.
+	nodeWatcher.nodeCordonedHandler = podWatcher.setNodeCordoned
+	priorityClassWatcher := NewPriorityClassWatcher(ClientSet)
+	priorityClassWatcher.priorityClassUpdatedHandler = podWatcher.requeuePriorityClassPods
+	wg := new(sync.WaitGroup)
+	wg.Add(3)
+	go func() {
+		defer wg.Done()
+		podWatcher.Run(stopCh, 10)
+	}()
+	go func() {
+		defer wg.Done()
+		nodeWatcher.Run(stopCh, 10)
+	}()
+	go func() {
+		defer wg.Done()
+		priorityClassWatcher.Run(stopCh)
+	}()
 
 	// We block here.
-	<-stopCh
+	wg.Wait()
 }
 
 func init() {
@@ -18,12 +18,15 @@ package k8sclient
 
 import (
 	"sync"
+	"time"
 )
 
 // Queue is an interface which abstracts a queue.
 type Queue interface {
 	// Add enqueues a key and its associated item.
 	Add(key interface{}, item interface{})
+	// AddBatch enqueues the keys and their associated items at once.
+	AddBatch(keys []interface{}, items []interface{})
 	// Get removes an item from the queue and inserts the item to the currently processing key set.
 	Get() (key interface{}, items []interface{}, shutdown bool)
 	// Done removes the item under processing.
@@ -32,6 +35,50 @@ type Queue interface {
 	ShutDown()
 	// ShuttingDown tests if the queue is shutting down.
 	ShuttingDown() bool
+	// Len returns the number of keys waiting to be processed.
+	Len() int
+}
+
+// DelayingQueue is a Queue which can also enqueue items after a delay.
+type DelayingQueue interface {
+	Queue
+	// AddAfter enqueues a key and its associated item once the duration has passed.
+	AddAfter(key interface{}, item interface{}, duration time.Duration)
+}
+
+// RateLimitingQueue is a DelayingQueue which delays the items requeued for a key exponentially.
+type RateLimitingQueue interface {
+	DelayingQueue
+	// AddRateLimited enqueues a key and its associated item once the backoff of the key has passed.
+	AddRateLimited(key interface{}, item interface{})
+	// Forget resets the backoff of a key.
+	Forget(key interface{})
+	// NumRequeues returns how many times the key was added with AddRateLimited since it was last forgotten.
+	NumRequeues(key interface{}) int
+}
+
+// QueueTransition is a transition of a key through a Queue.
+type QueueTransition string
+
+const (
+	// QueueAdded is the transition of a key and its item added to the queue.
+	QueueAdded QueueTransition = "add"
+	// QueueGot is the transition of a key and its items taken from the queue to be processed.
+	QueueGot QueueTransition = "get"
+	// QueueDone is the transition of a key whose processing is done.
+	QueueDone QueueTransition = "done"
+)
+
+// QueueObserver is called on every transition of a key through a queue, with the items involved: the
+// added item, the items got, none once done. It's called once the queue is unlocked, so it can use
+// the queue, and mustn't block.
+type QueueObserver func(transition QueueTransition, key interface{}, items []interface{})
+
+// ObservableQueue is a Queue whose transitions can be observed, e.g. by the tests or for monitoring.
+type ObservableQueue interface {
+	Queue
+	// SetObserver sets the function called on every transition, nil stops the observation.
+	SetObserver(observer QueueObserver)
 }
 
 type tk interface{}
@@ -60,6 +107,8 @@ type Type struct {
 	// shuttingDown is the flag representing if the queue is shutting down.
 	shuttingDown bool
 	cond         *sync.Cond
+	// observer is called on every transition, nil if the queue isn't observed.
+	observer QueueObserver
 }
 
 type empty struct{}
@@ -81,10 +130,40 @@ func (s set) delete(item tk) {
 // Add enqueues a key and its associated item.
 func (q *Type) Add(key interface{}, item interface{}) {
 	q.cond.L.Lock()
-	defer q.cond.L.Unlock()
 	if q.shuttingDown {
+		q.cond.L.Unlock()
+		return
+	}
+	q.add(key, item)
+	observer := q.observer
+	q.cond.L.Unlock()
+	if observer != nil {
+		observer(QueueAdded, key, []interface{}{item})
+	}
+}
+
+// AddBatch enqueues the keys and their associated items under a single lock acquisition.
+// The item at index i is associated with the key at index i.
+func (q *Type) AddBatch(keys []interface{}, items []interface{}) {
+	q.cond.L.Lock()
+	if q.shuttingDown {
+		q.cond.L.Unlock()
 		return
 	}
+	for i, key := range keys {
+		q.add(key, items[i])
+	}
+	observer := q.observer
+	q.cond.L.Unlock()
+	if observer != nil {
+		for i, key := range keys {
+			observer(QueueAdded, key, []interface{}{items[i]})
+		}
+	}
+}
+
+// add enqueues a key and its associated item. The caller must hold the lock.
+func (q *Type) add(key interface{}, item interface{}) {
 	if q.processing.has(key) {
 		// Key is under processing. Can not add it to the queue.
 		q.toQueue[key] = append(q.toQueue[key], item)
@@ -104,12 +183,12 @@ func (q *Type) Add(key interface{}, item interface{}) {
 // Get removes an item from the queue and inserts the item to the currently processing key set.
 func (q *Type) Get() (key interface{}, items []interface{}, shutdown bool) {
 	q.cond.L.Lock()
-	defer q.cond.L.Unlock()
 	for len(q.queue) == 0 && !q.shuttingDown {
 		q.cond.Wait()
 	}
 	if len(q.queue) == 0 {
 		// We must be shutting down.
+		q.cond.L.Unlock()
 		return nil, nil, true
 	}
 	key, q.queue = q.queue[0], q.queue[1:]
@@ -117,13 +196,17 @@ func (q *Type) Get() (key interface{}, items []interface{}, shutdown bool) {
 	q.processing.insert(key)
 	items = q.items[key]
 	delete(q.items, key)
+	observer := q.observer
+	q.cond.L.Unlock()
+	if observer != nil {
+		observer(QueueGot, key, items)
+	}
 	return key, items, false
 }
 
 // Done removes the item under processing and put the queued item into the to-be-processed set.
 func (q *Type) Done(key interface{}) {
 	q.cond.L.Lock()
-	defer q.cond.L.Unlock()
 	q.processing.delete(key)
 	items, ok := q.toQueue[key]
 	if ok {
@@ -132,6 +215,18 @@ func (q *Type) Done(key interface{}) {
 		delete(q.toQueue, key)
 		q.cond.Signal()
 	}
+	observer := q.observer
+	q.cond.L.Unlock()
+	if observer != nil {
+		observer(QueueDone, key, nil)
+	}
+}
+
+// SetObserver sets the function called on every transition, nil stops the observation.
+func (q *Type) SetObserver(observer QueueObserver) {
+	q.cond.L.Lock()
+	defer q.cond.L.Unlock()
+	q.observer = observer
 }
 
 // ShutDown shuts down the queue.
@@ -150,3 +245,83 @@ func (q *Type) ShuttingDown() bool {
 	defer q.cond.L.Unlock()
 	return q.shuttingDown
 }
+
+// Len returns the number of keys waiting to be processed.
+func (q *Type) Len() int {
+	q.cond.L.Lock()
+	defer q.cond.L.Unlock()
+	return len(q.queue)
+}
+
+// NewDelayingKeyedQueue initializes a delaying queue.
+func NewDelayingKeyedQueue() *DelayingType {
+	return &DelayingType{Type: NewKeyedQueue()}
+}
+
+// DelayingType implements the DelayingQueue interface.
+type DelayingType struct {
+	*Type
+}
+
+// AddAfter enqueues a key and its associated item once the duration has passed.
+// The item is dropped if the queue is shut down in the meantime.
+func (q *DelayingType) AddAfter(key interface{}, item interface{}, duration time.Duration) {
+	if duration <= 0 {
+		q.Add(key, item)
+		return
+	}
+	time.AfterFunc(duration, func() {
+		q.Add(key, item)
+	})
+}
+
+// NewRateLimitingKeyedQueue initializes a rate limiting queue whose backoff starts at baseDelay
+// and doubles on every requeue of a key, up to maxDelay.
+func NewRateLimitingKeyedQueue(baseDelay, maxDelay time.Duration) *RateLimitingType {
+	return &RateLimitingType{
+		DelayingType: NewDelayingKeyedQueue(),
+		requeues:     map[tk]int{},
+		baseDelay:    baseDelay,
+		maxDelay:     maxDelay,
+	}
+}
+
+// RateLimitingType implements the RateLimitingQueue interface.
+type RateLimitingType struct {
+	*DelayingType
+	// requeuesLock guards requeues.
+	requeuesLock sync.Mutex
+	// Number of requeues of each key since it was last forgotten.
+	requeues  map[tk]int
+	baseDelay time.Duration
+	maxDelay  time.Duration
+}
+
+// AddRateLimited enqueues a key and its associated item once the backoff of the key has passed.
+func (q *RateLimitingType) AddRateLimited(key interface{}, item interface{}) {
+	q.requeuesLock.Lock()
+	delay := q.baseDelay
+	for i := 0; i < q.requeues[key] && delay < q.maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > q.maxDelay {
+		delay = q.maxDelay
+	}
+	q.requeues[key]++
+	q.requeuesLock.Unlock()
+	q.AddAfter(key, item, delay)
+}
+
+// Forget resets the backoff of a key.
+func (q *RateLimitingType) Forget(key interface{}) {
+	q.requeuesLock.Lock()
+	defer q.requeuesLock.Unlock()
+	delete(q.requeues, key)
+}
+
+// NumRequeues returns how many times the key was added with AddRateLimited since it was last forgotten.
+func (q *RateLimitingType) NumRequeues(key interface{}) int {
+	q.requeuesLock.Lock()
+	defer q.requeuesLock.Unlock()
+	return q.requeues[key]
+}
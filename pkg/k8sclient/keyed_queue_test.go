@@ -60,6 +60,29 @@ func TestAdd(t *testing.T) {
 	}
 }
 
+func TestAddBatch(t *testing.T) {
+	fakeQueue := NewKeyedQueue()
+	keys := []interface{}{"Item1", "Item2", "Item2", "Item3"}
+	items := []interface{}{"Value1", "Value2", "Value22", "Value3"}
+
+	var testResult = []struct {
+		key   interface{}
+		value []interface{}
+	}{
+		{"Item1", []interface{}{"Value1"}},
+		{"Item2", []interface{}{"Value2", "Value22"}},
+		{"Item3", []interface{}{"Value3"}},
+	}
+
+	fakeQueue.AddBatch(keys, items)
+	for _, testValue := range testResult {
+		key, value, _ := fakeQueue.Get()
+		if !reflect.DeepEqual(key, testValue.key) || !reflect.DeepEqual(value, testValue.value) {
+			t.Error("expected ", testValue.key, testValue.value, "got ", key, value)
+		}
+	}
+}
+
 func TestNotDone(t *testing.T) {
 	fakeQueue := NewKeyedQueue()
 	var testDatas = []struct {
@@ -235,3 +258,75 @@ func TestShuttingDown(t *testing.T) {
 		t.Error("expected ", nil, nil, true, "got ", key, value, down)
 	}
 }
+
+func TestAddAfter(t *testing.T) {
+	fakeQueue := NewDelayingKeyedQueue()
+	start := time.Now()
+	fakeQueue.AddAfter("Item1", "Value1", 100*time.Millisecond)
+	fakeQueue.AddAfter("Item2", "Value2", 0)
+
+	key, value, _ := fakeQueue.Get()
+	if key != "Item2" || !reflect.DeepEqual(value, []interface{}{"Value2"}) {
+		t.Error("expected ", "Item2", "Value2", "got ", key, value)
+	}
+	key, value, _ = fakeQueue.Get()
+	if key != "Item1" || !reflect.DeepEqual(value, []interface{}{"Value1"}) {
+		t.Error("expected ", "Item1", "Value1", "got ", key, value)
+	}
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Error("expected the delayed item after 100ms, got it after ", elapsed)
+	}
+}
+
+func TestAddRateLimited(t *testing.T) {
+	fakeQueue := NewRateLimitingKeyedQueue(10*time.Millisecond, 40*time.Millisecond)
+	// The backoff doubles on every requeue up to the maximum delay: 10, 20, 40 then 40ms.
+	var expectedDelays = []time.Duration{10 * time.Millisecond, 20 * time.Millisecond, 40 * time.Millisecond, 40 * time.Millisecond}
+	for i, expectedDelay := range expectedDelays {
+		start := time.Now()
+		fakeQueue.AddRateLimited("Item1", "Value1")
+		key, _, _ := fakeQueue.Get()
+		elapsed := time.Since(start)
+		fakeQueue.Done(key)
+		if elapsed < expectedDelay {
+			t.Error("expected a delay of ", expectedDelay, "got ", elapsed)
+		}
+		if requeues := fakeQueue.NumRequeues("Item1"); requeues != i+1 {
+			t.Error("expected ", i+1, "requeues, got ", requeues)
+		}
+	}
+	fakeQueue.Forget("Item1")
+	if requeues := fakeQueue.NumRequeues("Item1"); requeues != 0 {
+		t.Error("expected no requeue after Forget, got ", requeues)
+	}
+}
+
+func TestObserver(t *testing.T) {
+	fakeQueue := NewKeyedQueue()
+	type transition struct {
+		transition QueueTransition
+		key        interface{}
+		items      []interface{}
+	}
+	var transitions []transition
+	fakeQueue.SetObserver(func(queueTransition QueueTransition, key interface{}, items []interface{}) {
+		transitions = append(transitions, transition{queueTransition, key, items})
+	})
+	fakeQueue.Add("Item1", "Value1")
+	fakeQueue.AddBatch([]interface{}{"Item1", "Item2"}, []interface{}{"Value11", "Value2"})
+	fakeQueue.Get()
+	fakeQueue.Done("Item1")
+	fakeQueue.SetObserver(nil)
+	fakeQueue.Add("Item3", "Value3")
+
+	expected := []transition{
+		{QueueAdded, "Item1", []interface{}{"Value1"}},
+		{QueueAdded, "Item1", []interface{}{"Value11"}},
+		{QueueAdded, "Item2", []interface{}{"Value2"}},
+		{QueueGot, "Item1", []interface{}{"Value1", "Value11"}},
+		{QueueDone, "Item1", nil},
+	}
+	if !reflect.DeepEqual(transitions, expected) {
+		t.Errorf("expected the transitions %v, got %v", expected, transitions)
+	}
+}
@@ -0,0 +1,72 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8sclient
+
+import (
+	"encoding/json"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// podAlias has the fields of Pod but not its methods, so that it's marshalled by encoding/json.
+type podAlias Pod
+
+// podJSON is the JSON form of a Pod. Its timestamps keep their nanoseconds, which metav1.Time drops,
+// so that a Pod survives a round trip unchanged. The zero timestamps are omitted.
+type podJSON struct {
+	*podAlias
+	CreateTimeStamp  *time.Time `json:"createTimeStamp,omitempty"`
+	StartTime        *time.Time `json:"startTime,omitempty"`
+	ScheduleDeadline *time.Time `json:"scheduleDeadline,omitempty"`
+}
+
+func toJSONTime(t metav1.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t.Time
+}
+
+func fromJSONTime(t *time.Time) metav1.Time {
+	if t == nil {
+		return metav1.Time{}
+	}
+	return metav1.NewTime(*t)
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (p Pod) MarshalJSON() ([]byte, error) {
+	return json.Marshal(&podJSON{
+		podAlias:         (*podAlias)(&p),
+		CreateTimeStamp:  toJSONTime(p.CreateTimeStamp),
+		StartTime:        toJSONTime(p.StartTime),
+		ScheduleDeadline: toJSONTime(p.ScheduleDeadline),
+	})
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (p *Pod) UnmarshalJSON(data []byte) error {
+	decoded := &podJSON{podAlias: (*podAlias)(p)}
+	if err := json.Unmarshal(data, decoded); err != nil {
+		return err
+	}
+	p.CreateTimeStamp = fromJSONTime(decoded.CreateTimeStamp)
+	p.StartTime = fromJSONTime(decoded.StartTime)
+	p.ScheduleDeadline = fromJSONTime(decoded.ScheduleDeadline)
+	return nil
+}
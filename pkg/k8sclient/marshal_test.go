@@ -0,0 +1,143 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8sclient
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestPod_JSONRoundTrip(t *testing.T) {
+	tolerationSeconds := int64(300)
+	nodeSelectorTerm := NodeSelectorTerm{
+		MatchExpressions: []NodeSelectorRequirement{
+			{Key: "mem-type", Operator: "NotIn", Values: []string{"DDR", "DDR2"}},
+		},
+	}
+	podAffinityTerm := PodAffinityTerm{
+		LabelSelector: &metav1.LabelSelector{
+			MatchLabels: map[string]string{"app": "web"},
+			MatchExpressions: []metav1.LabelSelectorRequirement{
+				{Key: "tier", Operator: metav1.LabelSelectorOpIn, Values: []string{"frontend"}},
+			},
+		},
+		Namespaces:  []string{"default"},
+		TopologyKey: "kubernetes.io/hostname",
+	}
+	pod := &Pod{
+		Identifier:     PodIdentifier{Name: "Pod1", Namespace: "Poseidon-Namespace"},
+		State:          PodPending,
+		CPURequest:     1500,
+		MemRequestKb:   2048,
+		EphemeralReqKb: 4096,
+		Labels:         map[string]string{"app": "web"},
+		Annotations:    map[string]string{"note": "value"},
+		NodeSelector:   map[string]string{"disktype": "ssd"},
+		OwnerRef:       "rs1-uid",
+		Affinity: &Affinity{
+			NodeAffinity: &NodeAffinity{
+				HardScheduling: &NodeSelector{NodeSelectorTerms: []NodeSelectorTerm{nodeSelectorTerm}},
+				SoftScheduling: []PreferredSchedulingTerm{{Weight: 10, Preference: nodeSelectorTerm}},
+			},
+			PodAffinity: &PodAffinity{
+				HardScheduling: []PodAffinityTerm{podAffinityTerm},
+				SoftScheduling: []WeightedPodAffinityTerm{{Weight: 20, PodAffinityTerm: podAffinityTerm}},
+			},
+			PodAntiAffinity: &PodAffinity{
+				HardScheduling: []PodAffinityTerm{podAffinityTerm},
+				SoftScheduling: []WeightedPodAffinityTerm{{Weight: 30, PodAffinityTerm: podAffinityTerm}},
+			},
+		},
+		CreateTimeStamp: metav1.NewTime(time.Date(2018, 6, 1, 10, 0, 0, 123456789, time.UTC)),
+		StartTime:       metav1.NewTime(time.Date(2018, 6, 1, 10, 0, 5, 987654321, time.UTC)),
+		Priority:        1000,
+		Tolerations: []Toleration{
+			{Key: "key", Operator: "Equal", Value: "value", Effect: "NoExecute", TolerationSeconds: &tolerationSeconds},
+		},
+		GangSize:         3,
+		ScheduleDeadline: metav1.NewTime(time.Date(2018, 6, 1, 11, 0, 0, 1, time.UTC)),
+		RestartCount:     2,
+		ControllerRef:    &ControllerRef{Kind: "Deployment", Name: "web", UID: "web-uid"},
+	}
+
+	data, err := json.Marshal(pod)
+	if err != nil {
+		t.Fatalf("Failed to marshal the pod: %v", err)
+	}
+	for _, field := range []string{`"identifier"`, `"cpuRequest"`, `"podAntiAffinity"`, `"tolerationSeconds"`, `"controllerRef"`, `"createTimeStamp":"2018-06-01T10:00:00.123456789Z"`} {
+		if !strings.Contains(string(data), field) {
+			t.Errorf("Expected %s in the JSON of the pod, got %s", field, data)
+		}
+	}
+	var decoded Pod
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Failed to unmarshal the pod: %v", err)
+	}
+	if !reflect.DeepEqual(pod, &decoded) {
+		t.Errorf("The pod changed in a JSON round trip:\nexpected %+v\ngot      %+v", pod, &decoded)
+	}
+
+	// The zero timestamps are left out and stay zero.
+	data, err = json.Marshal(&Pod{Identifier: pod.Identifier})
+	if err != nil {
+		t.Fatalf("Failed to marshal the pod: %v", err)
+	}
+	if strings.Contains(string(data), "startTime") {
+		t.Errorf("Expected no zero timestamp in the JSON of the pod, got %s", data)
+	}
+	decoded = Pod{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Failed to unmarshal the pod: %v", err)
+	}
+	if !reflect.DeepEqual(Pod{Identifier: pod.Identifier}, decoded) {
+		t.Errorf("Expected a pod with zero timestamps, got %+v", decoded)
+	}
+}
+
+func TestNode_JSONRoundTrip(t *testing.T) {
+	node := &Node{
+		Hostname:         "node0",
+		Phase:            NodeAdded,
+		IsReady:          true,
+		IsOutOfDisk:      true,
+		CPUCapacity:      4000,
+		CPUAllocatable:   3500,
+		MemCapacityKb:    8192,
+		MemAllocatableKb: 7168,
+		EphemeralCapKb:   1024,
+		EphemeralAllocKb: 512,
+		Labels:           map[string]string{"topology.kubernetes.io/zone": "zone-a"},
+		Annotations:      map[string]string{"note": "value"},
+		Taints:           []Taint{{Key: "key", Value: "value", Effect: "NoSchedule"}},
+	}
+	data, err := json.Marshal(node)
+	if err != nil {
+		t.Fatalf("Failed to marshal the node: %v", err)
+	}
+	var decoded Node
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Failed to unmarshal the node: %v", err)
+	}
+	if !reflect.DeepEqual(node, &decoded) {
+		t.Errorf("The node changed in a JSON round trip:\nexpected %+v\ngot      %+v", node, &decoded)
+	}
+}
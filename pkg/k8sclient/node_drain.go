@@ -0,0 +1,69 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8sclient
+
+import (
+	"github.com/golang/glog"
+	"k8s.io/api/core/v1"
+)
+
+// cordonedNodes holds the nodes marked unschedulable, true once they're being drained, i.e. one of
+// their pods was evicted since they were cordoned.
+var cordonedNodes map[string]bool
+
+// setNodeCordoned records whether a node is cordoned, so that the tasks of its pods are removed as soon
+// as they start being evicted.
+func (pw *PodWatcher) setNodeCordoned(nodeName string, cordoned bool) {
+	PodMux.Lock()
+	defer PodMux.Unlock()
+	if !cordoned {
+		delete(cordonedNodes, nodeName)
+		return
+	}
+	if _, ok := cordonedNodes[nodeName]; !ok {
+		cordonedNodes[nodeName] = false
+	}
+}
+
+// detectNodeDrain records that a cordoned node is being drained once one of its pods starts
+// terminating, e.g. evicted by kubectl drain. The drain is only logged once per cordon.
+func (pw *PodWatcher) detectNodeDrain(oldPod, newPod *v1.Pod) {
+	if oldPod.DeletionTimestamp != nil || newPod.DeletionTimestamp == nil || newPod.Spec.NodeName == "" {
+		return
+	}
+	nodeName := newPod.Spec.NodeName
+	PodMux.Lock()
+	draining, cordoned := cordonedNodes[nodeName]
+	if cordoned && !draining {
+		cordonedNodes[nodeName] = true
+	}
+	PodMux.Unlock()
+	if cordoned && !draining {
+		glog.Infof("Node %s is being drained, removing the tasks of its pods as they're evicted", nodeName)
+	}
+}
+
+// isDrainedPod returns true if the pod is terminating on a cordoned node. The node takes no new pods,
+// so its task can be removed right away rather than once the pod is deleted: the resources the pod
+// holds until then can't be given to another pod. The caller must hold PodMux.
+func isDrainedPod(pod *v1.Pod) bool {
+	if pod.DeletionTimestamp == nil || pod.Spec.NodeName == "" {
+		return false
+	}
+	_, cordoned := cordonedNodes[pod.Spec.NodeName]
+	return cordoned
+}
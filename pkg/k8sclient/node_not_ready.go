@@ -0,0 +1,89 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8sclient
+
+import (
+	"time"
+
+	"github.com/golang/glog"
+	"k8s.io/apimachinery/pkg/api/errors"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// watchNodeNotReady starts the timer of a node which became NotReady. Past the threshold, the
+// nodeNotReadyHandler is called so that the pods of the node are rescheduled.
+func (nw *NodeWatcher) watchNodeNotReady(nodeName string) {
+	if nw.notReadyThreshold <= 0 || nw.nodeNotReadyHandler == nil {
+		return
+	}
+	nw.notReadyTimersMux.Lock()
+	defer nw.notReadyTimersMux.Unlock()
+	if nw.notReadyTimers == nil {
+		nw.notReadyTimers = make(map[string]*time.Timer)
+	}
+	if _, ok := nw.notReadyTimers[nodeName]; ok {
+		return
+	}
+	var timer *time.Timer
+	timer = time.AfterFunc(nw.notReadyThreshold, func() {
+		nw.notReadyTimersMux.Lock()
+		// The node may have become ready, or NotReady again, since the timer fired.
+		current, ok := nw.notReadyTimers[nodeName]
+		if ok && current == timer {
+			delete(nw.notReadyTimers, nodeName)
+		}
+		nw.notReadyTimersMux.Unlock()
+		if !ok || current != timer {
+			return
+		}
+		glog.Infof("Node %s has been NotReady for %v, rescheduling its pods", nodeName, nw.notReadyThreshold)
+		nw.nodeNotReadyHandler(nodeName)
+	})
+	nw.notReadyTimers[nodeName] = timer
+}
+
+// clearNodeNotReady stops the timer of a node which became ready again or was deleted.
+func (nw *NodeWatcher) clearNodeNotReady(nodeName string) {
+	nw.notReadyTimersMux.Lock()
+	defer nw.notReadyTimersMux.Unlock()
+	if timer, ok := nw.notReadyTimers[nodeName]; ok {
+		timer.Stop()
+		delete(nw.notReadyTimers, nodeName)
+	}
+}
+
+// rescheduleNodePods deletes the pods bound to a node which stayed NotReady, with their own grace
+// period, as the node lifecycle controller does. Their controllers recreate them and Firmament places the new
+// pods, the tasks of the deleted pods are removed as their deletions are observed.
+func (pw *PodWatcher) rescheduleNodePods(nodeName string) {
+	var pods []PodIdentifier
+	PodMux.RLock()
+	for identifier, boundNode := range podToNode {
+		if boundNode == nodeName {
+			pods = append(pods, identifier)
+		}
+	}
+	PodMux.RUnlock()
+	for _, identifier := range pods {
+		err := pw.clientset.CoreV1().Pods(identifier.Namespace).Delete(identifier.Name, &meta_v1.DeleteOptions{})
+		if err != nil && !errors.IsNotFound(err) {
+			glog.Errorf("Could not delete pod %v of NotReady node %s: %v", identifier, nodeName, err)
+			continue
+		}
+		glog.V(2).Infof("rescheduleNodePods: Deleted pod %v of node %s", identifier, nodeName)
+	}
+}
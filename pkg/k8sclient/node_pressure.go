@@ -0,0 +1,50 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8sclient
+
+import (
+	"k8s.io/api/core/v1"
+)
+
+// PressureWeightLabel is the node label carrying the scheduling weight of the pressure the node is
+// under, e.g. "-20" for a node under memory and disk pressure. The Firmament API has no weight of
+// its own in the resource descriptor, so the weight is sent as a label the cost model can disfavor
+// the node with, the node isn't removed.
+const PressureWeightLabel = "poseidon.kubernetes.io/pressure-weight"
+
+// nodePressureWeight is the scheduling weight added for each pressure condition of a node.
+const nodePressureWeight int32 = -10
+
+// pressureConditions are the node conditions reporting the node is short of a resource.
+var pressureConditions = []v1.NodeConditionType{v1.NodeMemoryPressure, v1.NodeDiskPressure, v1.NodePIDPressure}
+
+// getPressureWeight returns the negative scheduling weight of the pressure conditions of the node,
+// 0 if the node is under no pressure.
+func getPressureWeight(node *v1.Node) int32 {
+	var weight int32
+	for _, cond := range node.Status.Conditions {
+		if cond.Status != v1.ConditionTrue {
+			continue
+		}
+		for _, pressure := range pressureConditions {
+			if cond.Type == pressure {
+				weight += nodePressureWeight
+			}
+		}
+	}
+	return weight
+}
@@ -19,12 +19,16 @@ package k8sclient
 import (
 	"fmt"
 	"reflect"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/golang/glog"
 	"github.com/jinzhu/copier"
+	"github.com/kubernetes-sigs/poseidon/pkg/config"
 	"github.com/kubernetes-sigs/poseidon/pkg/firmament"
+	"github.com/kubernetes-sigs/poseidon/pkg/metrics"
 	"k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -33,6 +37,7 @@ import (
 	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/cache"
+	v1helper "k8s.io/kubernetes/pkg/apis/core/v1/helper"
 )
 
 // NewNodeWatcher initializes a NodeWatcher based on the given Kubernetes client and Firmament client.
@@ -42,18 +47,26 @@ func NewNodeWatcher(client kubernetes.Interface, fc firmament.FirmamentScheduler
 	NodeToRTND = make(map[string]*firmament.ResourceTopologyNodeDescriptor)
 	ResIDToNode = make(map[string]string)
 	nodewatcher := &NodeWatcher{
-		clientset: client,
-		fc:        fc,
+		clientset:         client,
+		fc:                fc,
+		watchErrorHandler: newWatchErrorHandler("nodes"),
+		useNodeCapacity:   config.GetUseNodeCapacity(),
+		defaultArch:       config.GetDefaultArch(),
+		labelPrefixes:     config.GetNodeLabelPrefixes(),
+		resyncPeriod:      config.GetNodeResyncPeriod(),
+		notReadyThreshold: config.GetNodeNotReadyThreshold(),
 	}
-	_, controller := cache.NewInformer(
-		&cache.ListWatch{
+	store, controller := cache.NewInformer(
+		newErrorReportingListWatch(&cache.ListWatch{
 			ListFunc: func(alo metav1.ListOptions) (runtime.Object, error) {
 				return client.CoreV1().Nodes().List(alo)
 			},
 			WatchFunc: func(alo metav1.ListOptions) (watch.Interface, error) {
 				return client.CoreV1().Nodes().Watch(alo)
 			},
-		},
+		}, func(err error) {
+			nodewatcher.watchErrorHandler(err)
+		}),
 		&v1.Node{},
 		0,
 		cache.ResourceEventHandlerFuncs{
@@ -80,8 +93,10 @@ func NewNodeWatcher(client kubernetes.Interface, fc firmament.FirmamentScheduler
 			},
 		},
 	)
+	nodewatcher.store = store
 	nodewatcher.controller = controller
 	nodewatcher.nodeWorkQueue = NewKeyedQueue()
+	metrics.RegisterWorkQueue("nodes", nodewatcher.nodeWorkQueue.Len)
 	return nodewatcher
 }
 
@@ -125,13 +140,40 @@ func (nw *NodeWatcher) parseNode(node *v1.Node, phase NodePhase) *Node {
 		IsOutOfDisk:      isOutOfDisk,
 		CPUCapacity:      cpuCapQuantity.MilliValue(),
 		CPUAllocatable:   cpuAllocQuantity.MilliValue(),
-		MemCapacityKb:    memCap / bytesToKb,
-		MemAllocatableKb: memAlloc / bytesToKb,
+		MemCapacityKb:    memoryUnit.FromBytes(memCap),
+		MemAllocatableKb: memoryUnit.FromBytes(memAlloc),
 		EphemeralCapKb:   ephemeralCap / bytesToKb,
 		EphemeralAllocKb: ephemeralAlloc / bytesToKb,
 		Labels:           node.Labels,
 		Annotations:      node.Annotations,
 		Taints:           nw.getTaints(node),
+		ScalarResources:  getScalarResources(node),
+		PressureWeight:   getPressureWeight(node),
+	}
+}
+
+// getScalarResources returns the allocatable amount of every extended resource of the node, e.g.
+// example.com/fpga. The cpu, the memory and the ephemeral storage are sent in the resource vector, the
+// other native resources such as the pods and the hugepages aren't requested via the labels. Nil if
+// there's none.
+func getScalarResources(node *v1.Node) map[string]int64 {
+	var scalarResources map[string]int64
+	for name, quantity := range node.Status.Allocatable {
+		if !v1helper.IsExtendedResourceName(name) {
+			continue
+		}
+		if scalarResources == nil {
+			scalarResources = make(map[string]int64)
+		}
+		scalarResources[string(name)] = quantity.Value()
+	}
+	return scalarResources
+}
+
+// notifyNodeCordoned calls the nodeCordonedHandler, if set, once a node was cordoned or uncordoned.
+func (nw *NodeWatcher) notifyNodeCordoned(nodeName string, cordoned bool) {
+	if nw.nodeCordonedHandler != nil {
+		nw.nodeCordonedHandler(nodeName, cordoned)
 	}
 }
 
@@ -139,6 +181,7 @@ func (nw *NodeWatcher) enqueueNodeAddition(key, obj interface{}) {
 	node := obj.(*v1.Node)
 	if node.Spec.Unschedulable {
 		glog.Info("enqueueNodeAddition: received an Unschedulable node", node.Name)
+		nw.notifyNodeCordoned(node.Name, true)
 		return
 	}
 	addedNode := nw.parseNode(node, NodeAdded)
@@ -151,6 +194,7 @@ func (nw *NodeWatcher) enqueueNodeUpdate(key, oldObj, newObj interface{}) {
 	oldNode := oldObj.(*v1.Node)
 	newNode := newObj.(*v1.Node)
 	if oldNode.Spec.Unschedulable != newNode.Spec.Unschedulable {
+		nw.notifyNodeCordoned(newNode.Name, newNode.Spec.Unschedulable)
 		if oldNode.Spec.Unschedulable {
 			addedNode := nw.parseNode(newNode, NodeAdded)
 			nw.nodeWorkQueue.Add(key, addedNode)
@@ -166,6 +210,13 @@ func (nw *NodeWatcher) enqueueNodeUpdate(key, oldObj, newObj interface{}) {
 	oldIsReady, oldIsOutOfDisk := nw.getReadyAndOutOfDiskConditions(oldNode)
 	newIsReady, newIsOutOfDisk := nw.getReadyAndOutOfDiskConditions(newNode)
 
+	if oldIsReady != newIsReady {
+		if newIsReady {
+			nw.clearNodeNotReady(newNode.Name)
+		} else {
+			nw.watchNodeNotReady(newNode.Name)
+		}
+	}
 	if oldIsReady != newIsReady || oldIsOutOfDisk != newIsOutOfDisk {
 		if newIsReady && !newIsOutOfDisk {
 			addedNode := nw.parseNode(newNode, NodeAdded)
@@ -188,6 +239,12 @@ func (nw *NodeWatcher) enqueueNodeUpdate(key, oldObj, newObj interface{}) {
 	if !reflect.DeepEqual(oldNode.Spec.Taints, newNode.Spec.Taints) {
 		nodeUpdated = true
 	}
+	if !reflect.DeepEqual(getScalarResources(oldNode), getScalarResources(newNode)) {
+		nodeUpdated = true
+	}
+	if getPressureWeight(oldNode) != getPressureWeight(newNode) {
+		nodeUpdated = true
+	}
 	if nodeUpdated {
 		updatedNode := nw.parseNode(newNode, NodeUpdated)
 		nw.nodeWorkQueue.Add(key, updatedNode)
@@ -197,8 +254,10 @@ func (nw *NodeWatcher) enqueueNodeUpdate(key, oldObj, newObj interface{}) {
 
 func (nw *NodeWatcher) enqueueNodeDeletion(key, obj interface{}) {
 	node := obj.(*v1.Node)
+	nw.clearNodeNotReady(node.Name)
 	if node.Spec.Unschedulable {
 		// Poseidon doesn't care about Unschedulable nodes.
+		nw.notifyNodeCordoned(node.Name, false)
 		return
 	}
 	deletedNode := &Node{
@@ -229,6 +288,9 @@ func (nw *NodeWatcher) Run(stopCh <-chan struct{}, nWorkers int) {
 	for i := 0; i < nWorkers; i++ {
 		go wait.Until(nw.nodeWorker, time.Second, stopCh)
 	}
+	if nw.resyncPeriod > 0 {
+		go wait.Until(nw.resyncNodes, nw.resyncPeriod, stopCh)
+	}
 
 	<-stopCh
 	glog.Info("Stopping node watcher")
@@ -243,6 +305,7 @@ func (nw *NodeWatcher) nodeWorker() {
 			}
 			for _, item := range items {
 				node := item.(*Node)
+				metrics.WorkQueueItemProcessed("nodes")
 				switch node.Phase {
 				case NodeAdded:
 					NodeMux.Lock()
@@ -257,6 +320,9 @@ func (nw *NodeWatcher) nodeWorker() {
 					ResIDToNode[rtnd.GetResourceDesc().GetUuid()] = node.Hostname
 					NodeMux.Unlock()
 					firmament.NodeAdded(nw.fc, rtnd)
+					if nw.nodeAddedHandler != nil {
+						nw.nodeAddedHandler()
+					}
 
 				case NodeDeleted:
 					NodeMux.RLock()
@@ -315,27 +381,17 @@ func (nw *NodeWatcher) createResourceTopologyForNode(node *Node) *firmament.Reso
 	resUUID := nw.generateResourceID(node.Hostname)
 	rtnd := &firmament.ResourceTopologyNodeDescriptor{
 		ResourceDesc: &firmament.ResourceDescriptor{
-			Uuid:         resUUID,
-			Type:         firmament.ResourceDescriptor_RESOURCE_MACHINE,
-			State:        firmament.ResourceDescriptor_RESOURCE_IDLE,
-			FriendlyName: node.Hostname,
-			ResourceCapacity: &firmament.ResourceVector{
-				RamCap:       uint64(node.MemCapacityKb),
-				CpuCores:     float32(node.CPUCapacity),
-				EphemeralCap: uint64(node.EphemeralCapKb),
-			},
+			Uuid:             resUUID,
+			Type:             firmament.ResourceDescriptor_RESOURCE_MACHINE,
+			State:            firmament.ResourceDescriptor_RESOURCE_IDLE,
+			FriendlyName:     node.Hostname,
+			ResourceCapacity: nw.getResourceCapacity(node),
 		},
 	}
 	ResIDToNode[resUUID] = node.Hostname
 	// TODO(ionel) Add annotations.
 	// Add labels.
-	for label, value := range node.Labels {
-		rtnd.ResourceDesc.Labels = append(rtnd.ResourceDesc.Labels,
-			&firmament.Label{
-				Key:   label,
-				Value: value,
-			})
-	}
+	rtnd.ResourceDesc.Labels = nw.getFirmamentLabels(node)
 
 	for _, taint := range node.Taints {
 		rtnd.ResourceDesc.Taints = append(rtnd.ResourceDesc.Taints,
@@ -353,17 +409,13 @@ func (nw *NodeWatcher) createResourceTopologyForNode(node *Node) *firmament.Reso
 	puUUID := nw.generateResourceID(friendlyName)
 	puRtnd := &firmament.ResourceTopologyNodeDescriptor{
 		ResourceDesc: &firmament.ResourceDescriptor{
-			Uuid:         puUUID,
-			Type:         firmament.ResourceDescriptor_RESOURCE_PU,
-			State:        firmament.ResourceDescriptor_RESOURCE_IDLE,
-			FriendlyName: friendlyName,
-			Labels:       rtnd.ResourceDesc.Labels,
-			ResourceCapacity: &firmament.ResourceVector{
-				RamCap:       uint64(node.MemCapacityKb),
-				CpuCores:     float32(node.CPUCapacity),
-				EphemeralCap: uint64(node.EphemeralCapKb),
-			},
-			Taints: rtnd.ResourceDesc.Taints,
+			Uuid:             puUUID,
+			Type:             firmament.ResourceDescriptor_RESOURCE_PU,
+			State:            firmament.ResourceDescriptor_RESOURCE_IDLE,
+			FriendlyName:     friendlyName,
+			Labels:           rtnd.ResourceDesc.Labels,
+			ResourceCapacity: nw.getResourceCapacity(node),
+			Taints:           rtnd.ResourceDesc.Taints,
 		},
 		ParentId: resUUID,
 	}
@@ -373,21 +425,138 @@ func (nw *NodeWatcher) createResourceTopologyForNode(node *Node) *firmament.Reso
 	return rtnd
 }
 
+// getResourceCapacity returns the resources of the node available to the pods, i.e. its allocatable
+// resources, or its capacity if useNodeCapacity is set. The capacity is also used for a resource whose
+// allocatable amount the node doesn't report.
+func (nw *NodeWatcher) getResourceCapacity(node *Node) *firmament.ResourceVector {
+	cpu, memKb, ephemeralKb := node.CPUAllocatable, node.MemAllocatableKb, node.EphemeralAllocKb
+	if nw.useNodeCapacity || cpu == 0 {
+		cpu = node.CPUCapacity
+	}
+	if nw.useNodeCapacity || memKb == 0 {
+		memKb = node.MemCapacityKb
+	}
+	if nw.useNodeCapacity || ephemeralKb == 0 {
+		ephemeralKb = node.EphemeralCapKb
+	}
+	return &firmament.ResourceVector{
+		RamCap:       uint64(memKb),
+		CpuCores:     float32(cpu),
+		EphemeralCap: uint64(ephemeralKb),
+	}
+}
+
+// generateResourceID returns the ID of a resource of the node, distinct from the resources of the
+// nodes of the other clusters sharing Firmament.
 func (nw *NodeWatcher) generateResourceID(seed string) string {
-	return GenerateUUID(seed)
+	return GenerateUUID(withClusterID(seed))
 }
 
-// updateResourceDescriptor to update the labels to resource descriptor
-func (nw *NodeWatcher) updateResourceDescriptor(node *Node, rtnd *firmament.ResourceTopologyNodeDescriptor) {
-	rtnd.ResourceDesc.Labels = nil
-	rtnd.ResourceDesc.Taints = nil
+// forwardsLabel returns true if the node label is sent to Firmament.
+func (nw *NodeWatcher) forwardsLabel(label string) bool {
+	if len(nw.labelPrefixes) == 0 {
+		return true
+	}
+	switch label {
+	case LabelOS, BetaLabelOS, LabelArch, BetaLabelArch, LabelHostname:
+		return true
+	}
+	for _, prefix := range nw.labelPrefixes {
+		if strings.HasPrefix(label, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// getFirmamentLabels returns the node labels matching the configured prefixes. The OS and arch labels
+// are always set so that the pods can select the OS and the CPU architecture of their nodes, nodes
+// without OS label are linux nodes and nodes without arch label are of the default arch. The hostname
+// label is always forwarded, so that the pods can prefer a node by name. The scalar resources of the
+// node are forwarded as labels prefixed with ScalarResourceLabelPrefix, and the weight of the pressure
+// the node is under as the PressureWeightLabel.
+func (nw *NodeWatcher) getFirmamentLabels(node *Node) []*firmament.Label {
+	var firmamentLabels []*firmament.Label
 	for label, value := range node.Labels {
-		rtnd.ResourceDesc.Labels = append(rtnd.ResourceDesc.Labels,
+		if !nw.forwardsLabel(label) {
+			continue
+		}
+		firmamentLabels = append(firmamentLabels,
 			&firmament.Label{
 				Key:   label,
 				Value: value,
 			})
 	}
+	os := getNodeOS(node.Labels)
+	for _, label := range []string{LabelOS, BetaLabelOS} {
+		if _, ok := node.Labels[label]; !ok {
+			firmamentLabels = append(firmamentLabels,
+				&firmament.Label{
+					Key:   label,
+					Value: os,
+				})
+		}
+	}
+	arch := nw.getNodeArch(node.Labels)
+	for _, label := range []string{LabelArch, BetaLabelArch} {
+		if _, ok := node.Labels[label]; !ok {
+			firmamentLabels = append(firmamentLabels,
+				&firmament.Label{
+					Key:   label,
+					Value: arch,
+				})
+		}
+	}
+	for name, value := range node.ScalarResources {
+		firmamentLabels = append(firmamentLabels,
+			&firmament.Label{
+				Key:   ScalarResourceLabelPrefix + name,
+				Value: strconv.FormatInt(value, 10),
+			})
+	}
+	if node.PressureWeight != 0 {
+		firmamentLabels = append(firmamentLabels,
+			&firmament.Label{
+				Key:   PressureWeightLabel,
+				Value: strconv.FormatInt(int64(node.PressureWeight), 10),
+			})
+	}
+	return firmamentLabels
+}
+
+// getNodeArch returns the CPU architecture of a node given its labels.
+func (nw *NodeWatcher) getNodeArch(labels map[string]string) string {
+	if arch, ok := labels[LabelArch]; ok {
+		return arch
+	}
+	if arch, ok := labels[BetaLabelArch]; ok {
+		return arch
+	}
+	if nw.defaultArch != "" {
+		return nw.defaultArch
+	}
+	return DefaultArch
+}
+
+// getNodeOS returns the OS of a node given its labels.
+func getNodeOS(labels map[string]string) string {
+	if os, ok := labels[LabelOS]; ok {
+		return os
+	}
+	if os, ok := labels[BetaLabelOS]; ok {
+		return os
+	}
+	return DefaultOS
+}
+
+// updateResourceDescriptor to update the labels, the taints and the resources to resource descriptor
+func (nw *NodeWatcher) updateResourceDescriptor(node *Node, rtnd *firmament.ResourceTopologyNodeDescriptor) {
+	rtnd.ResourceDesc.ResourceCapacity = nw.getResourceCapacity(node)
+	for _, childRTND := range rtnd.GetChildren() {
+		childRTND.ResourceDesc.ResourceCapacity = nw.getResourceCapacity(node)
+	}
+	rtnd.ResourceDesc.Labels = nw.getFirmamentLabels(node)
+	rtnd.ResourceDesc.Taints = nil
 
 	for _, taint := range node.Taints {
 		rtnd.ResourceDesc.Taints = append(rtnd.ResourceDesc.Taints,
@@ -398,3 +567,31 @@ func (nw *NodeWatcher) updateResourceDescriptor(node *Node, rtnd *firmament.Reso
 			})
 	}
 }
+
+// sameResources returns true if the resource vectors hold the same cpu, memory and ephemeral storage.
+func sameResources(a, b *firmament.ResourceVector) bool {
+	return a.GetCpuCores() == b.GetCpuCores() && a.GetRamCap() == b.GetRamCap() && a.GetEphemeralCap() == b.GetEphemeralCap()
+}
+
+// resyncNodes reconciles the resources reported to Firmament for the known nodes with their current
+// allocatable resources, the nodes which drifted, e.g. because their allocatable resources changed
+// without any other change of the node, are updated.
+func (nw *NodeWatcher) resyncNodes() {
+	for _, obj := range nw.store.List() {
+		node, ok := obj.(*v1.Node)
+		if !ok {
+			continue
+		}
+		parsedNode := nw.parseNode(node, NodeUpdated)
+		capacity := nw.getResourceCapacity(parsedNode)
+		NodeMux.RLock()
+		rtnd, ok := NodeToRTND[node.Name]
+		drifted := ok && !sameResources(rtnd.GetResourceDesc().GetResourceCapacity(), capacity)
+		NodeMux.RUnlock()
+		if !drifted {
+			continue
+		}
+		glog.Infof("resyncNodes: Resources of node %s drifted, updating them to %v", node.Name, capacity)
+		nw.nodeWorkQueue.Add(node.Name, parsedNode)
+	}
+}
@@ -28,6 +28,7 @@ import (
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes/fake"
+	core "k8s.io/client-go/testing"
 	"k8s.io/client-go/tools/cache"
 )
 
@@ -82,6 +83,27 @@ func BuildFirmamentResourceDescriptor(
 	}
 }
 
+// BuildLabeledFirmamentResourceDescriptor constructs a ResourceTopologyNodeDescriptor whose machine
+// and PU carry the labels Poseidon gives a node without OS and arch labels.
+func BuildLabeledFirmamentResourceDescriptor(
+	uuid, friendlyName string,
+	cpuCores float32,
+	ramCap uint64,
+	coreOneUUID, coreOnefriendlyName string) *firmament.ResourceTopologyNodeDescriptor {
+
+	// Nodes without OS label are labeled as linux nodes, and nodes without arch label as amd64 nodes.
+	labels := []*firmament.Label{
+		{Key: LabelOS, Value: DefaultOS},
+		{Key: BetaLabelOS, Value: DefaultOS},
+		{Key: LabelArch, Value: DefaultArch},
+		{Key: BetaLabelArch, Value: DefaultArch},
+	}
+	rtnd := BuildFirmamentResourceDescriptor(uuid, friendlyName, cpuCores, ramCap, coreOneUUID, coreOnefriendlyName)
+	rtnd.ResourceDesc.Labels = labels
+	rtnd.Children[0].ResourceDesc.Labels = labels
+	return rtnd
+}
+
 //BuildNode build a v1.Node struct to test
 func BuildNode(name, requestCPU, requestMem string,
 	nodeLabel map[string]string,
@@ -319,7 +341,7 @@ func TestNodeWatcher_createResourceTopologyForNode(t *testing.T) {
 				Labels:           nil,
 				Annotations:      nil,
 			},
-			expected: BuildFirmamentResourceDescriptor("e8107a51-344b-4946-963c-6a4f4eb35f0c",
+			expected: BuildLabeledFirmamentResourceDescriptor("e8107a51-344b-4946-963c-6a4f4eb35f0c",
 				"node0",
 				1000,
 				9765625,
@@ -339,7 +361,7 @@ func TestNodeWatcher_createResourceTopologyForNode(t *testing.T) {
 				Labels:           nil,
 				Annotations:      nil,
 			},
-			expected: BuildFirmamentResourceDescriptor("3e4eff18-02e5-4066-aac1-e49c5d4b9766",
+			expected: BuildLabeledFirmamentResourceDescriptor("3e4eff18-02e5-4066-aac1-e49c5d4b9766",
 				"node1",
 				1000,
 				2048,
@@ -357,6 +379,40 @@ func TestNodeWatcher_createResourceTopologyForNode(t *testing.T) {
 	}
 }
 
+// TestNodeWatcher_ClusterID checks the same node of two clusters sharing Firmament gets distinct
+// resource IDs.
+func TestNodeWatcher_ClusterID(t *testing.T) {
+	defer SetClusterID("")
+	testObj := initializeNodeObj(t)
+	nodeWatch := NewNodeWatcher(testObj.kubeClient, testObj.firmamentClient)
+	node := &Node{
+		Hostname:      "node0",
+		Phase:         NodeAdded,
+		IsReady:       true,
+		CPUCapacity:   1000,
+		MemCapacityKb: 2048,
+	}
+	var resIDs, puIDs []string
+	for _, id := range []string{"east", "west"} {
+		SetClusterID(id)
+		rtnd := nodeWatch.createResourceTopologyForNode(node)
+		resIDs = append(resIDs, rtnd.ResourceDesc.Uuid)
+		puIDs = append(puIDs, rtnd.Children[0].ResourceDesc.Uuid)
+	}
+	if resIDs[0] == resIDs[1] {
+		t.Errorf("expected distinct resource IDs for the nodes of two clusters, got %s", resIDs[0])
+	}
+	if puIDs[0] == puIDs[1] {
+		t.Errorf("expected distinct PU IDs for the nodes of two clusters, got %s", puIDs[0])
+	}
+
+	// Without cluster ID, the resources are identified as before.
+	SetClusterID("")
+	if got := nodeWatch.createResourceTopologyForNode(node).ResourceDesc.Uuid; got != "e8107a51-344b-4946-963c-6a4f4eb35f0c" {
+		t.Errorf("expected the resource to be identified by its hostname only, got %s", got)
+	}
+}
+
 func TestNodeWatcher_nodeWorker(t *testing.T) {
 	fakeNow := metav1.Now()
 	var testData = []struct {
@@ -478,3 +534,347 @@ func TestNodeWatcher_nodeWorker(t *testing.T) {
 	<-timer1.C
 	nodeWatch.nodeWorkQueue.ShutDown()
 }
+
+func TestNodeWatcher_AllocatableResources(t *testing.T) {
+	node := BuildNode("node0", "4", "8Gi", nil, nil, false)
+	node.Status.Allocatable = v1.ResourceList{
+		v1.ResourceCPU:    resource.MustParse("3500m"),
+		v1.ResourceMemory: resource.MustParse("7Gi"),
+	}
+	testObj := initializeNodeObj(t)
+	defer testObj.mockCtrl.Finish()
+	nodeWatch := NewNodeWatcher(testObj.kubeClient, testObj.firmamentClient)
+	parsedNode := nodeWatch.parseNode(node, NodeAdded)
+
+	var testData = []struct {
+		useNodeCapacity bool
+		expectedCPU     float32
+		expectedRamCap  uint64
+	}{
+		{useNodeCapacity: false, expectedCPU: 3500, expectedRamCap: uint64(memoryUnit.FromBytes(7 * 1024 * 1024 * 1024))},
+		{useNodeCapacity: true, expectedCPU: 4000, expectedRamCap: uint64(memoryUnit.FromBytes(8 * 1024 * 1024 * 1024))},
+	}
+	for _, data := range testData {
+		nodeWatch.useNodeCapacity = data.useNodeCapacity
+		rtnd := nodeWatch.createResourceTopologyForNode(parsedNode)
+		for _, rd := range []*firmament.ResourceDescriptor{rtnd.ResourceDesc, rtnd.Children[0].ResourceDesc} {
+			capacity := rd.ResourceCapacity
+			if capacity.CpuCores != data.expectedCPU || capacity.RamCap != data.expectedRamCap {
+				t.Errorf("useNodeCapacity %v: expected %v cpu and %v memory for %s, got %v and %v", data.useNodeCapacity,
+					data.expectedCPU, data.expectedRamCap, rd.FriendlyName, capacity.CpuCores, capacity.RamCap)
+			}
+		}
+	}
+}
+
+func TestNodeWatcher_LabelPrefixes(t *testing.T) {
+	labels := map[string]string{
+		"topology.kubernetes.io/zone": "zone-a",
+		"example.com/rack":            "rack1",
+		LabelOS:                       "linux",
+	}
+	node := BuildNode("node0", "4", "8Gi", labels, nil, false)
+	testObj := initializeNodeObj(t)
+	defer testObj.mockCtrl.Finish()
+	nodeWatch := NewNodeWatcher(testObj.kubeClient, testObj.firmamentClient)
+	parsedNode := nodeWatch.parseNode(node, NodeAdded)
+
+	var testData = []struct {
+		labelPrefixes []string
+		forwarded     []string
+		dropped       []string
+	}{
+		{labelPrefixes: nil, forwarded: []string{"topology.kubernetes.io/zone", "example.com/rack", LabelOS, LabelArch}},
+		{labelPrefixes: []string{"topology.kubernetes.io/"}, forwarded: []string{"topology.kubernetes.io/zone", LabelOS, LabelArch}, dropped: []string{"example.com/rack"}},
+		{labelPrefixes: []string{"example.com/"}, forwarded: []string{"example.com/rack", LabelOS, LabelArch}, dropped: []string{"topology.kubernetes.io/zone"}},
+	}
+	for _, data := range testData {
+		nodeWatch.labelPrefixes = data.labelPrefixes
+		rtnd := nodeWatch.createResourceTopologyForNode(parsedNode)
+		firmamentLabels := make(map[string]string)
+		for _, label := range rtnd.ResourceDesc.Labels {
+			firmamentLabels[label.Key] = label.Value
+		}
+		for _, label := range data.forwarded {
+			if _, ok := firmamentLabels[label]; !ok {
+				t.Errorf("labelPrefixes %v: expected the %s label to be forwarded, got %v", data.labelPrefixes, label, firmamentLabels)
+			}
+		}
+		if zone, ok := firmamentLabels["topology.kubernetes.io/zone"]; ok && zone != "zone-a" {
+			t.Errorf("labelPrefixes %v: expected the zone-a zone, got %s", data.labelPrefixes, zone)
+		}
+		for _, label := range data.dropped {
+			if _, ok := firmamentLabels[label]; ok {
+				t.Errorf("labelPrefixes %v: expected the %s label to be dropped, got %v", data.labelPrefixes, label, firmamentLabels)
+			}
+		}
+	}
+}
+
+func TestNodeWatcher_ResyncNodes(t *testing.T) {
+	node := BuildNode("node0", "4", "8Gi", nil, nil, false)
+	node.Status.Allocatable = v1.ResourceList{
+		v1.ResourceCPU:    resource.MustParse("3500m"),
+		v1.ResourceMemory: resource.MustParse("7Gi"),
+	}
+	testObj := initializeNodeObj(t)
+	defer testObj.mockCtrl.Finish()
+	nodeWatch := NewNodeWatcher(testObj.kubeClient, testObj.firmamentClient)
+
+	added := make(chan struct{})
+	updated := make(chan *firmament.ResourceTopologyNodeDescriptor, 2)
+	gomock.InOrder(
+		testObj.firmamentClient.EXPECT().NodeAdded(gomock.Any(), gomock.Any()).Do(func(_ interface{}, _ *firmament.ResourceTopologyNodeDescriptor) {
+			close(added)
+		}).Return(&firmament.NodeAddedResponse{Type: firmament.NodeReplyType_NODE_ADDED_OK}, nil),
+		testObj.firmamentClient.EXPECT().NodeUpdated(gomock.Any(), gomock.Any()).Do(func(_ interface{}, rtnd *firmament.ResourceTopologyNodeDescriptor) {
+			updated <- rtnd
+		}).Return(&firmament.NodeUpdatedResponse{Type: firmament.NodeReplyType_NODE_UPDATED_OK}, nil),
+	)
+	go nodeWatch.nodeWorker()
+	nodeWatch.store.Add(node)
+	nodeWatch.enqueueNodeAddition(node.Name, node)
+	select {
+	case <-added:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the node to be added")
+	}
+	// Nothing drifted yet.
+	nodeWatch.resyncNodes()
+
+	// The allocatable resources of the node shrink without any event reaching the watcher.
+	driftedNode := node.DeepCopy()
+	driftedNode.Status.Allocatable[v1.ResourceCPU] = resource.MustParse("3")
+	nodeWatch.store.Update(driftedNode)
+	nodeWatch.resyncNodes()
+	select {
+	case rtnd := <-updated:
+		for _, rd := range []*firmament.ResourceDescriptor{rtnd.ResourceDesc, rtnd.Children[0].ResourceDesc} {
+			if cpu := rd.ResourceCapacity.CpuCores; cpu != 3000 {
+				t.Errorf("expected the resync to correct the cpu of %s to 3000, got %v", rd.FriendlyName, cpu)
+			}
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the node to be resynced")
+	}
+
+	// The node is in sync again.
+	nodeWatch.resyncNodes()
+	select {
+	case <-updated:
+		t.Error("expected no update of a node in sync")
+	case <-time.After(200 * time.Millisecond):
+	}
+	nodeWatch.nodeWorkQueue.ShutDown()
+}
+
+// TestNodeWatcher_NodeNotReady checks the pods of a node which stays NotReady past the threshold are
+// deleted for rescheduling, and not those of a node which becomes ready again in time.
+func TestNodeWatcher_NodeNotReady(t *testing.T) {
+	ready := []v1.NodeCondition{{Type: v1.NodeReady, Status: v1.ConditionTrue}}
+	notReady := []v1.NodeCondition{{Type: v1.NodeReady, Status: v1.ConditionFalse}}
+	testObj := initializeNodeObj(t)
+	defer testObj.mockCtrl.Finish()
+	nodeWatch := NewNodeWatcher(testObj.kubeClient, testObj.firmamentClient)
+	podWatch := NewPodWatcher(1, 6, "poseidon", testObj.kubeClient, testObj.firmamentClient)
+	nodeWatch.notReadyThreshold = 200 * time.Millisecond
+	nodeWatch.nodeNotReadyHandler = podWatch.rescheduleNodePods
+
+	PodMux.Lock()
+	podToNode[PodIdentifier{Name: "pod0", Namespace: "default"}] = "node0"
+	podToNode[PodIdentifier{Name: "pod1", Namespace: "default"}] = "node0"
+	podToNode[PodIdentifier{Name: "pod2", Namespace: "default"}] = "node1"
+	PodMux.Unlock()
+
+	nodeWatch.enqueueNodeUpdate("node0", BuildNode("node0", "4", "8Gi", nil, ready, false), BuildNode("node0", "4", "8Gi", nil, notReady, false))
+	nodeWatch.enqueueNodeUpdate("node1", BuildNode("node1", "4", "8Gi", nil, ready, false), BuildNode("node1", "4", "8Gi", nil, notReady, false))
+	// node1 recovers before the threshold.
+	time.Sleep(50 * time.Millisecond)
+	nodeWatch.enqueueNodeUpdate("node1", BuildNode("node1", "4", "8Gi", nil, notReady, false), BuildNode("node1", "4", "8Gi", nil, ready, false))
+	if len(podWatch.podWorkQueue.(*Type).items) != 0 {
+		t.Fatalf("expected no pod to be requeued before the threshold, got %v", podWatch.podWorkQueue.(*Type).items)
+	}
+
+	deletedPods := func() map[string]bool {
+		deleted := make(map[string]bool)
+		for _, action := range testObj.kubeClient.Actions() {
+			if deleteAction, ok := action.(core.DeleteAction); ok && action.GetResource().Resource == "pods" {
+				deleted[deleteAction.GetName()] = true
+			}
+		}
+		return deleted
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for len(deletedPods()) < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	// Leave the timer of node1 the time to fire, had it not been stopped.
+	time.Sleep(300 * time.Millisecond)
+	deleted := deletedPods()
+	if len(deleted) != 2 || !deleted["pod0"] || !deleted["pod1"] {
+		t.Fatalf("expected the 2 pods of node0 to be deleted, got %v", deleted)
+	}
+	// The tasks are only removed once the deletions are observed.
+	if items := podWatch.podWorkQueue.(*Type).items; len(items) != 0 {
+		t.Errorf("expected no pod to be requeued before its deletion is observed, got %v", items)
+	}
+	PodMux.RLock()
+	defer PodMux.RUnlock()
+	if node, ok := podToNode[PodIdentifier{Name: "pod0", Namespace: "default"}]; !ok || node != "node0" {
+		t.Errorf("expected pod0 to stay on node0 until its deletion is observed, got %q", node)
+	}
+}
+
+// TestNodeWatcher_NodeDrain checks the task of a pod of a cordoned node is removed as soon as the pod is
+// evicted, and not that of a pod of a node which isn't cordoned.
+func TestNodeWatcher_NodeDrain(t *testing.T) {
+	fakeNow := metav1.Now()
+	testObj := initializeNodeObj(t)
+	defer testObj.mockCtrl.Finish()
+	nodeWatch := NewNodeWatcher(testObj.kubeClient, testObj.firmamentClient)
+	podWatch := NewPodWatcher(1, 6, "poseidon", testObj.kubeClient, testObj.firmamentClient)
+	nodeWatch.nodeCordonedHandler = podWatch.setNodeCordoned
+
+	pods := make(map[string]*v1.Pod)
+	for name, node := range map[string]string{"drained0": "node2", "drained1": "node2", "kept": "node3"} {
+		pod := BuildPod("default", name, nil, GetPodPhase("Running"), "1", "1024", &fakeNow, "abcdfe12345")
+		pod.DeletionTimestamp = nil
+		pod.Spec.NodeName = node
+		pods[name] = pod
+		PodMux.Lock()
+		podToNode[PodIdentifier{Name: name, Namespace: "default"}] = node
+		PodMux.Unlock()
+	}
+	evict := func(name string) {
+		evictedPod := pods[name].DeepCopy()
+		evictedPod.DeletionTimestamp = &fakeNow
+		podWatch.enqueuePodUpdate("default/"+name, pods[name], evictedPod)
+		pods[name] = evictedPod
+	}
+
+	// The node isn't cordoned, its evicted pod is only deleted in due course.
+	evict("kept")
+	if len(podWatch.podWorkQueue.(*Type).items) != 0 {
+		t.Fatalf("expected no pod of an uncordoned node to be requeued, got %v", podWatch.podWorkQueue.(*Type).items)
+	}
+
+	nodeWatch.enqueueNodeUpdate("node2", BuildNode("node2", "4", "8Gi", nil, nil, false), BuildNode("node2", "4", "8Gi", nil, nil, true))
+	if len(podWatch.podWorkQueue.(*Type).items) != 0 {
+		t.Fatalf("expected no pod to be requeued before the drain, got %v", podWatch.podWorkQueue.(*Type).items)
+	}
+	evict("drained0")
+	items := podWatch.podWorkQueue.(*Type).items
+	if len(items) != 1 {
+		t.Fatalf("expected only the evicted pod of the drained node to be removed, got %v", items)
+	}
+	evict("drained1")
+	items = podWatch.podWorkQueue.(*Type).items
+	if len(items) != 2 {
+		t.Fatalf("expected the 2 evicted pods of the drained node to be removed, got %v", items)
+	}
+	for _, name := range []string{"drained0", "drained1"} {
+		removed, ok := items["default/"+name]
+		if !ok || len(removed) != 1 || removed[0].(*Pod).State != PodDeleted {
+			t.Errorf("expected pod %s to be removed, got %v", name, removed)
+		}
+	}
+	// The later updates of the terminating pod are ignored.
+	evictedPod := pods["drained0"].DeepCopy()
+	evictedPod.Status.Phase = v1.PodSucceeded
+	podWatch.enqueuePodUpdate("default/drained0", pods["drained0"], evictedPod)
+	if removed := podWatch.podWorkQueue.(*Type).items["default/drained0"]; len(removed) != 1 {
+		t.Errorf("expected the update of the removed pod to be ignored, got %v", removed)
+	}
+}
+
+func TestNodeWatcher_ScalarResources(t *testing.T) {
+	node := BuildNode("node0", "4", "8Gi", nil, nil, false)
+	node.Status.Allocatable = v1.ResourceList{
+		v1.ResourceCPU:                      resource.MustParse("4"),
+		v1.ResourceMemory:                   resource.MustParse("8Gi"),
+		v1.ResourceName("example.com/fpga"): resource.MustParse("4"),
+		v1.ResourcePods:                     resource.MustParse("110"),
+		v1.ResourceName("hugepages-2Mi"):    resource.MustParse("1Gi"),
+	}
+	testObj := initializeNodeObj(t)
+	defer testObj.mockCtrl.Finish()
+	nodeWatch := NewNodeWatcher(testObj.kubeClient, testObj.firmamentClient)
+	parsedNode := nodeWatch.parseNode(node, NodeAdded)
+
+	// The native resources other than the cpu and the memory aren't forwarded.
+	expected := map[string]int64{"example.com/fpga": 4}
+	if !reflect.DeepEqual(parsedNode.ScalarResources, expected) {
+		t.Fatalf("expected the scalar resources %v, got %v", expected, parsedNode.ScalarResources)
+	}
+	rtnd := nodeWatch.createResourceTopologyForNode(parsedNode)
+	found := false
+	for _, label := range rtnd.ResourceDesc.Labels {
+		if label.Key == ScalarResourceLabelPrefix+"example.com/fpga" {
+			found = true
+			if label.Value != "4" {
+				t.Errorf("expected 4 example.com/fpga, got %s", label.Value)
+			}
+		}
+	}
+	if !found {
+		t.Errorf("expected the example.com/fpga resource to be forwarded, got %v", rtnd.ResourceDesc.Labels)
+	}
+
+	// A change of the allocatable scalar resources updates the node.
+	newNode := node.DeepCopy()
+	newNode.Status.Allocatable[v1.ResourceName("example.com/fpga")] = resource.MustParse("2")
+	nodeWatch.enqueueNodeUpdate(node.Name, node, newNode)
+	_, items, _ := nodeWatch.nodeWorkQueue.Get()
+	if len(items) != 1 || items[0].(*Node).Phase != NodeUpdated || items[0].(*Node).ScalarResources["example.com/fpga"] != 2 {
+		t.Errorf("expected the node to be updated with 2 example.com/fpga, got %v", items)
+	}
+}
+
+// TestNodeWatcher_PressureWeight checks the pressure conditions of a node are sent as a negative
+// scheduling weight, and that a change of the pressure updates the node.
+func TestNodeWatcher_PressureWeight(t *testing.T) {
+	conditions := []v1.NodeCondition{
+		{Type: v1.NodeReady, Status: v1.ConditionTrue},
+		{Type: v1.NodeMemoryPressure, Status: v1.ConditionTrue},
+		{Type: v1.NodeDiskPressure, Status: v1.ConditionFalse},
+	}
+	node := BuildNode("node0", "4", "8Gi", nil, conditions, false)
+	testObj := initializeNodeObj(t)
+	defer testObj.mockCtrl.Finish()
+	nodeWatch := NewNodeWatcher(testObj.kubeClient, testObj.firmamentClient)
+	parsedNode := nodeWatch.parseNode(node, NodeAdded)
+	if parsedNode.PressureWeight != nodePressureWeight {
+		t.Fatalf("expected the pressure weight %d, got %d", nodePressureWeight, parsedNode.PressureWeight)
+	}
+	rtnd := nodeWatch.createResourceTopologyForNode(parsedNode)
+	found := false
+	for _, label := range rtnd.ResourceDesc.Labels {
+		if label.Key == PressureWeightLabel {
+			found = true
+			if label.Value != "-10" {
+				t.Errorf("expected the pressure weight -10, got %s", label.Value)
+			}
+		}
+	}
+	if !found {
+		t.Errorf("expected the pressure weight to be forwarded, got %v", rtnd.ResourceDesc.Labels)
+	}
+
+	// The disk pressure adds to the memory pressure.
+	newNode := node.DeepCopy()
+	newNode.Status.Conditions[2].Status = v1.ConditionTrue
+	nodeWatch.enqueueNodeUpdate(node.Name, node, newNode)
+	_, items, _ := nodeWatch.nodeWorkQueue.Get()
+	if len(items) != 1 || items[0].(*Node).Phase != NodeUpdated || items[0].(*Node).PressureWeight != 2*nodePressureWeight {
+		t.Errorf("expected the node to be updated with the pressure weight %d, got %v", 2*nodePressureWeight, items)
+	}
+
+	// A node under no pressure has no weight.
+	node.Status.Conditions[1].Status = v1.ConditionFalse
+	rtnd = nodeWatch.createResourceTopologyForNode(nodeWatch.parseNode(node, NodeAdded))
+	for _, label := range rtnd.ResourceDesc.Labels {
+		if label.Key == PressureWeightLabel {
+			t.Errorf("expected no pressure weight for a node under no pressure, got %s", label.Value)
+		}
+	}
+}
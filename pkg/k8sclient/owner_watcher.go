@@ -0,0 +1,160 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8sclient
+
+import (
+	"github.com/golang/glog"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+// OwnerWatcher caches the controllers owning the pods, e.g. the ReplicaSets and the Jobs, so that the pod watcher reads
+// them from the informer stores rather than getting them from the API server in its event handlers.
+type OwnerWatcher struct {
+	// stores maps the kinds of the controllers to the stores of their informers.
+	stores      map[string]cache.Store
+	controllers []cache.Controller
+	// watchErrorHandler is called on the list and watch errors of the informers.
+	watchErrorHandler func(err error)
+	// ownerChangedHandler, if set, is called with the UID of a controller updated or deleted.
+	ownerChangedHandler func(uid types.UID)
+}
+
+// NewOwnerWatcher initializes an OwnerWatcher.
+func NewOwnerWatcher(client kubernetes.Interface) *OwnerWatcher {
+	ow := &OwnerWatcher{
+		stores:            make(map[string]cache.Store),
+		watchErrorHandler: newWatchErrorHandler("owners"),
+	}
+	ow.addInformer("ReplicaSet", &cache.ListWatch{
+		ListFunc: func(alo metav1.ListOptions) (runtime.Object, error) {
+			return client.AppsV1().ReplicaSets("").List(alo)
+		},
+		WatchFunc: func(alo metav1.ListOptions) (watch.Interface, error) {
+			return client.AppsV1().ReplicaSets("").Watch(alo)
+		},
+	}, &appsv1.ReplicaSet{})
+	ow.addInformer("StatefulSet", &cache.ListWatch{
+		ListFunc: func(alo metav1.ListOptions) (runtime.Object, error) {
+			return client.AppsV1().StatefulSets("").List(alo)
+		},
+		WatchFunc: func(alo metav1.ListOptions) (watch.Interface, error) {
+			return client.AppsV1().StatefulSets("").Watch(alo)
+		},
+	}, &appsv1.StatefulSet{})
+	ow.addInformer("ReplicationController", &cache.ListWatch{
+		ListFunc: func(alo metav1.ListOptions) (runtime.Object, error) {
+			return client.CoreV1().ReplicationControllers("").List(alo)
+		},
+		WatchFunc: func(alo metav1.ListOptions) (watch.Interface, error) {
+			return client.CoreV1().ReplicationControllers("").Watch(alo)
+		},
+	}, &v1.ReplicationController{})
+	ow.addInformer("Job", &cache.ListWatch{
+		ListFunc: func(alo metav1.ListOptions) (runtime.Object, error) {
+			return client.BatchV1().Jobs("").List(alo)
+		},
+		WatchFunc: func(alo metav1.ListOptions) (watch.Interface, error) {
+			return client.BatchV1().Jobs("").Watch(alo)
+		},
+	}, &batchv1.Job{})
+	return ow
+}
+
+// addInformer adds the informer of a kind of controller.
+func (ow *OwnerWatcher) addInformer(kind string, lw *cache.ListWatch, objType runtime.Object) {
+	store, controller := cache.NewInformer(
+		newErrorReportingListWatch(lw, func(err error) {
+			ow.watchErrorHandler(err)
+		}),
+		objType,
+		0,
+		cache.ResourceEventHandlerFuncs{
+			UpdateFunc: func(old, new interface{}) {
+				ow.ownerChanged(new)
+			},
+			DeleteFunc: func(obj interface{}) {
+				ow.ownerChanged(obj)
+			},
+		},
+	)
+	ow.stores[kind] = store
+	ow.controllers = append(ow.controllers, controller)
+}
+
+// ownerChanged calls the ownerChangedHandler, if any, for a controller updated or deleted.
+func (ow *OwnerWatcher) ownerChanged(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	owner, ok := obj.(metav1.Object)
+	if !ok {
+		glog.Errorf("ownerChanged: unexpected object %T", obj)
+		return
+	}
+	if ow.ownerChangedHandler != nil {
+		ow.ownerChangedHandler(owner.GetUID())
+	}
+}
+
+// getOwner returns the cached controller of the given kind, namespace and name, nil if it isn't known.
+func (ow *OwnerWatcher) getOwner(kind, namespace, name string) metav1.Object {
+	store, ok := ow.stores[kind]
+	if !ok {
+		return nil
+	}
+	obj, exists, err := store.GetByKey(namespace + "/" + name)
+	if err != nil || !exists {
+		return nil
+	}
+	owner, ok := obj.(metav1.Object)
+	if !ok {
+		return nil
+	}
+	return owner
+}
+
+// getJob returns the cached Job, nil if it isn't known.
+func (ow *OwnerWatcher) getJob(namespace, name string) *batchv1.Job {
+	job, _ := ow.getOwner("Job", namespace, name).(*batchv1.Job)
+	return job
+}
+
+// HasSynced returns true once the informers listed all the controllers.
+func (ow *OwnerWatcher) HasSynced() bool {
+	for _, controller := range ow.controllers {
+		if !controller.HasSynced() {
+			return false
+		}
+	}
+	return true
+}
+
+// Run starts the informers, they stop when stopCh is closed.
+func (ow *OwnerWatcher) Run(stopCh <-chan struct{}) {
+	glog.Info("Getting owner updates...")
+	for _, controller := range ow.controllers {
+		go controller.Run(stopCh)
+	}
+}
@@ -0,0 +1,88 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8sclient
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/golang/glog"
+)
+
+// PathDebugPods is the path prefix of the pod debug endpoint, pods are served at
+// PathDebugPods + "{namespace}/{name}".
+const PathDebugPods = "/debug/pods/"
+
+// convertedPods maps the pods to the last Pod sent to Firmament for them.
+var convertedPods = make(map[PodIdentifier]*Pod)
+var convertedPodsLock = new(sync.RWMutex)
+
+// recordConvertedPod stores the Pod sent to Firmament for the debug endpoint.
+func recordConvertedPod(pod *Pod) {
+	convertedPodsLock.Lock()
+	defer convertedPodsLock.Unlock()
+	convertedPods[pod.Identifier] = pod
+}
+
+// forgetConvertedPod removes a deleted pod from the debug endpoint.
+func forgetConvertedPod(identifier PodIdentifier) {
+	convertedPodsLock.Lock()
+	defer convertedPodsLock.Unlock()
+	delete(convertedPods, identifier)
+}
+
+// GetConvertedPod returns the last Pod sent to Firmament for the given pod.
+func GetConvertedPod(namespace, name string) (*Pod, bool) {
+	convertedPodsLock.RLock()
+	defer convertedPodsLock.RUnlock()
+	pod, ok := convertedPods[NewPodIdentifier(namespace, name)]
+	return pod, ok
+}
+
+// NewPodDebugHandler returns the handler of the PathDebugPods requests, it replies with the JSON
+// of the last Pod sent to Firmament for the requested pod.
+func NewPodDebugHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		parts := strings.Split(strings.TrimPrefix(r.URL.Path, PathDebugPods), "/")
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			http.Error(w, "expected "+PathDebugPods+"{namespace}/{name}", http.StatusBadRequest)
+			return
+		}
+		pod, ok := GetConvertedPod(parts[0], parts[1])
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		// The converted pods are never modified once recorded, so they can be marshalled without the lock.
+		d, err := json.Marshal(pod)
+		if err != nil {
+			glog.Errorf("Marshal failed, err: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(d)
+	}
+}
@@ -0,0 +1,50 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8sclient
+
+// PodMutator changes a converted pod before it is submitted to Firmament, e.g. to add custom
+// scheduling hints. A pod is rejected if Mutate returns an error.
+type PodMutator interface {
+	Mutate(pod *Pod) error
+}
+
+// PodMutatorFunc adapts a function to the PodMutator interface.
+type PodMutatorFunc func(pod *Pod) error
+
+// Mutate calls f(pod).
+func (f PodMutatorFunc) Mutate(pod *Pod) error {
+	return f(pod)
+}
+
+// RegisterPodMutator appends a mutator to the chain the pod watcher invokes on the converted pods.
+func (pw *PodWatcher) RegisterPodMutator(mutator PodMutator) {
+	pw.podMutatorsMux.Lock()
+	defer pw.podMutatorsMux.Unlock()
+	pw.podMutators = append(pw.podMutators, mutator)
+}
+
+// mutatePod runs the registered mutators on a converted pod, it stops at the first error.
+func (pw *PodWatcher) mutatePod(pod *Pod) error {
+	pw.podMutatorsMux.RLock()
+	defer pw.podMutatorsMux.RUnlock()
+	for _, mutator := range pw.podMutators {
+		if err := mutator.Mutate(pod); err != nil {
+			return &PodMutationError{PodKey: pod.Identifier.UniqueName(), cause: err}
+		}
+	}
+	return nil
+}
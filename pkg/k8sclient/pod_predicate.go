@@ -0,0 +1,51 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8sclient
+
+import (
+	"sync"
+)
+
+// PodPredicate decides whether a converted pod may be submitted to Firmament, e.g. to enforce a policy
+// such as "no pod without a cost-center label" at the scheduler boundary. A rejected pod isn't submitted
+// and gets a FailedScheduling event with the returned reason.
+type PodPredicate func(pod *Pod) (bool, string)
+
+// podPredicate is the predicate the pods have to pass, nil if all the pods are accepted.
+var podPredicate PodPredicate
+var podPredicateLock = new(sync.RWMutex)
+
+// SetPodPredicate sets the predicate the pods have to pass before they're submitted, nil accepts all the pods.
+func SetPodPredicate(predicate PodPredicate) {
+	podPredicateLock.Lock()
+	defer podPredicateLock.Unlock()
+	podPredicate = predicate
+}
+
+// checkPodPredicate returns a PodPredicateError if the pod fails the predicate. It runs after the
+// mutators, so that the predicate sees the pod as it would be submitted.
+func checkPodPredicate(pod *Pod) error {
+	podPredicateLock.RLock()
+	defer podPredicateLock.RUnlock()
+	if podPredicate == nil {
+		return nil
+	}
+	if ok, reason := podPredicate(pod); !ok {
+		return &PodPredicateError{PodKey: pod.Identifier.UniqueName(), Reason: reason}
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8sclient
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/golang/glog"
+)
+
+// PathAdminResubmit is the path prefix of the endpoint forcing the re-evaluation of a pod, a pod is
+// resubmitted by a POST to PathAdminResubmit + "{namespace}/{name}".
+const PathAdminResubmit = "/admin/resubmit/"
+
+// podResubmitter re-enqueues a known pod, it's nil until the pod watcher is started.
+var podResubmitter func(identifier PodIdentifier) bool
+var podResubmitterLock = new(sync.RWMutex)
+
+// setPodResubmitter sets the function the resubmit endpoint re-enqueues the pods with.
+func setPodResubmitter(resubmitter func(identifier PodIdentifier) bool) {
+	podResubmitterLock.Lock()
+	defer podResubmitterLock.Unlock()
+	podResubmitter = resubmitter
+}
+
+// resubmitPod re-enqueues a known pod so that Firmament evaluates it again: the task of a submitted
+// pod is updated, any other pod goes through the submission again. It returns false if the pod isn't
+// known.
+func (pw *PodWatcher) resubmitPod(identifier PodIdentifier) bool {
+	PodToK8sPodLock.Lock()
+	k8sPod, ok := PodToK8sPod[identifier]
+	if ok {
+		k8sPod = k8sPod.DeepCopy()
+	}
+	PodToK8sPodLock.Unlock()
+	if !ok {
+		return false
+	}
+	pod, ok := pw.convertAddedPod(k8sPod)
+	if !ok {
+		// The conversion failure was already reported, there's nothing to resubmit.
+		return true
+	}
+	PodMux.RLock()
+	_, submitted := PodToTD[identifier]
+	PodMux.RUnlock()
+	if submitted {
+		pod.State = PodUpdated
+	}
+	pw.podWorkQueue.Add(identifier.UniqueName(), pod)
+	glog.Infof("resubmitPod: Requeued pod %v on request", identifier)
+	return true
+}
+
+// NewPodResubmitHandler returns the handler of the PathAdminResubmit requests, it re-enqueues the
+// requested pod and replies with 404 if the pod isn't known.
+func NewPodResubmitHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		parts := strings.Split(strings.TrimPrefix(r.URL.Path, PathAdminResubmit), "/")
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			http.Error(w, "expected "+PathAdminResubmit+"{namespace}/{name}", http.StatusBadRequest)
+			return
+		}
+		podResubmitterLock.RLock()
+		resubmitter := podResubmitter
+		podResubmitterLock.RUnlock()
+		if resubmitter == nil || !resubmitter(NewPodIdentifier(parts[0], parts[1])) {
+			http.NotFound(w, r)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
@@ -19,18 +19,24 @@ package k8sclient
 import (
 	"encoding/json"
 	"fmt"
+	"math"
 	"reflect"
 	"sort"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/kubernetes-sigs/poseidon/pkg/config"
 	"github.com/kubernetes-sigs/poseidon/pkg/firmament"
 	"github.com/kubernetes-sigs/poseidon/pkg/metrics"
+	"github.com/kubernetes-sigs/poseidon/pkg/tracing"
 
 	"github.com/golang/glog"
 	"github.com/jinzhu/copier"
+	"golang.org/x/net/context"
 	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/apimachinery/pkg/labels"
@@ -49,8 +55,27 @@ type NodeSelectors map[string]string
 const (
 	// CreatedByAnnotation represents the original Kubernetes `kubernetes.io/created-by` annotation.
 	CreatedByAnnotation = "kubernetes.io/created-by"
+	// SkipAnnotation keeps a pod off Poseidon when set to "true", so that another scheduler can place it.
+	SkipAnnotation = "poseidon.kubernetes.io/skip"
+	// MirrorPodAnnotation marks the mirror pods the kubelet creates for its static pods.
+	MirrorPodAnnotation = "kubernetes.io/config.mirror"
+	// PreferredNodeAnnotation names the node a pod would rather be placed on. It's a soft hint translated
+	// into a preferred node affinity term of the highest weight, Firmament may still place the pod elsewhere.
+	PreferredNodeAnnotation = "poseidon.io/preferred-node"
 )
 
+// ServiceAccountLabel is the task label holding the service account of the pod, so that the placement
+// policies can key on the identity of the workload.
+const ServiceAccountLabel = "poseidon.kubernetes.io/service-account"
+
+// RestartCountLabel is the task label holding the number of times the containers of the pod restarted,
+// e.g. for the cost models to deprioritize the crash-looping pods.
+const RestartCountLabel = "poseidon.kubernetes.io/restart-count"
+
+// ReadyLabel is the task label set on the ready pods, e.g. for the cost models to tell the pods
+// serving from the ones warming up.
+const ReadyLabel = "poseidon.kubernetes.io/ready"
+
 // SortNodeSelectorsKey sort node selectors keys and return an slice of sorted keys.
 func SortNodeSelectorsKey(nodeSelector NodeSelectors) []string {
 	var keyArray []string
@@ -69,15 +94,60 @@ func SortNodeSelectorsKey(nodeSelector NodeSelectors) []string {
 // NewPodWatcher initialize a PodWatcher.
 func NewPodWatcher(kubeVerMajor, kubeVerMinor int, schedulerName string, client kubernetes.Interface, fc firmament.FirmamentSchedulerClient) *PodWatcher {
 	glog.V(2).Info("Starting PodWatcher...")
+	if err := validateSchedulerName(schedulerName); err != nil {
+		glog.Warningf("WARNING: %v, Poseidon will schedule the pods which don't name any scheduler", err)
+	}
 	PodMux = new(sync.RWMutex)
 	PodToTD = make(map[PodIdentifier]*firmament.TaskDescriptor)
 	TaskIDToPod = make(map[uint64]PodIdentifier)
 	jobIDToJD = make(map[string]*firmament.JobDescriptor)
 	jobNumTasksToRemove = make(map[string]int)
+	podToNode = make(map[PodIdentifier]string)
+	oversizedPods = make(map[PodIdentifier]*Pod)
+	unschedulableAttempts = make(map[PodIdentifier]int)
+	jobGangSizes = make(map[string]int32)
+	pendingGangs = make(map[string][]*Pod)
+	abandonedPods = make(map[PodIdentifier]struct{})
+	completedPods = make(map[PodIdentifier]struct{})
+	terminatingPods = make(map[PodIdentifier]struct{})
+	cordonedNodes = make(map[string]bool)
+	inFlightPods = make(map[string]map[PodIdentifier]struct{})
+	inFlightOwners = make(map[PodIdentifier]string)
+	throttledPods = make(map[string][]*Pod)
+	bestEffortCPURequest := config.GetBestEffortCPURequest()
+	bestEffortMemRequest := config.GetBestEffortMemRequest()
+	maxCPURequest := config.GetMaxPodCPURequest()
+	maxMemRequest := config.GetMaxPodMemRequest()
 	podWatcher := &PodWatcher{
-		clientset: client,
-		fc:        fc,
+		clientset:               client,
+		backend:                 NewFirmamentBackend(fc),
+		owners:                  NewOwnerWatcher(client),
+		annotationLabelPrefixes: config.GetAnnotationLabelPrefixes(),
+		gangScheduling:          config.GetEnableGangScheduling(),
+		namespaceAllowlist:      toNamespaceSet(config.GetNamespaceAllowlist()),
+		namespaceDenylist:       toNamespaceSet(config.GetNamespaceDenylist()),
+		bestEffortCPURequest:    bestEffortCPURequest.MilliValue(),
+		bestEffortMemRequest:    bestEffortMemRequest.Value(),
+		taskRemovalMaxRetries:   config.GetTaskRemovalMaxRetries(),
+		maxCPURequest:           maxCPURequest.MilliValue(),
+		maxMemRequest:           maxMemRequest.Value(),
+		removeTasksOnShutdown:   config.GetRemoveTasksOnShutdown(),
+		submissionGracePeriod:   config.GetPodSubmissionGracePeriod(),
+		retryBudget:             newRetryBudget(config.GetRetryBudgetQPS(), config.GetRetryBudgetBurst()),
+		crashLoopUpdateInterval: config.GetCrashLoopUpdateInterval(),
+		starvationThreshold:     config.GetStarvationThreshold(),
+		skipMirrorPods:          config.GetSkipMirrorPods(),
+		withdrawJobRetries:      config.GetRemoveRetriableJobFailures(),
+		maxInFlightPerOwner:     config.GetMaxInFlightPodsPerOwner(),
+		memGranularity:          config.GetMemoryGranularity(),
+		reportContainers:        config.GetReportContainerResources(),
+		skipAffinity:            config.GetSkipAffinity(),
+		labelPrefixes:           config.GetPodLabelPrefixes(),
+		maxUnschedulable:        config.GetMaxUnschedulableAttempts(),
+		watchErrorHandler:       newWatchErrorHandler("pods"),
 	}
+	// A scaled controller changes the size of its gang.
+	podWatcher.owners.ownerChangedHandler = podWatcher.forgetGangSize
 	schedulerSelector := fields.Everything()
 	podSelector := labels.Everything()
 	if kubeVerMajor >= 1 && kubeVerMinor >= 6 {
@@ -91,83 +161,441 @@ func NewPodWatcher(kubeVerMajor, kubeVerMinor int, schedulerName string, client
 		}
 	}
 	_, controller := cache.NewInformer(
-		&cache.ListWatch{
+		newErrorReportingListWatch(&cache.ListWatch{
 			ListFunc: func(alo metav1.ListOptions) (runtime.Object, error) {
 				alo.FieldSelector = schedulerSelector.String()
 				alo.LabelSelector = podSelector.String()
 				return client.CoreV1().Pods("").List(alo)
 			},
+			// TODO: request watch bookmarks (ListOptions.AllowWatchBookmarks) once the vendored
+			// apimachinery and client-go are at 1.15 or later, so that a reconnecting watch resumes from
+			// the last bookmarked resource version. Neither the option nor the Bookmark events exist in
+			// the vendored version, whose reflector would fail on them.
 			WatchFunc: func(alo metav1.ListOptions) (watch.Interface, error) {
 				alo.FieldSelector = schedulerSelector.String()
 				alo.LabelSelector = podSelector.String()
 				return client.CoreV1().Pods("").Watch(alo)
 			},
-		},
+		}, func(err error) {
+			podWatcher.watchErrorHandler(err)
+		}),
 		&v1.Pod{},
 		0,
-		cache.ResourceEventHandlerFuncs{
-			AddFunc: func(obj interface{}) {
-				key, err := cache.MetaNamespaceKeyFunc(obj)
-				if err != nil {
-					glog.Errorf("AddFunc: error getting key %v", err)
-				}
-				podWatcher.enqueuePodAddition(key, obj)
-			},
-			UpdateFunc: func(old, new interface{}) {
-				key, err := cache.MetaNamespaceKeyFunc(new)
-				if err != nil {
-					glog.Errorf("UpdateFunc: error getting key %v", err)
-				}
-				podWatcher.enqueuePodUpdate(key, old, new)
-			},
-			DeleteFunc: func(obj interface{}) {
-				key, err := cache.MetaNamespaceKeyFunc(obj)
-				if err != nil {
-					glog.Errorf("DeleteFunc: error getting key %v", err)
-				}
-				podWatcher.enqueuePodDeletion(key, obj)
+		cache.FilteringResourceEventHandler{
+			FilterFunc: podWatcher.isSchedulablePod,
+			Handler: cache.ResourceEventHandlerFuncs{
+				AddFunc: func(obj interface{}) {
+					if podWatcher.bufferInitialPod(obj) {
+						return
+					}
+					key, err := cache.MetaNamespaceKeyFunc(obj)
+					if err != nil {
+						glog.Errorf("AddFunc: error getting key %v", err)
+					}
+					podWatcher.enqueuePodAddition(key, obj)
+				},
+				UpdateFunc: func(old, new interface{}) {
+					podWatcher.flushInitialPods()
+					key, err := cache.MetaNamespaceKeyFunc(new)
+					if err != nil {
+						glog.Errorf("UpdateFunc: error getting key %v", err)
+					}
+					podWatcher.enqueuePodUpdate(key, old, new)
+				},
+				DeleteFunc: func(obj interface{}) {
+					podWatcher.flushInitialPods()
+					// The tombstones of the deletions missed by the watch carry the key of their pod.
+					key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+					if err != nil {
+						glog.Errorf("DeleteFunc: error getting key %v", err)
+					}
+					podWatcher.enqueuePodDeletion(key, obj)
+				},
 			},
 		},
 	)
 	podWatcher.controller = controller
-	podWatcher.podWorkQueue = NewKeyedQueue()
+	podWorkQueue, err := newPodQueue(config.GetPodQueueType())
+	if err != nil {
+		glog.Fatalf("Incorrect content in --podQueueType: %v", err)
+	}
+	if _, ok := podWorkQueue.(DelayingQueue); !ok && podWatcher.submissionGracePeriod > 0 {
+		// The new pods are held in the queue for the grace period.
+		glog.Infof("Using a %s pod queue for --podSubmissionGracePeriod", PodQueueDelaying)
+		podWorkQueue = NewDelayingKeyedQueue()
+	}
+	podWatcher.podWorkQueue = podWorkQueue
+	metrics.RegisterWorkQueue("pods", podWorkQueue.Len)
 	return podWatcher
 }
 
+// validateSchedulerName checks that the scheduler name isn't empty, an empty name selects the pods
+// without a scheduler name.
+func validateSchedulerName(schedulerName string) error {
+	if strings.TrimSpace(schedulerName) == "" {
+		return fmt.Errorf("the scheduler name %q is empty", schedulerName)
+	}
+	return nil
+}
+
+// newPodQueue returns a queue of the given type for the pod events.
+func newPodQueue(queueType string) (Queue, error) {
+	switch queueType {
+	case PodQueueSimple, "":
+		return NewKeyedQueue(), nil
+	case PodQueueDelaying:
+		return NewDelayingKeyedQueue(), nil
+	case PodQueueRateLimiting:
+		return NewRateLimitingKeyedQueue(podRequeueBaseDelay, podRequeueMaxDelay), nil
+	}
+	return nil, fmt.Errorf("unknown queue type %q, it should be one of %s, %s or %s", queueType, PodQueueSimple, PodQueueDelaying, PodQueueRateLimiting)
+}
+
+// requeuePod enqueues a pod which failed to be processed again, delayed according to the type of the
+// queue and, if the shared retry budget is exhausted, until it allows the retry.
+func (pw *PodWatcher) requeuePod(key interface{}, item interface{}) {
+	if delay := pw.retryBudget.reserve(); delay > 0 {
+		glog.V(2).Infof("Retry budget exhausted, delaying the retry of %v by %v", key, delay)
+		time.AfterFunc(delay, func() {
+			pw.addBackedOff(key, item)
+		})
+		return
+	}
+	pw.addBackedOff(key, item)
+}
+
+// addBackedOff enqueues a pod which failed to be processed again, delayed according to the type of the queue.
+func (pw *PodWatcher) addBackedOff(key interface{}, item interface{}) {
+	switch queue := pw.podWorkQueue.(type) {
+	case RateLimitingQueue:
+		queue.AddRateLimited(key, item)
+	case DelayingQueue:
+		queue.AddAfter(key, item, podRequeueBaseDelay)
+	default:
+		queue.Add(key, item)
+	}
+}
+
+// maxPodWorkerRetries is the number of times a pod whose processing panics is requeued.
+const maxPodWorkerRetries = 3
+
+// Types of the queue of the pod events.
+const (
+	PodQueueSimple       = "simple"
+	PodQueueDelaying     = "delaying"
+	PodQueueRateLimiting = "rateLimiting"
+)
+
+// podRequeueBaseDelay is the delay of the pods requeued in a delaying queue, and the initial backoff
+// of the pods requeued in a rate limiting queue, which backs off up to podRequeueMaxDelay.
+const (
+	podRequeueBaseDelay = 100 * time.Millisecond
+	podRequeueMaxDelay  = time.Minute
+)
+
+// toNamespaceSet returns the set of the given namespaces.
+func toNamespaceSet(namespaces []string) map[string]struct{} {
+	set := make(map[string]struct{}, len(namespaces))
+	for _, namespace := range namespaces {
+		set[namespace] = struct{}{}
+	}
+	return set
+}
+
+// isSchedulablePod filters out the pods Poseidon must not schedule.
+func (pw *PodWatcher) isSchedulablePod(obj interface{}) bool {
+	return pw.isNamespaceScheduled(obj) && !isDaemonSetPod(obj) && !isSkippedPod(obj) &&
+		!(pw.skipMirrorPods && isMirrorPod(obj))
+}
+
+// isMirrorPod returns true for the mirror pods of the static kubelet manifests. The kubelet runs them
+// on its own node, they're not to be submitted to Firmament.
+func isMirrorPod(obj interface{}) bool {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	pod, ok := obj.(*v1.Pod)
+	if !ok {
+		return false
+	}
+	if _, ok := pod.Annotations[MirrorPodAnnotation]; ok {
+		glog.V(2).Infof("Ignoring mirror pod %s/%s", pod.Namespace, pod.Name)
+		return true
+	}
+	return false
+}
+
+// isSkippedPod returns true for the pods whose SkipAnnotation is "true", they're left to another scheduler.
+func isSkippedPod(obj interface{}) bool {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	pod, ok := obj.(*v1.Pod)
+	if !ok {
+		return false
+	}
+	if pod.Annotations[SkipAnnotation] == "true" {
+		glog.V(2).Infof("Ignoring pod %s/%s with the %s annotation", pod.Namespace, pod.Name, SkipAnnotation)
+		return true
+	}
+	return false
+}
+
+// isDaemonSetPod returns true for the pods owned by a DaemonSet. The DaemonSet controller places
+// them on their node itself, they're not to be submitted to Firmament.
+func isDaemonSetPod(obj interface{}) bool {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	pod, ok := obj.(*v1.Pod)
+	if !ok {
+		return false
+	}
+	if owner := metav1.GetControllerOf(pod); owner != nil && owner.Kind == "DaemonSet" {
+		glog.V(2).Infof("Ignoring pod %s/%s of DaemonSet %s", pod.Namespace, pod.Name, owner.Name)
+		return true
+	}
+	return false
+}
+
+// isNamespaceScheduled filters out the pods of the namespaces Poseidon doesn't schedule. The denylist
+// wins over the allowlist, and an empty allowlist allows every namespace.
+func (pw *PodWatcher) isNamespaceScheduled(obj interface{}) bool {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	pod, ok := obj.(*v1.Pod)
+	if !ok {
+		return true
+	}
+	if _, denied := pw.namespaceDenylist[pod.Namespace]; denied {
+		return false
+	}
+	if len(pw.namespaceAllowlist) == 0 {
+		return true
+	}
+	_, allowed := pw.namespaceAllowlist[pod.Namespace]
+	return allowed
+}
+
+// getCPUMemEphemeralRequest returns the effective cpu, memory and ephemeral storage requests of the pod.
+// App containers run together so their requests are summed, while init containers run one after the
+// other before them, hence the effective request is max(sum(app containers), max(init containers)) per resource.
 func (pw *PodWatcher) getCPUMemEphemeralRequest(pod *v1.Pod) (int64, int64, int64) {
 	cpuReq := int64(0)
 	memReq := int64(0)
 	ephemeralReq := int64(0)
 	for _, container := range pod.Spec.Containers {
-		request := container.Resources.Requests
-		cpuReqQuantity := request[v1.ResourceCPU]
-		cpuReq += cpuReqQuantity.MilliValue()
-		memReqQuantity := request[v1.ResourceMemory]
-		memReqCont, _ := memReqQuantity.AsInt64()
+		cpuReqCont, memReqCont, ephemeralReqCont := getContainerRequest(&container)
+		cpuReq += cpuReqCont
 		memReq += memReqCont
-		ephemeralReqQuantity := request[v1.ResourceEphemeralStorage]
-		ephemeralReqCont, _ := ephemeralReqQuantity.AsInt64()
 		ephemeralReq += ephemeralReqCont
 	}
+	for _, container := range pod.Spec.InitContainers {
+		cpuReqCont, memReqCont, ephemeralReqCont := getContainerRequest(&container)
+		if cpuReqCont > cpuReq {
+			cpuReq = cpuReqCont
+		}
+		if memReqCont > memReq {
+			memReq = memReqCont
+		}
+		if ephemeralReqCont > ephemeralReq {
+			ephemeralReq = ephemeralReqCont
+		}
+	}
 	return cpuReq, memReq, ephemeralReq
 }
 
+// getStartTime returns the start time of the pod, its creation time if it hasn't started yet.
+func getStartTime(pod *v1.Pod) metav1.Time {
+	if pod.Status.StartTime != nil {
+		return *pod.Status.StartTime
+	}
+	return pod.CreationTimestamp
+}
+
+// getPriority returns the priority of the pod, the last known value of its priority class if any so
+// that the class updates are taken into account.
+func getPriority(pod *v1.Pod) int32 {
+	if pod.Spec.PriorityClassName != "" {
+		if value, ok := getPriorityClassValue(pod.Spec.PriorityClassName); ok {
+			return value
+		}
+	}
+	if pod.Spec.Priority != nil {
+		return *pod.Spec.Priority
+	}
+	return 0
+}
+
+// isBestEffort returns true if none of the containers of the pod requests or limits cpu or memory.
+// A pod without containers, e.g. while it's being mutated, runs nothing and isn't BestEffort.
+func isBestEffort(pod *v1.Pod) bool {
+	if len(pod.Spec.Containers) == 0 {
+		return false
+	}
+	containers := append(append([]v1.Container{}, pod.Spec.InitContainers...), pod.Spec.Containers...)
+	for _, container := range containers {
+		for _, resources := range []v1.ResourceList{container.Resources.Requests, container.Resources.Limits} {
+			for _, name := range []v1.ResourceName{v1.ResourceCPU, v1.ResourceMemory} {
+				if quantity, ok := resources[name]; ok && !quantity.IsZero() {
+					return false
+				}
+			}
+		}
+	}
+	return true
+}
+
+// getContainerRequest returns the cpu (in millicores), memory and ephemeral storage requests of a container.
+func getContainerRequest(container *v1.Container) (int64, int64, int64) {
+	request := container.Resources.Requests
+	cpuReqQuantity := request[v1.ResourceCPU]
+	memReqQuantity := request[v1.ResourceMemory]
+	memReq, _ := memReqQuantity.AsInt64()
+	ephemeralReqQuantity := request[v1.ResourceEphemeralStorage]
+	ephemeralReq, _ := ephemeralReqQuantity.AsInt64()
+	return cpuReqQuantity.MilliValue(), memReq, ephemeralReq
+}
+
+// maxCPURequest is the largest cpu request whose millicores fit in an int64.
+var maxCPURequest = resource.NewMilliQuantity(math.MaxInt64, resource.DecimalSI)
+
+// checkTopologyKeys returns an InvalidAffinityError if a pod (anti-)affinity term has an empty topology key.
+// The API server rejects such terms, but Firmament would place the pod arbitrarily if one slipped through.
+func checkTopologyKeys(podKey, kind string, required []v1.PodAffinityTerm, preferred []v1.WeightedPodAffinityTerm) error {
+	terms := append([]v1.PodAffinityTerm{}, required...)
+	for _, weighted := range preferred {
+		terms = append(terms, weighted.PodAffinityTerm)
+	}
+	for _, term := range terms {
+		if strings.TrimSpace(term.TopologyKey) == "" {
+			return &InvalidAffinityError{PodKey: podKey, Detail: fmt.Sprintf("%s term with an empty topologyKey", kind)}
+		}
+	}
+	return nil
+}
+
+// checkPodConversion returns a ResourceParseError, an UnsupportedAffinityError or an InvalidAffinityError
+// if the pod can't be converted for Firmament without losing its requests or constraints.
+func (pw *PodWatcher) checkPodConversion(pod *v1.Pod) error {
+	podKey := pod.Namespace + "/" + pod.Name
+	containers := append(append([]v1.Container{}, pod.Spec.InitContainers...), pod.Spec.Containers...)
+	for _, container := range containers {
+		for _, resourceName := range []v1.ResourceName{v1.ResourceCPU, v1.ResourceMemory, v1.ResourceEphemeralStorage} {
+			quantity, ok := container.Resources.Requests[resourceName]
+			if !ok {
+				continue
+			}
+			if quantity.Sign() < 0 {
+				return &ResourceParseError{PodKey: podKey, ResourceName: resourceName, cause: fmt.Errorf("negative quantity %s", quantity.String())}
+			}
+			if resourceName == v1.ResourceCPU {
+				if quantity.Cmp(*maxCPURequest) > 0 {
+					return &ResourceParseError{PodKey: podKey, ResourceName: resourceName, cause: fmt.Errorf("%s millicores overflow an int64", quantity.String())}
+				}
+				continue
+			}
+			if _, ok := quantity.AsInt64(); !ok {
+				return &ResourceParseError{PodKey: podKey, ResourceName: resourceName, cause: fmt.Errorf("%s bytes don't fit in an int64", quantity.String())}
+			}
+		}
+	}
+	if pod.Spec.Affinity != nil && pod.Spec.Affinity.NodeAffinity != nil {
+		var terms []v1.NodeSelectorTerm
+		if required := pod.Spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution; required != nil {
+			terms = append(terms, required.NodeSelectorTerms...)
+		}
+		if !pw.skipAffinity {
+			for _, preferred := range pod.Spec.Affinity.NodeAffinity.PreferredDuringSchedulingIgnoredDuringExecution {
+				terms = append(terms, preferred.Preference)
+			}
+		}
+		for _, term := range terms {
+			for _, field := range term.MatchFields {
+				if field.Key != nodeNameField {
+					return &UnsupportedAffinityError{PodKey: podKey, Detail: fmt.Sprintf("node selector terms matching the field %s can't be sent to Firmament", field.Key)}
+				}
+			}
+		}
+	}
+	if !pw.skipAffinity && pod.Spec.Affinity != nil && pod.Spec.Affinity.PodAffinity != nil {
+		podAffinity := pod.Spec.Affinity.PodAffinity
+		if err := checkTopologyKeys(podKey, "pod affinity", podAffinity.RequiredDuringSchedulingIgnoredDuringExecution, podAffinity.PreferredDuringSchedulingIgnoredDuringExecution); err != nil {
+			return err
+		}
+	}
+	if !pw.skipAffinity && pod.Spec.Affinity != nil && pod.Spec.Affinity.PodAntiAffinity != nil {
+		podAntiAffinity := pod.Spec.Affinity.PodAntiAffinity
+		if err := checkTopologyKeys(podKey, "pod anti-affinity", podAntiAffinity.RequiredDuringSchedulingIgnoredDuringExecution, podAntiAffinity.PreferredDuringSchedulingIgnoredDuringExecution); err != nil {
+			return err
+		}
+	}
+	// Reject the obviously invalid requests, e.g. from a templating bug, rather than churn Firmament.
+	cpuReq, memReq, _ := pw.getCPUMemEphemeralRequest(pod)
+	if pw.maxCPURequest > 0 && cpuReq > pw.maxCPURequest {
+		return &RequestTooLargeError{
+			PodKey:       podKey,
+			ResourceName: v1.ResourceCPU,
+			Request:      *resource.NewMilliQuantity(cpuReq, resource.DecimalSI),
+			Limit:        *resource.NewMilliQuantity(pw.maxCPURequest, resource.DecimalSI),
+		}
+	}
+	if pw.maxMemRequest > 0 && memReq > pw.maxMemRequest {
+		return &RequestTooLargeError{
+			PodKey:       podKey,
+			ResourceName: v1.ResourceMemory,
+			Request:      *resource.NewQuantity(memReq, resource.BinarySI),
+			Limit:        *resource.NewQuantity(pw.maxMemRequest, resource.BinarySI),
+		}
+	}
+	return nil
+}
+
+// getNodeSelectorTerm returns the required node selector terms of the pod, its node affinity and its
+// nodeSelector merged together.
 func (pw *PodWatcher) getNodeSelectorTerm(pod *v1.Pod) []NodeSelectorTerm {
 	var nodeSelTerm []NodeSelectorTerm
+	var nodeAffinity *v1.NodeAffinity
 	if pod.Spec.Affinity != nil {
-		if pod.Spec.Affinity.NodeAffinity != nil {
-			if pod.Spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution != nil {
-				err := copier.Copy(&nodeSelTerm, pod.Spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms)
-				if err != nil {
-					glog.Errorf("NodeSelectorTerm %v could not be copied, err: %v", pod.Spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms, err)
-				}
-
+		nodeAffinity = pod.Spec.Affinity.NodeAffinity
+	}
+	nodeAffinity = mergeNodeAffinity(nodeAffinity, nodeSelectorToNodeSelector(pod.Spec.NodeSelector))
+	if nodeAffinity != nil && nodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution != nil {
+		err := copier.Copy(&nodeSelTerm, nodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms)
+		if err != nil {
+			glog.Errorf("NodeSelectorTerm %v could not be copied, err: %v", nodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms, err)
+		}
+		for i, term := range nodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms {
+			if i < len(nodeSelTerm) {
+				nodeSelTerm[i].MatchExpressions = append(nodeSelTerm[i].MatchExpressions, matchFieldsToExpressions(term.MatchFields)...)
 			}
 		}
 	}
 	return nodeSelTerm
 }
 
+// nodeNameField is the only node field the node selector terms can match.
+const nodeNameField = "metadata.name"
+
+// matchFieldsToExpressions converts the node name fields of a node selector term to requirements on the
+// hostname label, which Firmament knows the nodes by. Firmament has no node fields, the nodes are
+// assumed to be named after their hostname.
+func matchFieldsToExpressions(fields []v1.NodeSelectorRequirement) []NodeSelectorRequirement {
+	var requirements []NodeSelectorRequirement
+	for _, field := range fields {
+		if field.Key != nodeNameField {
+			continue
+		}
+		requirements = append(requirements, NodeSelectorRequirement{
+			Key:      LabelHostname,
+			Operator: string(field.Operator),
+			Values:   field.Values,
+		})
+	}
+	return requirements
+}
+
 func (pw *PodWatcher) getPreferredSchedulingTerm(pod *v1.Pod) []PreferredSchedulingTerm {
 	var prefSchTerm []PreferredSchedulingTerm
 	if pod.Spec.Affinity != nil {
@@ -176,12 +604,41 @@ func (pw *PodWatcher) getPreferredSchedulingTerm(pod *v1.Pod) []PreferredSchedul
 			if err != nil {
 				glog.Errorf("PreferredSchedulingTerm %v could not be copied, err: %v", pod.Spec.Affinity.NodeAffinity.PreferredDuringSchedulingIgnoredDuringExecution, err)
 			}
+			for i, term := range pod.Spec.Affinity.NodeAffinity.PreferredDuringSchedulingIgnoredDuringExecution {
+				if i < len(prefSchTerm) {
+					prefSchTerm[i].Preference.MatchExpressions = append(prefSchTerm[i].Preference.MatchExpressions, matchFieldsToExpressions(term.Preference.MatchFields)...)
+				}
+			}
 		}
 
 	}
+	if term := getPreferredNodeTerm(pod); term != nil {
+		prefSchTerm = append(prefSchTerm, *term)
+	}
 	return prefSchTerm
 }
 
+// getPreferredNodeTerm returns the preferred scheduling term selecting the node named by the
+// PreferredNodeAnnotation of the pod, nil if the pod has no such annotation.
+func getPreferredNodeTerm(pod *v1.Pod) *PreferredSchedulingTerm {
+	nodeName := strings.TrimSpace(pod.Annotations[PreferredNodeAnnotation])
+	if nodeName == "" {
+		return nil
+	}
+	return &PreferredSchedulingTerm{
+		Weight: maxAffinityWeight,
+		Preference: NodeSelectorTerm{
+			MatchExpressions: []NodeSelectorRequirement{
+				{
+					Key:      LabelHostname,
+					Operator: string(v1.NodeSelectorOpIn),
+					Values:   []string{nodeName},
+				},
+			},
+		},
+	}
+}
+
 func (pw *PodWatcher) getPodAffinityTerm(pod *v1.Pod) []PodAffinityTerm {
 	var podAffTerm []PodAffinityTerm
 	if pod.Spec.Affinity != nil {
@@ -236,61 +693,242 @@ func (pw *PodWatcher) getWgtPodAffinityTermforPodAntiAffinity(pod *v1.Pod) []Wei
 
 func (pw *PodWatcher) getTolerations(pod *v1.Pod) []Toleration {
 	var tolerations []Toleration
-
-	copier.Copy(&tolerations, pod.Spec.Tolerations)
-
+	for _, toleration := range pod.Spec.Tolerations {
+		var tolerationSeconds *int64
+		if toleration.TolerationSeconds != nil {
+			seconds := *toleration.TolerationSeconds
+			tolerationSeconds = &seconds
+		}
+		tolerations = append(tolerations, Toleration{
+			Key:               toleration.Key,
+			Operator:          string(toleration.Operator),
+			Value:             toleration.Value,
+			Effect:            string(toleration.Effect),
+			TolerationSeconds: tolerationSeconds,
+		})
+	}
 	return tolerations
 }
 
-func (pw *PodWatcher) parsePod(pod *v1.Pod) *Pod {
-	cpuReq, memReq, ephemeralReq := pw.getCPUMemEphemeralRequest(pod)
-	podPhase := PodUnknown
+// getPodPhase converts the phase of the pod. An empty or unexpected phase is converted to PodUnknown,
+// which the worker doesn't act on, rather than to a phase the pod may not be in.
+func getPodPhase(pod *v1.Pod) PodPhase {
 	switch pod.Status.Phase {
 	case v1.PodPending:
-		podPhase = PodPending
+		return PodPending
 	case v1.PodRunning:
-		podPhase = PodRunning
+		return PodRunning
 	case v1.PodSucceeded:
-		podPhase = PodSucceeded
+		return PodSucceeded
 	case v1.PodFailed:
-		podPhase = PodFailed
+		if isEvictedPod(pod) {
+			return PodEvicted
+		}
+		return PodFailed
+	case v1.PodUnknown:
+		return PodUnknown
+	}
+	glog.Warningf("Pod %s/%s has the unexpected phase %q, treating it as %s", pod.Namespace, pod.Name, pod.Status.Phase, PodUnknown)
+	return PodUnknown
+}
+
+// isPodReady returns true if the Ready condition of the pod is true and so are the conditions of all
+// its readiness gates. A Running pod may not be ready yet, e.g. while an external readiness gate is unsatisfied.
+func isPodReady(pod *v1.Pod) bool {
+	conditions := make(map[v1.PodConditionType]v1.ConditionStatus, len(pod.Status.Conditions))
+	for _, condition := range pod.Status.Conditions {
+		conditions[condition.Type] = condition.Status
+	}
+	if conditions[v1.PodReady] != v1.ConditionTrue {
+		return false
 	}
+	for _, gate := range pod.Spec.ReadinessGates {
+		if conditions[gate.ConditionType] != v1.ConditionTrue {
+			return false
+		}
+	}
+	return true
+}
+
+// getServiceAccount returns the service account the pod runs as, Kubernetes defaults it to "default".
+func getServiceAccount(pod *v1.Pod) string {
+	if pod.Spec.ServiceAccountName == "" {
+		return "default"
+	}
+	return pod.Spec.ServiceAccountName
+}
+
+// getRestartCount returns the number of times the containers of the pod restarted.
+func getRestartCount(pod *v1.Pod) int32 {
+	var restartCount int32
+	for _, status := range pod.Status.ContainerStatuses {
+		restartCount += status.RestartCount
+	}
+	return restartCount
+}
+
+func (pw *PodWatcher) parsePod(pod *v1.Pod) *Pod {
+	cpuReq, memReq, ephemeralReq := pw.getCPUMemEphemeralRequest(pod)
+	if isBestEffort(pod) {
+		// BestEffort pods request nothing, give them the shadow requests so that they can't pile up on a node.
+		cpuReq, memReq = pw.bestEffortCPURequest, pw.bestEffortMemRequest
+	}
+	podPhase := getPodPhase(pod)
 	return &Pod{
-		Identifier: PodIdentifier{
-			Name:      pod.Name,
-			Namespace: pod.Namespace,
-		},
-		State:          podPhase,
-		CPURequest:     cpuReq,
-		MemRequestKb:   memReq / bytesToKb,
-		EphemeralReqKb: ephemeralReq / bytesToKb,
-		Labels:         pod.Labels,
-		Annotations:    pod.Annotations,
-		NodeSelector:   pod.Spec.NodeSelector,
-		OwnerRef:       GetOwnerReference(pod),
-		Affinity: &Affinity{
-			NodeAffinity: &NodeAffinity{
-				HardScheduling: &NodeSelector{
-					NodeSelectorTerms: pw.getNodeSelectorTerm(pod),
-				},
-				SoftScheduling: pw.getPreferredSchedulingTerm(pod),
-			},
-			PodAffinity: &PodAffinity{
-				HardScheduling: pw.getPodAffinityTerm(pod),
-				SoftScheduling: pw.getWgtPodAffinityTerm(pod),
-			},
-			PodAntiAffinity: &PodAffinity{
-				HardScheduling: pw.getPodAffinityTermforPodAntiAffinity(pod),
-				SoftScheduling: pw.getWgtPodAffinityTermforPodAntiAffinity(pod),
-			},
-		},
-		CreateTimeStamp: pod.CreationTimestamp,
-		Tolerations:     pw.getTolerations(pod),
+		Identifier:       NewPodIdentifier(pod.Namespace, pod.Name),
+		State:            podPhase,
+		CPURequest:       cpuReq,
+		MemRequestKb:     roundUpToGranularity(memoryUnit.FromBytes(memReq), pw.memGranularity),
+		EphemeralReqKb:   ephemeralReq / bytesToKb,
+		SwapRequestKb:    getSwapRequest(pod),
+		ExtendedRequests: getExtendedRequests(pod),
+		Containers:       getContainerResources(pod),
+		Labels:           pod.Labels,
+		Annotations:      pod.Annotations,
+		NodeSelector:     pod.Spec.NodeSelector,
+		OwnerRef:         GetOwnerReference(pod),
+		ControllerRef:    pw.resolveControllerRef(pod),
+		RestartCount:     getRestartCount(pod),
+		GangSize:         pw.getGangSize(GetOwnerReference(pod)),
+		Affinity:         pw.getAffinity(pod),
+		CreateTimeStamp:  pod.CreationTimestamp,
+		StartTime:        getStartTime(pod),
+		Priority:         getPriority(pod),
+		ScheduleDeadline: getScheduleDeadline(pod),
+		BandwidthRequest: getBandwidthRequest(pod),
+		IsReady:          isPodReady(pod),
+		ServiceAccount:   getServiceAccount(pod),
+		Tolerations:      pw.getTolerations(pod),
+	}
+}
+
+// getAffinity converts the affinity of the pod. The pods without affinity skip the conversion of the
+// pod affinity and anti-affinity, only their node selector is converted, and the conversion is skipped
+// altogether if the affinity is disabled. The node selector is still sent as label selectors then.
+func (pw *PodWatcher) getAffinity(pod *v1.Pod) *Affinity {
+	affinity := &Affinity{
+		NodeAffinity:    &NodeAffinity{HardScheduling: &NodeSelector{}},
+		PodAffinity:     &PodAffinity{},
+		PodAntiAffinity: &PodAffinity{},
+	}
+	affinity.NodeAffinity.HardScheduling.NodeSelectorTerms = pw.getNodeSelectorTerm(pod)
+	if pw.skipAffinity {
+		// The required terms are kept: they hold the node selector and the topology of the bound
+		// volumes, the pod can't run on a node they don't select.
+		return affinity
+	}
+	// The PreferredNodeAnnotation adds a preferred term to the pods without affinity too.
+	affinity.NodeAffinity.SoftScheduling = pw.getPreferredSchedulingTerm(pod)
+	if pod.Spec.Affinity == nil {
+		return affinity
 	}
+	affinity.PodAffinity.HardScheduling = pw.getPodAffinityTerm(pod)
+	affinity.PodAffinity.SoftScheduling = pw.getWgtPodAffinityTerm(pod)
+	affinity.PodAntiAffinity.HardScheduling = pw.getPodAffinityTermforPodAntiAffinity(pod)
+	affinity.PodAntiAffinity.SoftScheduling = pw.getWgtPodAffinityTermforPodAntiAffinity(pod)
+	return affinity
 }
 
 func (pw *PodWatcher) enqueuePodAddition(key interface{}, obj interface{}) {
 	pod := obj.(*v1.Pod)
+	addedPod, ok := pw.convertAddedPod(pod)
+	if !ok {
+		return
+	}
+	// update the pod
+	// Note the sequence is importatnt
+	PodToK8sPodLock.Lock()
+	identifier := NewPodIdentifier(pod.Namespace, pod.Name)
+	PodToK8sPod[identifier] = pod.DeepCopy()
+	PodToK8sPodLock.Unlock()
+	if pw.holdPod(key, addedPod) {
+		glog.V(2).Infof("enqueuePodAddition: Holding pod %v for %v", addedPod.Identifier, pw.submissionGracePeriod)
+		return
+	}
+	pw.podWorkQueue.Add(key, addedPod)
+	glog.V(2).Info("enqueuePodAddition: Added pod ", addedPod.Identifier)
+}
+
+// enqueuePodAdditions converts and enqueues a batch of added pods. Unlike enqueuePodAddition
+// it takes the PodToK8sPod and queue locks once for the whole batch.
+func (pw *PodWatcher) enqueuePodAdditions(pods []*v1.Pod) {
+	keys := make([]interface{}, 0, len(pods))
+	addedPods := make([]interface{}, 0, len(pods))
+	k8sPods := make([]*v1.Pod, 0, len(pods))
+	for _, pod := range pods {
+		key, err := cache.MetaNamespaceKeyFunc(pod)
+		if err != nil {
+			glog.Errorf("enqueuePodAdditions: error getting key %v", err)
+			continue
+		}
+		addedPod, ok := pw.convertAddedPod(pod)
+		if !ok {
+			continue
+		}
+		keys = append(keys, key)
+		addedPods = append(addedPods, addedPod)
+		k8sPods = append(k8sPods, pod)
+	}
+	PodToK8sPodLock.Lock()
+	for _, pod := range k8sPods {
+		identifier := NewPodIdentifier(pod.Namespace, pod.Name)
+		PodToK8sPod[identifier] = pod.DeepCopy()
+	}
+	PodToK8sPodLock.Unlock()
+	pw.podWorkQueue.AddBatch(keys, addedPods)
+	glog.V(2).Infof("enqueuePodAdditions: Added %d pods", len(addedPods))
+}
+
+// bufferInitialPod holds back the pods added by the initial list of the informer, they are
+// enqueued in a single batch by flushInitialPods. It returns false once the initial list is over.
+func (pw *PodWatcher) bufferInitialPod(obj interface{}) bool {
+	pw.initialPodsMux.Lock()
+	defer pw.initialPodsMux.Unlock()
+	if pw.initialSyncDone {
+		return false
+	}
+	pod, ok := obj.(*v1.Pod)
+	if !ok {
+		return false
+	}
+	pw.initialPods = append(pw.initialPods, pod)
+	return true
+}
+
+// flushInitialPods enqueues the pods buffered during the initial list. It is called once the
+// informer has synced, or earlier if an update or a deletion comes in, so that the buffered
+// additions are always enqueued before the later events.
+func (pw *PodWatcher) flushInitialPods() {
+	pw.initialPodsMux.Lock()
+	defer pw.initialPodsMux.Unlock()
+	if pw.initialSyncDone {
+		return
+	}
+	pw.initialSyncDone = true
+	pw.enqueuePodAdditions(pw.initialPods)
+	pw.initialPods = nil
+}
+
+// convertAddedPod converts an added pod for Firmament. It returns false if the pod can't be scheduled.
+func (pw *PodWatcher) convertAddedPod(pod *v1.Pod) (*Pod, bool) {
+	span := startPodSpan(tracing.SpanContext{}, "poseidon.ConvertPod", NewPodIdentifier(pod.Namespace, pod.Name))
+	defer span.Finish()
+	if isHeldByFinalizers(pod) {
+		// The pod is terminating, it's not to be submitted.
+		glog.V(2).Infof("Ignoring pod %s/%s whose deletion is held by finalizers", pod.Namespace, pod.Name)
+		return nil, false
+	}
+	if err := pw.checkPodConversion(pod); err != nil {
+		glog.Errorf("Ignoring pod which can't be scheduled by Firmament: %v", err)
+		span.SetError(err)
+		if pw.clientset != nil {
+			NewPoseidonEvents(pw.clientset).ProcessConversionErrorEvent(pod, err)
+		}
+		return nil, false
+	}
+	if pw.gangScheduling {
+		pw.recordGangSize(pod)
+	}
 	addedPod := pw.parsePod(pod)
 
 	// if the pod had volumes
@@ -305,33 +943,48 @@ func (pw *PodWatcher) enqueuePodAddition(key interface{}, obj interface{}) {
 			// this case has to be handled
 			// also we need to broadcast the pod failure event here.
 			glog.Error("Falied to find the matching volumes for the pod", addedPod)
-			return
+			return nil, false
 		}
 	}
-	// update the pod
-	// Note the sequence is importatnt
-	PodToK8sPodLock.Lock()
-	identifier := PodIdentifier{
-		Name:      pod.Name,
-		Namespace: pod.Namespace,
+	if err := pw.mutatePod(addedPod); err != nil {
+		glog.Errorf("Ignoring pod which can't be scheduled by Firmament: %v", err)
+		span.SetError(err)
+		if pw.clientset != nil {
+			NewPoseidonEvents(pw.clientset).ProcessConversionErrorEvent(pod, err)
+		}
+		return nil, false
 	}
-	PodToK8sPod[identifier] = pod.DeepCopy()
-	PodToK8sPodLock.Unlock()
-	pw.podWorkQueue.Add(key, addedPod)
-	glog.V(2).Info("enqueuePodAddition: Added pod ", addedPod.Identifier)
+	if err := checkPodPredicate(addedPod); err != nil {
+		glog.Errorf("Ignoring pod which can't be scheduled by Firmament: %v", err)
+		span.SetError(err)
+		if pw.clientset != nil {
+			NewPoseidonEvents(pw.clientset).ProcessConversionErrorEvent(pod, err)
+		}
+		return nil, false
+	}
+	// The submission of the pod continues the trace of its conversion.
+	addedPod.spanContext = span.Context()
+	return addedPod, true
 }
 
 func (pw *PodWatcher) enqueuePodDeletion(key interface{}, obj interface{}) {
-	pod := obj.(*v1.Pod)
-	if pod.DeletionTimestamp != nil {
-		// Only delete pods if they have a DeletionTimestamp.
+	tombstone, missed := obj.(cache.DeletedFinalStateUnknown)
+	if missed {
+		obj = tombstone.Obj
+	}
+	pod, ok := obj.(*v1.Pod)
+	if !ok {
+		glog.Errorf("enqueuePodDeletion: unexpected object %T", obj)
+		return
+	}
+	forgetPreemption(NewPodIdentifier(pod.Namespace, pod.Name))
+	// Only delete pods if they have a DeletionTimestamp. The last known state of a pod whose deletion
+	// the watch missed usually has none, the pod is gone all the same.
+	if pod.DeletionTimestamp != nil || missed {
 		deletedPod := &Pod{
-			Identifier: PodIdentifier{
-				Name:      pod.Name,
-				Namespace: pod.Namespace,
-			},
-			State:    PodDeleted,
-			OwnerRef: GetOwnerReference(pod),
+			Identifier: NewPodIdentifier(pod.Namespace, pod.Name),
+			State:      PodDeleted,
+			OwnerRef:   GetOwnerReference(pod),
 		}
 		ProcessedPodEventsLock.Lock()
 		if _, ok := ProcessedPodEvents[deletedPod.Identifier]; ok {
@@ -344,6 +997,13 @@ func (pw *PodWatcher) enqueuePodDeletion(key interface{}, obj interface{}) {
 			delete(PodToK8sPod, deletedPod.Identifier)
 		}
 		PodToK8sPodLock.Unlock()
+		PodMux.Lock()
+		delete(abandonedPods, deletedPod.Identifier)
+		delete(terminatingPods, deletedPod.Identifier)
+		delete(oversizedPods, deletedPod.Identifier)
+		delete(unschedulableAttempts, deletedPod.Identifier)
+		PodMux.Unlock()
+		pw.forgetCrashLoop(deletedPod.Identifier)
 		pw.podWorkQueue.Add(key, deletedPod)
 
 		glog.V(2).Info("enqueuePodDeletion: Added pod ", deletedPod.Identifier)
@@ -353,15 +1013,41 @@ func (pw *PodWatcher) enqueuePodDeletion(key interface{}, obj interface{}) {
 func (pw *PodWatcher) enqueuePodUpdate(key, oldObj, newObj interface{}) {
 	oldPod := oldObj.(*v1.Pod)
 	newPod := newObj.(*v1.Pod)
+	confirmBind(newPod)
+	pw.detectNodeDrain(oldPod, newPod)
+	if pw.handleTerminatingPod(key, newPod) {
+		return
+	}
+	if pw.isHeld(newPod) {
+		// The pod changed during its grace period, hold its latest version for another period.
+		// It was never submitted, so there's nothing to update in Firmament.
+		updatedPod, ok := pw.convertAddedPod(newPod)
+		if !ok {
+			pw.unholdPod(NewPodIdentifier(newPod.Namespace, newPod.Name))
+			return
+		}
+		PodToK8sPodLock.Lock()
+		PodToK8sPod[updatedPod.Identifier] = newPod.DeepCopy()
+		PodToK8sPodLock.Unlock()
+		if !pw.holdPod(key, updatedPod) {
+			pw.unholdPod(updatedPod.Identifier)
+			return
+		}
+		glog.V(2).Info("enqueuePodUpdate: Holding updated pod ", updatedPod.Identifier)
+		return
+	}
 	if oldPod.Status.Phase != newPod.Status.Phase {
 		// TODO(ionel): pw code assumes that if other fields changed as well then Firmament will automatically update them upon state transition. pw is currently not true.
 		updatedPod := pw.parsePod(newPod)
+		if updatedPod.State == PodFailed && pw.withdrawJobRetries && pw.isRetriableJobFailure(newPod) {
+			// The Job replaces the pod, whose replacement is a new task: the failed task is withdrawn
+			// rather than reported failed.
+			glog.V(2).Infof("enqueuePodUpdate: Removing pod %v, its Job retries it", updatedPod.Identifier)
+			updatedPod.State = PodDeleted
+		}
 		// update the pod
 		PodToK8sPodLock.Lock()
-		identifier := PodIdentifier{
-			Name:      newPod.Name,
-			Namespace: newPod.Namespace,
-		}
+		identifier := NewPodIdentifier(newPod.Namespace, newPod.Name)
 		PodToK8sPod[identifier] = newPod.DeepCopy()
 		PodToK8sPodLock.Unlock()
 		pw.podWorkQueue.Add(key, updatedPod)
@@ -372,13 +1058,37 @@ func (pw *PodWatcher) enqueuePodUpdate(key, oldObj, newObj interface{}) {
 	newCPUReq, newMemReq, newEphemeralReq := pw.getCPUMemEphemeralRequest(newPod)
 	if oldCPUReq != newCPUReq || oldMemReq != newMemReq || oldEphemeralReq != newEphemeralReq ||
 		!reflect.DeepEqual(oldPod.Labels, newPod.Labels) ||
-		!reflect.DeepEqual(oldPod.Annotations, newPod.Annotations) ||
-		!reflect.DeepEqual(oldPod.Spec.NodeSelector, newPod.Spec.NodeSelector) {
+		annotationsChanged(oldPod, newPod) ||
+		!reflect.DeepEqual(oldPod.Spec.NodeSelector, newPod.Spec.NodeSelector) ||
+		getRestartCount(oldPod) != getRestartCount(newPod) ||
+		isPodReady(oldPod) != isPodReady(newPod) {
+		if err := pw.checkPodConversion(newPod); err != nil {
+			glog.Errorf("Ignoring the update of pod which can't be scheduled by Firmament: %v", err)
+			if pw.clientset != nil {
+				NewPoseidonEvents(pw.clientset).ProcessConversionErrorEvent(newPod, err)
+			}
+			return
+		}
 		if updatedPod := pw.parsePod(newPod); updatedPod != nil {
+			if err := pw.mutatePod(updatedPod); err != nil {
+				glog.Errorf("Ignoring the update of pod %v: %v", updatedPod.Identifier, err)
+				if pw.clientset != nil {
+					NewPoseidonEvents(pw.clientset).ProcessConversionErrorEvent(newPod, err)
+				}
+				return
+			}
+			if err := checkPodPredicate(updatedPod); err != nil {
+				glog.Errorf("Ignoring the update of pod %v: %v", updatedPod.Identifier, err)
+				return
+			}
 			// we need to change the state here
 			updatedPod.State = PodUpdated
+			if pw.throttleCrashLoopUpdate(updatedPod, newPod, time.Now()) {
+				glog.V(2).Info("enqueuePodUpdate: Held the update of crash-looping pod ", updatedPod.Identifier)
+				return
+			}
 			pw.podWorkQueue.Add(key, updatedPod)
-			glog.V(2).Infof("enqueuePodUpdate: Updated pod ", updatedPod.Identifier)
+			glog.V(2).Info("enqueuePodUpdate: Updated pod ", updatedPod.Identifier)
 		}
 		return
 	}
@@ -394,19 +1104,160 @@ func (pw *PodWatcher) Run(stopCh <-chan struct{}, nWorkers int) {
 	glog.V(2).Info("Getting pod updates...")
 
 	go pw.controller.Run(stopCh)
+	pw.owners.Run(stopCh)
 
-	if !cache.WaitForCacheSync(stopCh, pw.controller.HasSynced) {
+	if !cache.WaitForCacheSync(stopCh, pw.controller.HasSynced, pw.owners.HasSynced) {
 		utilruntime.HandleError(fmt.Errorf("Timed out waiting for caches to sync"))
 		return
 	}
+	// Enqueue the pods of the initial list in one batch.
+	pw.flushInitialPods()
 
 	glog.V(2).Info("Starting pod watching workers")
+	wg := new(sync.WaitGroup)
 	for i := 0; i < nWorkers; i++ {
-		go wait.Until(pw.podWorker, time.Second, stopCh)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			wait.Until(pw.podWorker, time.Second, stopCh)
+		}()
 	}
+	go wait.Until(pw.abandonExpiredPods, scheduleDeadlineCheckInterval, stopCh)
+	go wait.Until(pw.reportPendingPods, pendingPodsReportInterval, stopCh)
 
 	<-stopCh
 	glog.V(2).Info("Stopping pod watcher")
+	// Shutting down the queue lets the workers drain the already queued pods before they return.
+	pw.podWorkQueue.ShutDown()
+	pw.Resume()
+	wg.Wait()
+	if pw.removeTasksOnShutdown {
+		pw.removeAllTasks()
+	}
+}
+
+// removeAllTasks withdraws all the tasks Poseidon submitted from Firmament, so that another scheduler
+// can take over the pods cleanly. It's only called once the workers have returned.
+func (pw *PodWatcher) removeAllTasks() {
+	PodMux.Lock()
+	defer PodMux.Unlock()
+	glog.Infof("Removing the %d tasks from Firmament", len(PodToTD))
+	for identifier, td := range PodToTD {
+		if err := pw.backend.RemoveTask(td.Uid); err != nil {
+			glog.Errorf("Failed to remove the task of pod %v from Firmament: %v", identifier, err)
+			continue
+		}
+		delete(PodToTD, identifier)
+		delete(TaskIDToPod, td.GetUid())
+	}
+}
+
+// Assignments returns a snapshot of the nodes Poseidon bound the pods to.
+func (pw *PodWatcher) Assignments() map[PodIdentifier]string {
+	PodMux.RLock()
+	defer PodMux.RUnlock()
+	assignments := make(map[PodIdentifier]string, len(podToNode))
+	for podIdentifier, nodeName := range podToNode {
+		assignments[podIdentifier] = nodeName
+	}
+	return assignments
+}
+
+// Pause stops the pod workers from processing queued pods, e.g. during a Firmament maintenance window.
+// Pods keep being watched and queued while paused.
+func (pw *PodWatcher) Pause() {
+	pw.pauseMux.Lock()
+	defer pw.pauseMux.Unlock()
+	if !pw.paused {
+		glog.Info("Pausing the pod workers")
+		pw.paused = true
+		pw.resumeCh = make(chan struct{})
+	}
+}
+
+// Resume lets the pod workers process the pods queued while paused.
+func (pw *PodWatcher) Resume() {
+	pw.pauseMux.Lock()
+	defer pw.pauseMux.Unlock()
+	if pw.paused {
+		glog.Info("Resuming the pod workers")
+		pw.paused = false
+		close(pw.resumeCh)
+	}
+}
+
+// waitWhilePaused blocks until the pod workers are resumed.
+func (pw *PodWatcher) waitWhilePaused() {
+	pw.pauseMux.Lock()
+	if !pw.paused {
+		pw.pauseMux.Unlock()
+		return
+	}
+	resumeCh := pw.resumeCh
+	pw.pauseMux.Unlock()
+	<-resumeCh
+}
+
+// handlePodWorkerPanic reports a panic raised while processing the first of the given items and
+// requeues the items, so that a malformed pod doesn't take the worker down. An item which keeps
+// panicking is dropped after maxPodWorkerRetries retries.
+func (pw *PodWatcher) handlePodWorkerPanic(key interface{}, items []interface{}, r interface{}) {
+	pod := items[0].(*Pod)
+	utilruntime.HandleError(fmt.Errorf("recovered from a panic processing pod %s in state %v: %v", pod.Identifier.UniqueName(), pod.State, r))
+	metrics.WorkQueueItemFailed("pods")
+	pw.panicRetriesMux.Lock()
+	if pw.panicRetries == nil {
+		pw.panicRetries = make(map[PodIdentifier]int)
+	}
+	pw.panicRetries[pod.Identifier]++
+	if pw.panicRetries[pod.Identifier] > maxPodWorkerRetries {
+		glog.Errorf("Dropping pod %v in state %v after %d retries", pod.Identifier, pod.State, maxPodWorkerRetries)
+		delete(pw.panicRetries, pod.Identifier)
+		items = items[1:]
+	}
+	pw.panicRetriesMux.Unlock()
+	// The key is still being processed, so the items are queued again once it's done.
+	for _, item := range items {
+		pw.requeuePod(key, item)
+	}
+}
+
+// retryTaskRemoval requeues the deletion of a pod whose task Firmament failed to remove, with an
+// exponential backoff. It returns false once the removal has been retried taskRemovalMaxRetries times,
+// the task is left in Firmament then.
+func (pw *PodWatcher) retryTaskRemoval(key interface{}, pod *Pod, err error) bool {
+	pw.taskRemovalRetriesMux.Lock()
+	if pw.taskRemovalRetries == nil {
+		pw.taskRemovalRetries = make(map[PodIdentifier]int)
+	}
+	retries := pw.taskRemovalRetries[pod.Identifier]
+	if retries >= pw.taskRemovalMaxRetries {
+		delete(pw.taskRemovalRetries, pod.Identifier)
+		pw.taskRemovalRetriesMux.Unlock()
+		glog.Errorf("Giving up removing the task of pod %v after %d retries, it's left in Firmament: %v", pod.Identifier, retries, err)
+		return false
+	}
+	pw.taskRemovalRetries[pod.Identifier] = retries + 1
+	pw.taskRemovalRetriesMux.Unlock()
+	delay := podRequeueBaseDelay << uint(retries)
+	if delay > podRequeueMaxDelay || delay <= 0 {
+		delay = podRequeueMaxDelay
+	}
+	if budgetDelay := pw.retryBudget.reserve(); budgetDelay > delay {
+		delay = budgetDelay
+	}
+	glog.Warningf("Failed to remove the task of pod %v, retrying in %v: %v", pod.Identifier, delay, err)
+	time.AfterFunc(delay, func() {
+		pw.podWorkQueue.Add(key, pod)
+	})
+	return true
+}
+
+// forgetTaskRemoval resets the retries of the removal of the task of a pod.
+func (pw *PodWatcher) forgetTaskRemoval(identifier PodIdentifier) {
+	pw.taskRemovalRetriesMux.Lock()
+	defer pw.taskRemovalRetriesMux.Unlock()
+	delete(pw.taskRemovalRetries, identifier)
 }
 
 func (pw *PodWatcher) podWorker() {
@@ -420,55 +1271,50 @@ func (pw *PodWatcher) podWorker() {
 			if quit {
 				return
 			}
+			// Hold the dequeued key while paused, the following keys stay queued in order.
+			pw.waitWhilePaused()
 			wg.Add(1)
 			go func(key interface{}, items []interface{}, wg *sync.WaitGroup) {
 				defer func() {
 					pw.podWorkQueue.Done(key)
 					wg.Done()
 				}()
-				for _, item := range items {
+				// processing is the index of the item being processed, the items from there on are
+				// requeued if processing it panics.
+				processing := 0
+				defer func() {
+					if r := recover(); r != nil {
+						pw.handlePodWorkerPanic(key, items[processing:], r)
+					}
+				}()
+				for i, item := range items {
+					processing = i
 					pod := item.(*Pod)
+					metrics.WorkQueueItemProcessed("pods")
 					switch pod.State {
 					case PodPending:
 						glog.V(2).Info("PodPending ", pod.Identifier)
-						PodMux.Lock()
-
-						// check if the pod already exists
-						// this cases happend when Replicaset are used.
-						// When a replicaset is delete it creates more pods with the same name
-						_, ok := PodToTD[pod.Identifier]
-						if ok {
-							// we ignore this since the pod already exists
-							// release the lock
-							glog.V(2).Info("Pod already added", pod.Identifier.Name, pod.Identifier.Namespace)
-							PodMux.Unlock()
+						if pod.Affinity != nil {
+							glog.V(3).Infof("PodPending %v affinity: %s", pod.Identifier, pod.Affinity)
+						}
+						if !pw.releaseHeldPod(pod) {
 							continue
 						}
-						jobID := pw.generateJobID(pod.OwnerRef)
-						jd, ok := jobIDToJD[jobID]
-						if !ok {
-							jd = pw.createNewJob(pod.OwnerRef)
-							jobIDToJD[jobID] = jd
-							jobNumTasksToRemove[jobID] = 0
+						if isAbandoned(pod.Identifier) {
+							continue
 						}
-						jobNumTasksToRemove[jobID]++
-						taskCount := jobNumTasksToRemove[jobID]
-						PodMux.Unlock()
-						td := pw.addTaskToJob(pod, jd.Uuid, jd.Name, (taskCount))
-						PodMux.Lock()
-						// if taskCount is '1' it means root task, update the RootTask pointer in the JobDescriptor
-						if taskCount == 1 {
-							jd.RootTask = td
+						if deadlineExceeded(pod.ScheduleDeadline, time.Now()) {
+							pw.abandonPod(pod)
+							continue
 						}
-						PodToTD[pod.Identifier] = td
-						TaskIDToPod[td.GetUid()] = pod.Identifier
-						taskDescription := &firmament.TaskDescription{
-							TaskDescriptor: td,
-							JobDescriptor:  jd,
+						if pod.GangSize > 1 {
+							pw.submitGangMember(pod)
+							continue
 						}
-						PodMux.Unlock()
-						metrics.SchedulingSubmitmLatency.Observe(metrics.SinceInMicroseconds(time.Time(pod.CreateTimeStamp.Time)))
-						firmament.TaskSubmitted(pw.fc, taskDescription)
+						if pw.throttleOwnerPod(pod) {
+							continue
+						}
+						pw.submitPod(pod)
 					case PodSucceeded:
 						glog.V(2).Info("PodSucceeded ", pod.Identifier)
 						PodMux.RLock()
@@ -477,20 +1323,37 @@ func (pw *PodWatcher) podWorker() {
 						if !ok {
 							glog.Fatalf("Pod %v does not exist", pod.Identifier)
 						}
-						firmament.TaskCompleted(pw.fc, &firmament.TaskUID{TaskUid: td.Uid})
+						pw.backend.CompleteTask(td.Uid)
+						PodMux.Lock()
+						completedPods[pod.Identifier] = struct{}{}
+						PodMux.Unlock()
 					case PodDeleted:
 						glog.V(2).Info("PodDeleted ", pod.Identifier)
-						PodMux.RLock()
+						PodMux.Lock()
+						delete(podToNode, pod.Identifier)
+						pw.forgetGangMember(pod)
+						forgetThrottledPod(pod)
 						td, ok := PodToTD[pod.Identifier]
-						PodMux.RUnlock()
+						_, completed := completedPods[pod.Identifier]
+						PodMux.Unlock()
+						pw.releaseInFlightPod(pod.Identifier)
+						forgetConvertedPod(pod.Identifier)
 						if !ok {
 							glog.Infof("Pod %s does not exist", pod.Identifier)
 							continue
 						}
+						// A completed pod, e.g. the pod of a Job garbage-collected once it succeeded, was
+						// already reported to firmament, only its local state is cleaned.
 						// TODO(jiaxuanzhou) need to metric the task remove latency ?
-						firmament.TaskRemoved(pw.fc, &firmament.TaskUID{TaskUid: td.Uid})
+						if completed {
+							glog.V(2).Infof("Pod %s was completed, not removing its task", pod.Identifier)
+						} else if err := pw.backend.RemoveTask(td.Uid); err != nil && pw.retryTaskRemoval(key, pod, err) {
+							continue
+						}
+						pw.forgetTaskRemoval(pod.Identifier)
 						PodMux.Lock()
 						delete(PodToTD, pod.Identifier)
+						delete(completedPods, pod.Identifier)
 						delete(TaskIDToPod, td.GetUid())
 						// TODO(ionel): Should we delete the task from JD's spawned field?
 						jobID := pw.generateJobID(pod.OwnerRef)
@@ -499,6 +1362,7 @@ func (pw *PodWatcher) podWorker() {
 							// Clean state because the job doesn't have any tasks left.
 							delete(jobNumTasksToRemove, jobID)
 							delete(jobIDToJD, jobID)
+							delete(jobGangSizes, jobID)
 						}
 						PodMux.Unlock()
 					case PodFailed:
@@ -509,7 +1373,18 @@ func (pw *PodWatcher) podWorker() {
 						if !ok {
 							glog.Fatalf("Pod %s does not exist", pod.Identifier)
 						}
-						firmament.TaskFailed(pw.fc, &firmament.TaskUID{TaskUid: td.Uid})
+						pw.backend.FailTask(td.Uid)
+					case PodEvicted:
+						glog.V(2).Info("PodEvicted ", pod.Identifier)
+						PodMux.RLock()
+						td, ok := PodToTD[pod.Identifier]
+						PodMux.RUnlock()
+						if !ok {
+							// The pod may be evicted before it was ever submitted to Firmament.
+							glog.Infof("Pod %s does not exist", pod.Identifier)
+							continue
+						}
+						pw.backend.EvictTask(td.Uid)
 					case PodRunning:
 						glog.V(2).Info("PodRunning ", pod.Identifier)
 						// We don't have to do anything.
@@ -518,11 +1393,34 @@ func (pw *PodWatcher) podWorker() {
 						// TODO(ionel): Handle Unknown case.
 					case PodUpdated:
 						glog.V(2).Info("PodUpdated ", pod.Identifier)
+						if pod.Affinity != nil {
+							glog.V(3).Infof("PodUpdated %v affinity: %s", pod.Identifier, pod.Affinity)
+						}
 						PodMux.Lock()
 						jobId := pw.generateJobID(pod.OwnerRef)
 						jd, okJob := jobIDToJD[jobId]
 						td, okPod := PodToTD[pod.Identifier]
+						_, oversized := oversizedPods[pod.Identifier]
+						// The pod changed, its attempts start over.
+						delete(unschedulableAttempts, pod.Identifier)
+						throttled := replaceThrottledPod(pod)
 						PodMux.Unlock()
+						if throttled {
+							// The latest version of the pod is submitted once it's released.
+							continue
+						}
+						if oversized {
+							// The pod changed, or a node was added, so Firmament gets to place it again.
+							PodMux.Lock()
+							delete(oversizedPods, pod.Identifier)
+							PodMux.Unlock()
+							pod.State = PodPending
+							if pw.throttleOwnerPod(pod) {
+								continue
+							}
+							pw.submitPod(pod)
+							continue
+						}
 						if !okJob {
 							glog.Infof("Pod's %v job does not exist", pod.Identifier)
 							continue
@@ -532,20 +1430,156 @@ func (pw *PodWatcher) podWorker() {
 							continue
 						}
 						pw.updateTask(pod, td)
-						taskDescription := &firmament.TaskDescription{
+						recordConvertedPod(pod)
+						pw.backend.UpdateTask(&firmament.TaskDescription{
 							TaskDescriptor: td,
 							JobDescriptor:  jd,
-						}
-						firmament.TaskUpdated(pw.fc, taskDescription)
+						})
 					default:
 						glog.Fatalf("Pod %v in unexpected state %v", pod.Identifier, pod.State)
 					}
 				}
+				// All the items were processed, reset the backoff of the key.
+				if queue, ok := pw.podWorkQueue.(RateLimitingQueue); ok {
+					queue.Forget(key)
+				}
 			}(key, items, wg)
 		}
 	}()
 }
 
+// submitPod adds the pod's task to its job and submits it to the scheduler backend.
+func (pw *PodWatcher) submitPod(pod *Pod) {
+	span := startPodSpan(pod.spanContext, "poseidon.SubmitPod", pod.Identifier)
+	defer span.Finish()
+	PodMux.Lock()
+
+	// check if the pod already exists
+	// this cases happend when Replicaset are used.
+	// When a replicaset is delete it creates more pods with the same name
+	_, ok := PodToTD[pod.Identifier]
+	if ok {
+		// we ignore this since the pod already exists
+		// release the lock
+		glog.V(2).Info("Pod already added", pod.Identifier.Name, pod.Identifier.Namespace)
+		PodMux.Unlock()
+		return
+	}
+	jobID := pw.generateJobID(pod.OwnerRef)
+	jd, ok := jobIDToJD[jobID]
+	if !ok {
+		jd = pw.createNewJob(pod.OwnerRef)
+		jobIDToJD[jobID] = jd
+		jobNumTasksToRemove[jobID] = 0
+	}
+	jobNumTasksToRemove[jobID]++
+	taskCount := jobNumTasksToRemove[jobID]
+	PodMux.Unlock()
+	td := pw.addTaskToJob(pod, jd.Uuid, jd.Name, (taskCount))
+	PodMux.Lock()
+	// if taskCount is '1' it means root task, update the RootTask pointer in the JobDescriptor
+	if taskCount == 1 {
+		jd.RootTask = td
+	}
+	PodToTD[pod.Identifier] = td
+	TaskIDToPod[td.GetUid()] = pod.Identifier
+	taskDescription := &firmament.TaskDescription{
+		TaskDescriptor: td,
+		JobDescriptor:  jd,
+	}
+	PodMux.Unlock()
+	recordConvertedPod(pod)
+	metrics.SchedulingSubmitmLatency.Observe(metrics.SinceInMicroseconds(time.Time(pod.CreateTimeStamp.Time)))
+	pw.backend.SubmitTask(tracing.ContextWithSpan(context.Background(), span), taskDescription)
+	go pw.markPodSubmitted(pod.Identifier, time.Now())
+}
+
+// exceedsNodeCapacities returns true if the pod requests more cpu, memory or ephemeral storage than
+// any of the known nodes can provide. It returns false while no node is known. The ephemeral storage
+// of the nodes which don't report any isn't checked.
+func (pw *PodWatcher) exceedsNodeCapacities(pod *Pod) bool {
+	NodeMux.RLock()
+	defer NodeMux.RUnlock()
+	if len(NodeToRTND) == 0 {
+		return false
+	}
+	for _, rtnd := range NodeToRTND {
+		capacity := rtnd.GetResourceDesc().GetResourceCapacity()
+		if capacity == nil {
+			continue
+		}
+		if float32(pod.CPURequest) <= capacity.CpuCores && uint64(pod.MemRequestKb) <= capacity.RamCap &&
+			(capacity.EphemeralCap == 0 || uint64(pod.EphemeralReqKb) <= capacity.EphemeralCap) {
+			return false
+		}
+	}
+	return true
+}
+
+// requeueUnschedulablePods enqueues the pods held back because they didn't fit on any node again,
+// so that they're checked against the nodes added since. The pods Firmament failed to place don't
+// need it, Firmament considers them again in every scheduling round.
+func (pw *PodWatcher) requeueUnschedulablePods() {
+	PodMux.RLock()
+	pods := make([]*Pod, 0, len(oversizedPods))
+	for _, pod := range oversizedPods {
+		requeuedPod := *pod
+		requeuedPod.State = PodUpdated
+		pods = append(pods, &requeuedPod)
+	}
+	PodMux.RUnlock()
+	for _, pod := range pods {
+		pw.podWorkQueue.Add(pod.Identifier.UniqueName(), pod)
+		glog.V(2).Info("requeueUnschedulablePods: Requeued pod ", pod.Identifier)
+	}
+}
+
+// requeuePriorityClassPods re-enqueues the pods of a priority class whose value changed, so that
+// their priority is updated in Firmament.
+func (pw *PodWatcher) requeuePriorityClassPods(priorityClassName string) {
+	var k8sPods []*v1.Pod
+	PodToK8sPodLock.Lock()
+	for _, k8sPod := range PodToK8sPod {
+		if k8sPod.Spec.PriorityClassName == priorityClassName {
+			k8sPods = append(k8sPods, k8sPod.DeepCopy())
+		}
+	}
+	PodToK8sPodLock.Unlock()
+	// The pods are parsed once PodToK8sPodLock is released: parsePod may take PodMux, which is taken
+	// before PodToK8sPodLock.
+	for _, k8sPod := range k8sPods {
+		pod := pw.parsePod(k8sPod)
+		pod.State = PodUpdated
+		pw.podWorkQueue.Add(pod.Identifier.UniqueName(), pod)
+		glog.V(2).Info("requeuePriorityClassPods: Requeued pod ", pod.Identifier)
+	}
+}
+
+// requeueSubmittedPods re-enqueues the pods whose task is in Firmament and which haven't terminated,
+// so that their task is updated with the constraints Firmament may have just become able to express.
+func (pw *PodWatcher) requeueSubmittedPods() {
+	var k8sPods []*v1.Pod
+	PodMux.RLock()
+	PodToK8sPodLock.Lock()
+	for podIdentifier := range PodToTD {
+		k8sPod, ok := PodToK8sPod[podIdentifier]
+		if !ok || k8sPod.Status.Phase == v1.PodSucceeded || k8sPod.Status.Phase == v1.PodFailed {
+			continue
+		}
+		k8sPods = append(k8sPods, k8sPod.DeepCopy())
+	}
+	PodToK8sPodLock.Unlock()
+	PodMux.RUnlock()
+	// The pods are parsed once the locks are released: parsePod may take PodMux again, which blocks
+	// behind a waiting writer.
+	for _, k8sPod := range k8sPods {
+		pod := pw.parsePod(k8sPod)
+		pod.State = PodUpdated
+		pw.podWorkQueue.Add(pod.Identifier.UniqueName(), pod)
+	}
+	glog.Infof("requeueSubmittedPods: Requeued %d pods", len(k8sPods))
+}
+
 func (pw *PodWatcher) createNewJob(jobName string) *firmament.JobDescriptor {
 	jobDesc := &firmament.JobDescriptor{
 		Uuid:  pw.generateJobID(jobName),
@@ -559,30 +1593,22 @@ func (pw *PodWatcher) updateTask(pod *Pod, td *firmament.TaskDescriptor) {
 	// TODO(ionel): Update LabelSelector!
 	td.ResourceRequest.CpuCores = float32(pod.CPURequest)
 	td.ResourceRequest.RamCap = uint64(pod.MemRequestKb)
+	td.ResourceRequest.EphemeralCap = uint64(pod.EphemeralReqKb)
+	td.StartTime = toFirmamentTimestamp(pod.StartTime.Time)
+	td.Priority = toFirmamentPriority(pod.Priority)
+	setTaskBandwidthRequest(td, pod)
+	setTaskNetworkRequirement(td, pod.Labels)
 	// Update labels.
-	td.Labels = nil
-	for label, value := range pod.Labels {
-		td.Labels = append(td.Labels,
-			&firmament.Label{
-				Key:   label,
-				Value: value,
-			})
-	}
+	td.Labels = pw.getFirmamentLabels(pod)
 
 	// update label selectors
 	td.LabelSelectors = nil
 	td.LabelSelectors = pw.getFirmamentLabelSelectorFromNodeSelectorMap(pod.NodeSelector, SortNodeSelectorsKey(pod.NodeSelector))
+	td.LabelSelectors = append(td.LabelSelectors, pw.getDefaultOSLabelSelector(pod)...)
+	td.LabelSelectors = append(td.LabelSelectors, getExtendedResourceSelectors(pod)...)
 
 	//Add tolerations
-	for _, tolerations := range pod.Tolerations {
-		td.Toleration = append(td.Toleration,
-			&firmament.Toleration{
-				Key:      tolerations.Key,
-				Value:    tolerations.Value,
-				Operator: tolerations.Operator,
-				Effect:   tolerations.Effect,
-			})
-	}
+	td.Toleration = pw.getFirmamentTolerations(pod)
 
 	nodeAffinity := len(pod.Affinity.NodeAffinity.HardScheduling.NodeSelectorTerms) > 0 || len(pod.Affinity.NodeAffinity.SoftScheduling) > 0
 	podAffinity := len(pod.Affinity.PodAffinity.HardScheduling) > 0 || len(pod.Affinity.PodAffinity.SoftScheduling) > 0
@@ -621,7 +1647,7 @@ func (pw *PodWatcher) updateTask(pod *Pod, td *firmament.TaskDescriptor) {
 
 func (pw *PodWatcher) addTaskToJob(pod *Pod, jdUid string, jdName string, tdID int) *firmament.TaskDescriptor {
 	task := &firmament.TaskDescriptor{
-		Name:      pod.Identifier.UniqueName(),
+		Name:      withClusterID(pod.Identifier.UniqueName()),
 		Namespace: pod.Identifier.Namespace,
 		State:     firmament.TaskDescriptor_CREATED,
 		JobId:     jdUid,
@@ -632,29 +1658,22 @@ func (pw *PodWatcher) addTaskToJob(pod *Pod, jdUid string, jdName string, tdID i
 			EphemeralCap: uint64(pod.EphemeralReqKb),
 		},
 	}
+	// Forward the age of the pod, e.g. for the cost models to favor evicting the newer pods.
+	task.StartTime = toFirmamentTimestamp(pod.StartTime.Time)
+	task.Priority = toFirmamentPriority(pod.Priority)
+	// Forward the bandwidth, e.g. for network-aware placement.
+	setTaskBandwidthRequest(task, pod)
 
 	// Add labels.
-	for label, value := range pod.Labels {
-		task.Labels = append(task.Labels,
-			&firmament.Label{
-				Key:   label,
-				Value: value,
-			})
-	}
+	task.Labels = pw.getFirmamentLabels(pod)
 
 	//Add tolerations
-	for _, tolerations := range pod.Tolerations {
-		task.Toleration = append(task.Toleration,
-			&firmament.Toleration{
-				Key:      tolerations.Key,
-				Value:    tolerations.Value,
-				Operator: tolerations.Operator,
-				Effect:   tolerations.Effect,
-			})
-	}
+	task.Toleration = pw.getFirmamentTolerations(pod)
 	// Get the network requirement from pods label, and set it in ResourceRequest of the TaskDescriptor
 	setTaskNetworkRequirement(task, pod.Labels)
 	task.LabelSelectors = pw.getFirmamentLabelSelectorFromNodeSelectorMap(pod.NodeSelector, SortNodeSelectorsKey(pod.NodeSelector))
+	task.LabelSelectors = append(task.LabelSelectors, pw.getDefaultOSLabelSelector(pod)...)
+	task.LabelSelectors = append(task.LabelSelectors, getExtendedResourceSelectors(pod)...)
 
 	nodeAffinity := len(pod.Affinity.NodeAffinity.HardScheduling.NodeSelectorTerms) > 0 || len(pod.Affinity.NodeAffinity.SoftScheduling) > 0
 	podAffinity := len(pod.Affinity.PodAffinity.HardScheduling) > 0 || len(pod.Affinity.PodAffinity.SoftScheduling) > 0
@@ -701,24 +1720,20 @@ func (pw *PodWatcher) generateJobID(seed string) string {
 		glog.Fatal("Seed value is nil")
 	}
 
-	return GenerateUUID(seed)
+	return GenerateUUID(withClusterID(seed))
 }
 
 func (pw *PodWatcher) generateTaskID(jdUID string, taskNum int) uint64 {
-	return HashCombine(jdUID, taskNum)
+	return HashCombine(withClusterID(jdUID), taskNum)
 }
 
-// GetOwnerReference to get the parent object reference
+// GetOwnerReference returns the UID of the controller of the pod, the owner reference marked as
+// controller among the owner references of the pod, which aren't controllers otherwise, e.g. garbage
+// collection dependencies. It falls back to the pod UID if the pod has no controller.
 func GetOwnerReference(pod *v1.Pod) string {
-	// Return if owner reference exists.
-	ownerRefs := pod.GetObjectMeta().GetOwnerReferences()
-	if len(ownerRefs) != 0 {
-		for x := range ownerRefs {
-			ref := &ownerRefs[x]
-			if ref.Controller != nil && *ref.Controller {
-				return string(ref.UID)
-			}
-		}
+	// Return the controller owner reference if it exists.
+	if ownerRef := metav1.GetControllerOf(pod); ownerRef != nil {
+		return string(ownerRef.UID)
 	}
 
 	// Return the controller-uid label if it exists.
@@ -751,6 +1766,32 @@ func (pw *PodWatcher) getFirmamentLabelSelectorFromNodeSelectorMap(nodeSelector
 	return firmamentLabelSelector
 }
 
+// getDefaultOSLabelSelector returns a selector of the DefaultOS nodes if the pod doesn't select
+// the OS of its node through its node selector or its required node affinity.
+func (pw *PodWatcher) getDefaultOSLabelSelector(pod *Pod) []*firmament.LabelSelector {
+	for _, label := range []string{LabelOS, BetaLabelOS} {
+		if _, ok := pod.NodeSelector[label]; ok {
+			return nil
+		}
+	}
+	if pod.Affinity != nil && pod.Affinity.NodeAffinity != nil {
+		for _, term := range pod.Affinity.NodeAffinity.HardScheduling.NodeSelectorTerms {
+			for _, requirement := range term.MatchExpressions {
+				if requirement.Key == LabelOS || requirement.Key == BetaLabelOS {
+					return nil
+				}
+			}
+		}
+	}
+	return []*firmament.LabelSelector{
+		{
+			Type:   firmament.LabelSelector_IN_SET,
+			Key:    LabelOS,
+			Values: []string{DefaultOS},
+		},
+	}
+}
+
 func (pw *PodWatcher) getFirmamentNodeSelTerm(pod *Pod) []*firmament.NodeSelectorTerm {
 	var fns []*firmament.NodeSelectorTerm
 	err := copier.Copy(&fns, pod.Affinity.NodeAffinity.HardScheduling.NodeSelectorTerms)
@@ -769,21 +1810,93 @@ func (pw *PodWatcher) getFirmamentPreferredSchedulingTerm(pod *Pod) []*firmament
 	return pst
 }
 
+// matchLabelsAsRequirements returns the matchLabels of the selector as the equivalent In requirements,
+// sorted by key. A Firmament label selector only holds a single match label, so the matchLabels are
+// sent to Firmament as requirements.
+func matchLabelsAsRequirements(selector *metav1.LabelSelector) []metav1.LabelSelectorRequirement {
+	if selector == nil || len(selector.MatchLabels) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(selector.MatchLabels))
+	for key := range selector.MatchLabels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	requirements := make([]metav1.LabelSelectorRequirement, 0, len(keys))
+	for _, key := range keys {
+		requirements = append(requirements, metav1.LabelSelectorRequirement{
+			Key:      key,
+			Operator: metav1.LabelSelectorOpIn,
+			Values:   []string{selector.MatchLabels[key]},
+		})
+	}
+	return requirements
+}
+
+// addMatchLabels adds the matchLabels of the selector to the converted pod affinity term.
+func addMatchLabels(term *firmament.PodAffinityTerm, selector *metav1.LabelSelector) {
+	requirements := matchLabelsAsRequirements(selector)
+	if term == nil || len(requirements) == 0 {
+		return
+	}
+	if term.LabelSelector == nil {
+		term.LabelSelector = &firmament.PodLabelSelector{}
+	}
+	term.LabelSelector.MatchLabels = nil
+	for _, requirement := range requirements {
+		term.LabelSelector.MatchExpressions = append(term.LabelSelector.MatchExpressions, &firmament.LabelSelectorRequirement{
+			Key:      requirement.Key,
+			Operator: string(requirement.Operator),
+			Values:   requirement.Values,
+		})
+	}
+}
+
+// addMatchLabelsAntiAff adds the matchLabels of the selector to the converted pod anti-affinity term.
+func addMatchLabelsAntiAff(term *firmament.PodAffinityTermAntiAff, selector *metav1.LabelSelector) {
+	requirements := matchLabelsAsRequirements(selector)
+	if term == nil || len(requirements) == 0 {
+		return
+	}
+	if term.LabelSelector == nil {
+		term.LabelSelector = &firmament.LabelSelectorAntiAff{}
+	}
+	term.LabelSelector.MatchLabels = nil
+	for _, requirement := range requirements {
+		term.LabelSelector.MatchExpressions = append(term.LabelSelector.MatchExpressions, &firmament.LabelSelectorRequirementAntiAff{
+			Key:      requirement.Key,
+			Operator: string(requirement.Operator),
+			Values:   requirement.Values,
+		})
+	}
+}
+
 func (pw *PodWatcher) getFirmamentPodAffinityTerm(pod *Pod) []*firmament.PodAffinityTerm {
 	var pat []*firmament.PodAffinityTerm
 	err := copier.Copy(&pat, pod.Affinity.PodAffinity.HardScheduling)
 	if err != nil {
 		glog.Errorf("PodAffinityTerm %v could not be copied to firmament, err: %v", pod.Affinity.PodAffinity.HardScheduling, err)
 	}
+	for i := range pat {
+		addMatchLabels(pat[i], pod.Affinity.PodAffinity.HardScheduling[i].LabelSelector)
+	}
 	return pat
 }
 
+// maxAffinityWeight is the highest weight of a soft affinity term. The weights are forwarded verbatim:
+// the affinity messages of the Firmament API carry a preference weight, which Firmament's cost model
+// normalizes into arc costs itself, and have no field for a cost.
+const maxAffinityWeight = 100
+
 func (pw *PodWatcher) getFirmamentWeightedPodAffinityTerm(pod *Pod) []*firmament.WeightedPodAffinityTerm {
 	var wpat []*firmament.WeightedPodAffinityTerm
 	err := copier.Copy(&wpat, pod.Affinity.PodAffinity.SoftScheduling)
 	if err != nil {
 		glog.Errorf("WeightedPodAffinityTerm %v could not be copied to firmament, err: %v", pod.Affinity.PodAffinity.SoftScheduling, err)
 	}
+	for i := range wpat {
+		addMatchLabels(wpat[i].GetPodAffinityTerm(), pod.Affinity.PodAffinity.SoftScheduling[i].PodAffinityTerm.LabelSelector)
+	}
 	return wpat
 }
 
@@ -793,6 +1906,9 @@ func (pw *PodWatcher) getFirmamentPodAffinityTermforPodAntiAffinity(pod *Pod) []
 	if err != nil {
 		glog.Errorf("PodAffinityTerm %v for PodAntiAffinity could not be copied to firmament, err: %v", pod.Affinity.PodAntiAffinity.HardScheduling, err)
 	}
+	for i := range pat {
+		addMatchLabelsAntiAff(pat[i], pod.Affinity.PodAntiAffinity.HardScheduling[i].LabelSelector)
+	}
 	return pat
 }
 
@@ -802,9 +1918,176 @@ func (pw *PodWatcher) getFirmamentWeightedPodAffinityTermforPodAntiAffinity(pod
 	if err != nil {
 		glog.Errorf("WeightedPodAffinityTerm %v for PodAntiAffinity could not be copied to firmament, err: %v", pod.Affinity.PodAntiAffinity.SoftScheduling, err)
 	}
+	for i := range wpat {
+		addMatchLabelsAntiAff(wpat[i].GetPodAffinityTerm(), pod.Affinity.PodAntiAffinity.SoftScheduling[i].PodAffinityTerm.LabelSelector)
+	}
 	return wpat
 }
 
+// forwardsLabel returns true if the pod label is sent to Firmament: it matches one of the prefixes,
+// or the pod (anti-)affinity of a pod selects it.
+func (pw *PodWatcher) forwardsLabel(label string) bool {
+	if len(pw.labelPrefixes) == 0 {
+		return true
+	}
+	for _, prefix := range pw.labelPrefixes {
+		if strings.HasPrefix(label, prefix) {
+			return true
+		}
+	}
+	pw.affinityLabelsMux.Lock()
+	defer pw.affinityLabelsMux.Unlock()
+	_, ok := pw.affinityLabels[label]
+	return ok
+}
+
+// recordAffinityLabels exempts the labels the pod (anti-)affinity of the pod selects from the label
+// prefixes, so that they're sent for the pods submitted from now on. The pods already submitted
+// without them can't be matched until they're updated, which is warned about.
+func (pw *PodWatcher) recordAffinityLabels(pod *Pod) {
+	if len(pw.labelPrefixes) == 0 || pod.Affinity == nil {
+		return
+	}
+	var terms []PodAffinityTerm
+	for _, podAffinity := range []*PodAffinity{pod.Affinity.PodAffinity, pod.Affinity.PodAntiAffinity} {
+		if podAffinity == nil {
+			continue
+		}
+		terms = append(terms, podAffinity.HardScheduling...)
+		for _, weighted := range podAffinity.SoftScheduling {
+			terms = append(terms, weighted.PodAffinityTerm)
+		}
+	}
+	var keys []string
+	for _, term := range terms {
+		if term.LabelSelector == nil {
+			continue
+		}
+		for key := range term.LabelSelector.MatchLabels {
+			keys = append(keys, key)
+		}
+		for _, expression := range term.LabelSelector.MatchExpressions {
+			keys = append(keys, expression.Key)
+		}
+	}
+	for _, key := range keys {
+		if pw.forwardsLabel(key) {
+			continue
+		}
+		pw.affinityLabelsMux.Lock()
+		if pw.affinityLabels == nil {
+			pw.affinityLabels = make(map[string]struct{})
+		}
+		pw.affinityLabels[key] = struct{}{}
+		pw.affinityLabelsMux.Unlock()
+		glog.Warningf("The pod affinity of pod %v selects label %s, which doesn't match --podLabelPrefixes: it's now sent to Firmament, but the pods already submitted can't be matched on it until they're updated", pod.Identifier, key)
+	}
+}
+
+// getFirmamentLabels returns the pod labels and the labels mapped from the pod annotations.
+// A pod label wins over an annotation mapped to the same key.
+func (pw *PodWatcher) getFirmamentLabels(pod *Pod) []*firmament.Label {
+	pw.recordAffinityLabels(pod)
+	var firmamentLabels []*firmament.Label
+	for label, value := range pod.Labels {
+		if !pw.forwardsLabel(label) {
+			continue
+		}
+		firmamentLabels = append(firmamentLabels,
+			&firmament.Label{
+				Key:   label,
+				Value: value,
+			})
+	}
+	for annotation, value := range pod.Annotations {
+		for annotationPrefix, labelPrefix := range pw.annotationLabelPrefixes {
+			if !strings.HasPrefix(annotation, annotationPrefix) {
+				continue
+			}
+			label := labelPrefix + strings.TrimPrefix(annotation, annotationPrefix)
+			if _, ok := pod.Labels[label]; ok {
+				continue
+			}
+			firmamentLabels = append(firmamentLabels,
+				&firmament.Label{
+					Key:   label,
+					Value: value,
+				})
+			break
+		}
+	}
+	if pod.GangSize > 1 {
+		firmamentLabels = append(firmamentLabels,
+			&firmament.Label{
+				Key:   GangSizeLabel,
+				Value: strconv.Itoa(int(pod.GangSize)),
+			})
+	}
+	if pod.ControllerRef != nil {
+		firmamentLabels = append(firmamentLabels,
+			&firmament.Label{
+				Key:   ControllerUIDLabel,
+				Value: pod.ControllerRef.UID,
+			})
+	}
+	if pod.ServiceAccount != "" {
+		firmamentLabels = append(firmamentLabels,
+			&firmament.Label{
+				Key:   ServiceAccountLabel,
+				Value: pod.ServiceAccount,
+			})
+	}
+	if pod.RestartCount > 0 {
+		firmamentLabels = append(firmamentLabels,
+			&firmament.Label{
+				Key:   RestartCountLabel,
+				Value: strconv.Itoa(int(pod.RestartCount)),
+			})
+	}
+	if pod.IsReady {
+		firmamentLabels = append(firmamentLabels,
+			&firmament.Label{
+				Key:   ReadyLabel,
+				Value: "true",
+			})
+	}
+	if pod.SwapRequestKb > 0 {
+		firmamentLabels = append(firmamentLabels,
+			&firmament.Label{
+				Key:   SwapRequestLabel,
+				Value: strconv.FormatInt(pod.SwapRequestKb, 10),
+			})
+	}
+	if pw.reportContainers && len(pod.Containers) > 0 {
+		firmamentLabels = append(firmamentLabels,
+			&firmament.Label{
+				Key:   ContainerResourcesLabel,
+				Value: containerResourcesLabelValue(pod.Containers),
+			})
+	}
+	return firmamentLabels
+}
+
+// getFirmamentTolerations converts the pod tolerations. The effect is forwarded verbatim, including
+// PreferNoSchedule, so that Firmament respects the soft taints too. TolerationSeconds is only
+// forwarded when it is set, Firmament reads an unset value as tolerating the taint forever.
+func (pw *PodWatcher) getFirmamentTolerations(pod *Pod) []*firmament.Toleration {
+	var tolerations []*firmament.Toleration
+	for _, toleration := range pod.Tolerations {
+		firmamentToleration := &firmament.Toleration{
+			Key:      toleration.Key,
+			Value:    toleration.Value,
+			Operator: toleration.Operator,
+			Effect:   toleration.Effect,
+		}
+		if toleration.TolerationSeconds != nil {
+			firmamentToleration.TolerationSeconds = *toleration.TolerationSeconds
+		}
+		tolerations = append(tolerations, firmamentToleration)
+	}
+	return tolerations
+}
+
 func setTaskNetworkRequirement(td *firmament.TaskDescriptor, nodeSelectors NodeSelectors) {
 	if val, ok := nodeSelectors["networkRequirement"]; ok {
 		res, err := strconv.ParseUint(val, 10, 64)
@@ -875,46 +2158,10 @@ func (pw *PodWatcher) getPVNodeAffinity(volumes []v1.Volume, pod *v1.Pod) (*v1.P
 				continue
 			}
 			// update the pods NodeAfiinity field with he PV's NodeAffinity term
-			if pod.Spec.Affinity != nil {
-				podNodeAffinity := pod.Spec.Affinity.NodeAffinity
-				if podNodeAffinity != nil {
-					// Check if the NodeAffinity Hard section is available, update only the RequiredDuringSchedulingIgnoredDuringExecution section
-					// of the pod NodeAffinity
-					if podNodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution != nil {
-						podNodeSelector := podNodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution
-
-						// check Pods NodeSelectorTerms and prepend PV's Node selector requirement to the first NodeSelectorTerms
-						if len(podNodeSelector.NodeSelectorTerms) > 0 {
-							//get the first nodeselector term and update the match expression with our term
-							nodeSelectorTerm := podNodeSelector.NodeSelectorTerms[0]
-							for _, pvNodeSelector := range pvNodeSelector.NodeSelectorTerms {
-								//Note: we don't use the node fields terms
-								nodeSelectorTerm.MatchExpressions = append(nodeSelectorTerm.MatchExpressions, pvNodeSelector.MatchExpressions...)
-							}
-							podNodeSelector.NodeSelectorTerms[0] = nodeSelectorTerm
-						} else {
-							podNodeSelector.NodeSelectorTerms = append(podNodeSelector.NodeSelectorTerms, pvNodeSelector.NodeSelectorTerms...)
-						}
-					} else {
-						podNodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution = &v1.NodeSelector{
-							NodeSelectorTerms: pvNodeSelector.NodeSelectorTerms,
-						}
-					}
-				} else {
-					pod.Spec.Affinity.NodeAffinity = &v1.NodeAffinity{
-						RequiredDuringSchedulingIgnoredDuringExecution: &v1.NodeSelector{
-							NodeSelectorTerms: pvNodeSelector.NodeSelectorTerms,
-						}}
-				}
-			} else {
-				pod.Spec.Affinity = &v1.Affinity{
-					NodeAffinity: &v1.NodeAffinity{
-						RequiredDuringSchedulingIgnoredDuringExecution: &v1.NodeSelector{
-							NodeSelectorTerms: pvNodeSelector.NodeSelectorTerms,
-						},
-					},
-				}
+			if pod.Spec.Affinity == nil {
+				pod.Spec.Affinity = &v1.Affinity{}
 			}
+			pod.Spec.Affinity.NodeAffinity = mergeNodeAffinity(pod.Spec.Affinity.NodeAffinity, pvNodeSelector)
 		} else {
 			// cannot find the right pv
 			glog.V(2).Info("Cannot schedule this pod since no matchin PV found", pod.Name)
@@ -925,10 +2172,73 @@ func (pw *PodWatcher) getPVNodeAffinity(volumes []v1.Volume, pod *v1.Pod) (*v1.P
 	return pod, true
 }
 
+// mergeNodeAffinity returns a node affinity requiring the nodes to match both the required node
+// selector of affinity and the given required node selectors, e.g. the ones of the nodeSelector or
+// of the volumes of the pod. The preferred terms of affinity are kept. A nil or empty selector
+// doesn't constrain the nodes. The result only depends on the order of the selectors.
+func mergeNodeAffinity(affinity *v1.NodeAffinity, required ...*v1.NodeSelector) *v1.NodeAffinity {
+	var merged *v1.NodeAffinity
+	if affinity != nil {
+		merged = affinity.DeepCopy()
+	}
+	for _, selector := range required {
+		if selector == nil || len(selector.NodeSelectorTerms) == 0 {
+			continue
+		}
+		if merged == nil {
+			merged = &v1.NodeAffinity{}
+		}
+		current := merged.RequiredDuringSchedulingIgnoredDuringExecution
+		if current == nil || len(current.NodeSelectorTerms) == 0 {
+			merged.RequiredDuringSchedulingIgnoredDuringExecution = selector.DeepCopy()
+			continue
+		}
+		current.NodeSelectorTerms = mergeNodeSelectorTerms(current.NodeSelectorTerms, selector.NodeSelectorTerms)
+	}
+	return merged
+}
+
+// mergeNodeSelectorTerms returns the terms matching the nodes selected by both podTerms and pvTerms.
+// The terms of a selector are ORed and the requirements of a term are ANDed, so every pod term
+// is combined with every PV term.
+func mergeNodeSelectorTerms(podTerms, pvTerms []v1.NodeSelectorTerm) []v1.NodeSelectorTerm {
+	var merged []v1.NodeSelectorTerm
+	for _, podTerm := range podTerms {
+		for _, pvTerm := range pvTerms {
+			var term v1.NodeSelectorTerm
+			term.MatchExpressions = append(term.MatchExpressions, podTerm.MatchExpressions...)
+			term.MatchExpressions = append(term.MatchExpressions, pvTerm.MatchExpressions...)
+			term.MatchFields = append(term.MatchFields, podTerm.MatchFields...)
+			term.MatchFields = append(term.MatchFields, pvTerm.MatchFields...)
+			merged = append(merged, term)
+		}
+	}
+	return merged
+}
+
+// nodeSelectorToNodeSelector converts the nodeSelector of a pod to the equivalent required node
+// selector, a single term with a requirement per label in the order of the label keys. It returns
+// nil if the nodeSelector has no node label.
+func nodeSelectorToNodeSelector(nodeSelector map[string]string) *v1.NodeSelector {
+	keys := SortNodeSelectorsKey(nodeSelector)
+	if len(keys) == 0 {
+		return nil
+	}
+	var term v1.NodeSelectorTerm
+	for _, key := range keys {
+		term.MatchExpressions = append(term.MatchExpressions, v1.NodeSelectorRequirement{
+			Key:      key,
+			Operator: v1.NodeSelectorOpIn,
+			Values:   []string{nodeSelector[key]},
+		})
+	}
+	return &v1.NodeSelector{NodeSelectorTerms: []v1.NodeSelectorTerm{term}}
+}
+
 func Update(pw kubernetes.Interface, pod *v1.Pod, condition *v1.PodCondition) error {
 	glog.V(1).Infof("Updating pod condition for %s/%s to (%s==%s)", pod.Namespace, pod.Name, condition.Type, condition.Status)
 	if UpdatePodCondition(&pod.Status, condition) {
-		_, err := pw.CoreV1().Pods(pod.Namespace).UpdateStatus(pod)
+		_, err := updatePodStatus(pw, pod)
 		return err
 	}
 	return nil
@@ -18,18 +18,40 @@ package k8sclient
 
 import (
 	"bytes"
+	"encoding/json"
+	"expvar"
+	"fmt"
 	"github.com/golang/mock/gomock"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
 	"k8s.io/api/core/v1"
+	schedulingv1beta1 "k8s.io/api/scheduling/v1beta1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"net/http"
+	"net/http/httptest"
 	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"testing"
 	"time"
 
 	"github.com/kubernetes-sigs/poseidon/pkg/firmament"
+	"github.com/kubernetes-sigs/poseidon/pkg/metrics"
+	"github.com/kubernetes-sigs/poseidon/pkg/signals"
+	"github.com/kubernetes-sigs/poseidon/pkg/tracing"
+	dto "github.com/prometheus/client_model/go"
 	"k8s.io/client-go/kubernetes/fake"
+	core "k8s.io/client-go/testing"
 	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
 	"log"
 )
 
@@ -179,6 +201,8 @@ func GetPodPhase(strPhase string) v1.PodPhase {
 		podPhase = v1.PodSucceeded
 	case "Failed":
 		podPhase = v1.PodFailed
+	default:
+		podPhase = v1.PodUnknown
 	}
 	return podPhase
 }
@@ -212,8 +236,6 @@ func TestNewPodWatcher(t *testing.T) {
 func TestPodWatcher_enqueuePodAddition(t *testing.T) {
 	var empty map[string]string
 	fakeNow := metav1.Now()
-	keychan := make(chan interface{})
-	itemschan := make(chan []interface{})
 	fakeOwnerRef := "abcdfe12345"
 
 	var testData = []struct {
@@ -288,6 +310,8 @@ func TestPodWatcher_enqueuePodAddition(t *testing.T) {
 						Effect:   "NoSchedule",
 					},
 				},
+				ServiceAccount: "default",
+				Containers:     []ContainerResources{{CPURequest: 2000, MemRequestKb: 1}},
 			},
 		},
 		{
@@ -358,6 +382,8 @@ func TestPodWatcher_enqueuePodAddition(t *testing.T) {
 						Effect:   "NoSchedule",
 					},
 				},
+				ServiceAccount: "default",
+				Containers:     []ContainerResources{{CPURequest: 2000, MemRequestKb: 1}},
 			},
 		},
 		{
@@ -428,6 +454,8 @@ func TestPodWatcher_enqueuePodAddition(t *testing.T) {
 						Effect:   "NoSchedule",
 					},
 				},
+				ServiceAccount: "default",
+				Containers:     []ContainerResources{{CPURequest: 2000, MemRequestKb: 1}},
 			},
 		},
 		{
@@ -498,6 +526,8 @@ func TestPodWatcher_enqueuePodAddition(t *testing.T) {
 						Effect:   "NoSchedule",
 					},
 				},
+				ServiceAccount: "default",
+				Containers:     []ContainerResources{{CPURequest: 2000, MemRequestKb: 1}},
 			},
 		},
 	}
@@ -506,27 +536,31 @@ func TestPodWatcher_enqueuePodAddition(t *testing.T) {
 	defer testObj.mockCtrl.Finish()
 	podWatch := NewPodWatcher(testObj.kubeVerMajor, testObj.kubeVerMinor, testObj.schedulerName, testObj.kubeClient, testObj.firmamentClient)
 
+	// The additions are observed as they happen, rather than by waiting on the queue.
+	type addition struct {
+		key   interface{}
+		items []interface{}
+	}
+	additions := make(chan addition, 1)
+	podWatch.podWorkQueue.(ObservableQueue).SetObserver(func(transition QueueTransition, key interface{}, items []interface{}) {
+		if transition == QueueAdded {
+			additions <- addition{key, items}
+		}
+	})
 	for _, podData := range testData {
 		key := GetKey(podData.pod, t)
 		podWatch.enqueuePodAddition(key, podData.pod)
-		go func() {
-			newkey, newitems, _ := podWatch.podWorkQueue.Get()
-			keychan <- newkey
-			itemschan <- newitems
-		}()
-		waitTimer := time.NewTimer(time.Second * 2)
+		var added addition
 		select {
-		case <-waitTimer.C:
-		case newkey := <-keychan:
-			newitems := <-itemschan
-			for _, item := range newitems {
-				if newItem, ok := item.(*Pod); ok {
-					if !(reflect.DeepEqual(podData.expected, newItem) && reflect.DeepEqual(newkey, key)) {
-						t.Error("expected ", podData.expected, "got ", newItem)
-					}
-				}
-			}
+		case added = <-additions:
+		default:
+			t.Fatalf("expected pod %s to be added to the queue", podData.pod.Name)
 		}
+		if !reflect.DeepEqual(added.key, key) || len(added.items) != 1 || !reflect.DeepEqual(podData.expected, added.items[0]) {
+			t.Error("expected ", key, podData.expected, "got ", added.key, added.items)
+		}
+		podWatch.podWorkQueue.Get()
+		podWatch.podWorkQueue.Done(key)
 	}
 }
 
@@ -708,3 +742,4125 @@ func TestPodWatcher_CaseFive_podWorker(t *testing.T) {
 	t.Log(buf.String())
 	<-newTimer.C
 }
+
+// Checks the effective request is max(sum(app containers), max(init containers)) per resource
+func TestPodWatcher_getCPUMemEphemeralRequest(t *testing.T) {
+	var empty map[string]string
+	fakeNow := metav1.Now()
+	pod := BuildPod("Poseidon-Namespace", "Pod1", empty, GetPodPhase("Pending"), "500m", "512Mi", &fakeNow, "abcdfe12345")
+	pod.Spec.Containers = append(pod.Spec.Containers, pod.Spec.Containers[0])
+	pod.Spec.InitContainers = []v1.Container{
+		{
+			Resources: v1.ResourceRequirements{
+				Requests: v1.ResourceList{
+					v1.ResourceCPU:    resource.MustParse("4"),
+					v1.ResourceMemory: resource.MustParse("256Mi"),
+				},
+			},
+		},
+		{
+			Resources: v1.ResourceRequirements{
+				Requests: v1.ResourceList{
+					v1.ResourceCPU: resource.MustParse("2"),
+				},
+			},
+		},
+	}
+
+	testObj := initializePodObj(t)
+	defer testObj.mockCtrl.Finish()
+	podWatch := NewPodWatcher(testObj.kubeVerMajor, testObj.kubeVerMinor, testObj.schedulerName, testObj.kubeClient, testObj.firmamentClient)
+
+	parsedPod := podWatch.parsePod(pod)
+	// The large init container dominates the cpu, the app containers sum dominates the memory.
+	if parsedPod.CPURequest != 4000 {
+		t.Errorf("expected cpu request 4000, got %d", parsedPod.CPURequest)
+	}
+	if parsedPod.MemRequestKb != 1024*1024 {
+		t.Errorf("expected memory request %d, got %d", 1024*1024, parsedPod.MemRequestKb)
+	}
+}
+
+func TestPodWatcher_getTolerations(t *testing.T) {
+	var empty map[string]string
+	fakeNow := metav1.Now()
+	tolerationSeconds := int64(300)
+	pod := BuildPod("Poseidon-Namespace", "Pod1", empty, GetPodPhase("Pending"), "2", "1024", &fakeNow, "abcdfe12345")
+	pod.Spec.Tolerations = append(pod.Spec.Tolerations, v1.Toleration{
+		Key:               "node.kubernetes.io/unreachable",
+		Operator:          v1.TolerationOpExists,
+		Effect:            v1.TaintEffectNoExecute,
+		TolerationSeconds: &tolerationSeconds,
+	})
+
+	testObj := initializePodObj(t)
+	defer testObj.mockCtrl.Finish()
+	podWatch := NewPodWatcher(testObj.kubeVerMajor, testObj.kubeVerMinor, testObj.schedulerName, testObj.kubeClient, testObj.firmamentClient)
+
+	parsedPod := podWatch.parsePod(pod)
+	expected := []Toleration{
+		{
+			Key:      "key",
+			Operator: "Equal",
+			Value:    "value",
+			Effect:   "NoSchedule",
+		},
+		{
+			Key:               "node.kubernetes.io/unreachable",
+			Operator:          "Exists",
+			Effect:            "NoExecute",
+			TolerationSeconds: &tolerationSeconds,
+		},
+	}
+	if !reflect.DeepEqual(parsedPod.Tolerations, expected) {
+		t.Errorf("expected tolerations %+v, got %+v", expected, parsedPod.Tolerations)
+	}
+
+	td := podWatch.addTaskToJob(parsedPod, "jobUID", "jobName", 0)
+	if len(td.Toleration) != 2 {
+		t.Fatalf("expected 2 tolerations forwarded to Firmament, got %d", len(td.Toleration))
+	}
+	if td.Toleration[0].TolerationSeconds != 0 {
+		t.Errorf("expected no toleration seconds for the NoSchedule toleration, got %d", td.Toleration[0].TolerationSeconds)
+	}
+	if td.Toleration[1].Effect != "NoExecute" || td.Toleration[1].TolerationSeconds != 300 {
+		t.Errorf("expected a NoExecute toleration of 300 seconds, got %+v", td.Toleration[1])
+	}
+}
+
+func TestPodWatcher_PreferNoScheduleToleration(t *testing.T) {
+	var empty map[string]string
+	fakeNow := metav1.Now()
+	pod := BuildPod("Poseidon-Namespace", "Pod1", empty, GetPodPhase("Pending"), "2", "1024", &fakeNow, "abcdfe12345")
+	pod.Spec.Tolerations = []v1.Toleration{
+		{
+			Key:      "dedicated",
+			Operator: v1.TolerationOpEqual,
+			Value:    "batch",
+			Effect:   v1.TaintEffectPreferNoSchedule,
+		},
+	}
+
+	testObj := initializePodObj(t)
+	defer testObj.mockCtrl.Finish()
+	podWatch := NewPodWatcher(testObj.kubeVerMajor, testObj.kubeVerMinor, testObj.schedulerName, testObj.kubeClient, testObj.firmamentClient)
+
+	parsedPod := podWatch.parsePod(pod)
+	expected := []Toleration{
+		{
+			Key:      "dedicated",
+			Operator: "Equal",
+			Value:    "batch",
+			Effect:   "PreferNoSchedule",
+		},
+	}
+	if !reflect.DeepEqual(parsedPod.Tolerations, expected) {
+		t.Errorf("expected tolerations %+v, got %+v", expected, parsedPod.Tolerations)
+	}
+
+	td := podWatch.addTaskToJob(parsedPod, "jobUID", "jobName", 0)
+	if len(td.Toleration) != 1 {
+		t.Fatalf("expected 1 toleration forwarded to Firmament, got %d", len(td.Toleration))
+	}
+	if got := td.Toleration[0]; got.Key != "dedicated" || got.Operator != "Equal" || got.Value != "batch" ||
+		got.Effect != "PreferNoSchedule" {
+		t.Errorf("expected the PreferNoSchedule toleration to be forwarded verbatim, got %+v", got)
+	}
+}
+
+func TestPodWatcher_getPVNodeAffinity(t *testing.T) {
+	var empty map[string]string
+	fakeNow := metav1.Now()
+	pod := BuildPod("Poseidon-Namespace", "Pod1", empty, GetPodPhase("Pending"), "2", "1024", &fakeNow, "abcdfe12345")
+	// The pod can run on either of two memory types.
+	pod.Spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms = append(
+		pod.Spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms,
+		v1.NodeSelectorTerm{
+			MatchExpressions: []v1.NodeSelectorRequirement{
+				{
+					Key:      "mem-type",
+					Operator: v1.NodeSelectorOpIn,
+					Values:   []string{"DDR4"},
+				},
+			},
+		})
+	pod.Spec.Volumes = []v1.Volume{
+		{
+			Name: "data",
+			VolumeSource: v1.VolumeSource{
+				PersistentVolumeClaim: &v1.PersistentVolumeClaimVolumeSource{ClaimName: "data-claim"},
+			},
+		},
+	}
+	zoneRequirement := v1.NodeSelectorRequirement{
+		Key:      "failure-domain.beta.kubernetes.io/zone",
+		Operator: v1.NodeSelectorOpIn,
+		Values:   []string{"us-east-1a"},
+	}
+	pvc := &v1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{Name: "data-claim", Namespace: "Poseidon-Namespace"},
+		Spec:       v1.PersistentVolumeClaimSpec{VolumeName: "data-volume"},
+	}
+	pv := &v1.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{Name: "data-volume"},
+		Spec: v1.PersistentVolumeSpec{
+			NodeAffinity: &v1.VolumeNodeAffinity{
+				Required: &v1.NodeSelector{
+					NodeSelectorTerms: []v1.NodeSelectorTerm{
+						{MatchExpressions: []v1.NodeSelectorRequirement{zoneRequirement}},
+					},
+				},
+			},
+		},
+	}
+
+	testObj := initializePodObj(t)
+	defer testObj.mockCtrl.Finish()
+	podWatch := NewPodWatcher(testObj.kubeVerMajor, testObj.kubeVerMinor, testObj.schedulerName, fake.NewSimpleClientset(pvc, pv), testObj.firmamentClient)
+
+	newPod, ok := podWatch.getPVNodeAffinity(pod.Spec.Volumes, pod.DeepCopy())
+	if !ok {
+		t.Fatal("expected the PV node affinity to be resolved")
+	}
+	// Every alternative of the pod must also be in the PV's zone.
+	expected := []NodeSelectorTerm{
+		{
+			MatchExpressions: []NodeSelectorRequirement{
+				{Key: "mem-type", Operator: "NotIn", Values: []string{"DDR", "DDR2"}},
+				{Key: zoneRequirement.Key, Operator: "In", Values: zoneRequirement.Values},
+			},
+		},
+		{
+			MatchExpressions: []NodeSelectorRequirement{
+				{Key: "mem-type", Operator: "In", Values: []string{"DDR4"}},
+				{Key: zoneRequirement.Key, Operator: "In", Values: zoneRequirement.Values},
+			},
+		},
+	}
+	parsedPod := podWatch.parsePod(newPod)
+	if !reflect.DeepEqual(parsedPod.Affinity.NodeAffinity.HardScheduling.NodeSelectorTerms, expected) {
+		t.Errorf("expected node selector terms %+v, got %+v", expected, parsedPod.Affinity.NodeAffinity.HardScheduling.NodeSelectorTerms)
+	}
+
+	// A pod without node affinity only gets the PV's constraint.
+	pod.Spec.Affinity = nil
+	newPod, ok = podWatch.getPVNodeAffinity(pod.Spec.Volumes, pod.DeepCopy())
+	if !ok {
+		t.Fatal("expected the PV node affinity to be resolved")
+	}
+	if !reflect.DeepEqual(newPod.Spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution, pv.Spec.NodeAffinity.Required) {
+		t.Errorf("expected the PV node selector, got %+v", newPod.Spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution)
+	}
+}
+
+// TestPodWatcher_SkipAffinityVolumeTopology checks the topology of the volume a pod is bound to is still
+// sent to Firmament once the affinity is skipped.
+func TestPodWatcher_SkipAffinityVolumeTopology(t *testing.T) {
+	var empty map[string]string
+	fakeNow := metav1.Now()
+	pod := BuildPod("Poseidon-Namespace", "Pod1", empty, GetPodPhase("Pending"), "2", "1024", &fakeNow, "abcdfe12345")
+	pod.Spec.Affinity = nil
+	pod.Spec.Volumes = []v1.Volume{
+		{
+			Name: "data",
+			VolumeSource: v1.VolumeSource{
+				PersistentVolumeClaim: &v1.PersistentVolumeClaimVolumeSource{ClaimName: "data-claim"},
+			},
+		},
+	}
+	zoneRequirement := v1.NodeSelectorRequirement{
+		Key:      "failure-domain.beta.kubernetes.io/zone",
+		Operator: v1.NodeSelectorOpIn,
+		Values:   []string{"us-east-1a"},
+	}
+	pvc := &v1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{Name: "data-claim", Namespace: "Poseidon-Namespace"},
+		Spec:       v1.PersistentVolumeClaimSpec{VolumeName: "data-volume"},
+	}
+	pv := &v1.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{Name: "data-volume"},
+		Spec: v1.PersistentVolumeSpec{
+			NodeAffinity: &v1.VolumeNodeAffinity{
+				Required: &v1.NodeSelector{
+					NodeSelectorTerms: []v1.NodeSelectorTerm{
+						{MatchExpressions: []v1.NodeSelectorRequirement{zoneRequirement}},
+					},
+				},
+			},
+		},
+	}
+
+	testObj := initializePodObj(t)
+	defer testObj.mockCtrl.Finish()
+	podWatch := NewPodWatcher(testObj.kubeVerMajor, testObj.kubeVerMinor, testObj.schedulerName, fake.NewSimpleClientset(pvc, pv), testObj.firmamentClient)
+	podWatch.skipAffinity = true
+
+	convertedPod, ok := podWatch.convertAddedPod(pod)
+	if !ok {
+		t.Fatalf("expected pod %s to be converted", pod.Name)
+	}
+	expected := []NodeSelectorTerm{
+		{
+			MatchExpressions: []NodeSelectorRequirement{
+				{Key: zoneRequirement.Key, Operator: "In", Values: zoneRequirement.Values},
+			},
+		},
+	}
+	if terms := convertedPod.Affinity.NodeAffinity.HardScheduling.NodeSelectorTerms; !reflect.DeepEqual(terms, expected) {
+		t.Errorf("expected the volume topology %+v once the affinity is skipped, got %+v", expected, terms)
+	}
+	td := podWatch.addTaskToJob(convertedPod, "jobUID", "jobName", 0)
+	if td.Affinity == nil || td.Affinity.NodeAffinity == nil {
+		t.Errorf("expected the volume topology to be sent to Firmament, got %v", td.Affinity)
+	}
+}
+
+// Checks no task is submitted while the pod workers are paused
+func TestPodWatcher_PauseResume(t *testing.T) {
+	var empty map[string]string
+	fakeNow := metav1.Now()
+	pod := BuildPod("Poseidon-Namespace", "Pod1", empty, GetPodPhase("Pending"), "2", "1024", &fakeNow, "abcdfe12345")
+
+	testObj := initializePodObj(t)
+	defer testObj.mockCtrl.Finish()
+	podWatch := NewPodWatcher(testObj.kubeVerMajor, testObj.kubeVerMinor, testObj.schedulerName, testObj.kubeClient, testObj.firmamentClient)
+
+	podWatch.Pause()
+	podWatch.enqueuePodAddition(GetKey(pod, t), pod)
+	go podWatch.podWorker()
+	// No call is expected yet, the mock fails the test on any Firmament RPC issued while paused.
+	time.Sleep(500 * time.Millisecond)
+
+	submitted := make(chan struct{})
+	testObj.firmamentClient.EXPECT().TaskSubmitted(gomock.Any(), gomock.Any()).Do(func(interface{}, interface{}) {
+		close(submitted)
+	}).Return(&firmament.TaskSubmittedResponse{Type: firmament.TaskReplyType_TASK_SUBMITTED_OK}, nil)
+	podWatch.Resume()
+
+	select {
+	case <-submitted:
+	case <-time.After(2 * time.Second):
+		t.Error("expected the task to be submitted once resumed")
+	}
+}
+
+// Checks the pod workers never issue more concurrent Firmament calls than the limit
+func TestPodWatcher_FirmamentConcurrencyLimit(t *testing.T) {
+	var empty map[string]string
+	fakeNow := metav1.Now()
+	const numPods = 10
+	const limit = 2
+
+	testObj := initializePodObj(t)
+	defer testObj.mockCtrl.Finish()
+	podWatch := NewPodWatcher(testObj.kubeVerMajor, testObj.kubeVerMinor, testObj.schedulerName, testObj.kubeClient, testObj.firmamentClient)
+	podWatch.backend = NewFirmamentBackend(firmament.NewLimitedClient(testObj.firmamentClient, limit))
+
+	var inFlight, maxInFlight int32
+	done := make(chan struct{}, numPods)
+	testObj.firmamentClient.EXPECT().TaskSubmitted(gomock.Any(), gomock.Any()).Times(numPods).Do(func(interface{}, interface{}) {
+		current := atomic.AddInt32(&inFlight, 1)
+		for {
+			max := atomic.LoadInt32(&maxInFlight)
+			if current <= max || atomic.CompareAndSwapInt32(&maxInFlight, max, current) {
+				break
+			}
+		}
+		time.Sleep(50 * time.Millisecond)
+		atomic.AddInt32(&inFlight, -1)
+		done <- struct{}{}
+	}).Return(&firmament.TaskSubmittedResponse{Type: firmament.TaskReplyType_TASK_SUBMITTED_OK}, nil)
+
+	for i := 0; i < numPods; i++ {
+		pod := BuildPod("Poseidon-Namespace", fmt.Sprintf("Pod%d", i), empty, GetPodPhase("Pending"), "2", "1024", &fakeNow, "abcdfe12345")
+		podWatch.enqueuePodAddition(GetKey(pod, t), pod)
+	}
+	go podWatch.podWorker()
+
+	for i := 0; i < numPods; i++ {
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for the tasks to be submitted, %d submitted", i)
+		}
+	}
+	if max := atomic.LoadInt32(&maxInFlight); max > limit {
+		t.Errorf("expected at most %d concurrent calls, got %d", limit, max)
+	}
+}
+
+// resetNodes starts without any node, the node watcher tests leave theirs behind.
+func resetNodes() {
+	NodeMux = new(sync.RWMutex)
+	NodeToRTND = make(map[string]*firmament.ResourceTopologyNodeDescriptor)
+}
+
+// Checks a pod Firmament reports unscheduled while it's larger than every node is reported once as too
+// large, removed from Firmament and submitted again once its requests change
+func TestPodWatcher_OversizedPod(t *testing.T) {
+	var empty map[string]string
+	fakeNow := metav1.Now()
+
+	testObj := initializePodObj(t)
+	defer testObj.mockCtrl.Finish()
+	podWatch := NewPodWatcher(testObj.kubeVerMajor, testObj.kubeVerMinor, testObj.schedulerName, testObj.kubeClient, testObj.firmamentClient)
+	setPodUnschedulableHandler(podWatch.handleUnschedulablePod)
+	defer setPodUnschedulableHandler(nil)
+
+	fakeRecorder := record.NewFakeRecorder(10)
+	poseidonEventsLock.Lock()
+	poseidonEvents = &PoseidonEvents{
+		podEvents: &PodEvents{Recorder: fakeRecorder},
+		k8sClient: testObj.kubeClient,
+	}
+	poseidonEventsLock.Unlock()
+	defer func() {
+		poseidonEventsLock.Lock()
+		poseidonEvents = nil
+		poseidonEventsLock.Unlock()
+	}()
+	resetNodes()
+	defer resetNodes()
+	NodeMux.Lock()
+	NodeToRTND["Node1"] = &firmament.ResourceTopologyNodeDescriptor{
+		ResourceDesc: &firmament.ResourceDescriptor{
+			ResourceCapacity: &firmament.ResourceVector{
+				CpuCores:     4000,
+				RamCap:       8 * 1024 * 1024,
+				EphemeralCap: 8 * 1024 * 1024,
+			},
+		},
+	}
+	NodeMux.Unlock()
+
+	calls := make(chan string, 10)
+	testObj.firmamentClient.EXPECT().TaskSubmitted(gomock.Any(), gomock.Any()).Do(func(interface{}, interface{}) {
+		calls <- "TaskSubmitted"
+	}).Return(&firmament.TaskSubmittedResponse{Type: firmament.TaskReplyType_TASK_SUBMITTED_OK}, nil).Times(2)
+	testObj.firmamentClient.EXPECT().TaskRemoved(gomock.Any(), gomock.Any()).Do(func(interface{}, interface{}) {
+		calls <- "TaskRemoved"
+	}).Return(&firmament.TaskRemovedResponse{Type: firmament.TaskReplyType_TASK_REMOVED_OK}, nil)
+	expectCall := func(expected string) {
+		select {
+		case call := <-calls:
+			if call != expected {
+				t.Fatalf("expected %s, got %s", expected, call)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for %s", expected)
+		}
+	}
+
+	// The pod is submitted, Firmament decides whether it can be placed.
+	pod := BuildPod("Poseidon-Namespace", "OversizedPod", empty, GetPodPhase("Pending"), "16", "1024", &fakeNow, "abcdfe12345")
+	pod.DeletionTimestamp = nil
+	identifier := NewPodIdentifier(pod.Namespace, pod.Name)
+	key := GetKey(pod, t)
+	podWatch.enqueuePodAddition(key, pod)
+	go podWatch.podWorker()
+	defer podWatch.podWorkQueue.ShutDown()
+	expectCall("TaskSubmitted")
+
+	PodMux.RLock()
+	taskID := PodToTD[identifier].Uid
+	PodMux.RUnlock()
+	poseidonEvents.ProcessFailureEvents([]uint64{taskID})
+	expectCall("TaskRemoved")
+	var tooLarge int
+	for len(fakeRecorder.Events) > 0 {
+		if event := <-fakeRecorder.Events; strings.Contains(event, "too large") {
+			tooLarge++
+		}
+	}
+	if tooLarge != 1 {
+		t.Errorf("expected a single too large event, got %d", tooLarge)
+	}
+	PodMux.RLock()
+	_, held := oversizedPods[identifier]
+	_, submitted := PodToTD[identifier]
+	PodMux.RUnlock()
+	if !held || submitted {
+		t.Fatalf("expected the oversized pod to be held back, held %v submitted %v", held, submitted)
+	}
+
+	// A later report of the removed task is ignored.
+	poseidonEvents.ProcessFailureEvents([]uint64{taskID})
+	select {
+	case event := <-fakeRecorder.Events:
+		t.Errorf("expected no event once the pod is held back, got %q", event)
+	case call := <-calls:
+		t.Errorf("expected no call once the pod is held back, got %s", call)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	// Once the pod changes it is submitted again.
+	podWatch.enqueuePodUpdate(key, pod, ChangePodCPUAndMemRequest(pod, "2", "1024"))
+	expectCall("TaskSubmitted")
+}
+
+// Checks a pod which fits on a node is held back once Firmament left it unscheduled in
+// maxUnschedulable rounds
+func TestPodWatcher_UnschedulableAttempts(t *testing.T) {
+	var empty map[string]string
+	fakeNow := metav1.Now()
+
+	testObj := initializePodObj(t)
+	defer testObj.mockCtrl.Finish()
+	podWatch := NewPodWatcher(testObj.kubeVerMajor, testObj.kubeVerMinor, testObj.schedulerName, testObj.kubeClient, testObj.firmamentClient)
+	podWatch.maxUnschedulable = 2
+	resetNodes()
+
+	pod := BuildPod("Poseidon-Namespace", "UnschedulablePod", empty, GetPodPhase("Pending"), "1", "1024", &fakeNow, "abcdfe12345")
+	parsedPod := podWatch.parsePod(pod)
+	PodMux.Lock()
+	PodToTD[parsedPod.Identifier] = podWatch.addTaskToJob(parsedPod, "jobUID", "jobName", 0)
+	PodMux.Unlock()
+	recordConvertedPod(parsedPod)
+	defer forgetConvertedPod(parsedPod.Identifier)
+
+	podWatch.handleUnschedulablePod(parsedPod.Identifier)
+	if podWatch.podWorkQueue.Len() != 0 {
+		t.Fatalf("expected the pod to be left to Firmament after a single attempt")
+	}
+	podWatch.handleUnschedulablePod(parsedPod.Identifier)
+	_, items, _ := podWatch.podWorkQueue.Get()
+	if len(items) != 1 || items[0].(*Pod).State != PodDeleted {
+		t.Fatalf("expected the task of the pod to be removed after 2 attempts, got %v", items)
+	}
+	PodMux.RLock()
+	_, held := oversizedPods[parsedPod.Identifier]
+	PodMux.RUnlock()
+	if !held {
+		t.Errorf("expected the pod to be held back after 2 attempts")
+	}
+}
+
+// Checks the mapped pod annotations are submitted as task labels
+func TestPodWatcher_AnnotationLabels(t *testing.T) {
+	fakeNow := metav1.Now()
+	pod := BuildPod("Poseidon-Namespace", "Pod1", map[string]string{"app": "web"}, GetPodPhase("Pending"), "2", "1024", &fakeNow, "abcdfe12345")
+	pod.Annotations = map[string]string{
+		"poseidon.io/cost-center": "cc-42",
+		"poseidon.io/app":         "ignored",
+		"example.com/team":        "infra",
+		"kubernetes.io/psp":       "restricted",
+	}
+
+	testObj := initializePodObj(t)
+	defer testObj.mockCtrl.Finish()
+	podWatch := NewPodWatcher(testObj.kubeVerMajor, testObj.kubeVerMinor, testObj.schedulerName, testObj.kubeClient, testObj.firmamentClient)
+	podWatch.annotationLabelPrefixes = map[string]string{
+		"poseidon.io/": "",
+		"example.com/": "accounting/",
+	}
+
+	submitted := make(chan *firmament.TaskDescription, 1)
+	testObj.firmamentClient.EXPECT().TaskSubmitted(gomock.Any(), gomock.Any()).Do(func(_ interface{}, td interface{}) {
+		submitted <- td.(*firmament.TaskDescription)
+	}).Return(&firmament.TaskSubmittedResponse{Type: firmament.TaskReplyType_TASK_SUBMITTED_OK}, nil)
+
+	podWatch.enqueuePodAddition(GetKey(pod, t), pod)
+	go podWatch.podWorker()
+
+	var td *firmament.TaskDescription
+	select {
+	case td = <-submitted:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the task to be submitted")
+	}
+	labels := make(map[string]string)
+	for _, label := range td.TaskDescriptor.Labels {
+		labels[label.Key] = label.Value
+	}
+	// The pod label wins over the annotation mapped to the same key.
+	expected := map[string]string{
+		"app":               "web",
+		"cost-center":       "cc-42",
+		"accounting/team":   "infra",
+		ServiceAccountLabel: "default",
+	}
+	if !reflect.DeepEqual(labels, expected) {
+		t.Errorf("expected task labels %v, got %v", expected, labels)
+	}
+}
+
+// TestPodWatcher_LabelPrefixes checks only the pod labels matching the configured prefixes are
+// submitted as task labels, all of them if none is configured, and that pods without labels are handled.
+func TestPodWatcher_LabelPrefixes(t *testing.T) {
+	var empty map[string]string
+	fakeNow := metav1.Now()
+	labels := map[string]string{
+		"app.kubernetes.io/name": "web",
+		"example.com/team":       "infra",
+		"tier":                   "frontend",
+	}
+	testObj := initializePodObj(t)
+	defer testObj.mockCtrl.Finish()
+	podWatch := NewPodWatcher(testObj.kubeVerMajor, testObj.kubeVerMinor, testObj.schedulerName, testObj.kubeClient, testObj.firmamentClient)
+
+	var testData = []struct {
+		labels        map[string]string
+		labelPrefixes []string
+		expected      map[string]string
+	}{
+		{labels: labels, labelPrefixes: nil, expected: labels},
+		{labels: labels, labelPrefixes: []string{"app.kubernetes.io/"}, expected: map[string]string{"app.kubernetes.io/name": "web"}},
+		{labels: labels, labelPrefixes: []string{"app.kubernetes.io/", "example.com/"}, expected: map[string]string{"app.kubernetes.io/name": "web", "example.com/team": "infra"}},
+		{labels: empty, labelPrefixes: nil, expected: map[string]string{}},
+		{labels: empty, labelPrefixes: []string{"app.kubernetes.io/"}, expected: map[string]string{}},
+	}
+	for _, data := range testData {
+		podWatch.labelPrefixes = data.labelPrefixes
+		pod := BuildPod("Poseidon-Namespace", "Pod1", data.labels, GetPodPhase("Pending"), "2", "1024", &fakeNow, "abcdfe12345")
+		td := podWatch.addTaskToJob(podWatch.parsePod(pod), "jobUID", "jobName", 0)
+		forwarded := make(map[string]string)
+		for _, label := range td.Labels {
+			if label.Key != ServiceAccountLabel {
+				forwarded[label.Key] = label.Value
+			}
+		}
+		if !reflect.DeepEqual(forwarded, data.expected) {
+			t.Errorf("labels %v, labelPrefixes %v: expected the task labels %v, got %v", data.labels, data.labelPrefixes, data.expected, forwarded)
+		}
+	}
+}
+
+// TestPodWatcher_LabelPrefixesAffinity checks the labels selected by the pod affinity of a pod are
+// submitted whatever the label prefixes.
+func TestPodWatcher_LabelPrefixesAffinity(t *testing.T) {
+	fakeNow := metav1.Now()
+	testObj := initializePodObj(t)
+	defer testObj.mockCtrl.Finish()
+	podWatch := NewPodWatcher(testObj.kubeVerMajor, testObj.kubeVerMinor, testObj.schedulerName, testObj.kubeClient, testObj.firmamentClient)
+	podWatch.labelPrefixes = []string{"app.kubernetes.io/"}
+
+	labels := map[string]string{"app.kubernetes.io/name": "web", "tier": "frontend", "team": "infra"}
+	pod := podWatch.parsePod(BuildPod("Poseidon-Namespace", "Pod1", labels, GetPodPhase("Pending"), "2", "1024", &fakeNow, "abcdfe12345"))
+	forwarded := func(td *firmament.TaskDescriptor) map[string]string {
+		got := make(map[string]string)
+		for _, label := range td.Labels {
+			if label.Key != ServiceAccountLabel {
+				got[label.Key] = label.Value
+			}
+		}
+		return got
+	}
+	if got := forwarded(podWatch.addTaskToJob(pod, "jobUID", "jobName", 0)); !reflect.DeepEqual(got, map[string]string{"app.kubernetes.io/name": "web"}) {
+		t.Errorf("expected only the labels matching the prefixes before any pod affinity, got %v", got)
+	}
+
+	affine := podWatch.parsePod(BuildPod("Poseidon-Namespace", "Pod2", nil, GetPodPhase("Pending"), "2", "1024", &fakeNow, "abcdfe12346"))
+	affine.Affinity.PodAntiAffinity.HardScheduling = []PodAffinityTerm{
+		{
+			LabelSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"tier": "frontend"}},
+			TopologyKey:   "kubernetes.io/hostname",
+		},
+	}
+	podWatch.addTaskToJob(affine, "jobUID", "jobName", 1)
+	expected := map[string]string{"app.kubernetes.io/name": "web", "tier": "frontend"}
+	if got := forwarded(podWatch.addTaskToJob(pod, "jobUID", "jobName", 0)); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected the labels selected by the pod anti-affinity to be submitted %v, got %v", expected, got)
+	}
+}
+
+// Checks a bound pod is reported by Assignments
+func TestPodWatcher_Assignments(t *testing.T) {
+	testObj := initializePodObj(t)
+	defer testObj.mockCtrl.Finish()
+	podWatch := NewPodWatcher(testObj.kubeVerMajor, testObj.kubeVerMinor, testObj.schedulerName, testObj.kubeClient, testObj.firmamentClient)
+	client := &fake.Clientset{}
+	client.AddReactor("create", "pods", func(action core.Action) (bool, runtime.Object, error) {
+		if action.GetSubresource() != "binding" {
+			return false, nil, nil
+		}
+		return true, nil, nil
+	})
+	ClientSet = client
+	defer func() {
+		ClientSet = nil
+	}()
+
+	go BindPodToNode()
+	BindChannel <- BindInfo{Name: "Pod1", Namespace: "Poseidon-Namespace", Nodename: "Node1"}
+
+	expected := map[PodIdentifier]string{
+		{Name: "Pod1", Namespace: "Poseidon-Namespace"}: "Node1",
+	}
+	var assignments map[PodIdentifier]string
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if assignments = podWatch.Assignments(); len(assignments) > 0 {
+			break
+		}
+	}
+	if !reflect.DeepEqual(assignments, expected) {
+		t.Fatalf("expected assignments %v, got %v", expected, assignments)
+	}
+	// The snapshot is a copy.
+	assignments[PodIdentifier{Name: "Pod2", Namespace: "Poseidon-Namespace"}] = "Node2"
+	if !reflect.DeepEqual(podWatch.Assignments(), expected) {
+		t.Errorf("expected the assignments to be unchanged, got %v", podWatch.Assignments())
+	}
+}
+
+// Checks the bounds of the soft affinity weights reach Firmament unchanged: its cost model turns the
+// weights into arc costs itself, a cost sent in their place would invert the preferences.
+func TestPodWatcher_AffinityWeights(t *testing.T) {
+	var empty map[string]string
+	fakeNow := metav1.Now()
+	testObj := initializePodObj(t)
+	defer testObj.mockCtrl.Finish()
+	podWatch := NewPodWatcher(testObj.kubeVerMajor, testObj.kubeVerMinor, testObj.schedulerName, testObj.kubeClient, testObj.firmamentClient)
+
+	term := v1.PodAffinityTerm{
+		LabelSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}},
+		TopologyKey:   LabelHostname,
+	}
+	weighted := []v1.WeightedPodAffinityTerm{
+		{Weight: 1, PodAffinityTerm: term},
+		{Weight: maxAffinityWeight, PodAffinityTerm: term},
+	}
+	pod := BuildPod("Poseidon-Namespace", "Pod1", empty, GetPodPhase("Pending"), "1", "1024", &fakeNow, "abcdfe12345")
+	pod.Spec.Affinity.PodAffinity = &v1.PodAffinity{PreferredDuringSchedulingIgnoredDuringExecution: weighted}
+	pod.Spec.Affinity.PodAntiAffinity = &v1.PodAntiAffinity{PreferredDuringSchedulingIgnoredDuringExecution: weighted}
+	parsedPod := podWatch.parsePod(pod)
+
+	affinityTerms := podWatch.getFirmamentWeightedPodAffinityTerm(parsedPod)
+	antiAffinityTerms := podWatch.getFirmamentWeightedPodAffinityTermforPodAntiAffinity(parsedPod)
+	if len(affinityTerms) != 2 || len(antiAffinityTerms) != 2 {
+		t.Fatalf("expected two weighted terms, got %v and %v", affinityTerms, antiAffinityTerms)
+	}
+	for i, expected := range []int32{1, maxAffinityWeight} {
+		if affinityTerms[i].Weight != expected || antiAffinityTerms[i].Weight != expected {
+			t.Errorf("expected the weight %d to be forwarded, got %d and %d", expected, affinityTerms[i].Weight, antiAffinityTerms[i].Weight)
+		}
+	}
+}
+
+// Checks the errors of the pod watch are passed to the watch error handler
+func TestPodWatcher_WatchErrorHandler(t *testing.T) {
+	testObj := initializePodObj(t)
+	defer testObj.mockCtrl.Finish()
+	client := fake.NewSimpleClientset()
+	fakeWatch := watch.NewFake()
+	client.PrependWatchReactor("pods", core.DefaultWatchReactor(fakeWatch, nil))
+	podWatch := NewPodWatcher(testObj.kubeVerMajor, testObj.kubeVerMinor, testObj.schedulerName, client, testObj.firmamentClient)
+	watchErrors := make(chan error, 10)
+	podWatch.watchErrorHandler = func(err error) {
+		watchErrors <- err
+	}
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	go podWatch.controller.Run(stopCh)
+	if !cache.WaitForCacheSync(stopCh, podWatch.controller.HasSynced) {
+		t.Fatal("timed out waiting for the caches to sync")
+	}
+	// The API server closes the watch with an expired resource version.
+	fakeWatch.Error(&metav1.Status{
+		Status:  metav1.StatusFailure,
+		Code:    http.StatusGone,
+		Reason:  metav1.StatusReasonGone,
+		Message: "too old resource version",
+	})
+
+	select {
+	case err := <-watchErrors:
+		if !apierrors.IsGone(err) {
+			t.Errorf("expected a gone error, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the watch error handler")
+	}
+}
+
+func TestPodWatcher_MemoryUnit(t *testing.T) {
+	var empty map[string]string
+	fakeNow := metav1.Now()
+	pod := BuildPod("Poseidon-Namespace", "Pod1", empty, GetPodPhase("Pending"), "2", "256Mi", &fakeNow, "abcdfe12345")
+
+	testObj := initializePodObj(t)
+	defer testObj.mockCtrl.Finish()
+	podWatch := NewPodWatcher(testObj.kubeVerMajor, testObj.kubeVerMinor, testObj.schedulerName, testObj.kubeClient, testObj.firmamentClient)
+	defer func() {
+		memoryUnit = MemoryUnitKB
+	}()
+
+	var testData = []struct {
+		unit     string
+		expected int64
+	}{
+		{unit: "Bytes", expected: 256 * 1024 * 1024},
+		{unit: "KB", expected: 256 * 1024},
+		{unit: "MB", expected: 256},
+	}
+	for _, data := range testData {
+		unit, err := ParseMemoryUnit(data.unit)
+		if err != nil {
+			t.Fatalf("unexpected error parsing %s: %v", data.unit, err)
+		}
+		memoryUnit = unit
+		if memReq := podWatch.parsePod(pod).MemRequestKb; memReq != data.expected {
+			t.Errorf("expected a memory request of %d in %s, got %d", data.expected, data.unit, memReq)
+		}
+	}
+	if _, err := ParseMemoryUnit("GB"); err == nil {
+		t.Error("expected an error for an unknown memory unit")
+	}
+}
+
+func TestPodWatcher_checkPodConversion(t *testing.T) {
+	var empty map[string]string
+	fakeNow := metav1.Now()
+
+	testObj := initializePodObj(t)
+	defer testObj.mockCtrl.Finish()
+	podWatch := NewPodWatcher(testObj.kubeVerMajor, testObj.kubeVerMinor, testObj.schedulerName, testObj.kubeClient, testObj.firmamentClient)
+
+	hugeMemory := BuildPod("Poseidon-Namespace", "Pod1", empty, GetPodPhase("Pending"), "2", "100E", &fakeNow, "abcdfe12345")
+	hugeCPU := BuildPod("Poseidon-Namespace", "Pod2", empty, GetPodPhase("Pending"), "10P", "1024", &fakeNow, "abcdfe12345")
+	matchFields := BuildPod("Poseidon-Namespace", "Pod3", empty, GetPodPhase("Pending"), "2", "1024", &fakeNow, "abcdfe12345")
+	matchFields.Spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms[0].MatchFields = []v1.NodeSelectorRequirement{
+		{
+			Key:      "spec.unschedulable",
+			Operator: v1.NodeSelectorOpIn,
+			Values:   []string{"false"},
+		},
+	}
+	valid := BuildPod("Poseidon-Namespace", "Pod4", empty, GetPodPhase("Pending"), "2", "1024", &fakeNow, "abcdfe12345")
+	nodeName := BuildPod("Poseidon-Namespace", "Pod5", empty, GetPodPhase("Pending"), "2", "1024", &fakeNow, "abcdfe12345")
+	nodeName.Spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms[0].MatchFields = []v1.NodeSelectorRequirement{
+		{
+			Key:      "metadata.name",
+			Operator: v1.NodeSelectorOpIn,
+			Values:   []string{"Node1"},
+		},
+	}
+
+	err := podWatch.checkPodConversion(hugeMemory)
+	if parseErr, ok := err.(*ResourceParseError); !ok || parseErr.ResourceName != v1.ResourceMemory || parseErr.PodKey != "Poseidon-Namespace/Pod1" {
+		t.Errorf("expected a memory ResourceParseError, got %#v", err)
+	}
+	err = podWatch.checkPodConversion(hugeCPU)
+	if parseErr, ok := err.(*ResourceParseError); !ok || parseErr.ResourceName != v1.ResourceCPU || parseErr.Cause() == nil {
+		t.Errorf("expected a cpu ResourceParseError, got %#v", err)
+	}
+	err = podWatch.checkPodConversion(matchFields)
+	if affinityErr, ok := err.(*UnsupportedAffinityError); !ok || affinityErr.PodKey != "Poseidon-Namespace/Pod3" {
+		t.Errorf("expected an UnsupportedAffinityError, got %#v", err)
+	}
+	if err := podWatch.checkPodConversion(valid); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+
+	// The node name fields are sent to Firmament as requirements on the hostname label.
+	if err := podWatch.checkPodConversion(nodeName); err != nil {
+		t.Errorf("expected no error for a node name field, got %v", err)
+	}
+	terms := podWatch.parsePod(nodeName).Affinity.NodeAffinity.HardScheduling.NodeSelectorTerms
+	expected := NodeSelectorRequirement{Key: LabelHostname, Operator: "In", Values: []string{"Node1"}}
+	if len(terms) == 0 || !reflect.DeepEqual(terms[0].MatchExpressions[len(terms[0].MatchExpressions)-1], expected) {
+		t.Errorf("expected the node name field converted to %v, got %v", expected, terms)
+	}
+
+	// The updates of a pod which can't be converted are ignored as well.
+	key := GetKey(matchFields, t)
+	relabeled := matchFields.DeepCopy()
+	relabeled.Labels = map[string]string{"app": "relabeled"}
+	podWatch.enqueuePodUpdate(key, matchFields, relabeled)
+	if podWatch.podWorkQueue.Len() != 0 {
+		t.Errorf("expected the update of the unconvertible pod to be ignored, %d queued", podWatch.podWorkQueue.Len())
+	}
+}
+
+func TestPodWatcher_OSLabelSelector(t *testing.T) {
+	var empty map[string]string
+	fakeNow := metav1.Now()
+	windowsPod := BuildPod("Poseidon-Namespace", "WindowsPod", empty, GetPodPhase("Pending"), "1", "1024", &fakeNow, "abcdfe12345")
+	windowsPod.Spec.NodeSelector = map[string]string{LabelOS: "windows"}
+	linuxPod := BuildPod("Poseidon-Namespace", "LinuxPod", empty, GetPodPhase("Pending"), "1", "1024", &fakeNow, "abcdfe12346")
+
+	testObj := initializePodObj(t)
+	defer testObj.mockCtrl.Finish()
+	podWatch := NewPodWatcher(testObj.kubeVerMajor, testObj.kubeVerMinor, testObj.schedulerName, testObj.kubeClient, testObj.firmamentClient)
+	nodeWatch := NewNodeWatcher(testObj.kubeClient, testObj.firmamentClient)
+
+	nodes := map[string]*v1.Node{
+		"windows":      BuildNode("WindowsNode", "2", "4Gi", map[string]string{LabelOS: "windows", BetaLabelOS: "windows"}, nil, true),
+		"windows-beta": BuildNode("BetaWindowsNode", "2", "4Gi", map[string]string{BetaLabelOS: "windows"}, nil, true),
+		"linux":        BuildNode("LinuxNode", "2", "4Gi", map[string]string{LabelOS: "linux"}, nil, true),
+		"unlabeled":    BuildNode("UnlabeledNode", "2", "4Gi", empty, nil, true),
+	}
+	var testData = []struct {
+		pod      *v1.Pod
+		expected map[string]bool
+	}{
+		{
+			pod:      windowsPod,
+			expected: map[string]bool{"windows": true, "windows-beta": true, "linux": false, "unlabeled": false},
+		},
+		{
+			pod:      linuxPod,
+			expected: map[string]bool{"windows": false, "windows-beta": false, "linux": true, "unlabeled": true},
+		},
+	}
+	for _, data := range testData {
+		td := podWatch.addTaskToJob(podWatch.parsePod(data.pod), "jobUID", "jobName", 0)
+		for name, node := range nodes {
+			rtnd := nodeWatch.createResourceTopologyForNode(nodeWatch.parseNode(node, NodeAdded))
+			if matched := matchesLabelSelectors(rtnd.ResourceDesc.Labels, td.LabelSelectors); matched != data.expected[name] {
+				t.Errorf("expected pod %s to match node %s: %v, got %v", data.pod.Name, name, data.expected[name], matched)
+			}
+		}
+	}
+}
+
+// matchesLabelSelectors checks the IN_SET selectors of a task against the labels of a resource.
+func matchesLabelSelectors(labels []*firmament.Label, selectors []*firmament.LabelSelector) bool {
+	for _, selector := range selectors {
+		matched := false
+		for _, label := range labels {
+			if label.Key != selector.Key {
+				continue
+			}
+			for _, value := range selector.Values {
+				if label.Value == value {
+					matched = true
+				}
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
+
+func TestPodWatcher_enqueuePodAdditions(t *testing.T) {
+	var empty map[string]string
+	fakeNow := metav1.Now()
+	pods := []*v1.Pod{
+		BuildPod("Poseidon-Namespace", "Pod1", empty, GetPodPhase("Pending"), "1", "1024", &fakeNow, "abcdfe12345"),
+		BuildPod("Poseidon-Namespace", "Pod2", empty, GetPodPhase("Pending"), "1", "1024", &fakeNow, "abcdfe12345"),
+		BuildPod("Poseidon-Namespace", "Pod3", empty, GetPodPhase("Pending"), "-1", "1024", &fakeNow, "abcdfe12345"),
+	}
+
+	testObj := initializePodObj(t)
+	defer testObj.mockCtrl.Finish()
+	podWatch := NewPodWatcher(testObj.kubeVerMajor, testObj.kubeVerMinor, testObj.schedulerName, testObj.kubeClient, testObj.firmamentClient)
+
+	// The pods of the initial list are held back until the informer has synced.
+	for _, pod := range pods {
+		if !podWatch.bufferInitialPod(pod) {
+			t.Fatalf("expected pod %s to be buffered", pod.Name)
+		}
+	}
+	podWatch.flushInitialPods()
+	if podWatch.bufferInitialPod(pods[0]) {
+		t.Error("expected no pod to be buffered after the initial sync")
+	}
+
+	// Pod3 has a negative CPU request and is dropped.
+	for _, name := range []string{"Pod1", "Pod2"} {
+		key, items, _ := podWatch.podWorkQueue.Get()
+		if key != "Poseidon-Namespace/"+name {
+			t.Errorf("expected key Poseidon-Namespace/%s, got %v", name, key)
+		}
+		if len(items) != 1 || items[0].(*Pod).Identifier.Name != name {
+			t.Errorf("expected the added pod %s, got %v", name, items)
+		}
+		podWatch.podWorkQueue.Done(key)
+	}
+	PodToK8sPodLock.Lock()
+	defer PodToK8sPodLock.Unlock()
+	if _, ok := PodToK8sPod[PodIdentifier{Name: "Pod2", Namespace: "Poseidon-Namespace"}]; !ok {
+		t.Error("expected Pod2 to be recorded in PodToK8sPod")
+	}
+}
+
+// buildBenchmarkPods returns n pending pods for the enqueue benchmarks.
+func buildBenchmarkPods(n int) []*v1.Pod {
+	var empty map[string]string
+	fakeNow := metav1.Now()
+	pods := make([]*v1.Pod, n)
+	for i := range pods {
+		pods[i] = BuildPod("Poseidon-Namespace", fmt.Sprintf("Pod%d", i), empty, GetPodPhase("Pending"), "1", "1024", &fakeNow, "abcdfe12345")
+	}
+	return pods
+}
+
+func BenchmarkPodWatcher_enqueuePodAddition(b *testing.B) {
+	pods := buildBenchmarkPods(10000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		podWatch := NewPodWatcher(1, 6, "poseidon", &fake.Clientset{}, nil)
+		for _, pod := range pods {
+			key, _ := cache.MetaNamespaceKeyFunc(pod)
+			podWatch.enqueuePodAddition(key, pod)
+		}
+	}
+}
+
+func BenchmarkPodWatcher_enqueuePodAdditions(b *testing.B) {
+	pods := buildBenchmarkPods(10000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		podWatch := NewPodWatcher(1, 6, "poseidon", &fake.Clientset{}, nil)
+		podWatch.enqueuePodAdditions(pods)
+	}
+}
+
+// BenchmarkPodWatcher_enqueuePodAddition_affinity compares the enqueue throughput of pods with affinity
+// converted or skipped, and of pods without affinity.
+func BenchmarkPodWatcher_enqueuePodAddition_affinity(b *testing.B) {
+	pods := buildBenchmarkPods(10000)
+	podsWithoutAffinity := buildBenchmarkPods(10000)
+	for _, pod := range podsWithoutAffinity {
+		pod.Spec.Affinity = nil
+	}
+	for _, bench := range []struct {
+		name         string
+		pods         []*v1.Pod
+		skipAffinity bool
+	}{
+		{name: "AffinityOn", pods: pods},
+		{name: "AffinityOff", pods: pods, skipAffinity: true},
+		{name: "NoAffinity", pods: podsWithoutAffinity},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				podWatch := NewPodWatcher(1, 6, "poseidon", &fake.Clientset{}, nil)
+				podWatch.skipAffinity = bench.skipAffinity
+				for _, pod := range bench.pods {
+					key, _ := cache.MetaNamespaceKeyFunc(pod)
+					podWatch.enqueuePodAddition(key, pod)
+				}
+			}
+		})
+	}
+}
+
+// TestPodWatcher_SkipAffinity checks the pod affinity and the preferred node affinity of a pod aren't
+// converted once skipped, while its node selector and required node affinity are still sent to Firmament,
+// and that a pod without affinity converts as before.
+func TestPodWatcher_SkipAffinity(t *testing.T) {
+	fakeNow := metav1.Now()
+	testObj := initializePodObj(t)
+	defer testObj.mockCtrl.Finish()
+	podWatch := NewPodWatcher(testObj.kubeVerMajor, testObj.kubeVerMinor, testObj.schedulerName, testObj.kubeClient, testObj.firmamentClient)
+
+	pod := BuildPod("Poseidon-Namespace", "Pod1", nil, GetPodPhase("Pending"), "1", "1024", &fakeNow, "abcdfe12345")
+	pod.Spec.NodeSelector = map[string]string{"disk": "ssd"}
+	if td := podWatch.addTaskToJob(podWatch.parsePod(pod), "jobUID", "jobName", 0); td.Affinity == nil {
+		t.Errorf("expected the affinity of the pod to be sent to Firmament")
+	}
+
+	podWatch.skipAffinity = true
+	pod.Spec.Affinity.NodeAffinity.PreferredDuringSchedulingIgnoredDuringExecution = []v1.PreferredSchedulingTerm{
+		{
+			Weight: 10,
+			Preference: v1.NodeSelectorTerm{
+				MatchExpressions: []v1.NodeSelectorRequirement{
+					{Key: "example.com/rack", Operator: v1.NodeSelectorOpIn, Values: []string{"rack1"}},
+				},
+			},
+		},
+	}
+	pod.Spec.Affinity.PodAntiAffinity = &v1.PodAntiAffinity{
+		RequiredDuringSchedulingIgnoredDuringExecution: []v1.PodAffinityTerm{
+			{
+				LabelSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}},
+				TopologyKey:   LabelHostname,
+			},
+		},
+	}
+	parsedPod := podWatch.parsePod(pod)
+	expected := &Affinity{
+		NodeAffinity:    &NodeAffinity{HardScheduling: &NodeSelector{NodeSelectorTerms: podWatch.getNodeSelectorTerm(pod)}},
+		PodAffinity:     &PodAffinity{},
+		PodAntiAffinity: &PodAffinity{},
+	}
+	if len(expected.NodeAffinity.HardScheduling.NodeSelectorTerms) == 0 || !reflect.DeepEqual(parsedPod.Affinity, expected) {
+		t.Errorf("expected only the required node affinity to be converted once skipped, got %v", parsedPod.Affinity)
+	}
+	td := podWatch.addTaskToJob(parsedPod, "jobUID", "jobName", 0)
+	if td.Affinity == nil || td.Affinity.NodeAffinity == nil || td.Affinity.PodAntiAffinity != nil ||
+		len(td.Affinity.NodeAffinity.PreferredDuringSchedulingIgnoredDuringExecution) != 0 {
+		t.Errorf("expected only the required node affinity to be sent to Firmament once skipped, got %v", td.Affinity)
+	}
+	var selected bool
+	for _, selector := range td.LabelSelectors {
+		if selector.Key == "disk" {
+			selected = true
+		}
+	}
+	if !selected {
+		t.Errorf("expected the node selector to be sent to Firmament, got %v", td.LabelSelectors)
+	}
+
+	// A pod without affinity only has its node selector converted.
+	podWatch.skipAffinity = false
+	pod.Spec.Affinity = nil
+	parsedPod = podWatch.parsePod(pod)
+	if terms := parsedPod.Affinity.NodeAffinity.HardScheduling.NodeSelectorTerms; len(terms) != 1 {
+		t.Errorf("expected the node selector to be converted to a node selector term, got %v", terms)
+	}
+	if parsedPod.Affinity.PodAffinity.HardScheduling != nil || parsedPod.Affinity.PodAntiAffinity.HardScheduling != nil {
+		t.Errorf("expected no pod affinity for a pod without affinity, got %v", parsedPod.Affinity)
+	}
+}
+
+func TestPodWatcher_PodDebugHandler(t *testing.T) {
+	var empty map[string]string
+	fakeNow := metav1.Now()
+	pod := BuildPod("Poseidon-Namespace", "DebugPod", empty, GetPodPhase("Pending"), "2", "1024", &fakeNow, "abcdfe12345")
+
+	testObj := initializePodObj(t)
+	defer testObj.mockCtrl.Finish()
+	podWatch := NewPodWatcher(testObj.kubeVerMajor, testObj.kubeVerMinor, testObj.schedulerName, testObj.kubeClient, testObj.firmamentClient)
+	testObj.firmamentClient.EXPECT().TaskSubmitted(gomock.Any(), gomock.Any()).Return(
+		&firmament.TaskSubmittedResponse{Type: firmament.TaskReplyType_TASK_SUBMITTED_OK}, nil)
+	defer forgetConvertedPod(PodIdentifier{Name: "DebugPod", Namespace: "Poseidon-Namespace"})
+
+	submittedPod := podWatch.parsePod(pod)
+	podWatch.submitPod(submittedPod)
+
+	server := httptest.NewServer(NewPodDebugHandler())
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + PathDebugPods + "Poseidon-Namespace/DebugPod")
+	if err != nil {
+		t.Fatalf("unexpected error fetching the pod: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, resp.StatusCode)
+	}
+	var got Pod
+	if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+		t.Fatalf("unexpected error decoding the pod: %v", err)
+	}
+	if got.Identifier != submittedPod.Identifier || got.CPURequest != submittedPod.CPURequest ||
+		got.MemRequestKb != submittedPod.MemRequestKb || !reflect.DeepEqual(got.Tolerations, submittedPod.Tolerations) {
+		t.Errorf("expected the submitted pod %+v, got %+v", submittedPod, got)
+	}
+
+	for path, status := range map[string]int{
+		"Poseidon-Namespace/UnknownPod": http.StatusNotFound,
+		"Poseidon-Namespace":            http.StatusBadRequest,
+	} {
+		resp, err := http.Get(server.URL + PathDebugPods + path)
+		if err != nil {
+			t.Fatalf("unexpected error fetching %s: %v", path, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != status {
+			t.Errorf("expected status %d for %s, got %d", status, path, resp.StatusCode)
+		}
+	}
+}
+
+func TestPodWatcher_RequeueOnNodeAdded(t *testing.T) {
+	var empty map[string]string
+	fakeNow := metav1.Now()
+	pod := BuildPod("Poseidon-Namespace", "Pod1", empty, GetPodPhase("Pending"), "4", "1024", &fakeNow, "abcdfe12345")
+
+	testObj := initializePodObj(t)
+	defer testObj.mockCtrl.Finish()
+	podWatch := NewPodWatcher(testObj.kubeVerMajor, testObj.kubeVerMinor, testObj.schedulerName, testObj.kubeClient, testObj.firmamentClient)
+	nodeWatch := NewNodeWatcher(testObj.kubeClient, testObj.firmamentClient)
+	nodeWatch.nodeAddedHandler = podWatch.requeueUnschedulablePods
+	resetNodes()
+	NodeToRTND["Node1"] = &firmament.ResourceTopologyNodeDescriptor{
+		ResourceDesc: &firmament.ResourceDescriptor{
+			ResourceCapacity: &firmament.ResourceVector{
+				CpuCores: 1000,
+				RamCap:   8 * 1024 * 1024,
+			},
+		},
+	}
+
+	// The pod doesn't fit on the only node.
+	parsedPod := podWatch.parsePod(pod)
+	if !podWatch.exceedsNodeCapacities(parsedPod) {
+		t.Fatal("expected the pod to exceed the node capacities")
+	}
+	podWatch.holdUnschedulablePod(parsedPod, "it requests more resources than any node provides")
+	// The task of the held pod is removed.
+	if key, items, _ := podWatch.podWorkQueue.Get(); len(items) != 1 || items[0].(*Pod).State != PodDeleted {
+		t.Fatalf("expected the task of the held pod to be removed, got %v", items)
+	} else {
+		podWatch.podWorkQueue.Done(key)
+	}
+
+	testObj.firmamentClient.EXPECT().NodeAdded(gomock.Any(), gomock.Any()).Return(
+		&firmament.NodeAddedResponse{Type: firmament.NodeReplyType_NODE_ADDED_OK}, nil)
+	node := BuildNode("Node2", "8", "16Gi", nil, []v1.NodeCondition{
+		{
+			Type:               v1.NodeReady,
+			Status:             v1.ConditionTrue,
+			LastHeartbeatTime:  fakeNow,
+			LastTransitionTime: fakeNow,
+		},
+	}, false)
+	nodeKey, err := cache.MetaNamespaceKeyFunc(node)
+	if err != nil {
+		t.Fatalf("unexpected error getting the node key: %v", err)
+	}
+	nodeWatch.enqueueNodeAddition(nodeKey, node)
+	go nodeWatch.nodeWorker()
+
+	requeued := make(chan []interface{})
+	go func() {
+		key, items, _ := podWatch.podWorkQueue.Get()
+		if key != GetKey(pod, t) {
+			t.Errorf("expected the key %s, got %v", GetKey(pod, t), key)
+		}
+		requeued <- items
+	}()
+	select {
+	case items := <-requeued:
+		if len(items) != 1 {
+			t.Fatalf("expected a single requeued pod, got %v", items)
+		}
+		requeuedPod := items[0].(*Pod)
+		if requeuedPod.Identifier != parsedPod.Identifier || requeuedPod.State != PodUpdated {
+			t.Errorf("expected pod %v to be requeued as updated, got %v in state %v", parsedPod.Identifier, requeuedPod.Identifier, requeuedPod.State)
+		}
+		if podWatch.exceedsNodeCapacities(requeuedPod) {
+			t.Error("expected the requeued pod to fit on the new node")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the pod to be requeued")
+	}
+	nodeWatch.nodeWorkQueue.ShutDown()
+}
+
+func TestPodWatcher_GangScheduling(t *testing.T) {
+	var empty map[string]string
+	fakeNow := metav1.Now()
+	replicas := int32(3)
+	isController := true
+	replicaSet := &appsv1.ReplicaSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "rs1", Namespace: "Poseidon-Namespace", UID: "rs1-uid"},
+		Spec:       appsv1.ReplicaSetSpec{Replicas: &replicas},
+	}
+	var pods []*v1.Pod
+	for _, name := range []string{"Pod1", "Pod2", "Pod3"} {
+		pod := BuildPod("Poseidon-Namespace", name, empty, GetPodPhase("Pending"), "1", "1024", &fakeNow, "abcdfe12345")
+		pod.OwnerReferences = []metav1.OwnerReference{
+			{Kind: "ReplicaSet", Name: "rs1", UID: "rs1-uid", Controller: &isController},
+		}
+		pods = append(pods, pod)
+	}
+
+	testObj := initializePodObj(t)
+	defer testObj.mockCtrl.Finish()
+	podWatch := NewPodWatcher(testObj.kubeVerMajor, testObj.kubeVerMinor, testObj.schedulerName, testObj.kubeClient, testObj.firmamentClient)
+	podWatch.gangScheduling = true
+	// The ReplicaSet is read from the informer cache, not from the API server.
+	podWatch.owners.stores["ReplicaSet"].Add(replicaSet)
+
+	submitted := make(chan *firmament.TaskDescription, len(pods))
+	testObj.firmamentClient.EXPECT().TaskSubmitted(gomock.Any(), gomock.Any()).Do(func(_ interface{}, td *firmament.TaskDescription) {
+		submitted <- td
+	}).Return(&firmament.TaskSubmittedResponse{Type: firmament.TaskReplyType_TASK_SUBMITTED_OK}, nil).Times(len(pods))
+	go podWatch.podWorker()
+
+	// The first pods of the gang are held back.
+	for _, pod := range pods[:2] {
+		podWatch.enqueuePodAddition(GetKey(pod, t), pod)
+	}
+	select {
+	case td := <-submitted:
+		t.Fatalf("expected no task before the whole gang is pending, got %v", td.TaskDescriptor.Name)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	// The last pod releases the whole gang, within a single job.
+	podWatch.enqueuePodAddition(GetKey(pods[2], t), pods[2])
+	jobIDs := make(map[string]struct{})
+	for range pods {
+		select {
+		case td := <-submitted:
+			jobIDs[td.JobDescriptor.Uuid] = struct{}{}
+			gangLabel := false
+			for _, label := range td.TaskDescriptor.Labels {
+				if label.Key == GangSizeLabel && label.Value == "3" {
+					gangLabel = true
+				}
+			}
+			if !gangLabel {
+				t.Errorf("expected task %s to carry the gang size label, got %v", td.TaskDescriptor.Name, td.TaskDescriptor.Labels)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for the gang to be submitted")
+		}
+	}
+	if len(jobIDs) != 1 {
+		t.Errorf("expected the pods to be grouped in a single job, got %v", jobIDs)
+	}
+	podWatch.podWorkQueue.ShutDown()
+}
+
+// TestPodWatcher_GangSizeOwnerChanged checks the gang size of a controller is looked up again once
+// the controller is scaled, and isn't recorded while the controller isn't known.
+func TestPodWatcher_GangSizeOwnerChanged(t *testing.T) {
+	var empty map[string]string
+	fakeNow := metav1.Now()
+	replicas := int32(3)
+	isController := true
+	replicaSet := &appsv1.ReplicaSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "scaled-rs", Namespace: "Poseidon-Namespace", UID: "scaled-rs-uid"},
+		Spec:       appsv1.ReplicaSetSpec{Replicas: &replicas},
+	}
+	pod := BuildPod("Poseidon-Namespace", "ScaledPod", empty, GetPodPhase("Pending"), "1", "1024", &fakeNow, "scaled-rs-uid")
+	pod.OwnerReferences = []metav1.OwnerReference{
+		{Kind: "ReplicaSet", Name: "scaled-rs", UID: "scaled-rs-uid", Controller: &isController},
+	}
+
+	testObj := initializePodObj(t)
+	defer testObj.mockCtrl.Finish()
+	podWatch := NewPodWatcher(testObj.kubeVerMajor, testObj.kubeVerMinor, testObj.schedulerName, testObj.kubeClient, testObj.firmamentClient)
+	podWatch.gangScheduling = true
+
+	// The ReplicaSet isn't observed yet.
+	podWatch.recordGangSize(pod)
+	if size := podWatch.getGangSize("scaled-rs-uid"); size != 0 {
+		t.Errorf("expected no gang size while the ReplicaSet isn't known, got %d", size)
+	}
+	podWatch.owners.stores["ReplicaSet"].Add(replicaSet)
+	podWatch.recordGangSize(pod)
+	if size := podWatch.getGangSize("scaled-rs-uid"); size != 3 {
+		t.Errorf("expected a gang size of 3, got %d", size)
+	}
+
+	// The ReplicaSet is scaled.
+	scaledReplicas := int32(5)
+	scaledReplicaSet := replicaSet.DeepCopy()
+	scaledReplicaSet.Spec.Replicas = &scaledReplicas
+	podWatch.owners.stores["ReplicaSet"].Update(scaledReplicaSet)
+	podWatch.owners.ownerChanged(scaledReplicaSet)
+	podWatch.recordGangSize(pod)
+	if size := podWatch.getGangSize("scaled-rs-uid"); size != 5 {
+		t.Errorf("expected the gang size of the scaled ReplicaSet to be 5, got %d", size)
+	}
+
+	// The ReplicaSet is deleted.
+	podWatch.owners.ownerChanged(cache.DeletedFinalStateUnknown{Key: "Poseidon-Namespace/scaled-rs", Obj: scaledReplicaSet})
+	if size := podWatch.getGangSize("scaled-rs-uid"); size != 0 {
+		t.Errorf("expected the gang size of the deleted ReplicaSet to be forgotten, got %d", size)
+	}
+}
+
+func TestPodWatcher_WorkerPanic(t *testing.T) {
+	var empty map[string]string
+	fakeNow := metav1.Now()
+
+	testObj := initializePodObj(t)
+	defer testObj.mockCtrl.Finish()
+	podWatch := NewPodWatcher(testObj.kubeVerMajor, testObj.kubeVerMinor, testObj.schedulerName, testObj.kubeClient, testObj.firmamentClient)
+
+	var panicsMux sync.Mutex
+	var panics []string
+	errorHandlers := utilruntime.ErrorHandlers
+	utilruntime.ErrorHandlers = append(utilruntime.ErrorHandlers, func(err error) {
+		panicsMux.Lock()
+		defer panicsMux.Unlock()
+		panics = append(panics, err.Error())
+	})
+	defer func() {
+		utilruntime.ErrorHandlers = errorHandlers
+	}()
+
+	// A malformed pod, without the affinity every converted pod has, makes updateTask panic.
+	malformedPod := &Pod{
+		Identifier: PodIdentifier{Name: "Pod1", Namespace: "Poseidon-Namespace"},
+		State:      PodUpdated,
+		OwnerRef:   "abcdfe12345",
+	}
+	jobID := podWatch.generateJobID(malformedPod.OwnerRef)
+	PodMux.Lock()
+	jobIDToJD[jobID] = podWatch.createNewJob(malformedPod.OwnerRef)
+	PodToTD[malformedPod.Identifier] = &firmament.TaskDescriptor{ResourceRequest: &firmament.ResourceVector{}}
+	PodMux.Unlock()
+	podWatch.podWorkQueue.Add(malformedPod.Identifier.UniqueName(), malformedPod)
+
+	// The worker carries on with the other pods.
+	submitted := make(chan struct{})
+	testObj.firmamentClient.EXPECT().TaskSubmitted(gomock.Any(), gomock.Any()).Do(func(interface{}, interface{}) {
+		close(submitted)
+	}).Return(&firmament.TaskSubmittedResponse{Type: firmament.TaskReplyType_TASK_SUBMITTED_OK}, nil)
+	pod := BuildPod("Poseidon-Namespace", "Pod2", empty, GetPodPhase("Pending"), "1", "1024", &fakeNow, "abcdfe12346")
+	podWatch.enqueuePodAddition(GetKey(pod, t), pod)
+	go podWatch.podWorker()
+
+	select {
+	case <-submitted:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the worker to submit the valid pod")
+	}
+	// The malformed pod is retried, then dropped.
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		panicsMux.Lock()
+		count := len(panics)
+		panicsMux.Unlock()
+		if count == maxPodWorkerRetries+1 {
+			break
+		}
+	}
+	time.Sleep(100 * time.Millisecond)
+	panicsMux.Lock()
+	defer panicsMux.Unlock()
+	if len(panics) != maxPodWorkerRetries+1 {
+		t.Fatalf("expected %d reported panics, got %d: %v", maxPodWorkerRetries+1, len(panics), panics)
+	}
+	if !strings.Contains(panics[0], "Poseidon-Namespace/Pod1") {
+		t.Errorf("expected the panic report to name the pod, got %q", panics[0])
+	}
+	podWatch.podWorkQueue.ShutDown()
+}
+
+func TestPodWatcher_NamespaceDenylist(t *testing.T) {
+	var empty map[string]string
+	fakeNow := metav1.Now()
+	systemPod := BuildPod("kube-system", "SystemPod", empty, GetPodPhase("Pending"), "1", "1024", &fakeNow, "abcdfe12345")
+	systemPod.Spec.SchedulerName = "poseidon"
+	userPod := BuildPod("Poseidon-Namespace", "UserPod", empty, GetPodPhase("Pending"), "1", "1024", &fakeNow, "abcdfe12346")
+	userPod.Spec.SchedulerName = "poseidon"
+
+	testObj := initializePodObj(t)
+	defer testObj.mockCtrl.Finish()
+	podWatch := NewPodWatcher(testObj.kubeVerMajor, testObj.kubeVerMinor, testObj.schedulerName, fake.NewSimpleClientset(systemPod, userPod), testObj.firmamentClient)
+	podWatch.namespaceDenylist = toNamespaceSet([]string{"kube-system"})
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	go podWatch.controller.Run(stopCh)
+	if !cache.WaitForCacheSync(stopCh, podWatch.controller.HasSynced) {
+		t.Fatal("timed out waiting for the caches to sync")
+	}
+	podWatch.flushInitialPods()
+
+	keys := make(chan interface{}, 2)
+	go func() {
+		for {
+			key, _, quit := podWatch.podWorkQueue.Get()
+			if quit {
+				return
+			}
+			keys <- key
+			podWatch.podWorkQueue.Done(key)
+		}
+	}()
+	select {
+	case key := <-keys:
+		if key != GetKey(userPod, t) {
+			t.Errorf("expected the key %s, got %v", GetKey(userPod, t), key)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the user pod")
+	}
+	select {
+	case key := <-keys:
+		t.Errorf("expected the kube-system pod to be skipped, got %v", key)
+	case <-time.After(200 * time.Millisecond):
+	}
+	podWatch.podWorkQueue.ShutDown()
+
+	// With an allowlist only its namespaces are scheduled, the denylist still wins.
+	podWatch.namespaceAllowlist = toNamespaceSet([]string{"kube-system", "Poseidon-Namespace"})
+	podWatch.namespaceDenylist = toNamespaceSet([]string{"kube-system"})
+	otherPod := BuildPod("other", "OtherPod", empty, GetPodPhase("Pending"), "1", "1024", &fakeNow, "abcdfe12347")
+	for pod, expected := range map[*v1.Pod]bool{systemPod: false, userPod: true, otherPod: false} {
+		if scheduled := podWatch.isNamespaceScheduled(pod); scheduled != expected {
+			t.Errorf("expected pod %s/%s to be scheduled: %v, got %v", pod.Namespace, pod.Name, expected, scheduled)
+		}
+	}
+}
+
+func TestPodWatcher_TaskUpdatedNotFound(t *testing.T) {
+	var empty map[string]string
+	fakeNow := metav1.Now()
+	pod := BuildPod("Poseidon-Namespace", "Pod1", empty, GetPodPhase("Pending"), "1", "1024", &fakeNow, "abcdfe12345")
+
+	testObj := initializePodObj(t)
+	defer testObj.mockCtrl.Finish()
+	podWatch := NewPodWatcher(testObj.kubeVerMajor, testObj.kubeVerMinor, testObj.schedulerName, testObj.kubeClient, testObj.firmamentClient)
+
+	resubmitted := make(chan *firmament.TaskDescription)
+	gomock.InOrder(
+		testObj.firmamentClient.EXPECT().TaskSubmitted(gomock.Any(), gomock.Any()).Return(
+			&firmament.TaskSubmittedResponse{Type: firmament.TaskReplyType_TASK_SUBMITTED_OK}, nil),
+		// Firmament lost the task, the update is turned into a new submission.
+		testObj.firmamentClient.EXPECT().TaskUpdated(gomock.Any(), gomock.Any()).Return(
+			&firmament.TaskUpdatedResponse{Type: firmament.TaskReplyType_TASK_NOT_FOUND}, nil),
+		testObj.firmamentClient.EXPECT().TaskSubmitted(gomock.Any(), gomock.Any()).Do(func(_ interface{}, td *firmament.TaskDescription) {
+			resubmitted <- td
+		}).Return(&firmament.TaskSubmittedResponse{Type: firmament.TaskReplyType_TASK_SUBMITTED_OK}, nil),
+	)
+	key := GetKey(pod, t)
+	podWatch.enqueuePodAddition(key, pod)
+	podWatch.enqueuePodUpdate(key, pod, ChangePodCPUAndMemRequest(pod, "2", "1024"))
+	go podWatch.podWorker()
+
+	select {
+	case td := <-resubmitted:
+		if td.TaskDescriptor.ResourceRequest.CpuCores != 2000 {
+			t.Errorf("expected the updated cpu request 2000 to be submitted, got %v", td.TaskDescriptor.ResourceRequest.CpuCores)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the task to be submitted again")
+	}
+	podWatch.podWorkQueue.ShutDown()
+}
+
+func TestPodWatcher_BestEffortShadowRequest(t *testing.T) {
+	var empty map[string]string
+	fakeNow := metav1.Now()
+	bestEffortPod := BuildPod("Poseidon-Namespace", "Pod1", empty, GetPodPhase("Pending"), "1", "1024", &fakeNow, "abcdfe12345")
+	bestEffortPod.Spec.Containers[0].Resources = v1.ResourceRequirements{}
+	burstablePod := BuildPod("Poseidon-Namespace", "Pod2", empty, GetPodPhase("Pending"), "1", "1Mi", &fakeNow, "abcdfe12345")
+
+	testObj := initializePodObj(t)
+	defer testObj.mockCtrl.Finish()
+	podWatch := NewPodWatcher(testObj.kubeVerMajor, testObj.kubeVerMinor, testObj.schedulerName, testObj.kubeClient, testObj.firmamentClient)
+
+	// The shadow requests default to zero.
+	if parsedPod := podWatch.parsePod(bestEffortPod); parsedPod.CPURequest != 0 || parsedPod.MemRequestKb != 0 {
+		t.Errorf("expected no request for the BestEffort pod, got %d cpu and %d memory", parsedPod.CPURequest, parsedPod.MemRequestKb)
+	}
+
+	shadowCPU := resource.MustParse("10m")
+	shadowMem := resource.MustParse("10Mi")
+	podWatch.bestEffortCPURequest = shadowCPU.MilliValue()
+	podWatch.bestEffortMemRequest = shadowMem.Value()
+	if parsedPod := podWatch.parsePod(bestEffortPod); parsedPod.CPURequest != 10 || parsedPod.MemRequestKb != 10*1024 {
+		t.Errorf("expected the shadow requests 10m and 10Mi for the BestEffort pod, got %d cpu and %d memory", parsedPod.CPURequest, parsedPod.MemRequestKb)
+	}
+	if parsedPod := podWatch.parsePod(burstablePod); parsedPod.CPURequest != 1000 || parsedPod.MemRequestKb != 1024 {
+		t.Errorf("expected the requests of the burstable pod to be kept, got %d cpu and %d memory", parsedPod.CPURequest, parsedPod.MemRequestKb)
+	}
+}
+
+func TestPodWatcher_PodWithoutContainers(t *testing.T) {
+	var empty map[string]string
+	fakeNow := metav1.Now()
+	pod := BuildPod("Poseidon-Namespace", "Pod1", empty, GetPodPhase("Pending"), "1", "1024", &fakeNow, "abcdfe12345")
+	pod.Spec.Containers = nil
+
+	testObj := initializePodObj(t)
+	defer testObj.mockCtrl.Finish()
+	podWatch := NewPodWatcher(testObj.kubeVerMajor, testObj.kubeVerMinor, testObj.schedulerName, testObj.kubeClient, testObj.firmamentClient)
+	// Even with shadow requests the pod requests nothing.
+	podWatch.bestEffortCPURequest = 10
+	podWatch.bestEffortMemRequest = 10 * 1024 * 1024
+
+	if err := podWatch.checkPodConversion(pod); err != nil {
+		t.Fatalf("unexpected conversion error: %v", err)
+	}
+	parsedPod := podWatch.parsePod(pod)
+	if parsedPod.CPURequest != 0 || parsedPod.MemRequestKb != 0 || parsedPod.EphemeralReqKb != 0 {
+		t.Errorf("expected no request, got %d cpu, %d memory and %d ephemeral storage",
+			parsedPod.CPURequest, parsedPod.MemRequestKb, parsedPod.EphemeralReqKb)
+	}
+}
+
+func TestPodWatcher_DaemonSetPod(t *testing.T) {
+	var empty map[string]string
+	fakeNow := metav1.Now()
+	isController := true
+	daemonSetPod := BuildPod("Poseidon-Namespace", "Pod1", empty, GetPodPhase("Pending"), "1", "1024", &fakeNow, "abcdfe12345")
+	daemonSetPod.OwnerReferences = []metav1.OwnerReference{
+		{Kind: "DaemonSet", Name: "ds1", UID: "ds1-uid", Controller: &isController},
+	}
+	replicaSetPod := BuildPod("Poseidon-Namespace", "Pod2", empty, GetPodPhase("Pending"), "1", "1024", &fakeNow, "abcdfe12345")
+	replicaSetPod.OwnerReferences = []metav1.OwnerReference{
+		{Kind: "ReplicaSet", Name: "rs1", UID: "rs1-uid", Controller: &isController},
+	}
+
+	testObj := initializePodObj(t)
+	defer testObj.mockCtrl.Finish()
+	podWatch := NewPodWatcher(testObj.kubeVerMajor, testObj.kubeVerMinor, testObj.schedulerName, testObj.kubeClient, testObj.firmamentClient)
+
+	if podWatch.isSchedulablePod(daemonSetPod) {
+		t.Error("expected the DaemonSet pod not to be schedulable")
+	}
+	if podWatch.isSchedulablePod(cache.DeletedFinalStateUnknown{Key: GetKey(daemonSetPod, t), Obj: daemonSetPod}) {
+		t.Error("expected the deleted DaemonSet pod not to be schedulable")
+	}
+	if !podWatch.isSchedulablePod(replicaSetPod) {
+		t.Error("expected the ReplicaSet pod to be schedulable")
+	}
+}
+
+func TestPodWatcher_MirrorPod(t *testing.T) {
+	var empty map[string]string
+	fakeNow := metav1.Now()
+	mirrorPod := BuildPod("kube-system", "kube-apiserver-node1", empty, GetPodPhase("Pending"), "1", "1024", &fakeNow, "abcdfe12345")
+	mirrorPod.Annotations = map[string]string{MirrorPodAnnotation: "3ab2e8d4c1f0"}
+	pod := BuildPod("Poseidon-Namespace", "Pod1", empty, GetPodPhase("Pending"), "1", "1024", &fakeNow, "abcdfe12346")
+
+	testObj := initializePodObj(t)
+	defer testObj.mockCtrl.Finish()
+	podWatch := NewPodWatcher(testObj.kubeVerMajor, testObj.kubeVerMinor, testObj.schedulerName, testObj.kubeClient, testObj.firmamentClient)
+
+	if !podWatch.skipMirrorPods {
+		t.Fatal("expected the mirror pods to be skipped by default")
+	}
+	if podWatch.isSchedulablePod(mirrorPod) {
+		t.Error("expected the mirror pod not to be schedulable")
+	}
+	if podWatch.isSchedulablePod(cache.DeletedFinalStateUnknown{Key: GetKey(mirrorPod, t), Obj: mirrorPod}) {
+		t.Error("expected the deleted mirror pod not to be schedulable")
+	}
+	if !podWatch.isSchedulablePod(pod) {
+		t.Error("expected the pod without the mirror annotation to be schedulable")
+	}
+	podWatch.skipMirrorPods = false
+	if !podWatch.isSchedulablePod(mirrorPod) {
+		t.Error("expected the mirror pod to be schedulable once the option is disabled")
+	}
+}
+
+func TestPodWatcher_DelayingQueue(t *testing.T) {
+	var empty map[string]string
+	fakeNow := metav1.Now()
+	pod := BuildPod("Poseidon-Namespace", "Pod1", empty, GetPodPhase("Pending"), "1", "1024", &fakeNow, "abcdfe12345")
+
+	testObj := initializePodObj(t)
+	defer testObj.mockCtrl.Finish()
+	podWatch := NewPodWatcher(testObj.kubeVerMajor, testObj.kubeVerMinor, testObj.schedulerName, testObj.kubeClient, testObj.firmamentClient)
+	queue, err := newPodQueue(PodQueueDelaying)
+	if err != nil {
+		t.Fatalf("unexpected error creating the queue: %v", err)
+	}
+	podWatch.podWorkQueue = queue
+	if _, err := newPodQueue("unknown"); err == nil {
+		t.Error("expected an error for an unknown queue type")
+	}
+
+	submitted := make(chan time.Time)
+	testObj.firmamentClient.EXPECT().TaskSubmitted(gomock.Any(), gomock.Any()).Do(func(interface{}, interface{}) {
+		submitted <- time.Now()
+	}).Return(&firmament.TaskSubmittedResponse{Type: firmament.TaskReplyType_TASK_SUBMITTED_OK}, nil)
+	go podWatch.podWorker()
+
+	start := time.Now()
+	delayingQueue, ok := podWatch.podWorkQueue.(DelayingQueue)
+	if !ok {
+		t.Fatalf("expected a delaying queue, got %T", podWatch.podWorkQueue)
+	}
+	delayingQueue.AddAfter(GetKey(pod, t), podWatch.parsePod(pod), 300*time.Millisecond)
+	select {
+	case submittedAt := <-submitted:
+		if delay := submittedAt.Sub(start); delay < 300*time.Millisecond {
+			t.Errorf("expected the pod to be submitted after 300ms, got it after %v", delay)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the delayed pod")
+	}
+	podWatch.podWorkQueue.ShutDown()
+}
+
+func TestPodWatcher_StartTime(t *testing.T) {
+	var empty map[string]string
+	fakeNow := metav1.Now()
+	createdAt := metav1.NewTime(time.Date(2018, time.June, 1, 10, 0, 0, 0, time.UTC))
+	startedAt := metav1.NewTime(createdAt.Add(time.Minute))
+	pendingPod := BuildPod("Poseidon-Namespace", "Pod1", empty, GetPodPhase("Pending"), "1", "1024", &fakeNow, "abcdfe12345")
+	pendingPod.CreationTimestamp = createdAt
+	startedPod := BuildPod("Poseidon-Namespace", "Pod2", empty, GetPodPhase("Pending"), "1", "1024", &fakeNow, "abcdfe12345")
+	startedPod.CreationTimestamp = createdAt
+	startedPod.Status.StartTime = &startedAt
+
+	testObj := initializePodObj(t)
+	defer testObj.mockCtrl.Finish()
+	podWatch := NewPodWatcher(testObj.kubeVerMajor, testObj.kubeVerMinor, testObj.schedulerName, testObj.kubeClient, testObj.firmamentClient)
+
+	var testData = []struct {
+		pod      *v1.Pod
+		expected uint64
+	}{
+		// Without a start time the creation time is used.
+		{pod: pendingPod, expected: uint64(createdAt.UnixNano() / 1000)},
+		{pod: startedPod, expected: uint64(startedAt.UnixNano() / 1000)},
+	}
+	for _, data := range testData {
+		parsedPod := podWatch.parsePod(data.pod)
+		td := podWatch.addTaskToJob(parsedPod, "jobUID", "jobName", 0)
+		if td.StartTime != data.expected {
+			t.Errorf("expected the start time %d for pod %s, got %d", data.expected, data.pod.Name, td.StartTime)
+		}
+		td.StartTime = 0
+		podWatch.updateTask(parsedPod, td)
+		if td.StartTime != data.expected {
+			t.Errorf("expected the updated start time %d for pod %s, got %d", data.expected, data.pod.Name, td.StartTime)
+		}
+	}
+}
+
+func Test_validateSchedulerName(t *testing.T) {
+	for name, valid := range map[string]bool{
+		"poseidon": true,
+		"":         false,
+		" \t":      false,
+	} {
+		if err := validateSchedulerName(name); (err == nil) != valid {
+			t.Errorf("expected the scheduler name %q to be valid: %v, got error %v", name, valid, err)
+		}
+	}
+}
+
+func TestPodWatcher_PodMutator(t *testing.T) {
+	var empty map[string]string
+	fakeNow := metav1.Now()
+
+	testObj := initializePodObj(t)
+	defer testObj.mockCtrl.Finish()
+	podWatch := NewPodWatcher(testObj.kubeVerMajor, testObj.kubeVerMinor, testObj.schedulerName, testObj.kubeClient, testObj.firmamentClient)
+	podWatch.RegisterPodMutator(PodMutatorFunc(func(pod *Pod) error {
+		if pod.Identifier.Name == "Rejected" {
+			return fmt.Errorf("no hint for pod %s", pod.Identifier.Name)
+		}
+		if pod.Labels == nil {
+			pod.Labels = make(map[string]string)
+		}
+		pod.Labels["poseidon.kubernetes.io/hint"] = "fast-disk"
+		return nil
+	}))
+
+	pod := BuildPod("Poseidon-Namespace", "Pod1", empty, GetPodPhase("Pending"), "1", "1024", &fakeNow, "abcdfe12345")
+	convertedPod, ok := podWatch.convertAddedPod(pod)
+	if !ok {
+		t.Fatalf("expected pod %s to be converted", pod.Name)
+	}
+	td := podWatch.addTaskToJob(convertedPod, "jobUID", "jobName", 0)
+	found := false
+	for _, label := range td.Labels {
+		if label.Key == "poseidon.kubernetes.io/hint" && label.Value == "fast-disk" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("expected the mutated label in the task descriptor labels %v", td.Labels)
+	}
+
+	fakeRecorder := record.NewFakeRecorder(10)
+	poseidonEventsLock.Lock()
+	poseidonEvents = &PoseidonEvents{
+		podEvents: &PodEvents{Recorder: fakeRecorder},
+		k8sClient: testObj.kubeClient,
+	}
+	poseidonEventsLock.Unlock()
+	defer func() {
+		poseidonEventsLock.Lock()
+		poseidonEvents = nil
+		poseidonEventsLock.Unlock()
+	}()
+	expectEvent := func() {
+		select {
+		case event := <-fakeRecorder.Events:
+			if !strings.Contains(event, "MutationFailed") {
+				t.Errorf("expected a MutationFailed event, got %q", event)
+			}
+		default:
+			t.Error("expected a MutationFailed event")
+		}
+	}
+
+	rejectedPod := BuildPod("Poseidon-Namespace", "Rejected", empty, GetPodPhase("Pending"), "1", "1024", &fakeNow, "abcdfe12345")
+	if _, ok := podWatch.convertAddedPod(rejectedPod); ok {
+		t.Errorf("expected pod %s to be rejected by the mutator", rejectedPod.Name)
+	}
+	expectEvent()
+
+	// The updates rejected by the mutators are reported as well.
+	relabeledPod := rejectedPod.DeepCopy()
+	relabeledPod.Labels = map[string]string{"app": "relabeled"}
+	podWatch.enqueuePodUpdate(GetKey(rejectedPod, t), rejectedPod, relabeledPod)
+	if podWatch.podWorkQueue.Len() != 0 {
+		t.Errorf("expected the rejected update not to be queued, %d queued", podWatch.podWorkQueue.Len())
+	}
+	expectEvent()
+
+	// The mutators are registered per pod watcher.
+	otherWatch := NewPodWatcher(testObj.kubeVerMajor, testObj.kubeVerMinor, testObj.schedulerName, testObj.kubeClient, testObj.firmamentClient)
+	if _, ok := otherWatch.convertAddedPod(rejectedPod); !ok {
+		t.Errorf("expected pod %s to be converted by a pod watcher without mutators", rejectedPod.Name)
+	}
+}
+
+func TestPodWatcher_PriorityClassUpdated(t *testing.T) {
+	var empty map[string]string
+	fakeNow := metav1.Now()
+	highPod := BuildPod("Poseidon-Namespace", "Pod1", empty, GetPodPhase("Pending"), "1", "1024", &fakeNow, "abcdfe12345")
+	highPod.Spec.PriorityClassName = "high"
+	lowPod := BuildPod("Poseidon-Namespace", "Pod2", empty, GetPodPhase("Pending"), "1", "1024", &fakeNow, "abcdfe12345")
+	lowPod.Spec.PriorityClassName = "low"
+
+	testObj := initializePodObj(t)
+	defer testObj.mockCtrl.Finish()
+	podWatch := NewPodWatcher(testObj.kubeVerMajor, testObj.kubeVerMinor, testObj.schedulerName, testObj.kubeClient, testObj.firmamentClient)
+	priorityClassWatch := NewPriorityClassWatcher(testObj.kubeClient)
+	priorityClassWatch.priorityClassUpdatedHandler = podWatch.requeuePriorityClassPods
+	PodToK8sPodLock.Lock()
+	for _, pod := range []*v1.Pod{highPod, lowPod} {
+		PodToK8sPod[PodIdentifier{Name: pod.Name, Namespace: pod.Namespace}] = pod
+	}
+	PodToK8sPodLock.Unlock()
+	defer func() {
+		PodToK8sPodLock.Lock()
+		PodToK8sPod = make(map[PodIdentifier]*v1.Pod)
+		PodToK8sPodLock.Unlock()
+	}()
+
+	highClass := &schedulingv1beta1.PriorityClass{ObjectMeta: metav1.ObjectMeta{Name: "high"}, Value: 1000}
+	priorityClassWatch.addPriorityClass(highClass)
+	if priority := podWatch.parsePod(highPod).Priority; priority != 1000 {
+		t.Errorf("expected the priority 1000, got %d", priority)
+	}
+
+	updatedClass := highClass.DeepCopy()
+	updatedClass.Value = 2000
+	priorityClassWatch.updatePriorityClass(highClass, updatedClass)
+	key, items, _ := podWatch.podWorkQueue.Get()
+	if key != GetKey(highPod, t) {
+		t.Fatalf("expected the pod %s to be requeued, got %v", GetKey(highPod, t), key)
+	}
+	requeuedPod := items[0].(*Pod)
+	if requeuedPod.State != PodUpdated || requeuedPod.Priority != 2000 {
+		t.Errorf("expected the updated pod with the priority 2000, got %s with %d", requeuedPod.State, requeuedPod.Priority)
+	}
+	podWatch.podWorkQueue.Done(key)
+	if queued := len(podWatch.podWorkQueue.(*Type).queue); queued != 0 {
+		t.Errorf("expected only the pods of the updated class to be requeued, %d left", queued)
+	}
+
+	// A deleted class leaves the pods at their last known priority.
+	priorityClassWatch.deletePriorityClass(updatedClass)
+	if priority := podWatch.parsePod(highPod).Priority; priority != 2000 {
+		t.Errorf("expected the last known priority 2000 after the class deletion, got %d", priority)
+	}
+	td := podWatch.addTaskToJob(podWatch.parsePod(highPod), "jobUID", "jobName", 0)
+	if td.Priority != 2000 {
+		t.Errorf("expected the task priority 2000, got %d", td.Priority)
+	}
+}
+
+func TestPodWatcher_ScheduleDeadline(t *testing.T) {
+	var empty map[string]string
+	fakeNow := metav1.Now()
+	expiredPod := BuildPod("Poseidon-Namespace", "Pod1", empty, GetPodPhase("Pending"), "1", "1024", &fakeNow, "abcdfe12345")
+	expiredPod.Annotations = map[string]string{ScheduleDeadlineAnnotation: time.Now().Add(-time.Minute).Format(time.RFC3339)}
+	pod := BuildPod("Poseidon-Namespace", "Pod2", empty, GetPodPhase("Pending"), "1", "1024", &fakeNow, "abcdfe12345")
+	pod.Annotations = map[string]string{ScheduleDeadlineAnnotation: time.Now().Add(time.Hour).Format(time.RFC3339)}
+
+	testObj := initializePodObj(t)
+	defer testObj.mockCtrl.Finish()
+	podWatch := NewPodWatcher(testObj.kubeVerMajor, testObj.kubeVerMinor, testObj.schedulerName, testObj.kubeClient, testObj.firmamentClient)
+	defer func() {
+		PodToK8sPodLock.Lock()
+		PodToK8sPod = make(map[PodIdentifier]*v1.Pod)
+		PodToK8sPodLock.Unlock()
+	}()
+
+	// Only the pod before its deadline is submitted.
+	submitted := make(chan *firmament.TaskDescription, 2)
+	testObj.firmamentClient.EXPECT().TaskSubmitted(gomock.Any(), gomock.Any()).Do(func(_ interface{}, td *firmament.TaskDescription) {
+		submitted <- td
+	}).Return(&firmament.TaskSubmittedResponse{Type: firmament.TaskReplyType_TASK_SUBMITTED_OK}, nil).Times(1)
+	go podWatch.podWorker()
+	podWatch.enqueuePodAddition(GetKey(expiredPod, t), expiredPod)
+	podWatch.enqueuePodAddition(GetKey(pod, t), pod)
+	select {
+	case td := <-submitted:
+		if td.TaskDescriptor.Name != pod.Namespace+"/"+pod.Name {
+			t.Errorf("expected the pod %s to be submitted, got %s", pod.Name, td.TaskDescriptor.Name)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the pod before its deadline to be submitted")
+	}
+	select {
+	case td := <-submitted:
+		t.Errorf("expected the pod past its deadline to be abandoned, got %s submitted", td.TaskDescriptor.Name)
+	case <-time.After(200 * time.Millisecond):
+	}
+	if !isAbandoned(PodIdentifier{Name: expiredPod.Name, Namespace: expiredPod.Namespace}) {
+		t.Errorf("expected the pod %s to be abandoned", expiredPod.Name)
+	}
+	if isAbandoned(PodIdentifier{Name: pod.Name, Namespace: pod.Namespace}) {
+		t.Errorf("expected the pod %s not to be abandoned", pod.Name)
+	}
+	podWatch.podWorkQueue.ShutDown()
+}
+
+func TestPodWatcher_mergeNodeAffinity(t *testing.T) {
+	var empty map[string]string
+	fakeNow := metav1.Now()
+	pod := BuildPod("Poseidon-Namespace", "Pod1", empty, GetPodPhase("Pending"), "2", "1024", &fakeNow, "abcdfe12345")
+	// The explicit affinity allows either of two memory types.
+	pod.Spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms = append(
+		pod.Spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms,
+		v1.NodeSelectorTerm{
+			MatchExpressions: []v1.NodeSelectorRequirement{
+				{Key: "mem-type", Operator: v1.NodeSelectorOpIn, Values: []string{"DDR4"}},
+			},
+		})
+	pod.Spec.NodeSelector = map[string]string{
+		"disktype":           "ssd",
+		"networkRequirement": "100",
+		"cpu-type":           "x86",
+	}
+
+	testObj := initializePodObj(t)
+	defer testObj.mockCtrl.Finish()
+	podWatch := NewPodWatcher(testObj.kubeVerMajor, testObj.kubeVerMinor, testObj.schedulerName, testObj.kubeClient, testObj.firmamentClient)
+
+	// Both alternatives of the explicit affinity also require the nodeSelector labels.
+	nodeSelectorRequirements := []NodeSelectorRequirement{
+		{Key: "cpu-type", Operator: "In", Values: []string{"x86"}},
+		{Key: "disktype", Operator: "In", Values: []string{"ssd"}},
+	}
+	expected := []NodeSelectorTerm{
+		{
+			MatchExpressions: append([]NodeSelectorRequirement{
+				{Key: "mem-type", Operator: "NotIn", Values: []string{"DDR", "DDR2"}},
+			}, nodeSelectorRequirements...),
+		},
+		{
+			MatchExpressions: append([]NodeSelectorRequirement{
+				{Key: "mem-type", Operator: "In", Values: []string{"DDR4"}},
+			}, nodeSelectorRequirements...),
+		},
+	}
+	for i := 0; i < 3; i++ {
+		parsedPod := podWatch.parsePod(pod)
+		if !reflect.DeepEqual(parsedPod.Affinity.NodeAffinity.HardScheduling.NodeSelectorTerms, expected) {
+			t.Errorf("expected node selector terms %+v, got %+v", expected, parsedPod.Affinity.NodeAffinity.HardScheduling.NodeSelectorTerms)
+		}
+	}
+	if len(pod.Spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms[0].MatchExpressions) != 1 {
+		t.Errorf("expected the node affinity of the pod to be left unchanged, got %+v", pod.Spec.Affinity.NodeAffinity)
+	}
+
+	// Without explicit affinity only the nodeSelector constrains the nodes.
+	pod.Spec.Affinity = nil
+	parsedPod := podWatch.parsePod(pod)
+	expected = []NodeSelectorTerm{{MatchExpressions: nodeSelectorRequirements}}
+	if !reflect.DeepEqual(parsedPod.Affinity.NodeAffinity.HardScheduling.NodeSelectorTerms, expected) {
+		t.Errorf("expected node selector terms %+v, got %+v", expected, parsedPod.Affinity.NodeAffinity.HardScheduling.NodeSelectorTerms)
+	}
+}
+
+func TestPodWatcher_MaxPodRequest(t *testing.T) {
+	var empty map[string]string
+	fakeNow := metav1.Now()
+
+	testObj := initializePodObj(t)
+	defer testObj.mockCtrl.Finish()
+	podWatch := NewPodWatcher(testObj.kubeVerMajor, testObj.kubeVerMinor, testObj.schedulerName, testObj.kubeClient, testObj.firmamentClient)
+	podWatch.maxCPURequest = 64000
+	podWatch.maxMemRequest = 256 * 1024 * 1024 * 1024
+
+	fakeRecorder := record.NewFakeRecorder(10)
+	poseidonEventsLock.Lock()
+	poseidonEvents = &PoseidonEvents{
+		podEvents: &PodEvents{Recorder: fakeRecorder},
+		k8sClient: testObj.kubeClient,
+	}
+	poseidonEventsLock.Unlock()
+	defer func() {
+		poseidonEventsLock.Lock()
+		poseidonEvents = nil
+		poseidonEventsLock.Unlock()
+	}()
+
+	hugeCPU := BuildPod("Poseidon-Namespace", "Pod1", empty, GetPodPhase("Pending"), "999999", "1024", &fakeNow, "abcdfe12345")
+	hugeMemory := BuildPod("Poseidon-Namespace", "Pod2", empty, GetPodPhase("Pending"), "2", "1Ti", &fakeNow, "abcdfe12345")
+	valid := BuildPod("Poseidon-Namespace", "Pod3", empty, GetPodPhase("Pending"), "64", "256Gi", &fakeNow, "abcdfe12345")
+
+	err := podWatch.checkPodConversion(hugeCPU)
+	if sizeErr, ok := err.(*RequestTooLargeError); !ok || sizeErr.ResourceName != v1.ResourceCPU || sizeErr.PodKey != "Poseidon-Namespace/Pod1" {
+		t.Errorf("expected a cpu RequestTooLargeError, got %#v", err)
+	}
+	err = podWatch.checkPodConversion(hugeMemory)
+	if sizeErr, ok := err.(*RequestTooLargeError); !ok || sizeErr.ResourceName != v1.ResourceMemory {
+		t.Errorf("expected a memory RequestTooLargeError, got %#v", err)
+	}
+	if err := podWatch.checkPodConversion(valid); err != nil {
+		t.Errorf("expected no error for a pod within the bounds, got %v", err)
+	}
+
+	// The pod over the bound gets an event and isn't submitted, the mock fails on any submission.
+	podWatch.enqueuePodAddition(GetKey(hugeCPU, t), hugeCPU)
+	select {
+	case event := <-fakeRecorder.Events:
+		if !strings.Contains(event, "FailedScheduling") || !strings.Contains(event, "exceeds the maximum") {
+			t.Errorf("unexpected event %q", event)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the FailedScheduling event")
+	}
+	if _, ok := podWatch.podWorkQueue.(*Type).items[GetKey(hugeCPU, t)]; ok {
+		t.Errorf("expected the pod %s not to be enqueued", hugeCPU.Name)
+	}
+
+	// The bounds are unlimited by default.
+	podWatch.maxCPURequest, podWatch.maxMemRequest = 0, 0
+	if err := podWatch.checkPodConversion(hugeCPU); err != nil {
+		t.Errorf("expected no error without bounds, got %v", err)
+	}
+}
+
+func TestPoseidonEvents_PodScheduledCondition(t *testing.T) {
+	var empty map[string]string
+	fakeNow := metav1.Now()
+	pod := BuildPod("Poseidon-Namespace", "Pod1", empty, GetPodPhase("Pending"), "1", "1024", &fakeNow, "abcdfe12345")
+	identifier := PodIdentifier{Name: pod.Name, Namespace: pod.Namespace}
+
+	testObj := initializePodObj(t)
+	defer testObj.mockCtrl.Finish()
+	NewPodWatcher(testObj.kubeVerMajor, testObj.kubeVerMinor, testObj.schedulerName, testObj.kubeClient, testObj.firmamentClient)
+	kubeClient := fake.NewSimpleClientset(pod)
+	events := &PoseidonEvents{
+		podEvents: &PodEvents{Recorder: record.NewFakeRecorder(10)},
+		k8sClient: kubeClient,
+	}
+	PodMux.Lock()
+	TaskIDToPod[1] = identifier
+	PodMux.Unlock()
+	NodeMux.Lock()
+	ResIDToNode["resource1"] = "Node1"
+	NodeMux.Unlock()
+	PodToK8sPodLock.Lock()
+	PodToK8sPod[identifier] = pod.DeepCopy()
+	PodToK8sPodLock.Unlock()
+	defer func() {
+		PodToK8sPodLock.Lock()
+		PodToK8sPod = make(map[PodIdentifier]*v1.Pod)
+		PodToK8sPodLock.Unlock()
+		ProcessedPodEventsLock.Lock()
+		ProcessedPodEvents = make(map[PodIdentifier]*v1.Pod)
+		ProcessedPodEventsLock.Unlock()
+	}()
+	getScheduledCondition := func() *v1.PodCondition {
+		updatedPod, err := kubeClient.CoreV1().Pods(pod.Namespace).Get(pod.Name, metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("unexpected error getting pod %s: %v", pod.Name, err)
+		}
+		_, condition := GetPodCondition(&updatedPod.Status, v1.PodScheduled)
+		return condition
+	}
+
+	events.ProcessFailureEvents([]uint64{1})
+	condition := getScheduledCondition()
+	if condition == nil || condition.Status != v1.ConditionFalse || condition.Reason != v1.PodReasonUnschedulable || condition.Message == "" {
+		t.Errorf("expected an unschedulable PodScheduled condition, got %+v", condition)
+	}
+
+	events.ProcessSuccessEvents([]*firmament.SchedulingDelta{
+		{Type: firmament.SchedulingDelta_PLACE, TaskId: 1, ResourceId: "resource1"},
+	})
+	condition = getScheduledCondition()
+	if condition == nil || condition.Status != v1.ConditionTrue || condition.Reason != "" {
+		t.Errorf("expected the PodScheduled condition to be cleared, got %+v", condition)
+	}
+}
+
+func TestPodWatcher_SkipAnnotation(t *testing.T) {
+	var empty map[string]string
+	fakeNow := metav1.Now()
+	skippedPod := BuildPod("Poseidon-Namespace", "SkippedPod", empty, GetPodPhase("Pending"), "1", "1024", &fakeNow, "abcdfe12345")
+	skippedPod.Spec.SchedulerName = "poseidon"
+	skippedPod.Annotations = map[string]string{SkipAnnotation: "true"}
+	pod := BuildPod("Poseidon-Namespace", "Pod", empty, GetPodPhase("Pending"), "1", "1024", &fakeNow, "abcdfe12346")
+	pod.Spec.SchedulerName = "poseidon"
+	pod.Annotations = map[string]string{SkipAnnotation: "false"}
+
+	testObj := initializePodObj(t)
+	defer testObj.mockCtrl.Finish()
+	podWatch := NewPodWatcher(testObj.kubeVerMajor, testObj.kubeVerMinor, testObj.schedulerName, fake.NewSimpleClientset(skippedPod, pod), testObj.firmamentClient)
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	go podWatch.controller.Run(stopCh)
+	if !cache.WaitForCacheSync(stopCh, podWatch.controller.HasSynced) {
+		t.Fatal("timed out waiting for the caches to sync")
+	}
+	podWatch.flushInitialPods()
+
+	keys := make(chan interface{}, 2)
+	go func() {
+		for {
+			key, _, quit := podWatch.podWorkQueue.Get()
+			if quit {
+				return
+			}
+			keys <- key
+			podWatch.podWorkQueue.Done(key)
+		}
+	}()
+	select {
+	case key := <-keys:
+		if key != GetKey(pod, t) {
+			t.Errorf("expected the key %s, got %v", GetKey(pod, t), key)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the pod without the skip annotation")
+	}
+	select {
+	case key := <-keys:
+		t.Errorf("expected the annotated pod to be skipped, got %v", key)
+	case <-time.After(200 * time.Millisecond):
+	}
+	podWatch.podWorkQueue.ShutDown()
+}
+
+func TestPodWatcher_TaskRemovedRetry(t *testing.T) {
+	var empty map[string]string
+	fakeNow := metav1.Now()
+	pod := BuildPod("Poseidon-Namespace", "Pod1", empty, GetPodPhase("Pending"), "1", "1024", &fakeNow, "abcdfe12345")
+	identifier := PodIdentifier{Name: pod.Name, Namespace: pod.Namespace}
+
+	testObj := initializePodObj(t)
+	defer testObj.mockCtrl.Finish()
+	podWatch := NewPodWatcher(testObj.kubeVerMajor, testObj.kubeVerMinor, testObj.schedulerName, testObj.kubeClient, testObj.firmamentClient)
+	podWatch.taskRemovalMaxRetries = 3
+
+	removed := make(chan struct{})
+	gomock.InOrder(
+		testObj.firmamentClient.EXPECT().TaskSubmitted(gomock.Any(), gomock.Any()).Return(
+			&firmament.TaskSubmittedResponse{Type: firmament.TaskReplyType_TASK_SUBMITTED_OK}, nil),
+		// Firmament fails to remove the task once, the deletion is retried.
+		testObj.firmamentClient.EXPECT().TaskRemoved(gomock.Any(), gomock.Any()).Return(
+			nil, fmt.Errorf("firmament unavailable")),
+		testObj.firmamentClient.EXPECT().TaskRemoved(gomock.Any(), gomock.Any()).Do(func(_ interface{}, _ *firmament.TaskUID) {
+			close(removed)
+		}).Return(&firmament.TaskRemovedResponse{Type: firmament.TaskReplyType_TASK_REMOVED_OK}, nil),
+	)
+	key := GetKey(pod, t)
+	podWatch.enqueuePodAddition(key, pod)
+	podWatch.enqueuePodDeletion(key, pod)
+	go podWatch.podWorker()
+
+	select {
+	case <-removed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the removal to be retried")
+	}
+	time.Sleep(100 * time.Millisecond)
+	PodMux.RLock()
+	_, ok := PodToTD[identifier]
+	PodMux.RUnlock()
+	if ok {
+		t.Errorf("expected the task of pod %v to be forgotten once removed", identifier)
+	}
+	podWatch.taskRemovalRetriesMux.Lock()
+	if retries, ok := podWatch.taskRemovalRetries[identifier]; ok {
+		t.Errorf("expected the retries to be reset once removed, got %d", retries)
+	}
+	podWatch.taskRemovalRetriesMux.Unlock()
+	podWatch.podWorkQueue.ShutDown()
+}
+
+// TestPodWatcher_TaskEvicted checks a pod evicted by the kubelet is reported to Firmament with
+// TaskFailed, Firmament has no eviction RPC.
+func TestPodWatcher_TaskEvicted(t *testing.T) {
+	var empty map[string]string
+	fakeNow := metav1.Now()
+	pod := BuildPod("Poseidon-Namespace", "Pod1", empty, GetPodPhase("Pending"), "1", "1024", &fakeNow, "abcdfe12345")
+	pod.DeletionTimestamp = nil
+
+	testObj := initializePodObj(t)
+	defer testObj.mockCtrl.Finish()
+	podWatch := NewPodWatcher(testObj.kubeVerMajor, testObj.kubeVerMinor, testObj.schedulerName, testObj.kubeClient, testObj.firmamentClient)
+
+	failed := make(chan struct{})
+	gomock.InOrder(
+		testObj.firmamentClient.EXPECT().TaskSubmitted(gomock.Any(), gomock.Any()).Return(
+			&firmament.TaskSubmittedResponse{Type: firmament.TaskReplyType_TASK_SUBMITTED_OK}, nil),
+		testObj.firmamentClient.EXPECT().TaskFailed(gomock.Any(), gomock.Any()).Do(func(_ interface{}, _ *firmament.TaskUID) {
+			close(failed)
+		}).Return(&firmament.TaskFailedResponse{Type: firmament.TaskReplyType_TASK_FAILED_OK}, nil),
+	)
+
+	key := GetKey(pod, t)
+	podWatch.enqueuePodAddition(key, pod)
+	// The kubelet evicts the running pod because its node is under memory pressure.
+	runningPod := pod.DeepCopy()
+	runningPod.Spec.NodeName = "Node1"
+	runningPod.Status.Phase = v1.PodRunning
+	evictedPod := runningPod.DeepCopy()
+	evictedPod.Status.Phase = v1.PodFailed
+	evictedPod.Status.Reason = podEvictedReason
+	podWatch.enqueuePodUpdate(key, runningPod, evictedPod)
+	go podWatch.podWorker()
+
+	select {
+	case <-failed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the evicted task to be reported")
+	}
+	podWatch.podWorkQueue.ShutDown()
+}
+
+func TestPodWatcher_isEvictedPod(t *testing.T) {
+	var empty map[string]string
+	fakeNow := metav1.Now()
+	pod := BuildPod("Poseidon-Namespace", "Pod1", empty, GetPodPhase("Failed"), "1", "1024", &fakeNow, "abcdfe12345")
+	if isEvictedPod(pod) {
+		t.Errorf("expected a failed pod not to be evicted")
+	}
+	kubeletEvicted := pod.DeepCopy()
+	kubeletEvicted.Status.Reason = podEvictedReason
+	if !isEvictedPod(kubeletEvicted) {
+		t.Errorf("expected a pod evicted by the kubelet to be evicted")
+	}
+	testObj := initializePodObj(t)
+	defer testObj.mockCtrl.Finish()
+	podWatch := NewPodWatcher(testObj.kubeVerMajor, testObj.kubeVerMinor, testObj.schedulerName, testObj.kubeClient, testObj.firmamentClient)
+	if state := podWatch.parsePod(kubeletEvicted).State; state != PodEvicted {
+		t.Errorf("expected the state of a pod evicted by the kubelet to be %v, got %v", PodEvicted, state)
+	}
+	if state := podWatch.parsePod(pod).State; state != PodFailed {
+		t.Errorf("expected the state of a failed pod to be %v, got %v", PodFailed, state)
+	}
+}
+
+func TestPodWatcher_FractionalCPURequest(t *testing.T) {
+	var empty map[string]string
+	fakeNow := metav1.Now()
+	testObj := initializePodObj(t)
+	defer testObj.mockCtrl.Finish()
+	podWatch := NewPodWatcher(testObj.kubeVerMajor, testObj.kubeVerMinor, testObj.schedulerName, testObj.kubeClient, testObj.firmamentClient)
+
+	testData := []struct {
+		cpu      string
+		expected int64
+	}{
+		{"0.5", 500},
+		{"1.25", 1250},
+		{"250m", 250},
+	}
+	for _, data := range testData {
+		pod := BuildPod("Poseidon-Namespace", "Pod1", empty, GetPodPhase("Pending"), data.cpu, "1024", &fakeNow, "abcdfe12345")
+		if cpuReq, _, _ := podWatch.getCPUMemEphemeralRequest(pod); cpuReq != data.expected {
+			t.Errorf("cpu request %s: expected %d millicores, got %d", data.cpu, data.expected, cpuReq)
+		}
+		if parsedPod := podWatch.parsePod(pod); parsedPod.CPURequest != data.expected {
+			t.Errorf("cpu request %s: expected the pod to request %d millicores, got %d", data.cpu, data.expected, parsedPod.CPURequest)
+		}
+	}
+}
+
+func TestPodWatcher_RemoveTasksOnShutdown(t *testing.T) {
+	var empty map[string]string
+	fakeNow := metav1.Now()
+	pods := []*v1.Pod{
+		BuildPod("Poseidon-Namespace", "Pod1", empty, GetPodPhase("Pending"), "1", "1024", &fakeNow, "abcdfe12345"),
+		BuildPod("Poseidon-Namespace", "Pod2", empty, GetPodPhase("Pending"), "1", "1024", &fakeNow, "abcdfe12346"),
+	}
+
+	testObj := initializePodObj(t)
+	defer testObj.mockCtrl.Finish()
+	podWatch := NewPodWatcher(testObj.kubeVerMajor, testObj.kubeVerMinor, testObj.schedulerName, fake.NewSimpleClientset(), testObj.firmamentClient)
+	podWatch.removeTasksOnShutdown = true
+
+	submitted := make(chan uint64, len(pods))
+	testObj.firmamentClient.EXPECT().TaskSubmitted(gomock.Any(), gomock.Any()).Do(func(_ interface{}, td *firmament.TaskDescription) {
+		submitted <- td.TaskDescriptor.Uid
+	}).Return(&firmament.TaskSubmittedResponse{Type: firmament.TaskReplyType_TASK_SUBMITTED_OK}, nil).Times(len(pods))
+	removed := make(map[uint64]bool)
+	testObj.firmamentClient.EXPECT().TaskRemoved(gomock.Any(), gomock.Any()).Do(func(_ interface{}, tuid *firmament.TaskUID) {
+		removed[tuid.TaskUid] = true
+	}).Return(&firmament.TaskRemovedResponse{Type: firmament.TaskReplyType_TASK_REMOVED_OK}, nil).Times(len(pods))
+
+	for _, pod := range pods {
+		podWatch.enqueuePodAddition(GetKey(pod, t), pod)
+	}
+	stopCh := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		podWatch.Run(stopCh, 2)
+		close(done)
+	}()
+	taskIDs := make(map[uint64]bool)
+	for range pods {
+		select {
+		case uid := <-submitted:
+			taskIDs[uid] = true
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for the tasks to be submitted")
+		}
+	}
+	close(stopCh)
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the pod watcher to stop")
+	}
+
+	if !reflect.DeepEqual(removed, taskIDs) {
+		t.Errorf("expected the tasks %v to be removed on shutdown, got %v", taskIDs, removed)
+	}
+	PodMux.RLock()
+	defer PodMux.RUnlock()
+	if len(PodToTD) != 0 {
+		t.Errorf("expected no task left once removed, got %d", len(PodToTD))
+	}
+}
+
+// TestPodWatcher_RemoveTasksOnSignal checks SIGTERM stops the pod watcher through the signal handler
+// Poseidon runs with, and that the tasks are then withdrawn from Firmament.
+func TestPodWatcher_RemoveTasksOnSignal(t *testing.T) {
+	var empty map[string]string
+	fakeNow := metav1.Now()
+	pod := BuildPod("Poseidon-Namespace", "Signaled", empty, GetPodPhase("Pending"), "1", "1024", &fakeNow, "abcdfe12345")
+	pod.DeletionTimestamp = nil
+
+	testObj := initializePodObj(t)
+	defer testObj.mockCtrl.Finish()
+	podWatch := NewPodWatcher(testObj.kubeVerMajor, testObj.kubeVerMinor, testObj.schedulerName, fake.NewSimpleClientset(), testObj.firmamentClient)
+	podWatch.removeTasksOnShutdown = true
+
+	submitted := make(chan struct{})
+	testObj.firmamentClient.EXPECT().TaskSubmitted(gomock.Any(), gomock.Any()).Do(func(_ interface{}, _ *firmament.TaskDescription) {
+		close(submitted)
+	}).Return(&firmament.TaskSubmittedResponse{Type: firmament.TaskReplyType_TASK_SUBMITTED_OK}, nil)
+	removed := make(chan struct{})
+	testObj.firmamentClient.EXPECT().TaskRemoved(gomock.Any(), gomock.Any()).Do(func(_ interface{}, _ *firmament.TaskUID) {
+		close(removed)
+	}).Return(&firmament.TaskRemovedResponse{Type: firmament.TaskReplyType_TASK_REMOVED_OK}, nil)
+
+	podWatch.enqueuePodAddition(GetKey(pod, t), pod)
+	stopCh := signals.SetupSignalHandler()
+	done := make(chan struct{})
+	go func() {
+		podWatch.Run(stopCh, 1)
+		close(done)
+	}()
+	select {
+	case <-submitted:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the task to be submitted")
+	}
+	if err := syscall.Kill(syscall.Getpid(), syscall.SIGTERM); err != nil {
+		t.Fatalf("failed to send SIGTERM: %v", err)
+	}
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the pod watcher to stop on SIGTERM")
+	}
+	select {
+	case <-removed:
+	default:
+		t.Error("expected the task to be removed from Firmament on SIGTERM")
+	}
+}
+
+func TestPodWatcher_EmptyTopologyKey(t *testing.T) {
+	var empty map[string]string
+	fakeNow := metav1.Now()
+	testObj := initializePodObj(t)
+	defer testObj.mockCtrl.Finish()
+	podWatch := NewPodWatcher(testObj.kubeVerMajor, testObj.kubeVerMinor, testObj.schedulerName, testObj.kubeClient, testObj.firmamentClient)
+
+	emptyAffinityKey := BuildPod("Poseidon-Namespace", "Pod1", empty, GetPodPhase("Pending"), "1", "1024", &fakeNow, "abcdfe12345")
+	emptyAffinityKey.Spec.Affinity.PodAffinity.RequiredDuringSchedulingIgnoredDuringExecution[0].TopologyKey = ""
+	emptyAntiAffinityKey := BuildPod("Poseidon-Namespace", "Pod2", empty, GetPodPhase("Pending"), "1", "1024", &fakeNow, "abcdfe12345")
+	emptyAntiAffinityKey.Spec.Affinity.PodAntiAffinity.PreferredDuringSchedulingIgnoredDuringExecution = []v1.WeightedPodAffinityTerm{
+		{
+			Weight: 10,
+			PodAffinityTerm: v1.PodAffinityTerm{
+				LabelSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"service": "antivirusscan"}},
+				TopologyKey:   " ",
+			},
+		},
+	}
+
+	for _, pod := range []*v1.Pod{emptyAffinityKey, emptyAntiAffinityKey} {
+		err := podWatch.checkPodConversion(pod)
+		if affinityErr, ok := err.(*InvalidAffinityError); !ok || affinityErr.PodKey != pod.Namespace+"/"+pod.Name {
+			t.Errorf("pod %s: expected an InvalidAffinityError, got %#v", pod.Name, err)
+		}
+	}
+	valid := BuildPod("Poseidon-Namespace", "Pod3", empty, GetPodPhase("Pending"), "1", "1024", &fakeNow, "abcdfe12345")
+	if err := podWatch.checkPodConversion(valid); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+}
+
+func TestPodWatcher_GPUProductConstraint(t *testing.T) {
+	const gpuProductLabel = "nvidia.com/gpu.product"
+	const gpuProduct = "Tesla-V100-SXM2-16GB"
+	var empty map[string]string
+	fakeNow := metav1.Now()
+	testObj := initializePodObj(t)
+	defer testObj.mockCtrl.Finish()
+	podWatch := NewPodWatcher(testObj.kubeVerMajor, testObj.kubeVerMinor, testObj.schedulerName, testObj.kubeClient, testObj.firmamentClient)
+	nodeWatch := NewNodeWatcher(testObj.kubeClient, testObj.firmamentClient)
+
+	// The node advertises its GPU product through the label set by the GPU feature discovery.
+	node := BuildNode("gpu-node", "8", "32Gi", map[string]string{gpuProductLabel: gpuProduct}, nil, false)
+	rtnd := nodeWatch.createResourceTopologyForNode(nodeWatch.parseNode(node, NodeAdded))
+	advertised := false
+	for _, label := range rtnd.ResourceDesc.Labels {
+		if label.Key == gpuProductLabel && label.Value == gpuProduct {
+			advertised = true
+		}
+	}
+	if !advertised {
+		t.Errorf("expected the node to report the label %s=%s, got %v", gpuProductLabel, gpuProduct, rtnd.ResourceDesc.Labels)
+	}
+
+	affinityPod := BuildPod("Poseidon-Namespace", "Pod1", empty, GetPodPhase("Pending"), "1", "1024", &fakeNow, "abcdfe12345")
+	affinityPod.Spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution = &v1.NodeSelector{
+		NodeSelectorTerms: []v1.NodeSelectorTerm{
+			{
+				MatchExpressions: []v1.NodeSelectorRequirement{
+					{
+						Key:      gpuProductLabel,
+						Operator: v1.NodeSelectorOpIn,
+						Values:   []string{gpuProduct},
+					},
+				},
+			},
+		},
+	}
+	selectorPod := BuildPod("Poseidon-Namespace", "Pod2", empty, GetPodPhase("Pending"), "1", "1024", &fakeNow, "abcdfe12346")
+	selectorPod.Spec.Affinity.NodeAffinity = nil
+	selectorPod.Spec.NodeSelector = map[string]string{gpuProductLabel: gpuProduct}
+
+	for _, pod := range []*v1.Pod{affinityPod, selectorPod} {
+		td := podWatch.addTaskToJob(podWatch.parsePod(pod), "jobUid", "jobName", 0)
+		if td.Affinity == nil || td.Affinity.NodeAffinity == nil || td.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution == nil {
+			t.Errorf("pod %s: expected a required node affinity, got %v", pod.Name, td.Affinity)
+			continue
+		}
+		required := false
+		for _, term := range td.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms {
+			for _, requirement := range term.MatchExpressions {
+				if requirement.Key == gpuProductLabel && requirement.Operator == string(v1.NodeSelectorOpIn) &&
+					reflect.DeepEqual(requirement.Values, []string{gpuProduct}) {
+					required = true
+				}
+			}
+		}
+		if !required {
+			t.Errorf("pod %s: expected the node affinity to require %s=%s, got %v", pod.Name, gpuProductLabel, gpuProduct,
+				td.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution)
+		}
+	}
+}
+
+func TestPodWatcher_ArchLabelSelector(t *testing.T) {
+	var empty map[string]string
+	fakeNow := metav1.Now()
+	arm64Pod := BuildPod("Poseidon-Namespace", "Arm64Pod", empty, GetPodPhase("Pending"), "1", "1024", &fakeNow, "abcdfe12345")
+	arm64Pod.Spec.NodeSelector = map[string]string{LabelArch: "arm64"}
+	betaArm64Pod := BuildPod("Poseidon-Namespace", "BetaArm64Pod", empty, GetPodPhase("Pending"), "1", "1024", &fakeNow, "abcdfe12346")
+	betaArm64Pod.Spec.NodeSelector = map[string]string{BetaLabelArch: "arm64"}
+	amd64Pod := BuildPod("Poseidon-Namespace", "Amd64Pod", empty, GetPodPhase("Pending"), "1", "1024", &fakeNow, "abcdfe12347")
+	amd64Pod.Spec.NodeSelector = map[string]string{LabelArch: "amd64"}
+	anyArchPod := BuildPod("Poseidon-Namespace", "AnyArchPod", empty, GetPodPhase("Pending"), "1", "1024", &fakeNow, "abcdfe12348")
+
+	testObj := initializePodObj(t)
+	defer testObj.mockCtrl.Finish()
+	podWatch := NewPodWatcher(testObj.kubeVerMajor, testObj.kubeVerMinor, testObj.schedulerName, testObj.kubeClient, testObj.firmamentClient)
+	nodeWatch := NewNodeWatcher(testObj.kubeClient, testObj.firmamentClient)
+	nodeWatch.defaultArch = DefaultArch
+
+	nodes := map[string]*v1.Node{
+		"arm64":      BuildNode("Arm64Node", "2", "4Gi", map[string]string{LabelArch: "arm64", BetaLabelArch: "arm64"}, nil, true),
+		"arm64-beta": BuildNode("BetaArm64Node", "2", "4Gi", map[string]string{BetaLabelArch: "arm64"}, nil, true),
+		"amd64":      BuildNode("Amd64Node", "2", "4Gi", map[string]string{LabelArch: "amd64"}, nil, true),
+		"unlabeled":  BuildNode("UnlabeledNode", "2", "4Gi", empty, nil, true),
+	}
+	var testData = []struct {
+		pod      *v1.Pod
+		expected map[string]bool
+	}{
+		{
+			pod:      arm64Pod,
+			expected: map[string]bool{"arm64": true, "arm64-beta": true, "amd64": false, "unlabeled": false},
+		},
+		{
+			pod:      betaArm64Pod,
+			expected: map[string]bool{"arm64": true, "arm64-beta": true, "amd64": false, "unlabeled": false},
+		},
+		{
+			pod:      amd64Pod,
+			expected: map[string]bool{"arm64": false, "arm64-beta": false, "amd64": true, "unlabeled": true},
+		},
+		{
+			pod:      anyArchPod,
+			expected: map[string]bool{"arm64": true, "arm64-beta": true, "amd64": true, "unlabeled": true},
+		},
+	}
+	for _, data := range testData {
+		td := podWatch.addTaskToJob(podWatch.parsePod(data.pod), "jobUID", "jobName", 0)
+		for name, node := range nodes {
+			rtnd := nodeWatch.createResourceTopologyForNode(nodeWatch.parseNode(node, NodeAdded))
+			if matched := matchesLabelSelectors(rtnd.ResourceDesc.Labels, td.LabelSelectors); matched != data.expected[name] {
+				t.Errorf("expected pod %s to match node %s: %v, got %v", data.pod.Name, name, data.expected[name], matched)
+			}
+		}
+	}
+}
+
+// TestGetOwnerReference checks the owner of a pod is its controller among its owner references,
+// and the pod itself if none of them is a controller.
+func TestGetOwnerReference(t *testing.T) {
+	var empty map[string]string
+	fakeNow := metav1.Now()
+	isController := true
+	notController := false
+
+	var testData = []struct {
+		description string
+		ownerRefs   []metav1.OwnerReference
+		expected    string
+	}{
+		{
+			description: "controller after other owners",
+			ownerRefs: []metav1.OwnerReference{
+				{Kind: "ConfigMap", Name: "cm1", UID: "cm1-uid"},
+				{Kind: "Service", Name: "svc1", UID: "svc1-uid", Controller: &notController},
+				{Kind: "ReplicaSet", Name: "rs1", UID: "rs1-uid", Controller: &isController},
+			},
+			expected: "rs1-uid",
+		},
+		{
+			description: "no controller",
+			ownerRefs: []metav1.OwnerReference{
+				{Kind: "ConfigMap", Name: "cm1", UID: "cm1-uid"},
+				{Kind: "Service", Name: "svc1", UID: "svc1-uid", Controller: &notController},
+			},
+			expected: "pod-uid",
+		},
+		{
+			description: "no owner",
+			expected:    "pod-uid",
+		},
+	}
+	for _, data := range testData {
+		pod := BuildPod("Poseidon-Namespace", "Pod1", empty, GetPodPhase("Pending"), "1", "1024", &fakeNow, "pod-uid")
+		pod.OwnerReferences = data.ownerRefs
+		if owner := GetOwnerReference(pod); owner != data.expected {
+			t.Errorf("%s: expected the owner %s, got %s", data.description, data.expected, owner)
+		}
+	}
+}
+
+func TestPodWatcher_ResolveControllerRef(t *testing.T) {
+	var empty map[string]string
+	fakeNow := metav1.Now()
+	isController := true
+	var replicaSets []runtime.Object
+	var pods []*v1.Pod
+	// The pods of the old and the new ReplicaSets of a rolling update.
+	for _, name := range []string{"web-5d4f8", "web-7c9b6"} {
+		replicaSets = append(replicaSets, &appsv1.ReplicaSet{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: "Poseidon-Namespace",
+				UID:       types.UID(name + "-uid"),
+				OwnerReferences: []metav1.OwnerReference{
+					{Kind: "Deployment", Name: "web", UID: "web-uid", Controller: &isController},
+				},
+			},
+		})
+		pod := BuildPod("Poseidon-Namespace", name+"-pod", empty, GetPodPhase("Pending"), "1", "1024", &fakeNow, name+"-pod-uid")
+		pod.OwnerReferences = []metav1.OwnerReference{
+			{Kind: "ReplicaSet", Name: name, UID: types.UID(name + "-uid"), Controller: &isController},
+		}
+		pods = append(pods, pod)
+	}
+	orphanedReplicaSetPod := BuildPod("Poseidon-Namespace", "orphan", empty, GetPodPhase("Pending"), "1", "1024", &fakeNow, "orphan-uid")
+	orphanedReplicaSetPod.OwnerReferences = []metav1.OwnerReference{
+		{Kind: "ReplicaSet", Name: "deleted", UID: "deleted-uid", Controller: &isController},
+	}
+	barePod := BuildPod("Poseidon-Namespace", "bare", empty, GetPodPhase("Pending"), "1", "1024", &fakeNow, "bare-uid")
+
+	testObj := initializePodObj(t)
+	defer testObj.mockCtrl.Finish()
+	podWatch := NewPodWatcher(testObj.kubeVerMajor, testObj.kubeVerMinor, testObj.schedulerName, testObj.kubeClient, testObj.firmamentClient)
+	// The ReplicaSets are read from the informer cache, not from the API server.
+	for _, replicaSet := range replicaSets {
+		podWatch.owners.stores["ReplicaSet"].Add(replicaSet)
+	}
+
+	expected := &ControllerRef{Kind: "Deployment", Name: "web", UID: "web-uid"}
+	for _, pod := range pods {
+		parsedPod := podWatch.parsePod(pod)
+		if !reflect.DeepEqual(parsedPod.ControllerRef, expected) {
+			t.Errorf("Pod %s: expected controller %+v, got %+v", pod.Name, expected, parsedPod.ControllerRef)
+		}
+		if parsedPod.OwnerRef != string(pod.OwnerReferences[0].UID) {
+			t.Errorf("Pod %s: expected the owner to stay the ReplicaSet, got %s", pod.Name, parsedPod.OwnerRef)
+		}
+		labelFound := false
+		for _, label := range podWatch.getFirmamentLabels(parsedPod) {
+			if label.Key == ControllerUIDLabel && label.Value == "web-uid" {
+				labelFound = true
+			}
+		}
+		if !labelFound {
+			t.Errorf("Pod %s: expected the %s label", pod.Name, ControllerUIDLabel)
+		}
+	}
+
+	// The controllers are cached.
+	podWatch.owners.stores["ReplicaSet"].Delete(replicaSets[0])
+	if ref := podWatch.parsePod(pods[0]).ControllerRef; !reflect.DeepEqual(ref, expected) {
+		t.Errorf("Expected the controller %+v to be cached, got %+v", expected, ref)
+	}
+
+	expected = &ControllerRef{Kind: "ReplicaSet", Name: "deleted", UID: "deleted-uid"}
+	if ref := podWatch.parsePod(orphanedReplicaSetPod).ControllerRef; !reflect.DeepEqual(ref, expected) {
+		t.Errorf("Expected the controller %+v of the pod whose owner is unknown, got %+v", expected, ref)
+	}
+	// The controller of an unknown owner isn't cached, it's resolved once the owner is observed.
+	podWatch.owners.stores["ReplicaSet"].Add(&appsv1.ReplicaSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "deleted",
+			Namespace: "Poseidon-Namespace",
+			UID:       "deleted-uid",
+			OwnerReferences: []metav1.OwnerReference{
+				{Kind: "Deployment", Name: "web", UID: "web-uid", Controller: &isController},
+			},
+		},
+	})
+	expected = &ControllerRef{Kind: "Deployment", Name: "web", UID: "web-uid"}
+	if ref := podWatch.parsePod(orphanedReplicaSetPod).ControllerRef; !reflect.DeepEqual(ref, expected) {
+		t.Errorf("Expected the controller %+v once the owner is observed, got %+v", expected, ref)
+	}
+	if ref := podWatch.parsePod(barePod).ControllerRef; ref != nil {
+		t.Errorf("Expected no controller for a pod without owner, got %+v", ref)
+	}
+}
+
+func TestPodWatcher_RestartCount(t *testing.T) {
+	var empty map[string]string
+	fakeNow := metav1.Now()
+	pod := BuildPod("Poseidon-Namespace", "Pod1", empty, GetPodPhase("Pending"), "1", "1024", &fakeNow, "abcdfe12345")
+	pod.Status.ContainerStatuses = []v1.ContainerStatus{
+		{Name: "app", RestartCount: 2},
+		{Name: "sidecar", RestartCount: 3},
+	}
+	restartedPod := pod.DeepCopy()
+	restartedPod.Status.ContainerStatuses[0].RestartCount = 4
+
+	testObj := initializePodObj(t)
+	defer testObj.mockCtrl.Finish()
+	podWatch := NewPodWatcher(testObj.kubeVerMajor, testObj.kubeVerMinor, testObj.schedulerName, testObj.kubeClient, testObj.firmamentClient)
+	if restartCount := podWatch.parsePod(pod).RestartCount; restartCount != 5 {
+		t.Fatalf("Expected the pod to have restarted 5 times, got %d", restartCount)
+	}
+
+	restartCounts := make(chan string, 2)
+	restartCountLabel := func(td *firmament.TaskDescription) string {
+		for _, label := range td.TaskDescriptor.Labels {
+			if label.Key == RestartCountLabel {
+				return label.Value
+			}
+		}
+		return ""
+	}
+	gomock.InOrder(
+		testObj.firmamentClient.EXPECT().TaskSubmitted(gomock.Any(), gomock.Any()).Do(func(_ interface{}, td *firmament.TaskDescription) {
+			restartCounts <- restartCountLabel(td)
+		}).Return(&firmament.TaskSubmittedResponse{Type: firmament.TaskReplyType_TASK_SUBMITTED_OK}, nil),
+		testObj.firmamentClient.EXPECT().TaskUpdated(gomock.Any(), gomock.Any()).Do(func(_ interface{}, td *firmament.TaskDescription) {
+			restartCounts <- restartCountLabel(td)
+		}).Return(&firmament.TaskUpdatedResponse{Type: firmament.TaskReplyType_TASK_UPDATED_OK}, nil),
+	)
+	go podWatch.podWorker()
+
+	podWatch.enqueuePodAddition(GetKey(pod, t), pod)
+	// Only the restarts changed, the task is updated anyway.
+	podWatch.enqueuePodUpdate(GetKey(restartedPod, t), pod, restartedPod)
+	for _, expected := range []string{"5", "7"} {
+		select {
+		case restartCount := <-restartCounts:
+			if restartCount != expected {
+				t.Errorf("Expected a restart count label of %q, got %q", expected, restartCount)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for the task with a restart count of %s", expected)
+		}
+	}
+	podWatch.podWorkQueue.ShutDown()
+}
+
+func TestPodWatcher_SubmissionGracePeriod(t *testing.T) {
+	var empty map[string]string
+	fakeNow := metav1.Now()
+	gracePeriod := 300 * time.Millisecond
+	pod := BuildPod("Poseidon-Namespace", "Pod1", empty, GetPodPhase("Pending"), "1", "1024", &fakeNow, "abcdfe12345")
+	injectedPod := pod.DeepCopy()
+	injectedPod.Labels = map[string]string{"sidecar-injected": "true"}
+
+	testObj := initializePodObj(t)
+	defer testObj.mockCtrl.Finish()
+	podWatch := NewPodWatcher(testObj.kubeVerMajor, testObj.kubeVerMinor, testObj.schedulerName, testObj.kubeClient, testObj.firmamentClient)
+	podWatch.podWorkQueue = NewDelayingKeyedQueue()
+	podWatch.submissionGracePeriod = gracePeriod
+
+	submitted := make(chan *firmament.TaskDescription, 2)
+	testObj.firmamentClient.EXPECT().TaskSubmitted(gomock.Any(), gomock.Any()).Do(func(_ interface{}, td *firmament.TaskDescription) {
+		submitted <- td
+	}).Return(&firmament.TaskSubmittedResponse{Type: firmament.TaskReplyType_TASK_SUBMITTED_OK}, nil).Times(1)
+	go podWatch.podWorker()
+
+	start := time.Now()
+	podWatch.enqueuePodAddition(GetKey(pod, t), pod)
+	select {
+	case td := <-submitted:
+		t.Fatalf("expected no task during the grace period, got %v", td.TaskDescriptor.Name)
+	case <-time.After(gracePeriod / 2):
+	}
+
+	// The sidecar injector updates the pod, which is held for another grace period.
+	podWatch.enqueuePodUpdate(GetKey(injectedPod, t), pod, injectedPod)
+	select {
+	case td := <-submitted:
+		t.Fatalf("expected no task before the pod is unchanged for the grace period, got %v", td.TaskDescriptor.Name)
+	case <-time.After(gracePeriod):
+	}
+
+	select {
+	case td := <-submitted:
+		if elapsed := time.Since(start); elapsed < gracePeriod*3/2 {
+			t.Errorf("expected the pod to be submitted after %v, it was after %v", gracePeriod*3/2, elapsed)
+		}
+		injected := false
+		for _, label := range td.TaskDescriptor.Labels {
+			if label.Key == "sidecar-injected" {
+				injected = true
+			}
+		}
+		if !injected {
+			t.Errorf("expected the latest version of the pod to be submitted, got labels %v", td.TaskDescriptor.Labels)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the pod to be submitted")
+	}
+	podWatch.podWorkQueue.ShutDown()
+}
+
+func TestPodWatcher_AffinityMatchLabels(t *testing.T) {
+	var empty map[string]string
+	fakeNow := metav1.Now()
+	testObj := initializePodObj(t)
+	defer testObj.mockCtrl.Finish()
+	podWatch := NewPodWatcher(testObj.kubeVerMajor, testObj.kubeVerMinor, testObj.schedulerName, testObj.kubeClient, testObj.firmamentClient)
+
+	selector := &metav1.LabelSelector{
+		MatchLabels: map[string]string{"app": "web", "tier": "frontend"},
+		MatchExpressions: []metav1.LabelSelectorRequirement{
+			{Key: "track", Operator: metav1.LabelSelectorOpNotIn, Values: []string{"canary"}},
+		},
+	}
+	term := v1.PodAffinityTerm{LabelSelector: selector, TopologyKey: "kubernetes.io/hostname"}
+	pod := BuildPod("Poseidon-Namespace", "Pod1", empty, GetPodPhase("Pending"), "1", "1024", &fakeNow, "abcdfe12345")
+	pod.Spec.Affinity.PodAffinity = &v1.PodAffinity{
+		RequiredDuringSchedulingIgnoredDuringExecution:  []v1.PodAffinityTerm{term},
+		PreferredDuringSchedulingIgnoredDuringExecution: []v1.WeightedPodAffinityTerm{{Weight: 10, PodAffinityTerm: term}},
+	}
+	pod.Spec.Affinity.PodAntiAffinity = &v1.PodAntiAffinity{
+		RequiredDuringSchedulingIgnoredDuringExecution:  []v1.PodAffinityTerm{term},
+		PreferredDuringSchedulingIgnoredDuringExecution: []v1.WeightedPodAffinityTerm{{Weight: 10, PodAffinityTerm: term}},
+	}
+	parsedPod := podWatch.parsePod(pod)
+
+	expected := []string{"track NotIn [canary]", "app In [web]", "tier In [frontend]"}
+	var selectors [][]string
+	for _, term := range podWatch.getFirmamentPodAffinityTerm(parsedPod) {
+		var requirements []string
+		for _, requirement := range term.LabelSelector.MatchExpressions {
+			requirements = append(requirements, fmt.Sprintf("%s %s %v", requirement.Key, requirement.Operator, requirement.Values))
+		}
+		selectors = append(selectors, requirements)
+	}
+	for _, term := range podWatch.getFirmamentWeightedPodAffinityTerm(parsedPod) {
+		var requirements []string
+		for _, requirement := range term.PodAffinityTerm.LabelSelector.MatchExpressions {
+			requirements = append(requirements, fmt.Sprintf("%s %s %v", requirement.Key, requirement.Operator, requirement.Values))
+		}
+		selectors = append(selectors, requirements)
+	}
+	for _, term := range podWatch.getFirmamentPodAffinityTermforPodAntiAffinity(parsedPod) {
+		var requirements []string
+		for _, requirement := range term.LabelSelector.MatchExpressions {
+			requirements = append(requirements, fmt.Sprintf("%s %s %v", requirement.Key, requirement.Operator, requirement.Values))
+		}
+		selectors = append(selectors, requirements)
+	}
+	for _, term := range podWatch.getFirmamentWeightedPodAffinityTermforPodAntiAffinity(parsedPod) {
+		var requirements []string
+		for _, requirement := range term.PodAffinityTerm.LabelSelector.MatchExpressions {
+			requirements = append(requirements, fmt.Sprintf("%s %s %v", requirement.Key, requirement.Operator, requirement.Values))
+		}
+		selectors = append(selectors, requirements)
+	}
+	if len(selectors) != 4 {
+		t.Fatalf("expected 4 converted terms, got %d", len(selectors))
+	}
+	for i, requirements := range selectors {
+		if !reflect.DeepEqual(requirements, expected) {
+			t.Errorf("term %d: expected the requirements %v, got %v", i, expected, requirements)
+		}
+	}
+}
+
+// TestPodWatcher_RetryBudget checks that a flood of failures is retried no faster than the shared
+// retry budget allows.
+func TestPodWatcher_RetryBudget(t *testing.T) {
+	const (
+		failures = 30
+		qps      = 20
+		burst    = 5
+	)
+	queue := NewKeyedQueue()
+	podWatch := &PodWatcher{
+		podWorkQueue: queue,
+		retryBudget:  newRetryBudget(qps, burst),
+	}
+	start := time.Now()
+	for i := 0; i < failures; i++ {
+		podWatch.requeuePod(fmt.Sprintf("default/pod-%d", i), &Pod{})
+	}
+	retried := make(chan time.Duration, failures)
+	go func() {
+		for {
+			key, _, quit := queue.Get()
+			if quit {
+				return
+			}
+			retried <- time.Since(start)
+			queue.Done(key)
+		}
+	}()
+	defer queue.ShutDown()
+	window := 500 * time.Millisecond
+	// The burst, the tokens refilled over the window, and one token of slack for the timers.
+	maxInWindow := burst + int(qps*window.Seconds()) + 1
+	inWindow := 0
+	for i := 0; i < failures; i++ {
+		select {
+		case elapsed := <-retried:
+			if elapsed <= window {
+				inWindow++
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("expected %d retries, got %d", failures, i)
+		}
+	}
+	if inWindow > maxInWindow {
+		t.Errorf("expected at most %d retries in the first %v, got %d", maxInWindow, window, inWindow)
+	}
+	if inWindow < burst {
+		t.Errorf("expected the burst of %d retries to run right away, got %d", burst, inWindow)
+	}
+	if elapsed := time.Since(start); elapsed < time.Duration(float64(failures-burst)/qps*float64(time.Second))-100*time.Millisecond {
+		t.Errorf("expected the %d retries to be spread at %d per second, they all ran in %v", failures, qps, elapsed)
+	}
+
+	if newRetryBudget(0, burst) != nil {
+		t.Errorf("expected no retry budget when its rate is 0")
+	}
+}
+
+// TestPodWatcher_BandwidthRequest checks the bandwidth annotations are parsed and forwarded to Firmament.
+func TestPodWatcher_BandwidthRequest(t *testing.T) {
+	var testData = []struct {
+		annotations map[string]string
+		expected    *BandwidthRequest
+	}{
+		{
+			annotations: nil,
+			expected:    nil,
+		},
+		{
+			annotations: map[string]string{
+				IngressBandwidthAnnotation: "10M",
+				EgressBandwidthAnnotation:  "1G",
+			},
+			expected: &BandwidthRequest{Ingress: 10000000, Egress: 1000000000},
+		},
+		{
+			annotations: map[string]string{
+				IngressBandwidthAnnotation: "8Mi",
+			},
+			expected: &BandwidthRequest{Ingress: 8 * 1024 * 1024},
+		},
+		{
+			annotations: map[string]string{
+				IngressBandwidthAnnotation: "fast",
+				EgressBandwidthAnnotation:  "100k",
+			},
+			expected: &BandwidthRequest{Egress: 100000},
+		},
+		{
+			annotations: map[string]string{
+				IngressBandwidthAnnotation: "-1M",
+				EgressBandwidthAnnotation:  "0",
+			},
+			expected: nil,
+		},
+	}
+	for i, data := range testData {
+		pod := &v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "pod",
+				Namespace:   "default",
+				Annotations: data.annotations,
+			},
+		}
+		bandwidth := getBandwidthRequest(pod)
+		if !reflect.DeepEqual(bandwidth, data.expected) {
+			t.Errorf("case %d: expected the bandwidth request %+v, got %+v", i, data.expected, bandwidth)
+		}
+	}
+
+	td := &firmament.TaskDescriptor{ResourceRequest: &firmament.ResourceVector{}}
+	setTaskBandwidthRequest(td, &Pod{BandwidthRequest: &BandwidthRequest{Ingress: 8 * 1024 * 1024, Egress: 16 * 1024}})
+	if td.ResourceRequest.NetRxBw != 1024 || td.ResourceRequest.NetTxBw != 2 {
+		t.Errorf("expected the task to request 1024 KB/s received and 2 KB/s transmitted, got %d and %d", td.ResourceRequest.NetRxBw, td.ResourceRequest.NetTxBw)
+	}
+	setTaskBandwidthRequest(td, &Pod{})
+	if td.ResourceRequest.NetRxBw != 0 || td.ResourceRequest.NetTxBw != 0 {
+		t.Errorf("expected the bandwidth request of the task to be cleared, got %d and %d", td.ResourceRequest.NetRxBw, td.ResourceRequest.NetTxBw)
+	}
+}
+
+// TestPodWatcher_PodPredicate checks that the pods failing the predicate get an event and aren't submitted.
+func TestPodWatcher_PodPredicate(t *testing.T) {
+	fakeNow := metav1.Now()
+	SetPodPredicate(func(pod *Pod) (bool, string) {
+		if _, ok := pod.Labels["cost-center"]; !ok {
+			return false, "the pod has no cost-center label"
+		}
+		return true, ""
+	})
+	defer SetPodPredicate(nil)
+
+	testObj := initializePodObj(t)
+	defer testObj.mockCtrl.Finish()
+	podWatch := NewPodWatcher(testObj.kubeVerMajor, testObj.kubeVerMinor, testObj.schedulerName, testObj.kubeClient, testObj.firmamentClient)
+
+	fakeRecorder := record.NewFakeRecorder(10)
+	poseidonEventsLock.Lock()
+	poseidonEvents = &PoseidonEvents{
+		podEvents: &PodEvents{Recorder: fakeRecorder},
+		k8sClient: testObj.kubeClient,
+	}
+	poseidonEventsLock.Unlock()
+	defer func() {
+		poseidonEventsLock.Lock()
+		poseidonEvents = nil
+		poseidonEventsLock.Unlock()
+	}()
+
+	accepted := BuildPod("Poseidon-Namespace", "Pod1", map[string]string{"cost-center": "research"}, GetPodPhase("Pending"), "1", "1024", &fakeNow, "abcdfe12345")
+	if _, ok := podWatch.convertAddedPod(accepted); !ok {
+		t.Errorf("expected pod %s with a cost-center label to be accepted", accepted.Name)
+	}
+
+	rejected := BuildPod("Poseidon-Namespace", "Pod2", map[string]string{"app": "web"}, GetPodPhase("Pending"), "1", "1024", &fakeNow, "abcdfe12345")
+	podWatch.enqueuePodAddition(GetKey(rejected, t), rejected)
+	select {
+	case event := <-fakeRecorder.Events:
+		if !strings.Contains(event, "FailedScheduling") || !strings.Contains(event, "the pod has no cost-center label") {
+			t.Errorf("unexpected event %q", event)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the FailedScheduling event")
+	}
+	if _, ok := podWatch.podWorkQueue.(*Type).items[GetKey(rejected, t)]; ok {
+		t.Errorf("expected the pod %s not to be enqueued", rejected.Name)
+	}
+}
+
+// TestPodWatcher_ReadinessGates checks a Running pod with an unsatisfied readiness gate isn't ready,
+// and that the task is updated once the gate is satisfied.
+func TestPodWatcher_ReadinessGates(t *testing.T) {
+	var empty map[string]string
+	fakeNow := metav1.Now()
+	pod := BuildPod("Poseidon-Namespace", "Pod1", empty, GetPodPhase("Pending"), "1", "1024", &fakeNow, "abcdfe12345")
+	pod.Spec.ReadinessGates = []v1.PodReadinessGate{{ConditionType: "example.com/load-balancer"}}
+	runningPod := pod.DeepCopy()
+	runningPod.Status.Phase = v1.PodRunning
+	runningPod.Status.Conditions = []v1.PodCondition{
+		{Type: v1.ContainersReady, Status: v1.ConditionTrue},
+		{Type: v1.PodReady, Status: v1.ConditionTrue},
+		{Type: "example.com/load-balancer", Status: v1.ConditionFalse},
+	}
+	readyPod := runningPod.DeepCopy()
+	readyPod.Status.Conditions[2].Status = v1.ConditionTrue
+
+	testObj := initializePodObj(t)
+	defer testObj.mockCtrl.Finish()
+	podWatch := NewPodWatcher(testObj.kubeVerMajor, testObj.kubeVerMinor, testObj.schedulerName, testObj.kubeClient, testObj.firmamentClient)
+	if podWatch.parsePod(runningPod).IsReady {
+		t.Errorf("expected the Running pod with an unsatisfied readiness gate not to be ready")
+	}
+	if !podWatch.parsePod(readyPod).IsReady {
+		t.Errorf("expected the pod with a satisfied readiness gate to be ready")
+	}
+
+	readiness := make(chan string, 2)
+	readyLabel := func(td *firmament.TaskDescription) string {
+		for _, label := range td.TaskDescriptor.Labels {
+			if label.Key == ReadyLabel {
+				return label.Value
+			}
+		}
+		return ""
+	}
+	gomock.InOrder(
+		testObj.firmamentClient.EXPECT().TaskSubmitted(gomock.Any(), gomock.Any()).Do(func(_ interface{}, td *firmament.TaskDescription) {
+			readiness <- readyLabel(td)
+		}).Return(&firmament.TaskSubmittedResponse{Type: firmament.TaskReplyType_TASK_SUBMITTED_OK}, nil),
+		testObj.firmamentClient.EXPECT().TaskUpdated(gomock.Any(), gomock.Any()).Do(func(_ interface{}, td *firmament.TaskDescription) {
+			readiness <- readyLabel(td)
+		}).Return(&firmament.TaskUpdatedResponse{Type: firmament.TaskReplyType_TASK_UPDATED_OK}, nil),
+	)
+	go podWatch.podWorker()
+
+	podWatch.enqueuePodAddition(GetKey(pod, t), pod)
+	// Only the readiness gate changed, the task is updated anyway.
+	podWatch.enqueuePodUpdate(GetKey(readyPod, t), runningPod, readyPod)
+	for _, expected := range []string{"", "true"} {
+		select {
+		case isReady := <-readiness:
+			if isReady != expected {
+				t.Errorf("expected the task readiness label to be %q, got %q", expected, isReady)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for the task with readiness %v", expected)
+		}
+	}
+	podWatch.podWorkQueue.ShutDown()
+}
+
+// TestPodWatcher_ResubmitEndpoint checks a POST to the resubmit endpoint re-enqueues a submitted pod,
+// whose task is updated, and that an unknown pod is a 404.
+func TestPodWatcher_ResubmitEndpoint(t *testing.T) {
+	var empty map[string]string
+	fakeNow := metav1.Now()
+	pod := BuildPod("Poseidon-Namespace", "Pod1", empty, GetPodPhase("Pending"), "1", "1024", &fakeNow, "abcdfe12345")
+
+	testObj := initializePodObj(t)
+	defer testObj.mockCtrl.Finish()
+	podWatch := NewPodWatcher(testObj.kubeVerMajor, testObj.kubeVerMinor, testObj.schedulerName, testObj.kubeClient, testObj.firmamentClient)
+	setPodResubmitter(podWatch.resubmitPod)
+	defer setPodResubmitter(nil)
+	defer func() {
+		PodToK8sPodLock.Lock()
+		PodToK8sPod = make(map[PodIdentifier]*v1.Pod)
+		PodToK8sPodLock.Unlock()
+	}()
+
+	calls := make(chan string, 2)
+	gomock.InOrder(
+		testObj.firmamentClient.EXPECT().TaskSubmitted(gomock.Any(), gomock.Any()).Do(func(_ interface{}, td *firmament.TaskDescription) {
+			calls <- "TaskSubmitted"
+		}).Return(&firmament.TaskSubmittedResponse{Type: firmament.TaskReplyType_TASK_SUBMITTED_OK}, nil),
+		testObj.firmamentClient.EXPECT().TaskUpdated(gomock.Any(), gomock.Any()).Do(func(_ interface{}, td *firmament.TaskDescription) {
+			calls <- "TaskUpdated"
+		}).Return(&firmament.TaskUpdatedResponse{Type: firmament.TaskReplyType_TASK_UPDATED_OK}, nil),
+	)
+	go podWatch.podWorker()
+	defer podWatch.podWorkQueue.ShutDown()
+
+	server := httptest.NewServer(NewPodResubmitHandler())
+	defer server.Close()
+	podWatch.enqueuePodAddition(GetKey(pod, t), pod)
+	for _, expected := range []string{"TaskSubmitted", "TaskUpdated"} {
+		select {
+		case call := <-calls:
+			if call != expected {
+				t.Errorf("expected a %s call, got %s", expected, call)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for the %s call", expected)
+		}
+		if expected == "TaskSubmitted" {
+			resp, err := http.Post(server.URL+PathAdminResubmit+"Poseidon-Namespace/Pod1", "", nil)
+			if err != nil {
+				t.Fatalf("resubmit request failed: %v", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusAccepted {
+				t.Errorf("expected status %d, got %d", http.StatusAccepted, resp.StatusCode)
+			}
+		}
+	}
+
+	for path, status := range map[string]int{
+		"Poseidon-Namespace/Unknown": http.StatusNotFound,
+		"Poseidon-Namespace":         http.StatusBadRequest,
+	} {
+		resp, err := http.Post(server.URL+PathAdminResubmit+path, "", nil)
+		if err != nil {
+			t.Fatalf("resubmit request failed: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != status {
+			t.Errorf("%s: expected status %d, got %d", path, status, resp.StatusCode)
+		}
+	}
+	resp, err := http.Get(server.URL + PathAdminResubmit + "Poseidon-Namespace/Pod1")
+	if err != nil {
+		t.Fatalf("resubmit request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("expected status %d for a GET, got %d", http.StatusMethodNotAllowed, resp.StatusCode)
+	}
+}
+
+// TestPodWatcher_ServiceAccount checks the service account of the pod is carried through the conversion.
+func TestPodWatcher_ServiceAccount(t *testing.T) {
+	var empty map[string]string
+	fakeNow := metav1.Now()
+	pod := BuildPod("Poseidon-Namespace", "Pod1", empty, GetPodPhase("Pending"), "1", "1024", &fakeNow, "abcdfe12345")
+	pod.Spec.ServiceAccountName = "billing"
+	defaultPod := BuildPod("Poseidon-Namespace", "Pod2", empty, GetPodPhase("Pending"), "1", "1024", &fakeNow, "abcdfe12345")
+
+	testObj := initializePodObj(t)
+	defer testObj.mockCtrl.Finish()
+	podWatch := NewPodWatcher(testObj.kubeVerMajor, testObj.kubeVerMinor, testObj.schedulerName, testObj.kubeClient, testObj.firmamentClient)
+	for k8sPod, expected := range map[*v1.Pod]string{pod: "billing", defaultPod: "default"} {
+		convertedPod := podWatch.parsePod(k8sPod)
+		if convertedPod.ServiceAccount != expected {
+			t.Errorf("pod %s: expected the service account %q, got %q", k8sPod.Name, expected, convertedPod.ServiceAccount)
+		}
+		td := podWatch.addTaskToJob(convertedPod, "jobUID", "jobName", 0)
+		found := false
+		for _, label := range td.Labels {
+			if label.Key == ServiceAccountLabel && label.Value == expected {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("pod %s: expected the %s=%s label in the task labels %v", k8sPod.Name, ServiceAccountLabel, expected, td.Labels)
+		}
+	}
+}
+
+// TestPodWatcher_CrashLoopThrottling checks the updates of a crash-looping pod are throttled, and that
+// the update of the recovered pod goes through.
+func TestPodWatcher_CrashLoopThrottling(t *testing.T) {
+	var empty map[string]string
+	fakeNow := metav1.Now()
+	pod := BuildPod("Poseidon-Namespace", "Pod1", empty, GetPodPhase("Running"), "1", "1024", &fakeNow, "abcdfe12345")
+
+	testObj := initializePodObj(t)
+	defer testObj.mockCtrl.Finish()
+	podWatch := NewPodWatcher(testObj.kubeVerMajor, testObj.kubeVerMinor, testObj.schedulerName, testObj.kubeClient, testObj.firmamentClient)
+	podWatch.crashLoopUpdateInterval = time.Hour
+	key := GetKey(pod, t)
+	numUpdates := func() int {
+		updates := 0
+		for _, item := range podWatch.podWorkQueue.(*Type).items[key] {
+			if item.(*Pod).State == PodUpdated {
+				updates++
+			}
+		}
+		return updates
+	}
+
+	// The pod restarts 10 times, each restart is an update.
+	oldPod := pod
+	for restarts := int32(1); restarts <= 10; restarts++ {
+		newPod := oldPod.DeepCopy()
+		newPod.Status.ContainerStatuses = []v1.ContainerStatus{{
+			Name:         "app",
+			RestartCount: restarts,
+			State: v1.ContainerState{
+				Waiting: &v1.ContainerStateWaiting{Reason: "CrashLoopBackOff"},
+			},
+		}}
+		podWatch.enqueuePodUpdate(key, oldPod, newPod)
+		oldPod = newPod
+	}
+	if updates := numUpdates(); updates != 1 {
+		t.Errorf("expected a single update of the crash-looping pod within the interval, got %d", updates)
+	}
+
+	recoveredPod := oldPod.DeepCopy()
+	recoveredPod.Status.ContainerStatuses[0].State = v1.ContainerState{Running: &v1.ContainerStateRunning{}}
+	recoveredPod.Status.Conditions = []v1.PodCondition{{Type: v1.PodReady, Status: v1.ConditionTrue}}
+	podWatch.enqueuePodUpdate(key, oldPod, recoveredPod)
+	if updates := numUpdates(); updates != 2 {
+		t.Errorf("expected the update of the recovered pod to go through, got %d updates", updates)
+	}
+
+	// Without an interval, all the updates go through.
+	podWatch.crashLoopUpdateInterval = 0
+	podWatch.enqueuePodUpdate(key, recoveredPod, oldPod)
+	podWatch.enqueuePodUpdate(key, oldPod, recoveredPod)
+	if updates := numUpdates(); updates != 4 {
+		t.Errorf("expected all the updates to go through without an interval, got %d updates", updates)
+	}
+}
+
+// TestPodWatcher_CrashLoopTrailingUpdate checks the updates of a crash-looping pod held within the
+// interval are coalesced, and that the latest one is sent once the interval expires.
+func TestPodWatcher_CrashLoopTrailingUpdate(t *testing.T) {
+	var empty map[string]string
+	fakeNow := metav1.Now()
+	pod := BuildPod("Poseidon-Namespace", "CrashLoopTrailing", empty, GetPodPhase("Running"), "1", "1024", &fakeNow, "abcdfe12345")
+
+	testObj := initializePodObj(t)
+	defer testObj.mockCtrl.Finish()
+	podWatch := NewPodWatcher(testObj.kubeVerMajor, testObj.kubeVerMinor, testObj.schedulerName, testObj.kubeClient, testObj.firmamentClient)
+	podWatch.crashLoopUpdateInterval = 100 * time.Millisecond
+	key := GetKey(pod, t)
+	updates := func() []*Pod {
+		var pods []*Pod
+		for _, item := range podWatch.podWorkQueue.(*Type).items[key] {
+			if item.(*Pod).State == PodUpdated {
+				pods = append(pods, item.(*Pod))
+			}
+		}
+		return pods
+	}
+
+	oldPod := pod
+	for restarts := int32(1); restarts <= 5; restarts++ {
+		newPod := oldPod.DeepCopy()
+		newPod.Status.ContainerStatuses = []v1.ContainerStatus{{
+			Name:         "app",
+			RestartCount: restarts,
+			State: v1.ContainerState{
+				Waiting: &v1.ContainerStateWaiting{Reason: "CrashLoopBackOff"},
+			},
+		}}
+		podWatch.enqueuePodUpdate(key, oldPod, newPod)
+		oldPod = newPod
+	}
+	if got := updates(); len(got) != 1 || got[0].RestartCount != 1 {
+		t.Fatalf("expected only the first update of the crash-looping pod within the interval, got %v", got)
+	}
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline) && len(updates()) < 2; time.Sleep(10 * time.Millisecond) {
+	}
+	if len(updates()) != 2 {
+		t.Fatalf("expected the held update to be sent once the interval expired")
+	}
+	if got := updates(); got[1].RestartCount != 5 {
+		t.Errorf("expected the latest held update to be sent, got restart count %d", got[1].RestartCount)
+	}
+
+	// A deleted pod's held update is dropped.
+	newPod := oldPod.DeepCopy()
+	newPod.Status.ContainerStatuses[0].RestartCount = 6
+	podWatch.enqueuePodUpdate(key, oldPod, newPod)
+	podWatch.forgetCrashLoop(NewPodIdentifier(pod.Namespace, pod.Name))
+	time.Sleep(2 * podWatch.crashLoopUpdateInterval)
+	if got := updates(); len(got) != 2 {
+		t.Errorf("expected the held update of the deleted pod to be dropped, got %d updates", len(got))
+	}
+}
+
+// TestPodWatcher_WorkQueueVars checks the statistics of the pod queue published via expvar after a pod
+// is processed, and that they're consistent with the Prometheus metrics.
+func TestPodWatcher_WorkQueueVars(t *testing.T) {
+	var empty map[string]string
+	fakeNow := metav1.Now()
+	pod := BuildPod("Poseidon-Namespace", "Pod1", empty, GetPodPhase("Pending"), "1", "1024", &fakeNow, "abcdfe12345")
+	queueVars := func() map[string]int64 {
+		vars := make(map[string]map[string]int64)
+		if err := json.Unmarshal([]byte(expvar.Get("poseidon_work_queues").String()), &vars); err != nil {
+			t.Fatalf("failed to decode the expvar work queues: %v", err)
+		}
+		return vars["pods"]
+	}
+	processedMetric := func() int64 {
+		m := &dto.Metric{}
+		if err := metrics.WorkQueueProcessed.WithLabelValues("pods").Write(m); err != nil {
+			t.Fatalf("failed to read the processed metric: %v", err)
+		}
+		return int64(m.GetCounter().GetValue())
+	}
+
+	testObj := initializePodObj(t)
+	defer testObj.mockCtrl.Finish()
+	podWatch := NewPodWatcher(testObj.kubeVerMajor, testObj.kubeVerMinor, testObj.schedulerName, testObj.kubeClient, testObj.firmamentClient)
+	before := queueVars()
+	metricBefore := processedMetric()
+
+	podWatch.enqueuePodAddition(GetKey(pod, t), pod)
+	if depth := queueVars()["depth"]; depth != 1 {
+		t.Errorf("expected a queue depth of 1 before the pod is processed, got %d", depth)
+	}
+	submitted := make(chan struct{})
+	testObj.firmamentClient.EXPECT().TaskSubmitted(gomock.Any(), gomock.Any()).Do(func(_ interface{}, _ *firmament.TaskDescription) {
+		close(submitted)
+	}).Return(&firmament.TaskSubmittedResponse{Type: firmament.TaskReplyType_TASK_SUBMITTED_OK}, nil)
+	go podWatch.podWorker()
+	defer podWatch.podWorkQueue.ShutDown()
+	select {
+	case <-submitted:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the pod to be processed")
+	}
+
+	after := queueVars()
+	if after["depth"] != 0 {
+		t.Errorf("expected an empty queue once the pod is processed, got a depth of %d", after["depth"])
+	}
+	if processed := after["processed"] - before["processed"]; processed != 1 {
+		t.Errorf("expected 1 processed item, got %d", processed)
+	}
+	if errors := after["errors"] - before["errors"]; errors != 0 {
+		t.Errorf("expected no error, got %d", errors)
+	}
+	if processed := processedMetric() - metricBefore; processed != 1 {
+		t.Errorf("expected the Prometheus metric to count 1 processed item too, got %d", processed)
+	}
+}
+
+// TestPodWatcher_UnknownPodPhase checks an unexpected or empty phase is converted to PodUnknown, and that
+// such a pod isn't submitted to Firmament.
+func TestPodWatcher_UnknownPodPhase(t *testing.T) {
+	var empty map[string]string
+	fakeNow := metav1.Now()
+	testObj := initializePodObj(t)
+	defer testObj.mockCtrl.Finish()
+	podWatch := NewPodWatcher(testObj.kubeVerMajor, testObj.kubeVerMinor, testObj.schedulerName, testObj.kubeClient, testObj.firmamentClient)
+
+	for _, phase := range []v1.PodPhase{"Hibernating", "", v1.PodUnknown, GetPodPhase("Unexpected")} {
+		pod := BuildPod("Poseidon-Namespace", "Pod1", empty, phase, "1", "1024", &fakeNow, "abcdfe12345")
+		if state := podWatch.parsePod(pod).State; state != PodUnknown {
+			t.Errorf("phase %q: expected the state %s, got %s", phase, PodUnknown, state)
+		}
+	}
+
+	// The mock fails on any call to Firmament.
+	pod := BuildPod("Poseidon-Namespace", "Pod2", empty, v1.PodPhase("Hibernating"), "1", "1024", &fakeNow, "abcdfe12345")
+	podWatch.enqueuePodAddition(GetKey(pod, t), pod)
+	key, items, _ := podWatch.podWorkQueue.Get()
+	if len(items) != 1 || items[0].(*Pod).State != PodUnknown {
+		t.Fatalf("expected the pod to be enqueued as %s, got %v", PodUnknown, items)
+	}
+	podWatch.podWorkQueue.Add(key, items[0])
+	podWatch.podWorkQueue.Done(key)
+	go podWatch.podWorker()
+	deadline := time.Now().Add(5 * time.Second)
+	for podWatch.podWorkQueue.Len() > 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	podWatch.podWorkQueue.ShutDown()
+	PodMux.RLock()
+	defer PodMux.RUnlock()
+	if _, ok := PodToTD[PodIdentifier{Name: pod.Name, Namespace: pod.Namespace}]; ok {
+		t.Errorf("expected the pod in an unknown phase not to be submitted")
+	}
+}
+
+// TestPodWatcher_PreferredNodeAnnotation checks the preferred node annotation is translated into a
+// preferred node affinity term of the highest weight, next to the preferred terms of the pod.
+func TestPodWatcher_PreferredNodeAnnotation(t *testing.T) {
+	var empty map[string]string
+	fakeNow := metav1.Now()
+	testObj := initializePodObj(t)
+	defer testObj.mockCtrl.Finish()
+	podWatch := NewPodWatcher(testObj.kubeVerMajor, testObj.kubeVerMinor, testObj.schedulerName, testObj.kubeClient, testObj.firmamentClient)
+
+	pod := BuildPod("Poseidon-Namespace", "Pod1", empty, GetPodPhase("Pending"), "1", "1024", &fakeNow, "abcdfe12345")
+	pod.Annotations = map[string]string{PreferredNodeAnnotation: "node1"}
+	pod.Spec.Affinity = &v1.Affinity{
+		NodeAffinity: &v1.NodeAffinity{
+			PreferredDuringSchedulingIgnoredDuringExecution: []v1.PreferredSchedulingTerm{
+				{
+					Weight: 10,
+					Preference: v1.NodeSelectorTerm{
+						MatchExpressions: []v1.NodeSelectorRequirement{
+							{Key: "example.com/rack", Operator: v1.NodeSelectorOpIn, Values: []string{"rack1"}},
+						},
+					},
+				},
+			},
+		},
+	}
+	expected := []PreferredSchedulingTerm{
+		{
+			Weight: 10,
+			Preference: NodeSelectorTerm{
+				MatchExpressions: []NodeSelectorRequirement{
+					{Key: "example.com/rack", Operator: "In", Values: []string{"rack1"}},
+				},
+			},
+		},
+		{
+			Weight: maxAffinityWeight,
+			Preference: NodeSelectorTerm{
+				MatchExpressions: []NodeSelectorRequirement{
+					{Key: LabelHostname, Operator: "In", Values: []string{"node1"}},
+				},
+			},
+		},
+	}
+	parsedPod := podWatch.parsePod(pod)
+	if !reflect.DeepEqual(parsedPod.Affinity.NodeAffinity.SoftScheduling, expected) {
+		t.Fatalf("expected the preferred terms %+v, got %+v", expected, parsedPod.Affinity.NodeAffinity.SoftScheduling)
+	}
+	firmamentTerms := podWatch.getFirmamentPreferredSchedulingTerm(parsedPod)
+	if len(firmamentTerms) != 2 || firmamentTerms[1].Weight != maxAffinityWeight ||
+		firmamentTerms[1].Preference.MatchExpressions[0].Values[0] != "node1" {
+		t.Errorf("expected the preferred node term to be sent to Firmament, got %v", firmamentTerms)
+	}
+
+	// Without the annotation, only the terms of the pod are kept.
+	pod.Annotations = nil
+	if terms := podWatch.parsePod(pod).Affinity.NodeAffinity.SoftScheduling; len(terms) != 1 {
+		t.Errorf("expected a single preferred term without the annotation, got %+v", terms)
+	}
+
+	// A pod without affinity gets the preferred node term alone.
+	pod.Annotations = map[string]string{PreferredNodeAnnotation: "node1"}
+	pod.Spec.Affinity = nil
+	if terms := podWatch.parsePod(pod).Affinity.NodeAffinity.SoftScheduling; !reflect.DeepEqual(terms, expected[1:]) {
+		t.Errorf("expected the preferred node term %+v for a pod without affinity, got %+v", expected[1:], terms)
+	}
+}
+
+// TestPodWatcher_TombstoneDeletion checks the deletion of a pod missed by the watch is queued under
+// the key of the pod, though its last known state has no DeletionTimestamp.
+func TestPodWatcher_TombstoneDeletion(t *testing.T) {
+	var empty map[string]string
+	testObj := initializePodObj(t)
+	defer testObj.mockCtrl.Finish()
+	podWatch := NewPodWatcher(testObj.kubeVerMajor, testObj.kubeVerMinor, testObj.schedulerName, testObj.kubeClient, testObj.firmamentClient)
+
+	pod := BuildPod("Poseidon-Namespace", "Pod1", empty, GetPodPhase("Running"), "1", "1024", nil, "abcdfe12345")
+	tombstone := cache.DeletedFinalStateUnknown{Key: "Poseidon-Namespace/Pod1", Obj: pod}
+	key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(tombstone)
+	if err != nil || key != "Poseidon-Namespace/Pod1" {
+		t.Fatalf("expected the key of the pod, got %q: %v", key, err)
+	}
+	podWatch.enqueuePodDeletion(key, tombstone)
+	if podWatch.podWorkQueue.Len() != 1 {
+		t.Fatalf("expected the deletion to be queued, %d queued", podWatch.podWorkQueue.Len())
+	}
+	queuedKey, items, _ := podWatch.podWorkQueue.Get()
+	defer podWatch.podWorkQueue.Done(queuedKey)
+	if queuedKey != key || len(items) != 1 || items[0].(*Pod).State != PodDeleted {
+		t.Errorf("expected the deletion of the pod under %q, got %v under %q", key, items, queuedKey)
+	}
+}
+
+// TestPodWatcher_CompletedPodDeletion checks the deletion of a completed pod, e.g. the pod of a Job
+// garbage-collected once it succeeded, doesn't report its task removed after it was reported completed.
+func TestPodWatcher_CompletedPodDeletion(t *testing.T) {
+	var empty map[string]string
+	fakeNow := metav1.Now()
+	testObj := initializePodObj(t)
+	defer testObj.mockCtrl.Finish()
+	podWatch := NewPodWatcher(testObj.kubeVerMajor, testObj.kubeVerMinor, testObj.schedulerName, testObj.kubeClient, testObj.firmamentClient)
+
+	pod := BuildPod("Poseidon-Namespace", "Pod1", empty, GetPodPhase("Pending"), "1", "1024", &fakeNow, "abcdfe12345")
+	key := GetKey(pod, t)
+	podWatch.enqueuePodAddition(key, pod)
+	succeededPod := ChangePodPhase(pod, "Succeeded")
+	podWatch.enqueuePodUpdate(key, pod, succeededPod)
+	podWatch.enqueuePodDeletion(key, succeededPod)
+
+	completed := make(chan struct{})
+	gomock.InOrder(
+		testObj.firmamentClient.EXPECT().TaskSubmitted(gomock.Any(), gomock.Any()).Return(
+			&firmament.TaskSubmittedResponse{Type: firmament.TaskReplyType_TASK_SUBMITTED_OK}, nil),
+		testObj.firmamentClient.EXPECT().TaskCompleted(gomock.Any(), gomock.Any()).Do(func(interface{}, interface{}) {
+			close(completed)
+		}).Return(&firmament.TaskCompletedResponse{Type: firmament.TaskReplyType_TASK_COMPLETED_OK}, nil),
+	)
+	// The mock fails on a TaskRemoved call.
+	go podWatch.podWorker()
+	select {
+	case <-completed:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected the task of the pod to be completed")
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		PodMux.RLock()
+		_, ok := PodToTD[PodIdentifier{Name: pod.Name, Namespace: pod.Namespace}]
+		PodMux.RUnlock()
+		if !ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the completed pod to be forgotten once deleted")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	podWatch.podWorkQueue.ShutDown()
+	PodMux.RLock()
+	defer PodMux.RUnlock()
+	if _, ok := completedPods[PodIdentifier{Name: pod.Name, Namespace: pod.Namespace}]; ok {
+		t.Errorf("expected the deleted pod to be forgotten as completed")
+	}
+}
+
+// TestPodWatcher_EphemeralStorage checks the ephemeral storage requested by a pod is matched against
+// the allocatable ephemeral storage of the nodes.
+func TestPodWatcher_EphemeralStorage(t *testing.T) {
+	var empty map[string]string
+	fakeNow := metav1.Now()
+	testObj := initializePodObj(t)
+	defer testObj.mockCtrl.Finish()
+	podWatch := NewPodWatcher(testObj.kubeVerMajor, testObj.kubeVerMinor, testObj.schedulerName, testObj.kubeClient, testObj.firmamentClient)
+	nodeWatch := NewNodeWatcher(testObj.kubeClient, testObj.firmamentClient)
+	resetNodes()
+
+	pod := BuildPod("Poseidon-Namespace", "Pod1", empty, GetPodPhase("Pending"), "1", "1024", &fakeNow, "abcdfe12345")
+	pod.Spec.Containers[0].Resources.Requests[v1.ResourceEphemeralStorage] = resource.MustParse("5Gi")
+	parsedPod := podWatch.parsePod(pod)
+	expectedKb := int64(5 * 1024 * 1024)
+	if parsedPod.EphemeralReqKb != expectedKb {
+		t.Fatalf("expected an ephemeral storage request of %d KB, got %d", expectedKb, parsedPod.EphemeralReqKb)
+	}
+	td := podWatch.addTaskToJob(parsedPod, "jobUID", "jobName", 0)
+	if td.ResourceRequest.EphemeralCap != uint64(expectedKb) {
+		t.Errorf("expected the task to request %d KB of ephemeral storage, got %d", expectedKb, td.ResourceRequest.EphemeralCap)
+	}
+
+	var testData = []struct {
+		nodeName  string
+		ephemeral string
+		exceeds   bool
+	}{
+		// The pod doesn't fit on the only node, nor on a node of the exact size minus one byte.
+		{nodeName: "small", ephemeral: "2Gi", exceeds: true},
+		{nodeName: "almost", ephemeral: "5368709119", exceeds: true},
+		{nodeName: "large", ephemeral: "10Gi", exceeds: false},
+	}
+	for _, data := range testData {
+		node := BuildNode(data.nodeName, "8", "16Gi", nil, nil, false)
+		node.Status.Allocatable = v1.ResourceList{
+			v1.ResourceCPU:              resource.MustParse("8"),
+			v1.ResourceMemory:           resource.MustParse("16Gi"),
+			v1.ResourceEphemeralStorage: resource.MustParse(data.ephemeral),
+		}
+		NodeMux.Lock()
+		NodeToRTND[data.nodeName] = nodeWatch.createResourceTopologyForNode(nodeWatch.parseNode(node, NodeAdded))
+		NodeMux.Unlock()
+		if exceeds := podWatch.exceedsNodeCapacities(parsedPod); exceeds != data.exceeds {
+			t.Errorf("node of %s ephemeral storage: expected the pod to exceed the node capacities %v, got %v", data.ephemeral, data.exceeds, exceeds)
+		}
+	}
+
+	// A change of the request is sent to Firmament.
+	pod.Spec.Containers[0].Resources.Requests[v1.ResourceEphemeralStorage] = resource.MustParse("1Gi")
+	podWatch.updateTask(podWatch.parsePod(pod), td)
+	if td.ResourceRequest.EphemeralCap != 1024*1024 {
+		t.Errorf("expected the task to request %d KB of ephemeral storage once updated, got %d", 1024*1024, td.ResourceRequest.EphemeralCap)
+	}
+}
+
+// TestPodWatcher_PendingPodsReport checks the age of the oldest pending pod grows while the pod isn't
+// placed, and that a pod pending past the starvation threshold is counted once.
+func TestPodWatcher_PendingPodsReport(t *testing.T) {
+	var empty map[string]string
+	testObj := initializePodObj(t)
+	defer testObj.mockCtrl.Finish()
+	podWatch := NewPodWatcher(testObj.kubeVerMajor, testObj.kubeVerMinor, testObj.schedulerName, testObj.kubeClient, testObj.firmamentClient)
+	podWatch.starvationThreshold = 20 * time.Second
+
+	created := metav1.NewTime(time.Now().Add(-30 * time.Second))
+	pod := BuildPod("Poseidon-Namespace", "Pod1", empty, GetPodPhase("Pending"), "1", "1024", &created, "abcdfe12345")
+	pod.CreationTimestamp = created
+	identifier := PodIdentifier{Name: pod.Name, Namespace: pod.Namespace}
+	PodToK8sPodLock.Lock()
+	PodToK8sPod[identifier] = pod
+	PodToK8sPodLock.Unlock()
+	defer func() {
+		PodToK8sPodLock.Lock()
+		delete(PodToK8sPod, identifier)
+		PodToK8sPodLock.Unlock()
+	}()
+
+	oldestAge := func() float64 {
+		m := &dto.Metric{}
+		if err := metrics.OldestPendingPodAge.Write(m); err != nil {
+			t.Fatalf("failed to read the oldest pending pod age: %v", err)
+		}
+		return m.GetGauge().GetValue()
+	}
+	starved := func() float64 {
+		m := &dto.Metric{}
+		if err := metrics.StarvedPods.Write(m); err != nil {
+			t.Fatalf("failed to read the starved pods: %v", err)
+		}
+		return m.GetCounter().GetValue()
+	}
+	starvedBefore := starved()
+
+	podWatch.reportPendingPods()
+	firstAge := oldestAge()
+	if firstAge < 30 {
+		t.Errorf("expected the oldest pending pod to be at least 30s old, got %vs", firstAge)
+	}
+	time.Sleep(100 * time.Millisecond)
+	podWatch.reportPendingPods()
+	if age := oldestAge(); age <= firstAge {
+		t.Errorf("expected the oldest pending pod age to grow from %vs, got %vs", firstAge, age)
+	}
+	if count := starved() - starvedBefore; count != 1 {
+		t.Errorf("expected the starved pod to be counted once, got %v", count)
+	}
+
+	// Once placed, the pod isn't pending anymore.
+	PodMux.Lock()
+	podToNode[identifier] = "Node1"
+	PodMux.Unlock()
+	defer func() {
+		PodMux.Lock()
+		delete(podToNode, identifier)
+		PodMux.Unlock()
+	}()
+	podWatch.reportPendingPods()
+	if age := oldestAge(); age != 0 {
+		t.Errorf("expected no pending pod once the pod is placed, got the age %vs", age)
+	}
+}
+
+// TestPodWatcher_JobPodFailure checks the failure of a Job pod the Job retries withdraws its task,
+// while the failure of a pod of a Job out of retries is reported.
+func TestPodWatcher_JobPodFailure(t *testing.T) {
+	var empty map[string]string
+	fakeNow := metav1.Now()
+	isController := true
+	backoffLimit := int32(3)
+
+	var testData = []struct {
+		description string
+		failed      int32
+		jobFailed   bool
+		withdraw    bool
+		expected    PodPhase
+	}{
+		{description: "under the backoff limit", failed: 1, withdraw: true, expected: PodDeleted},
+		{description: "reaching the backoff limit", failed: 3, withdraw: true, expected: PodFailed},
+		{description: "over the backoff limit", failed: 4, withdraw: true, expected: PodFailed},
+		{description: "failed Job", failed: 1, jobFailed: true, withdraw: true, expected: PodFailed},
+		{description: "option disabled", failed: 1, withdraw: false, expected: PodFailed},
+	}
+	for _, data := range testData {
+		job := &batchv1.Job{
+			ObjectMeta: metav1.ObjectMeta{Name: "job1", Namespace: "Poseidon-Namespace", UID: "job1-uid"},
+			Spec:       batchv1.JobSpec{BackoffLimit: &backoffLimit},
+			Status:     batchv1.JobStatus{Failed: data.failed},
+		}
+		if data.jobFailed {
+			job.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobFailed, Status: v1.ConditionTrue}}
+		}
+		testObj := initializePodObj(t)
+		podWatch := NewPodWatcher(testObj.kubeVerMajor, testObj.kubeVerMinor, testObj.schedulerName, testObj.kubeClient, testObj.firmamentClient)
+		podWatch.withdrawJobRetries = data.withdraw
+		// The Job is read from the informer cache, not from the API server.
+		podWatch.owners.stores["Job"].Add(job)
+
+		pod := BuildPod("Poseidon-Namespace", "Pod1", empty, GetPodPhase("Running"), "1", "1024", &fakeNow, "abcdfe12345")
+		pod.OwnerReferences = []metav1.OwnerReference{
+			{Kind: "Job", Name: "job1", UID: "job1-uid", Controller: &isController},
+		}
+		podWatch.enqueuePodUpdate(GetKey(pod, t), pod, ChangePodPhase(pod, "Failed"))
+		_, items, _ := podWatch.podWorkQueue.Get()
+		if len(items) != 1 {
+			t.Fatalf("%s: expected a single item, got %v", data.description, items)
+		}
+		if state := items[0].(*Pod).State; state != data.expected {
+			t.Errorf("%s: expected the failed pod to be enqueued as %s, got %s", data.description, data.expected, state)
+		}
+		podWatch.podWorkQueue.ShutDown()
+		testObj.mockCtrl.Finish()
+	}
+}
+
+// TestPodWatcher_MaxInFlightPerOwner checks the pods of an owner are submitted at most
+// maxInFlightPerOwner at a time, the next ones being submitted as the previous ones are placed.
+func TestPodWatcher_MaxInFlightPerOwner(t *testing.T) {
+	const numPods = 100
+	const maxInFlight = 10
+	fakeNow := metav1.Now()
+	testObj := initializePodObj(t)
+	defer testObj.mockCtrl.Finish()
+	podWatch := NewPodWatcher(testObj.kubeVerMajor, testObj.kubeVerMinor, testObj.schedulerName, testObj.kubeClient, testObj.firmamentClient)
+	podWatch.maxInFlightPerOwner = maxInFlight
+	setPodPlacedHandler(podWatch.releaseInFlightPod)
+	defer setPodPlacedHandler(nil)
+
+	var submitted int32
+	testObj.firmamentClient.EXPECT().TaskSubmitted(gomock.Any(), gomock.Any()).Do(func(interface{}, interface{}) {
+		atomic.AddInt32(&submitted, 1)
+	}).Return(&firmament.TaskSubmittedResponse{Type: firmament.TaskReplyType_TASK_SUBMITTED_OK}, nil).Times(numPods)
+
+	labels := map[string]string{"controller-uid": "job-uid"}
+	for i := 0; i < numPods; i++ {
+		pod := BuildPod("Poseidon-Namespace", fmt.Sprintf("Pod%d", i), labels, GetPodPhase("Pending"), "1", "1024", &fakeNow, fmt.Sprintf("uid%d", i))
+		podWatch.enqueuePodAddition(GetKey(pod, t), pod)
+	}
+	go podWatch.podWorker()
+	defer podWatch.podWorkQueue.ShutDown()
+
+	waitForSubmissions := func(expected int32) {
+		deadline := time.Now().Add(5 * time.Second)
+		for atomic.LoadInt32(&submitted) < expected {
+			if time.Now().After(deadline) {
+				t.Fatalf("expected %d pods to be submitted, got %d", expected, atomic.LoadInt32(&submitted))
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		// Give the workers the time to submit more pods than allowed.
+		time.Sleep(50 * time.Millisecond)
+		if got := atomic.LoadInt32(&submitted); got != expected {
+			t.Fatalf("expected %d pods to be submitted, got %d", expected, got)
+		}
+	}
+	placed := make(map[PodIdentifier]struct{})
+	placeSubmittedPods := func(max int) {
+		var identifiers []PodIdentifier
+		PodMux.RLock()
+		for identifier := range PodToTD {
+			if _, ok := placed[identifier]; !ok && len(identifiers) < max {
+				identifiers = append(identifiers, identifier)
+			}
+		}
+		PodMux.RUnlock()
+		for _, identifier := range identifiers {
+			placed[identifier] = struct{}{}
+			notifyPodPlaced(identifier)
+		}
+	}
+
+	waitForSubmissions(maxInFlight)
+	// Placing 5 pods releases 5 more pods.
+	placeSubmittedPods(5)
+	waitForSubmissions(maxInFlight + 5)
+	for expected := int32(maxInFlight + 5); expected < numPods; {
+		placeSubmittedPods(maxInFlight)
+		expected += maxInFlight
+		if expected > numPods {
+			expected = numPods
+		}
+		waitForSubmissions(expected)
+	}
+	PodMux.RLock()
+	defer PodMux.RUnlock()
+	if len(throttledPods) != 0 {
+		t.Errorf("expected no pod to be held back once all were submitted, got %v", throttledPods)
+	}
+}
+
+// TestPodWatcher_SwapRequest checks the swap budget of a pod is forwarded to Firmament, and that
+// the pods without swap budget request none.
+func TestPodWatcher_SwapRequest(t *testing.T) {
+	fakeNow := metav1.Now()
+	testObj := initializePodObj(t)
+	defer testObj.mockCtrl.Finish()
+	podWatch := NewPodWatcher(testObj.kubeVerMajor, testObj.kubeVerMinor, testObj.schedulerName, testObj.kubeClient, testObj.firmamentClient)
+
+	var testData = []struct {
+		annotation string
+		expected   int64
+	}{
+		{annotation: "", expected: 0},
+		{annotation: "512Mi", expected: 512 * 1024},
+		{annotation: "lots", expected: 0},
+		{annotation: "-1Gi", expected: 0},
+	}
+	for _, data := range testData {
+		pod := BuildPod("Poseidon-Namespace", "Pod1", nil, GetPodPhase("Pending"), "1", "1024", &fakeNow, "abcdfe12345")
+		if data.annotation != "" {
+			pod.Annotations = map[string]string{SwapRequestAnnotation: data.annotation}
+		}
+		parsedPod := podWatch.parsePod(pod)
+		if parsedPod.SwapRequestKb != data.expected {
+			t.Errorf("swap annotation %q: expected a swap request of %d KB, got %d", data.annotation, data.expected, parsedPod.SwapRequestKb)
+		}
+		td := podWatch.addTaskToJob(parsedPod, "jobUID", "jobName", 0)
+		var swapLabel *firmament.Label
+		for _, label := range td.Labels {
+			if label.Key == SwapRequestLabel {
+				swapLabel = label
+			}
+		}
+		switch {
+		case data.expected == 0 && swapLabel != nil:
+			t.Errorf("swap annotation %q: expected no swap request label, got %v", data.annotation, swapLabel)
+		case data.expected != 0 && (swapLabel == nil || swapLabel.Value != fmt.Sprint(data.expected)):
+			t.Errorf("swap annotation %q: expected the swap request label %d, got %v", data.annotation, data.expected, swapLabel)
+		}
+	}
+}
+
+// TestPodWatcher_ExtendedResources checks the extended resources requested by a pod are aggregated
+// and submitted as selectors on the scalar resource labels of the nodes, the native ones aren't.
+func TestPodWatcher_ExtendedResources(t *testing.T) {
+	fakeNow := metav1.Now()
+	testObj := initializePodObj(t)
+	defer testObj.mockCtrl.Finish()
+	podWatch := NewPodWatcher(testObj.kubeVerMajor, testObj.kubeVerMinor, testObj.schedulerName, testObj.kubeClient, testObj.firmamentClient)
+
+	pod := BuildPod("Poseidon-Namespace", "Pod1", nil, GetPodPhase("Pending"), "1", "1024", &fakeNow, "abcdfe12345")
+	pod.Spec.Containers[0].Resources.Requests[v1.ResourceName("example.com/fpga")] = resource.MustParse("1")
+	pod.Spec.Containers[0].Resources.Requests[v1.ResourceName("hugepages-2Mi")] = resource.MustParse("2Mi")
+	pod.Spec.Containers = append(pod.Spec.Containers, v1.Container{
+		Name: "sidecar",
+		Resources: v1.ResourceRequirements{
+			Requests: v1.ResourceList{
+				v1.ResourceName("example.com/fpga"): resource.MustParse("1"),
+				v1.ResourceName("example.com/gpu"):  resource.MustParse("1"),
+			},
+		},
+	})
+	pod.Spec.InitContainers = []v1.Container{{
+		Name: "init",
+		Resources: v1.ResourceRequirements{
+			Requests: v1.ResourceList{v1.ResourceName("example.com/gpu"): resource.MustParse("4")},
+		},
+	}}
+	parsedPod := podWatch.parsePod(pod)
+	expected := map[string]int64{"example.com/fpga": 2, "example.com/gpu": 4}
+	if !reflect.DeepEqual(parsedPod.ExtendedRequests, expected) {
+		t.Fatalf("expected the extended resource requests %v, got %v", expected, parsedPod.ExtendedRequests)
+	}
+	td := podWatch.addTaskToJob(parsedPod, "jobUID", "jobName", 0)
+	got := make(map[string]string)
+	for _, selector := range td.LabelSelectors {
+		if strings.HasPrefix(selector.Key, ScalarResourceLabelPrefix) {
+			if selector.Type != firmament.LabelSelector_GREATER_THAN || len(selector.Values) != 1 {
+				t.Errorf("expected a greater than selector on %s, got %v", selector.Key, selector)
+				continue
+			}
+			got[selector.Key] = selector.Values[0]
+		}
+	}
+	expectedSelectors := map[string]string{
+		ScalarResourceLabelPrefix + "example.com/fpga": "1",
+		ScalarResourceLabelPrefix + "example.com/gpu":  "3",
+	}
+	if !reflect.DeepEqual(got, expectedSelectors) {
+		t.Errorf("expected the extended resource selectors %v, got %v", expectedSelectors, got)
+	}
+}
+
+// TestPodWatcher_ContainerResources checks the requests and limits of each container of a pod are
+// reported alongside the pod-level requests, and forwarded to Firmament once enabled.
+func TestPodWatcher_ContainerResources(t *testing.T) {
+	fakeNow := metav1.Now()
+	testObj := initializePodObj(t)
+	defer testObj.mockCtrl.Finish()
+	podWatch := NewPodWatcher(testObj.kubeVerMajor, testObj.kubeVerMinor, testObj.schedulerName, testObj.kubeClient, testObj.firmamentClient)
+
+	pod := BuildPod("Poseidon-Namespace", "Pod1", nil, GetPodPhase("Pending"), "1", "1024", &fakeNow, "abcdfe12345")
+	pod.Spec.Containers = []v1.Container{
+		{
+			Name: "app",
+			Resources: v1.ResourceRequirements{
+				Requests: v1.ResourceList{
+					v1.ResourceCPU:    resource.MustParse("500m"),
+					v1.ResourceMemory: resource.MustParse("1Mi"),
+				},
+				Limits: v1.ResourceList{
+					v1.ResourceCPU:    resource.MustParse("1"),
+					v1.ResourceMemory: resource.MustParse("2Mi"),
+				},
+			},
+		},
+		{
+			Name: "sidecar",
+			Resources: v1.ResourceRequirements{
+				Requests: v1.ResourceList{
+					v1.ResourceCPU:    resource.MustParse("100m"),
+					v1.ResourceMemory: resource.MustParse("64Ki"),
+				},
+			},
+		},
+	}
+	expected := []ContainerResources{
+		{Name: "app", CPURequest: 500, MemRequestKb: 1024, CPULimit: 1000, MemLimitKb: 2048},
+		{Name: "sidecar", CPURequest: 100, MemRequestKb: 64},
+	}
+	parsedPod := podWatch.parsePod(pod)
+	if !reflect.DeepEqual(parsedPod.Containers, expected) {
+		t.Errorf("expected the container resources %+v, got %+v", expected, parsedPod.Containers)
+	}
+	if parsedPod.CPURequest != 600 || parsedPod.MemRequestKb != 1088 {
+		t.Errorf("expected the pod-level requests 600m and 1088 KB, got %dm and %d KB", parsedPod.CPURequest, parsedPod.MemRequestKb)
+	}
+
+	containerLabel := func() *firmament.Label {
+		td := podWatch.addTaskToJob(parsedPod, "jobUID", "jobName", 0)
+		for _, label := range td.Labels {
+			if label.Key == ContainerResourcesLabel {
+				return label
+			}
+		}
+		return nil
+	}
+	if label := containerLabel(); label != nil {
+		t.Errorf("expected no container resources label by default, got %v", label)
+	}
+	podWatch.reportContainers = true
+	label := containerLabel()
+	if label == nil {
+		t.Fatalf("expected the container resources label once enabled")
+	}
+	var reported []ContainerResources
+	if err := json.Unmarshal([]byte(label.Value), &reported); err != nil {
+		t.Fatalf("failed to decode the container resources label %q: %v", label.Value, err)
+	}
+	if !reflect.DeepEqual(reported, expected) {
+		t.Errorf("expected the container resources label to hold %+v, got %+v", expected, reported)
+	}
+}
+
+// TestPodWatcher_ClusterID checks the same pod of two clusters sharing Firmament gets distinct
+// identifiers, job IDs, task IDs and task names.
+func TestPodWatcher_ClusterID(t *testing.T) {
+	defer SetClusterID("")
+	fakeNow := metav1.Now()
+	testObj := initializePodObj(t)
+	defer testObj.mockCtrl.Finish()
+	podWatch := NewPodWatcher(testObj.kubeVerMajor, testObj.kubeVerMinor, testObj.schedulerName, testObj.kubeClient, testObj.firmamentClient)
+
+	pod := BuildPod("Poseidon-Namespace", "Pod1", nil, GetPodPhase("Pending"), "1", "1024", &fakeNow, "abcdfe12345")
+	var identifiers []PodIdentifier
+	var jobIDs []string
+	var taskIDs []uint64
+	var taskNames []string
+	for _, id := range []string{"east", "west"} {
+		SetClusterID(id)
+		parsedPod := podWatch.parsePod(pod)
+		if parsedPod.Identifier.ClusterID != id {
+			t.Errorf("expected the pod of cluster %s to be identified with its cluster, got %v", id, parsedPod.Identifier)
+		}
+		identifiers = append(identifiers, parsedPod.Identifier)
+		jd := podWatch.createNewJob(parsedPod.OwnerRef)
+		jobIDs = append(jobIDs, jd.Uuid)
+		td := podWatch.addTaskToJob(parsedPod, jd.Uuid, jd.Name, 1)
+		taskIDs = append(taskIDs, td.Uid)
+		taskNames = append(taskNames, td.Name)
+	}
+	if identifiers[0] == identifiers[1] {
+		t.Errorf("expected distinct identifiers for the pods of two clusters, got %v", identifiers[0])
+	}
+	if jobIDs[0] == jobIDs[1] {
+		t.Errorf("expected distinct job IDs for the pods of two clusters, got %s", jobIDs[0])
+	}
+	if taskIDs[0] == taskIDs[1] {
+		t.Errorf("expected distinct task IDs for the pods of two clusters, got %d", taskIDs[0])
+	}
+	if taskNames[0] != "east/Poseidon-Namespace/Pod1" || taskNames[1] != "west/Poseidon-Namespace/Pod1" {
+		t.Errorf("expected the task names to be prefixed with the cluster ID, got %v", taskNames)
+	}
+
+	// Without cluster ID, the pods are identified as before.
+	SetClusterID("")
+	if identifier := podWatch.parsePod(pod).Identifier; identifier != (PodIdentifier{Name: "Pod1", Namespace: "Poseidon-Namespace"}) {
+		t.Errorf("expected the pod to be identified by its namespace and name only, got %v", identifier)
+	}
+}
+
+// TestPodWatcher_FinalizerHeldPod checks the task of a pod is removed as soon as it's terminating
+// while finalizers hold its deletion, and that the pod is then ignored until it's deleted.
+func TestPodWatcher_FinalizerHeldPod(t *testing.T) {
+	fakeNow := metav1.Now()
+	testObj := initializePodObj(t)
+	defer testObj.mockCtrl.Finish()
+	podWatch := NewPodWatcher(testObj.kubeVerMajor, testObj.kubeVerMinor, testObj.schedulerName, testObj.kubeClient, testObj.firmamentClient)
+
+	pod := BuildPod("Poseidon-Namespace", "Pod1", nil, GetPodPhase("Pending"), "1", "1024", &fakeNow, "abcdfe12345")
+	key := GetKey(pod, t)
+	identifier := PodIdentifier{Name: pod.Name, Namespace: pod.Namespace}
+	removed := make(chan struct{})
+	gomock.InOrder(
+		testObj.firmamentClient.EXPECT().TaskSubmitted(gomock.Any(), gomock.Any()).Return(
+			&firmament.TaskSubmittedResponse{Type: firmament.TaskReplyType_TASK_SUBMITTED_OK}, nil),
+		// The task is removed once, while the pod still exists.
+		testObj.firmamentClient.EXPECT().TaskRemoved(gomock.Any(), gomock.Any()).Do(func(interface{}, interface{}) {
+			close(removed)
+		}).Return(&firmament.TaskRemovedResponse{Type: firmament.TaskReplyType_TASK_REMOVED_OK}, nil),
+	)
+	podWatch.enqueuePodAddition(key, pod)
+	go podWatch.podWorker()
+	defer podWatch.podWorkQueue.ShutDown()
+
+	terminatingPod := pod.DeepCopy()
+	terminatingPod.DeletionTimestamp = &fakeNow
+	terminatingPod.Finalizers = []string{"example.com/cleanup"}
+	podWatch.enqueuePodUpdate(key, pod, terminatingPod)
+	select {
+	case <-removed:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected the task of the terminating pod to be removed")
+	}
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		PodMux.RLock()
+		_, ok := PodToTD[identifier]
+		PodMux.RUnlock()
+		if !ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the terminating pod to be forgotten")
+		}
+	}
+
+	// The later updates are ignored, even once the finalizers are done.
+	failedPod := ChangePodPhase(terminatingPod, "Failed")
+	podWatch.enqueuePodUpdate(key, terminatingPod, failedPod)
+	finalizedPod := failedPod.DeepCopy()
+	finalizedPod.Finalizers = nil
+	podWatch.enqueuePodUpdate(key, failedPod, finalizedPod)
+	if podWatch.podWorkQueue.Len() != 0 {
+		t.Errorf("expected the updates of the terminating pod to be ignored")
+	}
+	podWatch.enqueuePodDeletion(key, finalizedPod)
+	PodMux.RLock()
+	_, terminating := terminatingPods[identifier]
+	PodMux.RUnlock()
+	if terminating {
+		t.Errorf("expected the deleted pod to be forgotten as terminating")
+	}
+}
+
+// TestPodWatcher_MemoryGranularity checks the memory requests are rounded up to the granularity.
+func TestPodWatcher_MemoryGranularity(t *testing.T) {
+	fakeNow := metav1.Now()
+	testObj := initializePodObj(t)
+	defer testObj.mockCtrl.Finish()
+	podWatch := NewPodWatcher(testObj.kubeVerMajor, testObj.kubeVerMinor, testObj.schedulerName, testObj.kubeClient, testObj.firmamentClient)
+
+	var testData = []struct {
+		memory      string
+		granularity int64
+		expected    int64
+	}{
+		// No rounding by default.
+		{memory: "6Ki", granularity: 1, expected: 6},
+		// The request isn't page-aligned, it's rounded up to the next page.
+		{memory: "6Ki", granularity: 4, expected: 8},
+		{memory: "8Ki", granularity: 4, expected: 8},
+		{memory: "1Mi", granularity: 4, expected: 1024},
+	}
+	for _, data := range testData {
+		podWatch.memGranularity = data.granularity
+		pod := BuildPod("Poseidon-Namespace", "Pod1", nil, GetPodPhase("Pending"), "1", data.memory, &fakeNow, "abcdfe12345")
+		if memRequest := podWatch.parsePod(pod).MemRequestKb; memRequest != data.expected {
+			t.Errorf("%s with a granularity of %d KB: expected a memory request of %d KB, got %d", data.memory, data.granularity, data.expected, memRequest)
+		}
+	}
+}
+
+func TestPodWatcher_BinaryMemory(t *testing.T) {
+	fakeNow := metav1.Now()
+	testObj := initializePodObj(t)
+	defer testObj.mockCtrl.Finish()
+	podWatch := NewPodWatcher(testObj.kubeVerMajor, testObj.kubeVerMinor, testObj.schedulerName, testObj.kubeClient, testObj.firmamentClient)
+	defer func() { binaryMemory = true }()
+
+	var testData = []struct {
+		binary   bool
+		expected int64
+	}{
+		// 1000000 bytes are 976.5625 KiB.
+		{binary: true, expected: 976},
+		{binary: false, expected: 1000},
+	}
+	for _, data := range testData {
+		binaryMemory = data.binary
+		pod := BuildPod("Poseidon-Namespace", "Pod1", nil, GetPodPhase("Pending"), "1", "1000000", &fakeNow, "abcdfe12345")
+		if memRequest := podWatch.parsePod(pod).MemRequestKb; memRequest != data.expected {
+			t.Errorf("binary memory %v: expected a memory request of %d KB, got %d", data.binary, data.expected, memRequest)
+		}
+	}
+}
+
+// Checks the submitted pods are stamped with the submitted annotation, whose stamping isn't an update
+func TestPodWatcher_SubmittedAnnotation(t *testing.T) {
+	fakeNow := metav1.Now()
+	testObj := initializePodObj(t)
+	defer testObj.mockCtrl.Finish()
+	k8sPod := BuildPod("Poseidon-Namespace", "Annotated", nil, GetPodPhase("Pending"), "1", "1024", &fakeNow, "abcdfe12345")
+	client := fake.NewSimpleClientset(k8sPod)
+	podWatch := NewPodWatcher(testObj.kubeVerMajor, testObj.kubeVerMinor, testObj.schedulerName, client, testObj.firmamentClient)
+	SetSubmittedAnnotation("poseidon.io/submitted")
+	defer SetSubmittedAnnotation("")
+
+	testObj.firmamentClient.EXPECT().TaskSubmitted(gomock.Any(), gomock.Any()).Return(
+		&firmament.TaskSubmittedResponse{Type: firmament.TaskReplyType_TASK_SUBMITTED_OK}, nil)
+	podWatch.submitPod(podWatch.parsePod(k8sPod))
+
+	var annotatedPod *v1.Pod
+	timeout := time.After(5 * time.Second)
+	for annotatedPod == nil {
+		pod, err := client.CoreV1().Pods("Poseidon-Namespace").Get("Annotated", metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("Failed to get the pod: %v", err)
+		}
+		if _, ok := pod.Annotations["poseidon.io/submitted"]; ok {
+			annotatedPod = pod
+			break
+		}
+		select {
+		case <-timeout:
+			t.Fatal("timed out waiting for the pod to be annotated")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	if _, err := time.Parse(time.RFC3339, annotatedPod.Annotations["poseidon.io/submitted"]); err != nil {
+		t.Errorf("expected the submission time in the annotation, got %q: %v", annotatedPod.Annotations["poseidon.io/submitted"], err)
+	}
+	if annotationsChanged(k8sPod, annotatedPod) {
+		t.Error("expected the stamping of the submitted annotation not to change the pod annotations")
+	}
+	annotatedPod.Annotations["other"] = "value"
+	if !annotationsChanged(k8sPod, annotatedPod) {
+		t.Error("expected the other annotations to still change the pod annotations")
+	}
+}
+
+// Checks a span is recorded per submission, continuing the trace of the conversion of the pod down to
+// the call to Firmament
+func TestPodWatcher_Tracing(t *testing.T) {
+	fakeNow := metav1.Now()
+	testObj := initializePodObj(t)
+	defer testObj.mockCtrl.Finish()
+	podWatch := NewPodWatcher(testObj.kubeVerMajor, testObj.kubeVerMinor, testObj.schedulerName, testObj.kubeClient, firmament.NewTracingClient(testObj.firmamentClient))
+	recorder := &tracing.InMemoryRecorder{}
+	tracing.SetRecorder(recorder)
+	defer tracing.SetRecorder(nil)
+
+	testObj.firmamentClient.EXPECT().TaskSubmitted(gomock.Any(), gomock.Any()).Return(
+		&firmament.TaskSubmittedResponse{Type: firmament.TaskReplyType_TASK_SUBMITTED_OK}, nil)
+	k8sPod := BuildPod("Poseidon-Namespace", "Traced", nil, GetPodPhase("Pending"), "1", "1024", &fakeNow, "abcdfe12345")
+	k8sPod.DeletionTimestamp = nil
+	pod, ok := podWatch.convertAddedPod(k8sPod)
+	if !ok {
+		t.Fatal("expected the pod to be converted")
+	}
+	podWatch.submitPod(pod)
+
+	spans := make(map[string]*tracing.Span)
+	for _, span := range recorder.Spans() {
+		spans[span.Name] = span
+	}
+	converted, submitted, called := spans["poseidon.ConvertPod"], spans["poseidon.SubmitPod"], spans["firmament.TaskSubmitted"]
+	if len(spans) != 3 || converted == nil || submitted == nil || called == nil {
+		t.Fatalf("expected the conversion, submission and TaskSubmitted spans, got %v", spans)
+	}
+	if submitted.Parent != converted.SpanContext || called.Parent != submitted.SpanContext {
+		t.Errorf("expected the spans to be chained, got %+v, %+v and %+v", converted, submitted, called)
+	}
+	if submitted.Attributes[spanAttributeNamespace] != "Poseidon-Namespace" || submitted.Attributes[spanAttributePod] != "Traced" {
+		t.Errorf("expected the submission span to be about pod Poseidon-Namespace/Traced, got %v", submitted.Attributes)
+	}
+}
@@ -0,0 +1,179 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8sclient
+
+import (
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/kubernetes-sigs/poseidon/pkg/metrics"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+var (
+	preemptionLock sync.Mutex
+	// nominatePreemptors makes the pods placed on a node where victims are still terminating wait for
+	// them to be deleted, nominated to the node, rather than being bound right away.
+	nominatePreemptors = true
+	// preemptionVictims maps the victims being deleted to their node.
+	preemptionVictims = make(map[PodIdentifier]string)
+	// victimTimers holds the timers forgetting the victims whose deletion wasn't observed within their
+	// grace period, so that the binds of their preemptors aren't held forever.
+	victimTimers = make(map[PodIdentifier]*time.Timer)
+	// nominatedPods maps the nodes to the binds of the preemptors pending on their victims.
+	nominatedPods = make(map[string][]BindInfo)
+)
+
+// SetNominatePreemptors sets whether the preemptors wait for their victims to be deleted before they're
+// bound.
+func SetNominatePreemptors(nominate bool) {
+	preemptionLock.Lock()
+	defer preemptionLock.Unlock()
+	nominatePreemptors = nominate
+}
+
+// victimDeletionSlack is the time a victim is waited for past its grace period, e.g. for the kubelet
+// to report the containers stopped, before its preemptors are bound anyway.
+var victimDeletionSlack = 30 * time.Second
+
+// victimGracePeriod returns the grace period the victim is deleted with, its own termination grace
+// period.
+func victimGracePeriod(pod *v1.Pod) *int64 {
+	if pod == nil || pod.Spec.TerminationGracePeriodSeconds == nil {
+		return nil
+	}
+	gracePeriod := *pod.Spec.TerminationGracePeriodSeconds
+	return &gracePeriod
+}
+
+// PreemptPod gracefully deletes a pod Firmament preempted or migrated. Kubernetes relies on the
+// controllers, e.g. job or replica set, to submit another instance of the pod. The victim is tracked
+// until it's deleted so that the preemptors placed on its node wait for the resources to be freed, at
+// most its grace period and victimDeletionSlack.
+func PreemptPod(identifier PodIdentifier) {
+	PodToK8sPodLock.Lock()
+	pod := PodToK8sPod[identifier]
+	PodToK8sPodLock.Unlock()
+	var nodeName string
+	if pod != nil {
+		nodeName = pod.Spec.NodeName
+	}
+	err := ClientSet.CoreV1().Pods(identifier.Namespace).Delete(identifier.Name, &meta_v1.DeleteOptions{
+		GracePeriodSeconds: victimGracePeriod(pod),
+	})
+	if errors.IsNotFound(err) {
+		glog.V(2).Infof("Preempted pod %v is already deleted", identifier)
+		return
+	}
+	if err != nil {
+		glog.Errorf("Could not delete preempted pod %v: %v", identifier, err)
+		return
+	}
+	preemptionLock.Lock()
+	defer preemptionLock.Unlock()
+	if !nominatePreemptors || nodeName == "" {
+		return
+	}
+	preemptionVictims[identifier] = nodeName
+	metrics.PreemptionVictims.Set(float64(len(preemptionVictims)))
+	gracePeriod := int64(v1.DefaultTerminationGracePeriodSeconds)
+	if gp := victimGracePeriod(pod); gp != nil {
+		gracePeriod = *gp
+	}
+	if timer, ok := victimTimers[identifier]; ok {
+		timer.Stop()
+	}
+	victimTimers[identifier] = time.AfterFunc(time.Duration(gracePeriod)*time.Second+victimDeletionSlack, func() {
+		glog.Warningf("Preemption victim %v wasn't deleted within its grace period, binding its preemptors", identifier)
+		forgetPreemption(identifier)
+	})
+}
+
+// NominatePod sets the nominated node of a pod placed on a node where preemption victims are still
+// terminating, and holds its bind until they're deleted. It returns true if the bind is held.
+func NominatePod(bindInfo BindInfo) bool {
+	preemptionLock.Lock()
+	if !nominatePreemptors || !hasPreemptionVictims(bindInfo.Nodename) {
+		preemptionLock.Unlock()
+		return false
+	}
+	nominatedPods[bindInfo.Nodename] = append(nominatedPods[bindInfo.Nodename], bindInfo)
+	preemptionLock.Unlock()
+
+	identifier := NewPodIdentifier(bindInfo.Namespace, bindInfo.Name)
+	glog.V(2).Infof("Pod %v is nominated to node %s, pending on its preemption victims", identifier, bindInfo.Nodename)
+	if ClientSet == nil {
+		return true
+	}
+	// The nomination is informative, the pod is bound all the same, so the binds don't wait for it.
+	go func(client kubernetes.Interface) {
+		if err := patchPodNominatedNode(client, bindInfo.Namespace, bindInfo.Name, bindInfo.Nodename); err != nil {
+			glog.Errorf("Could not nominate pod %v to node %s: %v", identifier, bindInfo.Nodename, err)
+		}
+	}(ClientSet)
+	return true
+}
+
+// hasPreemptionVictims returns true if victims are still terminating on the node. The caller holds
+// preemptionLock.
+func hasPreemptionVictims(nodeName string) bool {
+	for _, victimNode := range preemptionVictims {
+		if victimNode == nodeName {
+			return true
+		}
+	}
+	return false
+}
+
+// forgetPreemption is called once a pod is deleted. A deleted nominated pod is no longer bound, and
+// the preemptors nominated to the node of a deleted victim are bound once it has no victims left.
+func forgetPreemption(identifier PodIdentifier) {
+	preemptionLock.Lock()
+	for nodeName, binds := range nominatedPods {
+		for i, bindInfo := range binds {
+			if NewPodIdentifier(bindInfo.Namespace, bindInfo.Name) == identifier {
+				nominatedPods[nodeName] = append(binds[:i], binds[i+1:]...)
+				break
+			}
+		}
+	}
+	nodeName, ok := preemptionVictims[identifier]
+	if !ok {
+		preemptionLock.Unlock()
+		return
+	}
+	delete(preemptionVictims, identifier)
+	if timer, ok := victimTimers[identifier]; ok {
+		timer.Stop()
+		delete(victimTimers, identifier)
+	}
+	metrics.PreemptionVictims.Set(float64(len(preemptionVictims)))
+	var binds []BindInfo
+	if !hasPreemptionVictims(nodeName) {
+		binds = nominatedPods[nodeName]
+		delete(nominatedPods, nodeName)
+	}
+	preemptionLock.Unlock()
+	for _, bindInfo := range binds {
+		glog.V(2).Infof("Binding pod %s/%s to node %s, its preemption victims are deleted", bindInfo.Namespace, bindInfo.Name, nodeName)
+		requeueBind(bindInfo)
+	}
+}
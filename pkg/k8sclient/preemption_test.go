@@ -0,0 +1,163 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8sclient
+
+import (
+	"testing"
+	"time"
+
+	"k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+)
+
+// TestPreemption simulates Firmament preempting a victim to place a pod on its node: the victim is
+// deleted, the preemptor is nominated to the node and only bound once the victim is gone.
+func TestPreemption(t *testing.T) {
+	testObj := initializePodObj(t)
+	defer testObj.mockCtrl.Finish()
+	podWatch := NewPodWatcher(testObj.kubeVerMajor, testObj.kubeVerMinor, testObj.schedulerName, testObj.kubeClient, testObj.firmamentClient)
+
+	gracePeriod := int64(45)
+	victim := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "Victim", Namespace: "Poseidon-Namespace"},
+		Spec:       v1.PodSpec{NodeName: "PreemptionNode", TerminationGracePeriodSeconds: &gracePeriod},
+	}
+	preemptor := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "Preemptor", Namespace: "Poseidon-Namespace"},
+	}
+	victimID := NewPodIdentifier(victim.Namespace, victim.Name)
+	preemptorID := NewPodIdentifier(preemptor.Namespace, preemptor.Name)
+	ClientSet = fake.NewSimpleClientset(victim, preemptor)
+	PodToK8sPodLock.Lock()
+	PodToK8sPod[victimID] = victim
+	PodToK8sPod[preemptorID] = preemptor
+	PodToK8sPodLock.Unlock()
+	requeued := make(chan BindInfo, 1)
+	defaultRequeueBind := requeueBind
+	requeueBind = func(bindInfo BindInfo) {
+		requeued <- bindInfo
+	}
+	defer func() {
+		ClientSet = nil
+		requeueBind = defaultRequeueBind
+		PodToK8sPodLock.Lock()
+		delete(PodToK8sPod, victimID)
+		delete(PodToK8sPod, preemptorID)
+		PodToK8sPodLock.Unlock()
+	}()
+
+	if gp := victimGracePeriod(victim); gp == nil || *gp != gracePeriod {
+		t.Errorf("expected the victim to be deleted with its grace period %d, got %v", gracePeriod, gp)
+	}
+	PreemptPod(victimID)
+	if _, err := ClientSet.CoreV1().Pods(victim.Namespace).Get(victim.Name, metav1.GetOptions{}); !apierrors.IsNotFound(err) {
+		t.Errorf("expected the victim to be deleted, got %v", err)
+	}
+
+	// The preemptor placed on the victim's node is nominated rather than bound.
+	bindInfo := BindInfo{Name: preemptor.Name, Namespace: preemptor.Namespace, Nodename: "PreemptionNode"}
+	if !NominatePod(bindInfo) {
+		t.Fatalf("expected the bind of the preemptor to be held while the victim terminates")
+	}
+	// The nomination is patched asynchronously.
+	var nominatedNode string
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		nominated, err := ClientSet.CoreV1().Pods(preemptor.Namespace).Get(preemptor.Name, metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("failed to get the preemptor: %v", err)
+		}
+		if nominatedNode = nominated.Status.NominatedNodeName; nominatedNode != "" {
+			break
+		}
+	}
+	if nominatedNode != "PreemptionNode" {
+		t.Errorf("expected the preemptor to be nominated to PreemptionNode, got %q", nominatedNode)
+	}
+	select {
+	case bind := <-requeued:
+		t.Fatalf("expected the preemptor not to be bound before the victim is deleted, got %v", bind)
+	default:
+	}
+	// A pod placed on another node is bound right away.
+	if NominatePod(BindInfo{Name: "Other", Namespace: "Poseidon-Namespace", Nodename: "OtherNode"}) {
+		t.Errorf("expected the bind of a pod placed on a node without victims not to be held")
+	}
+
+	// The victim is deleted once its grace period elapsed, the informer only observes the deletion as a
+	// tombstone: the preemptor is bound.
+	deletedVictim := victim.DeepCopy()
+	deletedVictim.DeletionTimestamp = &metav1.Time{}
+	podWatch.enqueuePodDeletion(GetKey(deletedVictim, t), cache.DeletedFinalStateUnknown{Key: GetKey(deletedVictim, t), Obj: deletedVictim})
+	select {
+	case bind := <-requeued:
+		if bind != bindInfo {
+			t.Errorf("expected the preemptor to be bound with %v, got %v", bindInfo, bind)
+		}
+	default:
+		t.Fatalf("expected the preemptor to be bound once the victim is deleted")
+	}
+	if NominatePod(bindInfo) {
+		t.Errorf("expected the bind not to be held once the node has no victims left")
+	}
+}
+
+// TestPreemption_VictimNotDeleted checks the bind of a preemptor is released once its victim's grace
+// period and the slack elapsed, even though the victim's deletion was never observed.
+func TestPreemption_VictimNotDeleted(t *testing.T) {
+	gracePeriod := int64(0)
+	victim := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "StuckVictim", Namespace: "Poseidon-Namespace"},
+		Spec:       v1.PodSpec{NodeName: "StuckNode", TerminationGracePeriodSeconds: &gracePeriod},
+	}
+	victimID := NewPodIdentifier(victim.Namespace, victim.Name)
+	ClientSet = fake.NewSimpleClientset(victim)
+	PodToK8sPodLock.Lock()
+	PodToK8sPod[victimID] = victim
+	PodToK8sPodLock.Unlock()
+	requeued := make(chan BindInfo, 1)
+	defaultRequeueBind := requeueBind
+	requeueBind = func(bindInfo BindInfo) {
+		requeued <- bindInfo
+	}
+	defaultSlack := victimDeletionSlack
+	victimDeletionSlack = 100 * time.Millisecond
+	defer func() {
+		ClientSet = nil
+		requeueBind = defaultRequeueBind
+		victimDeletionSlack = defaultSlack
+		PodToK8sPodLock.Lock()
+		delete(PodToK8sPod, victimID)
+		PodToK8sPodLock.Unlock()
+	}()
+
+	PreemptPod(victimID)
+	bindInfo := BindInfo{Name: "StuckPreemptor", Namespace: "Poseidon-Namespace", Nodename: "StuckNode"}
+	if !NominatePod(bindInfo) {
+		t.Fatalf("expected the bind of the preemptor to be held while the victim terminates")
+	}
+	select {
+	case bind := <-requeued:
+		if bind != bindInfo {
+			t.Errorf("expected the preemptor to be bound with %v, got %v", bindInfo, bind)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected the preemptor to be bound once the grace period of its victim elapsed")
+	}
+}
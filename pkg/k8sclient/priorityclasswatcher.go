@@ -0,0 +1,150 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8sclient
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/golang/glog"
+	schedulingv1beta1 "k8s.io/api/scheduling/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+// PriorityClassMux guards priorityClassValues.
+var PriorityClassMux *sync.RWMutex
+
+// priorityClassValues maps the priority class names to their last known value. The value of a
+// deleted class is kept, so that the pods referencing it keep their last known priority.
+var priorityClassValues map[string]int32
+
+// PriorityClassWatcher is a Kubernetes priority class watcher.
+type PriorityClassWatcher struct {
+	clientset  kubernetes.Interface
+	controller cache.Controller
+	// watchErrorHandler is called on the list and watch errors of the informer.
+	watchErrorHandler func(err error)
+	// priorityClassUpdatedHandler, if set, is called with the name of a class whose value changed.
+	priorityClassUpdatedHandler func(name string)
+}
+
+// NewPriorityClassWatcher initialize a PriorityClassWatcher.
+func NewPriorityClassWatcher(client kubernetes.Interface) *PriorityClassWatcher {
+	glog.Info("Starting PriorityClassWatcher...")
+	PriorityClassMux = new(sync.RWMutex)
+	priorityClassValues = make(map[string]int32)
+	pcw := &PriorityClassWatcher{
+		clientset:         client,
+		watchErrorHandler: newWatchErrorHandler("priorityclasses"),
+	}
+	_, controller := cache.NewInformer(
+		newErrorReportingListWatch(&cache.ListWatch{
+			ListFunc: func(alo metav1.ListOptions) (runtime.Object, error) {
+				return client.SchedulingV1beta1().PriorityClasses().List(alo)
+			},
+			WatchFunc: func(alo metav1.ListOptions) (watch.Interface, error) {
+				return client.SchedulingV1beta1().PriorityClasses().Watch(alo)
+			},
+		}, func(err error) {
+			pcw.watchErrorHandler(err)
+		}),
+		&schedulingv1beta1.PriorityClass{},
+		0,
+		cache.ResourceEventHandlerFuncs{
+			AddFunc: func(obj interface{}) {
+				pcw.addPriorityClass(obj)
+			},
+			UpdateFunc: func(old, new interface{}) {
+				pcw.updatePriorityClass(old, new)
+			},
+			DeleteFunc: func(obj interface{}) {
+				pcw.deletePriorityClass(obj)
+			},
+		},
+	)
+	pcw.controller = controller
+	return pcw
+}
+
+func (pcw *PriorityClassWatcher) addPriorityClass(obj interface{}) {
+	priorityClass := obj.(*schedulingv1beta1.PriorityClass)
+	PriorityClassMux.Lock()
+	priorityClassValues[priorityClass.Name] = priorityClass.Value
+	PriorityClassMux.Unlock()
+	glog.V(2).Infof("addPriorityClass: Added priority class %s with value %d", priorityClass.Name, priorityClass.Value)
+}
+
+func (pcw *PriorityClassWatcher) updatePriorityClass(oldObj, newObj interface{}) {
+	oldPriorityClass := oldObj.(*schedulingv1beta1.PriorityClass)
+	newPriorityClass := newObj.(*schedulingv1beta1.PriorityClass)
+	PriorityClassMux.Lock()
+	priorityClassValues[newPriorityClass.Name] = newPriorityClass.Value
+	PriorityClassMux.Unlock()
+	if oldPriorityClass.Value == newPriorityClass.Value {
+		return
+	}
+	glog.V(2).Infof("updatePriorityClass: Priority class %s changed from %d to %d", newPriorityClass.Name, oldPriorityClass.Value, newPriorityClass.Value)
+	if pcw.priorityClassUpdatedHandler != nil {
+		pcw.priorityClassUpdatedHandler(newPriorityClass.Name)
+	}
+}
+
+func (pcw *PriorityClassWatcher) deletePriorityClass(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	priorityClass, ok := obj.(*schedulingv1beta1.PriorityClass)
+	if !ok {
+		glog.Errorf("deletePriorityClass: unexpected object %v", obj)
+		return
+	}
+	// The pods referencing the class keep their last known priority, so its value isn't forgotten.
+	glog.V(2).Infof("deletePriorityClass: Priority class %s deleted, keeping its value %d", priorityClass.Name, priorityClass.Value)
+}
+
+// getPriorityClassValue returns the last known value of a priority class.
+func getPriorityClassValue(name string) (int32, bool) {
+	if PriorityClassMux == nil {
+		return 0, false
+	}
+	PriorityClassMux.RLock()
+	defer PriorityClassMux.RUnlock()
+	value, ok := priorityClassValues[name]
+	return value, ok
+}
+
+// Run starts a priority class watcher.
+func (pcw *PriorityClassWatcher) Run(stopCh <-chan struct{}) {
+	defer utilruntime.HandleCrash()
+	defer glog.Info("Shutting down PriorityClassWatcher")
+	glog.Info("Getting priority class updates...")
+
+	go pcw.controller.Run(stopCh)
+
+	if !cache.WaitForCacheSync(stopCh, pcw.controller.HasSynced) {
+		utilruntime.HandleError(fmt.Errorf("Timed out waiting for caches to sync"))
+		return
+	}
+
+	<-stopCh
+	glog.Info("Stopping priority class watcher")
+}
@@ -0,0 +1,54 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8sclient
+
+import (
+	"time"
+
+	"github.com/golang/glog"
+	"golang.org/x/time/rate"
+)
+
+// retryBudget is a token bucket shared by the retries of all the pods. While a pod backs off on its
+// own failures, a burst of failures across many pods, e.g. while Firmament is unavailable, could still
+// requeue them faster than the backend can cope with. Once the budget is exhausted, the retries are
+// delayed until tokens are refilled, whatever the backoff of their pod.
+type retryBudget struct {
+	limiter *rate.Limiter
+}
+
+// newRetryBudget returns a budget refilled with qps tokens per second and holding up to burst tokens,
+// nil if qps is 0, i.e. the retries aren't limited.
+func newRetryBudget(qps float32, burst int) *retryBudget {
+	if qps <= 0 {
+		return nil
+	}
+	if burst < 1 {
+		glog.Warningf("Invalid retry budget burst %d, using 1", burst)
+		burst = 1
+	}
+	return &retryBudget{limiter: rate.NewLimiter(rate.Limit(qps), burst)}
+}
+
+// reserve takes a token from the budget and returns the time to wait before the retry is allowed, 0 if
+// the budget isn't exhausted.
+func (rb *retryBudget) reserve() time.Duration {
+	if rb == nil {
+		return 0
+	}
+	return rb.limiter.Reserve().Delay()
+}
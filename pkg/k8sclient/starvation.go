@@ -0,0 +1,80 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8sclient
+
+import (
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/kubernetes-sigs/poseidon/pkg/metrics"
+	"k8s.io/api/core/v1"
+)
+
+// pendingPodsReportInterval is the time between two reports of the pods waiting to be placed.
+const pendingPodsReportInterval = 10 * time.Second
+
+// reportPendingPods exports the age of the oldest pod waiting to be placed, and counts the pending pods
+// which crossed the starvation threshold since the last report. A pod is only counted once.
+func (pw *PodWatcher) reportPendingPods() {
+	now := time.Now()
+	var oldest time.Duration
+	pending := make(map[PodIdentifier]time.Duration)
+	PodMux.RLock()
+	PodToK8sPodLock.Lock()
+	for identifier, k8sPod := range PodToK8sPod {
+		if k8sPod.Status.Phase != v1.PodPending {
+			continue
+		}
+		if _, ok := podToNode[identifier]; ok {
+			continue
+		}
+		age := now.Sub(k8sPod.CreationTimestamp.Time)
+		pending[identifier] = age
+		if age > oldest {
+			oldest = age
+		}
+	}
+	PodToK8sPodLock.Unlock()
+	PodMux.RUnlock()
+	metrics.OldestPendingPodAge.Set(oldest.Seconds())
+
+	pw.starvedPodsMux.Lock()
+	defer pw.starvedPodsMux.Unlock()
+	if pw.starvedPods == nil {
+		pw.starvedPods = make(map[PodIdentifier]struct{})
+	}
+	// Forget the pods placed or deleted since, so that the set doesn't grow forever.
+	for identifier := range pw.starvedPods {
+		if _, ok := pending[identifier]; !ok {
+			delete(pw.starvedPods, identifier)
+		}
+	}
+	if pw.starvationThreshold <= 0 {
+		return
+	}
+	for identifier, age := range pending {
+		if age < pw.starvationThreshold {
+			continue
+		}
+		if _, ok := pw.starvedPods[identifier]; ok {
+			continue
+		}
+		pw.starvedPods[identifier] = struct{}{}
+		metrics.StarvedPods.Inc()
+		glog.Warningf("Pod %v has been pending for %v, longer than the starvation threshold %v", identifier, age, pw.starvationThreshold)
+	}
+}
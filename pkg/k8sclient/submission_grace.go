@@ -0,0 +1,103 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8sclient
+
+import (
+	"github.com/golang/glog"
+	"k8s.io/api/core/v1"
+)
+
+// heldPod is a new pod held in the queue until it has been unchanged for the grace period, e.g. so
+// that the mutating webhooks and the sidecar injectors are done with it when it's submitted.
+type heldPod struct {
+	// latest is the item of the latest version of the pod, the only one which is submitted. It is
+	// nil if the pod isn't to be submitted anymore.
+	latest *Pod
+	// inFlight is the number of items of the pod still delayed in the queue.
+	inFlight int
+}
+
+// holdPod enqueues the pending pod after the grace period instead of right away. It returns false
+// if the pod isn't held: there's no grace period, the queue can't delay the items or the pod isn't
+// pending.
+func (pw *PodWatcher) holdPod(key interface{}, pod *Pod) bool {
+	if pw.submissionGracePeriod <= 0 || pod.State != PodPending {
+		return false
+	}
+	queue, ok := pw.podWorkQueue.(DelayingQueue)
+	if !ok {
+		return false
+	}
+	pw.heldPodsMux.Lock()
+	if pw.heldPods == nil {
+		pw.heldPods = make(map[PodIdentifier]*heldPod)
+	}
+	held, ok := pw.heldPods[pod.Identifier]
+	if !ok {
+		held = &heldPod{}
+		pw.heldPods[pod.Identifier] = held
+	}
+	held.latest = pod
+	held.inFlight++
+	pw.heldPodsMux.Unlock()
+	queue.AddAfter(key, pod, pw.submissionGracePeriod)
+	return true
+}
+
+// isHeld returns true if the pod is held for the grace period.
+func (pw *PodWatcher) isHeld(pod *v1.Pod) bool {
+	pw.heldPodsMux.Lock()
+	defer pw.heldPodsMux.Unlock()
+	_, ok := pw.heldPods[NewPodIdentifier(pod.Namespace, pod.Name)]
+	return ok
+}
+
+// unholdPod gives up on submitting a held pod, e.g. because it isn't pending anymore. Its items
+// still in the queue are dropped.
+func (pw *PodWatcher) unholdPod(identifier PodIdentifier) {
+	pw.heldPodsMux.Lock()
+	defer pw.heldPodsMux.Unlock()
+	if held, ok := pw.heldPods[identifier]; ok {
+		held.latest = nil
+	}
+}
+
+// releaseHeldPod returns true if the pending pod is to be submitted. The pods which weren't held
+// are, the held pods are once the item of their latest version is out of the queue, unless they
+// were deleted in the meantime.
+func (pw *PodWatcher) releaseHeldPod(pod *Pod) bool {
+	pw.heldPodsMux.Lock()
+	held, ok := pw.heldPods[pod.Identifier]
+	if !ok {
+		pw.heldPodsMux.Unlock()
+		return true
+	}
+	held.inFlight--
+	if held.inFlight <= 0 {
+		delete(pw.heldPods, pod.Identifier)
+	}
+	latest := held.latest == pod
+	pw.heldPodsMux.Unlock()
+	if !latest {
+		glog.V(2).Infof("Dropping an outdated version of held pod %v", pod.Identifier)
+		return false
+	}
+	PodToK8sPodLock.Lock()
+	_, exists := PodToK8sPod[pod.Identifier]
+	PodToK8sPodLock.Unlock()
+	return exists
+}
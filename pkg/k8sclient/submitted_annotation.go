@@ -0,0 +1,82 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8sclient
+
+import (
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"k8s.io/api/core/v1"
+)
+
+var (
+	submittedAnnotationLock sync.RWMutex
+	// submittedAnnotation is the annotation the pods are stamped with, with the time, once they're
+	// submitted to Firmament, so that operators can tell which pods are under Poseidon's control. The
+	// pods aren't stamped if it's empty.
+	submittedAnnotation string
+)
+
+// SetSubmittedAnnotation sets the annotation the submitted pods are stamped with, an empty name
+// disables the stamping.
+func SetSubmittedAnnotation(name string) {
+	submittedAnnotationLock.Lock()
+	defer submittedAnnotationLock.Unlock()
+	submittedAnnotation = name
+}
+
+func getSubmittedAnnotation() string {
+	submittedAnnotationLock.RLock()
+	defer submittedAnnotationLock.RUnlock()
+	return submittedAnnotation
+}
+
+// markPodSubmitted stamps the pod with the submitted annotation, set to the submission time. It's
+// best effort: a failure is only logged.
+func (pw *PodWatcher) markPodSubmitted(identifier PodIdentifier, submitted time.Time) {
+	annotation := getSubmittedAnnotation()
+	if annotation == "" || pw.clientset == nil {
+		return
+	}
+	err := patchPodAnnotations(pw.clientset, identifier.Namespace, identifier.Name, map[string]string{
+		annotation: submitted.UTC().Format(time.RFC3339),
+	})
+	if err != nil {
+		glog.Errorf("Failed to annotate submitted pod %v: %v", identifier, err)
+	}
+}
+
+// annotationsChanged returns true if the annotations of the pod changed, other than the submitted
+// annotation, whose stamping isn't an update of the pod.
+func annotationsChanged(oldPod, newPod *v1.Pod) bool {
+	annotation := getSubmittedAnnotation()
+	if annotation == "" {
+		return !reflect.DeepEqual(oldPod.Annotations, newPod.Annotations)
+	}
+	withoutSubmitted := func(annotations map[string]string) map[string]string {
+		stripped := make(map[string]string, len(annotations))
+		for key, value := range annotations {
+			if key != annotation {
+				stripped[key] = value
+			}
+		}
+		return stripped
+	}
+	return !reflect.DeepEqual(withoutSubmitted(oldPod.Annotations), withoutSubmitted(newPod.Annotations))
+}
@@ -0,0 +1,51 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8sclient
+
+import (
+	"fmt"
+
+	"github.com/golang/glog"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// SwapRequestAnnotation is the pod annotation holding the swap the pod may use on the nodes with
+// swap enabled, e.g. "512Mi". The pod API has no swap budget of its own.
+const SwapRequestAnnotation = "poseidon.kubernetes.io/swap-request"
+
+// SwapRequestLabel is the task label telling Firmament the swap requested by the pod, in the unit of
+// the memory requests. The Firmament resource vector has no swap, so it's forwarded as a label.
+const SwapRequestLabel = "poseidon.kubernetes.io/swap-request"
+
+// getSwapRequest returns the swap requested by the annotation of the pod, in the unit of the memory
+// requests. It returns 0 if the pod has no swap budget, an invalid annotation is ignored.
+func getSwapRequest(pod *v1.Pod) int64 {
+	value, ok := pod.Annotations[SwapRequestAnnotation]
+	if !ok {
+		return 0
+	}
+	quantity, err := resource.ParseQuantity(value)
+	if err == nil && quantity.Sign() < 0 {
+		err = fmt.Errorf("swap %s is negative", value)
+	}
+	if err != nil {
+		glog.Errorf("Ignoring the invalid %s annotation of pod %s/%s: %v", SwapRequestAnnotation, pod.Namespace, pod.Name, err)
+		return 0
+	}
+	return memoryUnit.FromBytes(quantity.Value())
+}
@@ -0,0 +1,65 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8sclient
+
+import (
+	"github.com/golang/glog"
+	"k8s.io/api/core/v1"
+)
+
+// terminatingPods holds the pods whose task was removed when they started terminating, while
+// finalizers held their deletion or their node was being drained. Their updates are ignored until
+// they're deleted.
+var terminatingPods map[PodIdentifier]struct{}
+
+// isHeldByFinalizers returns true if the pod is terminating and finalizers keep it from being deleted,
+// which can last indefinitely.
+func isHeldByFinalizers(pod *v1.Pod) bool {
+	return pod.DeletionTimestamp != nil && len(pod.Finalizers) > 0
+}
+
+// handleTerminatingPod removes the task of a pod which started terminating and whose deletion is held
+// by finalizers, or whose node is being drained, rather than waiting for the pod to be deleted, so that
+// Firmament frees its resources. It returns true if the update of the pod is handled, i.e. the pod is
+// terminating and its task was removed.
+func (pw *PodWatcher) handleTerminatingPod(key interface{}, pod *v1.Pod) bool {
+	identifier := NewPodIdentifier(pod.Namespace, pod.Name)
+	PodMux.Lock()
+	_, removed := terminatingPods[identifier]
+	drained := isDrainedPod(pod)
+	if !removed && (drained || isHeldByFinalizers(pod)) {
+		terminatingPods[identifier] = struct{}{}
+	}
+	PodMux.Unlock()
+	if removed {
+		return true
+	}
+	if drained {
+		glog.V(2).Infof("Removing pod %v, it's evicted from drained node %s", identifier, pod.Spec.NodeName)
+	} else if isHeldByFinalizers(pod) {
+		glog.V(2).Infof("Removing pod %v, its deletion is held by the finalizers %v", identifier, pod.Finalizers)
+	} else {
+		return false
+	}
+	pw.unholdPod(identifier)
+	pw.podWorkQueue.Add(key, &Pod{
+		Identifier: identifier,
+		State:      PodDeleted,
+		OwnerRef:   GetOwnerReference(pod),
+	})
+	return true
+}
@@ -0,0 +1,37 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8sclient
+
+import (
+	"github.com/kubernetes-sigs/poseidon/pkg/tracing"
+)
+
+// The attributes of the spans, named after the OpenTelemetry semantic conventions.
+const (
+	spanAttributeNamespace = "k8s.namespace.name"
+	spanAttributePod       = "k8s.pod.name"
+	spanAttributeNode      = "k8s.node.name"
+)
+
+// startPodSpan starts a span about a pod, child of the given span context if it's valid. It returns
+// nil if tracing is disabled.
+func startPodSpan(parent tracing.SpanContext, name string, identifier PodIdentifier) *tracing.Span {
+	span := tracing.StartWithParent(parent, name)
+	span.SetAttribute(spanAttributeNamespace, identifier.Namespace)
+	span.SetAttribute(spanAttributePod, identifier.Name)
+	return span
+}
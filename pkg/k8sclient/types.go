@@ -18,8 +18,10 @@ package k8sclient
 
 import (
 	"sync"
+	"time"
 
 	"github.com/kubernetes-sigs/poseidon/pkg/firmament"
+	"github.com/kubernetes-sigs/poseidon/pkg/tracing"
 	"k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
@@ -28,6 +30,46 @@ import (
 
 const bytesToKb = 1024
 
+const (
+	// LabelOS is the node label holding the operating system of the node.
+	LabelOS = "kubernetes.io/os"
+	// BetaLabelOS is the deprecated node label holding the operating system of the node.
+	BetaLabelOS = "beta.kubernetes.io/os"
+	// DefaultOS is the operating system of the nodes without OS label and of the pods which don't select one.
+	DefaultOS = "linux"
+	// LabelArch is the node label holding the CPU architecture of the node.
+	LabelArch = "kubernetes.io/arch"
+	// BetaLabelArch is the deprecated node label holding the CPU architecture of the node.
+	BetaLabelArch = "beta.kubernetes.io/arch"
+	// LabelHostname is the node label holding the hostname of the node.
+	LabelHostname = "kubernetes.io/hostname"
+	// DefaultArch is the CPU architecture of the nodes without arch label, unless configured otherwise.
+	DefaultArch = "amd64"
+	// ScalarResourceLabelPrefix prefixes the names of the scalar resources of the nodes forwarded to
+	// Firmament as labels, the value of the label is the allocatable amount of the resource.
+	ScalarResourceLabelPrefix = "scalar-resource.poseidon.kubernetes.io/"
+)
+
+// MemoryUnit is the unit of the memory sent to Firmament.
+type MemoryUnit string
+
+const (
+	// MemoryUnitBytes sends the memory in bytes.
+	MemoryUnitBytes MemoryUnit = "Bytes"
+	// MemoryUnitKB sends the memory in KiB, this is the unit Firmament expects by default.
+	MemoryUnitKB MemoryUnit = "KB"
+	// MemoryUnitMB sends the memory in MiB.
+	MemoryUnitMB MemoryUnit = "MB"
+)
+
+// memoryUnit is the unit of the pod memory requests and the node memory capacities.
+// The MemRequestKb and Mem*Kb fields hold values in this unit.
+var memoryUnit = MemoryUnitKB
+
+// binaryMemory is true if the KB and MB memory units are binary, i.e. KiB and MiB, and false if they're
+// decimal, of 1000 bytes and 1000 KB.
+var binaryMemory = true
+
 // PodMux is used to guard access to the pod, task and job related maps.
 var PodMux *sync.RWMutex
 
@@ -39,6 +81,22 @@ var TaskIDToPod map[uint64]PodIdentifier
 var jobIDToJD map[string]*firmament.JobDescriptor
 var jobNumTasksToRemove map[string]int
 
+// podToNode maps Kubernetes pod identifier(namespace + name) to the node the pod was bound to.
+var podToNode map[PodIdentifier]string
+
+// jobGangSizes maps the job IDs to the number of their pods which are submitted together.
+var jobGangSizes map[string]int32
+
+// pendingGangs holds the pods waiting for the rest of their gang, keyed by job ID.
+var pendingGangs map[string][]*Pod
+
+// oversizedPods holds the latest version of the pods too large to be placed, which were removed from firmament.
+var oversizedPods map[PodIdentifier]*Pod
+
+// completedPods holds the pods whose task was reported completed to firmament, their deletion
+// doesn't report the task removed again.
+var completedPods map[PodIdentifier]struct{}
+
 // NodeMux is used to guard access to the node and resource related maps.
 var NodeMux *sync.RWMutex
 
@@ -64,14 +122,14 @@ const (
 
 type Taint struct {
 	// Required. The taint key to be applied to a node.
-	Key string
+	Key string `json:"key,omitempty"`
 	// Required. The taint value corresponding to the taint key.
 	// +optional
-	Value string
+	Value string `json:"value,omitempty"`
 	// Required. The effect of the taint on pods
 	// that do not tolerate the taint.
 	// Valid effects are NoSchedule, PreferNoSchedule and NoExecute.
-	Effect string
+	Effect string `json:"effect,omitempty"`
 	// TimeAdded represents the time at which the taint was added.
 	// It is only written for NoExecute taints.
 	// +optional
@@ -80,19 +138,25 @@ type Taint struct {
 
 // Node is an internal structure for a Kubernetes node.
 type Node struct {
-	Hostname         string
-	Phase            NodePhase
-	IsReady          bool
-	IsOutOfDisk      bool
-	CPUCapacity      int64
-	CPUAllocatable   int64
-	MemCapacityKb    int64
-	MemAllocatableKb int64
-	EphemeralCapKb   int64
-	EphemeralAllocKb int64
-	Labels           map[string]string
-	Annotations      map[string]string
-	Taints           []Taint
+	Hostname         string            `json:"hostname,omitempty"`
+	Phase            NodePhase         `json:"phase,omitempty"`
+	IsReady          bool              `json:"isReady,omitempty"`
+	IsOutOfDisk      bool              `json:"isOutOfDisk,omitempty"`
+	CPUCapacity      int64             `json:"cpuCapacity,omitempty"`
+	CPUAllocatable   int64             `json:"cpuAllocatable,omitempty"`
+	MemCapacityKb    int64             `json:"memCapacityKb,omitempty"`
+	MemAllocatableKb int64             `json:"memAllocatableKb,omitempty"`
+	EphemeralCapKb   int64             `json:"ephemeralCapKb,omitempty"`
+	EphemeralAllocKb int64             `json:"ephemeralAllocKb,omitempty"`
+	Labels           map[string]string `json:"labels,omitempty"`
+	Annotations      map[string]string `json:"annotations,omitempty"`
+	Taints           []Taint           `json:"taints,omitempty"`
+	// ScalarResources maps the extended resources the node can allocate, e.g. example.com/fpga, to
+	// their allocatable amount.
+	ScalarResources map[string]int64 `json:"scalarResources,omitempty"`
+	// PressureWeight is the negative scheduling weight of the pressure conditions of the node, 0 if
+	// the node is under no pressure.
+	PressureWeight int32 `json:"pressureWeight,omitempty"`
 }
 
 // PodPhase represents a pod phase.
@@ -107,6 +171,8 @@ const (
 	PodSucceeded PodPhase = "Succeeded"
 	// PodFailed is an internal phase used for failed pods.
 	PodFailed PodPhase = "Failed"
+	// PodEvicted is an internal phase used for pods evicted from their node.
+	PodEvicted PodPhase = "Evicted"
 	// PodUnknown is an internal phase used for state unknown pods.
 	PodUnknown PodPhase = "Unknown"
 	// PodDeleted is an internal phase used for removed pods.
@@ -115,67 +181,71 @@ const (
 	PodUpdated PodPhase = "Updated"
 )
 
-// PodIdentifier is used to identify a pod by its namespace and name.
+// PodIdentifier is used to identify a pod by its namespace and name, and by its cluster when several
+// clusters share Firmament.
 type PodIdentifier struct {
-	Name      string
-	Namespace string
+	Name      string `json:"name,omitempty"`
+	Namespace string `json:"namespace,omitempty"`
+	// ClusterID is the cluster of the pod, empty unless set with SetClusterID.
+	ClusterID string `json:"clusterID,omitempty"`
 }
 
-// UniqueName returns pod namespace/name.
+// UniqueName returns pod namespace/name. It's unique within the cluster of the pod only, as the keys
+// of the informers: the names of the tasks in Firmament are prefixed with the cluster ID.
 func (this *PodIdentifier) UniqueName() string {
 	return this.Namespace + "/" + this.Name
 }
 
 //Node Affinity Struct
 type NodeSelectorRequirement struct {
-	Key      string
-	Operator string
-	Values   []string
+	Key      string   `json:"key,omitempty"`
+	Operator string   `json:"operator,omitempty"`
+	Values   []string `json:"values,omitempty"`
 }
 
 type NodeSelector struct {
 	//Required. A list of node selector terms. The terms are ORed.
-	NodeSelectorTerms []NodeSelectorTerm
+	NodeSelectorTerms []NodeSelectorTerm `json:"nodeSelectorTerms,omitempty"`
 }
 
 // A null or empty node selector term matches no objects.
 type NodeSelectorTerm struct {
-	MatchExpressions []NodeSelectorRequirement
+	MatchExpressions []NodeSelectorRequirement `json:"matchExpressions,omitempty"`
 }
 type PreferredSchedulingTerm struct {
 	// Weight associated with matching the corresponding nodeSelectorTerm, in the range 1-100.
-	Weight int32
+	Weight int32 `json:"weight,omitempty"`
 	// A node selector term, associated with the corresponding weight.
-	Preference NodeSelectorTerm
+	Preference NodeSelectorTerm `json:"preference"`
 }
 type NodeAffinity struct {
-	HardScheduling *NodeSelector
-	SoftScheduling []PreferredSchedulingTerm
+	HardScheduling *NodeSelector             `json:"hardScheduling,omitempty"`
+	SoftScheduling []PreferredSchedulingTerm `json:"softScheduling,omitempty"`
 }
 
 //--------Pod Affinity -----//
 // Pod affinity is a group of inter pod affinity scheduling rules.
 
 type PodAffinityTerm struct {
-	LabelSelector *metav1.LabelSelector
-	Namespaces    []string
-	TopologyKey   string
+	LabelSelector *metav1.LabelSelector `json:"labelSelector,omitempty"`
+	Namespaces    []string              `json:"namespaces,omitempty"`
+	TopologyKey   string                `json:"topologyKey,omitempty"`
 }
 
 type WeightedPodAffinityTerm struct {
-	Weight          int32
-	PodAffinityTerm PodAffinityTerm
+	Weight          int32           `json:"weight,omitempty"`
+	PodAffinityTerm PodAffinityTerm `json:"podAffinityTerm"`
 }
 
 type PodAffinity struct {
-	HardScheduling []PodAffinityTerm
-	SoftScheduling []WeightedPodAffinityTerm
+	HardScheduling []PodAffinityTerm         `json:"hardScheduling,omitempty"`
+	SoftScheduling []WeightedPodAffinityTerm `json:"softScheduling,omitempty"`
 }
 
 type Affinity struct {
-	NodeAffinity    *NodeAffinity
-	PodAffinity     *PodAffinity
-	PodAntiAffinity *PodAffinity
+	NodeAffinity    *NodeAffinity `json:"nodeAffinity,omitempty"`
+	PodAffinity     *PodAffinity  `json:"podAffinity,omitempty"`
+	PodAntiAffinity *PodAffinity  `json:"podAntiAffinity,omitempty"`
 }
 
 // The pod this Toleration is attached to tolerates any taint that matches
@@ -184,43 +254,70 @@ type Toleration struct {
 	// Key is the taint key that the toleration applies to. Empty means match all taint keys.
 	// If the key is empty, operator must be Exists; this combination means to match all values and all keys.
 	// +optional
-	Key string
+	Key string `json:"key,omitempty"`
 	// Operator represents a key's relationship to the value.
 	// Valid operators are Exists and Equal. Defaults to Equal.
 	// Exists is equivalent to wildcard for value, so that a pod can
 	// tolerate all taints of a particular category.
 	// +optional
-	Operator string
+	Operator string `json:"operator,omitempty"`
 	// Value is the taint value the toleration matches to.
 	// If the operator is Exists, the value should be empty, otherwise just a regular string.
 	// +optional
-	Value string
+	Value string `json:"value,omitempty"`
 	// Effect indicates the taint effect to match. Empty means match all taint effects.
 	// When specified, allowed values are NoSchedule, PreferNoSchedule and NoExecute.
 	// +optional
-	Effect string
+	Effect string `json:"effect,omitempty"`
 	// TolerationSeconds represents the period of time the toleration (which must be
 	// of effect NoExecute, otherwise this field is ignored) tolerates the taint. By default,
 	// it is not set, which means tolerate the taint forever (do not evict). Zero and
 	// negative values will be treated as 0 (evict immediately) by the system.
 	// +optional
-	TolerationSeconds *int64
+	TolerationSeconds *int64 `json:"tolerationSeconds,omitempty"`
 }
 
 // Pod is an internal structure for a Kubernetes pod.
 type Pod struct {
-	Identifier      PodIdentifier
-	State           PodPhase
-	CPURequest      int64
-	MemRequestKb    int64
-	EphemeralReqKb  int64
-	Labels          map[string]string
-	Annotations     map[string]string
-	NodeSelector    map[string]string
-	OwnerRef        string
-	Affinity        *Affinity
-	CreateTimeStamp metav1.Time
-	Tolerations     []Toleration
+	Identifier      PodIdentifier     `json:"identifier"`
+	State           PodPhase          `json:"state,omitempty"`
+	CPURequest      int64             `json:"cpuRequest,omitempty"`
+	MemRequestKb    int64             `json:"memRequestKb,omitempty"`
+	EphemeralReqKb  int64             `json:"ephemeralReqKb,omitempty"`
+	Labels          map[string]string `json:"labels,omitempty"`
+	Annotations     map[string]string `json:"annotations,omitempty"`
+	NodeSelector    map[string]string `json:"nodeSelector,omitempty"`
+	OwnerRef        string            `json:"ownerRef,omitempty"`
+	Affinity        *Affinity         `json:"affinity,omitempty"`
+	CreateTimeStamp metav1.Time       `json:"createTimeStamp"`
+	StartTime       metav1.Time       `json:"startTime"`
+	Priority        int32             `json:"priority,omitempty"`
+	Tolerations     []Toleration      `json:"tolerations,omitempty"`
+	// GangSize is the number of pods of the owner which are submitted together, 0 if the pod isn't part of a gang.
+	GangSize int32 `json:"gangSize,omitempty"`
+	// ScheduleDeadline is the time by which the pod has to be placed, zero if it has no deadline.
+	ScheduleDeadline metav1.Time `json:"scheduleDeadline"`
+	// RestartCount is the number of times the containers of the pod restarted.
+	RestartCount int32 `json:"restartCount,omitempty"`
+	// ControllerRef is the top-level controller of the pod, e.g. the Deployment of the ReplicaSet
+	// owning it, nil if the pod has no controller.
+	ControllerRef *ControllerRef `json:"controllerRef,omitempty"`
+	// BandwidthRequest is the network bandwidth requested by the annotations of the pod, nil if none.
+	BandwidthRequest *BandwidthRequest `json:"bandwidthRequest,omitempty"`
+	// IsReady is true if the Ready condition of the pod and all its readiness gates are satisfied.
+	IsReady bool `json:"isReady,omitempty"`
+	// ServiceAccount is the service account the pod runs as.
+	ServiceAccount string `json:"serviceAccount,omitempty"`
+	// SwapRequestKb is the swap the pod may use on the nodes with swap enabled, 0 if it has no swap budget.
+	SwapRequestKb int64 `json:"swapRequestKb,omitempty"`
+	// ExtendedRequests holds the extended resources requested by the pod, e.g. example.com/fpga.
+	ExtendedRequests map[string]int64 `json:"extendedRequests,omitempty"`
+	// Containers holds the requests and limits of each container of the pod, which the requests above
+	// aggregate.
+	Containers []ContainerResources `json:"containers,omitempty"`
+	// spanContext is the span of the conversion of the pod, which its submission continues. It's invalid
+	// if tracing is disabled.
+	spanContext tracing.SpanContext
 }
 
 // NodeWatcher is a Kubernetes node watcher.
@@ -230,6 +327,30 @@ type NodeWatcher struct {
 	nodeWorkQueue Queue
 	controller    cache.Controller
 	fc            firmament.FirmamentSchedulerClient
+	// watchErrorHandler is called on the list and watch errors of the informer.
+	watchErrorHandler func(err error)
+	// nodeAddedHandler, if set, is called once a new node has been added to Firmament.
+	nodeAddedHandler func()
+	// useNodeCapacity reports the node capacity to Firmament instead of the allocatable resources.
+	useNodeCapacity bool
+	// defaultArch is the CPU architecture of the nodes without arch label.
+	defaultArch string
+	// labelPrefixes holds the prefixes of the node labels forwarded to Firmament, all of them if empty.
+	labelPrefixes []string
+	// store holds the nodes of the informer.
+	store cache.Store
+	// resyncPeriod is the time between two reconciliations of the node resources, 0 if disabled.
+	resyncPeriod time.Duration
+	// notReadyThreshold is the time a node has to stay NotReady before its pods are rescheduled, 0 if disabled.
+	notReadyThreshold time.Duration
+	// nodeNotReadyHandler, if set, is called with the name of a node which stayed NotReady past the threshold.
+	nodeNotReadyHandler func(nodeName string)
+	// nodeCordonedHandler, if set, is called with the name of a node which was cordoned or uncordoned.
+	nodeCordonedHandler func(nodeName string, cordoned bool)
+	// notReadyTimersMux guards notReadyTimers.
+	notReadyTimersMux sync.Mutex
+	// notReadyTimers holds the timers of the nodes which are NotReady.
+	notReadyTimers map[string]*time.Timer
 }
 
 // PodWatcher is a Kubernetes pod watcher.
@@ -238,7 +359,98 @@ type PodWatcher struct {
 	clientset    kubernetes.Interface
 	podWorkQueue Queue
 	controller   cache.Controller
-	fc           firmament.FirmamentSchedulerClient
+	// backend is the scheduler the tasks of the pods are handed to, Firmament by default.
+	backend SchedulerBackend
+	// controllerRefs caches the top-level controllers of the owners of the pods.
+	controllerRefs controllerRefCache
+	// owners caches the controllers owning the pods, e.g. the Jobs.
+	owners *OwnerWatcher
+	// gangScheduling enables holding back the pods of an owner until the whole gang is pending.
+	gangScheduling bool
+	// namespaceAllowlist holds the namespaces whose pods are scheduled, all of them if empty.
+	namespaceAllowlist map[string]struct{}
+	// namespaceDenylist holds the namespaces whose pods are ignored.
+	namespaceDenylist map[string]struct{}
+	// bestEffortCPURequest (in millicores) and bestEffortMemRequest (in bytes) are the shadow requests of the BestEffort pods.
+	bestEffortCPURequest int64
+	bestEffortMemRequest int64
+	// maxCPURequest (in millicores) and maxMemRequest (in bytes) bound the requests of the pods, 0 if unbounded.
+	maxCPURequest int64
+	maxMemRequest int64
+	// annotationLabelPrefixes maps the prefixes of the pod annotations forwarded as task labels
+	// to the prefixes of the label keys.
+	annotationLabelPrefixes map[string]string
+	// watchErrorHandler is called on the list and watch errors of the informer.
+	watchErrorHandler func(err error)
+	// pauseMux guards paused and resumeCh.
+	pauseMux sync.Mutex
+	paused   bool
+	// resumeCh is closed when the paused workers can carry on.
+	resumeCh chan struct{}
+	// panicRetriesMux guards panicRetries.
+	panicRetriesMux sync.Mutex
+	// panicRetries counts the retries of the pods whose processing panicked.
+	panicRetries map[PodIdentifier]int
+	// taskRemovalMaxRetries is the number of times the removal of a task from Firmament is retried.
+	taskRemovalMaxRetries int
+	// taskRemovalRetriesMux guards taskRemovalRetries.
+	taskRemovalRetriesMux sync.Mutex
+	// taskRemovalRetries counts the retries of the removals of the tasks Firmament failed to remove.
+	taskRemovalRetries map[PodIdentifier]int
+	// initialPodsMux guards initialPods and initialSyncDone.
+	initialPodsMux sync.Mutex
+	// initialPods buffers the pods of the initial list until they are enqueued in one batch.
+	initialPods     []*v1.Pod
+	initialSyncDone bool
+	// removeTasksOnShutdown withdraws all the tasks from Firmament on a clean shutdown.
+	removeTasksOnShutdown bool
+	// submissionGracePeriod is the time a new pod has to stay unchanged before it's submitted.
+	submissionGracePeriod time.Duration
+	// heldPodsMux guards heldPods.
+	heldPodsMux sync.Mutex
+	// heldPods holds the new pods held for the grace period.
+	heldPods map[PodIdentifier]*heldPod
+	// retryBudget, if set, bounds the rate of the retries of all the pods.
+	retryBudget *retryBudget
+	// crashLoopUpdateInterval is the minimum time between two updates of a crash-looping pod, 0 if unlimited.
+	crashLoopUpdateInterval time.Duration
+	// crashLoopUpdatesMux guards crashLoopUpdates.
+	crashLoopUpdatesMux sync.Mutex
+	// crashLoopUpdates holds the last update of the crash-looping pods and the update held since.
+	crashLoopUpdates map[PodIdentifier]*crashLoopUpdate
+	// starvationThreshold is the time after which a pending pod is counted as starved, 0 if never.
+	starvationThreshold time.Duration
+	// starvedPodsMux guards starvedPods.
+	starvedPodsMux sync.Mutex
+	// starvedPods holds the pending pods already counted as starved.
+	starvedPods map[PodIdentifier]struct{}
+	// skipMirrorPods keeps the mirror pods of the static kubelet manifests off Firmament.
+	skipMirrorPods bool
+	// withdrawJobRetries removes the failed Job pods the Job retries instead of reporting them failed.
+	withdrawJobRetries bool
+	// maxInFlightPerOwner is the number of pods of an owner submitted and not yet placed at once, 0 if unlimited.
+	maxInFlightPerOwner int
+	// memGranularity is the granularity, in the memory unit, the memory requests are rounded up to.
+	memGranularity int64
+	// reportContainers forwards the requests and limits of each container to Firmament as a task label.
+	reportContainers bool
+	// skipAffinity doesn't convert the pod (anti-)affinity and the preferred node affinity of the pods,
+	// for throughput in the clusters which don't use them. The required node affinity is still converted.
+	skipAffinity bool
+	// labelPrefixes holds the prefixes of the pod labels forwarded to Firmament, all of them if empty.
+	labelPrefixes []string
+	// affinityLabelsMux guards affinityLabels.
+	affinityLabelsMux sync.Mutex
+	// affinityLabels holds the labels selected by the pod (anti-)affinity of the pods, forwarded
+	// whatever labelPrefixes.
+	affinityLabels map[string]struct{}
+	// maxUnschedulable is the number of scheduling rounds a pod may be left unscheduled in before
+	// it's held back, 0 if unlimited.
+	maxUnschedulable int
+	// podMutatorsMux guards podMutators.
+	podMutatorsMux sync.RWMutex
+	// podMutators holds the registered mutators, in the order they are invoked.
+	podMutators []PodMutator
 }
 
 // BindInfo
@@ -0,0 +1,99 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8sclient
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/golang/glog"
+)
+
+// unschedulableAttempts counts the scheduling rounds Firmament left each submitted pod unscheduled in.
+var unschedulableAttempts map[PodIdentifier]int
+
+// podUnschedulableHandler handles the pods Firmament failed to place, it's nil until the pod watcher is started.
+var podUnschedulableHandler func(identifier PodIdentifier)
+var podUnschedulableHandlerLock = new(sync.RWMutex)
+
+// setPodUnschedulableHandler sets the function called for each pod Firmament reports unscheduled.
+func setPodUnschedulableHandler(handler func(identifier PodIdentifier)) {
+	podUnschedulableHandlerLock.Lock()
+	defer podUnschedulableHandlerLock.Unlock()
+	podUnschedulableHandler = handler
+}
+
+// notifyPodUnschedulable calls the podUnschedulableHandler, if any, for a pod Firmament reported unscheduled.
+func notifyPodUnschedulable(identifier PodIdentifier) {
+	podUnschedulableHandlerLock.RLock()
+	handler := podUnschedulableHandler
+	podUnschedulableHandlerLock.RUnlock()
+	if handler != nil {
+		handler(identifier)
+	}
+}
+
+// handleUnschedulablePod counts a scheduling round Firmament left the pod unscheduled in. Firmament
+// considers the pod again in every round, so a pod which requests more than any node provides, or
+// which is still unscheduled after maxUnschedulable rounds, is held back instead.
+func (pw *PodWatcher) handleUnschedulablePod(identifier PodIdentifier) {
+	PodMux.Lock()
+	_, held := oversizedPods[identifier]
+	_, submitted := PodToTD[identifier]
+	if held || !submitted {
+		PodMux.Unlock()
+		return
+	}
+	unschedulableAttempts[identifier]++
+	attempts := unschedulableAttempts[identifier]
+	PodMux.Unlock()
+	convertedPodsLock.RLock()
+	pod, ok := convertedPods[identifier]
+	convertedPodsLock.RUnlock()
+	if !ok {
+		return
+	}
+	switch {
+	case pw.exceedsNodeCapacities(pod):
+		pw.holdUnschedulablePod(pod, "it requests more resources than any node provides")
+	case pw.maxUnschedulable > 0 && attempts >= pw.maxUnschedulable:
+		pw.holdUnschedulablePod(pod, fmt.Sprintf("Firmament couldn't place it in %d attempts", attempts))
+	}
+}
+
+// holdUnschedulablePod reports a pod which is too large to be placed and removes it from Firmament.
+// The pod is evaluated again once it changes or a node is added.
+func (pw *PodWatcher) holdUnschedulablePod(pod *Pod, reason string) {
+	PodMux.Lock()
+	if _, held := oversizedPods[pod.Identifier]; held {
+		PodMux.Unlock()
+		return
+	}
+	heldPod := *pod
+	oversizedPods[pod.Identifier] = &heldPod
+	delete(unschedulableAttempts, pod.Identifier)
+	PodMux.Unlock()
+	glog.Warningf("Pod %v is too large, %s, removing it from Firmament until it changes", pod.Identifier, reason)
+	if pw.clientset != nil {
+		NewPoseidonEvents(pw.clientset).ProcessOversizedPodEvent(pod, reason)
+	}
+	pw.podWorkQueue.Add(pod.Identifier.UniqueName(), &Pod{
+		Identifier: pod.Identifier,
+		State:      PodDeleted,
+		OwnerRef:   pod.OwnerRef,
+	})
+}
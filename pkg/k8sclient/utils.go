@@ -19,9 +19,11 @@ package k8sclient
 import (
 	"bytes"
 	"encoding/gob"
+	"fmt"
 	"hash/fnv"
 	"math/rand"
 	"sync"
+	"time"
 
 	"github.com/golang/glog"
 	"github.com/google/uuid"
@@ -68,3 +70,56 @@ func HashCombine(valueOne, valueTwo interface{}) uint64 {
 	newHash.Write(append(valueOneBytes, valueTwoBytes...))
 	return newHash.Sum64()
 }
+
+// ParseMemoryUnit returns the MemoryUnit with the given name.
+func ParseMemoryUnit(name string) (MemoryUnit, error) {
+	switch unit := MemoryUnit(name); unit {
+	case MemoryUnitBytes, MemoryUnitKB, MemoryUnitMB:
+		return unit, nil
+	default:
+		return "", fmt.Errorf("unknown memory unit %q, valid units are %s, %s and %s", name, MemoryUnitBytes, MemoryUnitKB, MemoryUnitMB)
+	}
+}
+
+// FromBytes converts a number of bytes into the unit, binary or decimal depending on binaryMemory.
+func (unit MemoryUnit) FromBytes(bytes int64) int64 {
+	var base int64 = bytesToKb
+	if !binaryMemory {
+		base = 1000
+	}
+	switch unit {
+	case MemoryUnitBytes:
+		return bytes
+	case MemoryUnitMB:
+		return bytes / (base * base)
+	default:
+		return bytes / base
+	}
+}
+
+// roundUpToGranularity rounds an amount up to a multiple of the granularity, a granularity of 1 or
+// less leaves it unchanged.
+func roundUpToGranularity(amount, granularity int64) int64 {
+	if granularity <= 1 || amount%granularity == 0 {
+		return amount
+	}
+	return (amount/granularity + 1) * granularity
+}
+
+// toFirmamentTimestamp converts a time to a Firmament timestamp, in microseconds since the epoch.
+// The zero time is converted to 0.
+func toFirmamentTimestamp(t time.Time) uint64 {
+	if t.IsZero() {
+		return 0
+	}
+	return uint64(t.UnixNano() / int64(time.Microsecond))
+}
+
+// toFirmamentPriority converts a pod priority to a Firmament priority, the negative priorities are
+// converted to 0.
+func toFirmamentPriority(priority int32) uint32 {
+	if priority < 0 {
+		return 0
+	}
+	return uint32(priority)
+}
@@ -0,0 +1,73 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8sclient
+
+import (
+	"io"
+
+	"github.com/golang/glog"
+	"github.com/kubernetes-sigs/poseidon/pkg/metrics"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+)
+
+// newWatchErrorHandler returns the default handler of the list and watch errors of the given resource.
+// The reflector of the informer relists and watches again after an error, so the handler only reports it.
+func newWatchErrorHandler(resource string) func(err error) {
+	return func(err error) {
+		metrics.WatchErrors.WithLabelValues(resource).Inc()
+		switch {
+		case apierrors.IsResourceExpired(err) || apierrors.IsGone(err):
+			// The watched resource version is too old, this is expected from time to time.
+			glog.V(2).Infof("Watch of %s closed with: %v", resource, err)
+		case err == io.EOF:
+			glog.V(2).Infof("Watch of %s closed by the API server", resource)
+		default:
+			glog.Errorf("Failed to list or watch %s: %v", resource, err)
+		}
+	}
+}
+
+// newErrorReportingListWatch wraps listWatch so that its list and watch errors, including the error
+// events of an open watch, are passed to handleError before the informer sees them.
+func newErrorReportingListWatch(listWatch *cache.ListWatch, handleError func(err error)) *cache.ListWatch {
+	return &cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			obj, err := listWatch.ListFunc(options)
+			if err != nil {
+				handleError(err)
+			}
+			return obj, err
+		},
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			w, err := listWatch.WatchFunc(options)
+			if err != nil {
+				handleError(err)
+				return w, err
+			}
+			return watch.Filter(w, func(event watch.Event) (watch.Event, bool) {
+				if event.Type == watch.Error {
+					handleError(apierrors.FromObject(event.Object))
+				}
+				return event, true
+			}), nil
+		},
+	}
+}
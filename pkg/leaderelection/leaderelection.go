@@ -0,0 +1,272 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package leaderelection implements a lease based leader election so that only
+// one Poseidon replica at a time watches pods and talks to Firmament.
+// The lease is stored as an annotation on a ConfigMap, which is the lock
+// type available in all the Kubernetes versions Poseidon supports.
+package leaderelection
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/golang/glog"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/clock"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// LeaderElectionRecordAnnotationKey is the annotation holding the lease on the lock ConfigMap.
+	LeaderElectionRecordAnnotationKey = "control-plane.alpha.kubernetes.io/leader"
+	// JitterFactor is the jitter applied to the retry period while acquiring the lease.
+	JitterFactor = 1.2
+)
+
+// LeaderElectionRecord is the record stored in the lock annotation.
+type LeaderElectionRecord struct {
+	HolderIdentity       string      `json:"holderIdentity"`
+	LeaseDurationSeconds int         `json:"leaseDurationSeconds"`
+	AcquireTime          metav1.Time `json:"acquireTime"`
+	RenewTime            metav1.Time `json:"renewTime"`
+	LeaderTransitions    int         `json:"leaderTransitions"`
+}
+
+// LeaderCallbacks are invoked on leadership changes.
+type LeaderCallbacks struct {
+	// OnStartedLeading is called when the lease is acquired. The stop channel
+	// is closed once the lease is lost and the callback is expected to return
+	// after it has stopped its work.
+	OnStartedLeading func(stop <-chan struct{})
+	// OnStoppedLeading is called after OnStartedLeading has returned, or when
+	// the elector is stopped before it ever acquired the lease.
+	OnStoppedLeading func()
+}
+
+// Config holds the leader election parameters.
+type Config struct {
+	// Client is used to read and write the lock ConfigMap.
+	Client kubernetes.Interface
+	// Namespace and Name identify the lock ConfigMap.
+	Namespace string
+	Name      string
+	// Identity is the unique identity of this candidate, e.g. the pod name.
+	Identity string
+	// LeaseDuration is how long non-leader candidates wait before trying to take over the lease.
+	LeaseDuration time.Duration
+	// RenewDeadline is how long the leader retries renewing the lease before giving up.
+	RenewDeadline time.Duration
+	// RetryPeriod is the time between acquire and renew attempts.
+	RetryPeriod time.Duration
+	Callbacks   LeaderCallbacks
+}
+
+// LeaderElector runs the leader election for one candidate.
+type LeaderElector struct {
+	config Config
+	// observedRecord is the last lease record read from or written to the lock.
+	observedRecord LeaderElectionRecord
+	// observedTime is the local time observedRecord was last changed.
+	observedTime time.Time
+	clock        clock.Clock
+}
+
+// NewLeaderElector validates the config and returns a LeaderElector.
+func NewLeaderElector(lec Config) (*LeaderElector, error) {
+	if lec.LeaseDuration <= lec.RenewDeadline {
+		return nil, fmt.Errorf("leaseDuration must be greater than renewDeadline")
+	}
+	if lec.RenewDeadline <= time.Duration(JitterFactor*float64(lec.RetryPeriod)) {
+		return nil, fmt.Errorf("renewDeadline must be greater than retryPeriod*JitterFactor")
+	}
+	if lec.Client == nil {
+		return nil, fmt.Errorf("client must not be nil")
+	}
+	if lec.Name == "" || lec.Namespace == "" {
+		return nil, fmt.Errorf("lock namespace and name must not be empty")
+	}
+	if lec.Identity == "" {
+		return nil, fmt.Errorf("identity must not be empty")
+	}
+	if lec.Callbacks.OnStartedLeading == nil || lec.Callbacks.OnStoppedLeading == nil {
+		return nil, fmt.Errorf("OnStartedLeading and OnStoppedLeading callbacks must not be nil")
+	}
+	return &LeaderElector{
+		config: lec,
+		clock:  clock.RealClock{},
+	}, nil
+}
+
+// Run blocks until the lease is acquired, runs OnStartedLeading while the
+// lease is held and returns once the lease is lost or stopCh is closed.
+func (le *LeaderElector) Run(stopCh <-chan struct{}) {
+	defer utilruntime.HandleCrash()
+	defer le.config.Callbacks.OnStoppedLeading()
+	if !le.acquire(stopCh) {
+		return
+	}
+	leaderStopCh := make(chan struct{})
+	leaderDone := make(chan struct{})
+	go func() {
+		defer close(leaderDone)
+		le.config.Callbacks.OnStartedLeading(leaderStopCh)
+	}()
+	le.renew(stopCh)
+	close(leaderStopCh)
+	// Wait for the leader to stop its work before reporting the loss.
+	<-leaderDone
+}
+
+// IsLeader returns true if the last observed leader was this candidate.
+func (le *LeaderElector) IsLeader() bool {
+	return le.observedRecord.HolderIdentity == le.config.Identity
+}
+
+// GetLeader returns the identity of the last observed leader.
+func (le *LeaderElector) GetLeader() string {
+	return le.observedRecord.HolderIdentity
+}
+
+// acquire loops until the lease is acquired or stopCh is closed.
+func (le *LeaderElector) acquire(stopCh <-chan struct{}) bool {
+	glog.Infof("Attempting to acquire leader lease %s", le.describe())
+	for {
+		if le.tryAcquireOrRenew() {
+			glog.Infof("Successfully acquired lease %s", le.describe())
+			return true
+		}
+		glog.V(4).Infof("Failed to acquire lease %s, current leader is %q", le.describe(), le.GetLeader())
+		select {
+		case <-stopCh:
+			return false
+		case <-time.After(wait.Jitter(le.config.RetryPeriod, JitterFactor)):
+		}
+	}
+}
+
+// renew loops renewing the lease until it fails to renew within RenewDeadline or stopCh is closed.
+func (le *LeaderElector) renew(stopCh <-chan struct{}) {
+	for {
+		err := wait.Poll(le.config.RetryPeriod, le.config.RenewDeadline, func() (bool, error) {
+			return le.tryAcquireOrRenew(), nil
+		})
+		if err != nil {
+			glog.Errorf("Failed to renew lease %s: %v", le.describe(), err)
+			return
+		}
+		glog.V(4).Infof("Successfully renewed lease %s", le.describe())
+		select {
+		case <-stopCh:
+			return
+		case <-time.After(le.config.RetryPeriod):
+		}
+	}
+}
+
+// tryAcquireOrRenew tries to acquire the lease if it is free or expired, or to renew it if
+// this candidate already holds it. It returns true on success.
+func (le *LeaderElector) tryAcquireOrRenew() bool {
+	now := metav1.NewTime(le.clock.Now())
+	leaderElectionRecord := LeaderElectionRecord{
+		HolderIdentity:       le.config.Identity,
+		LeaseDurationSeconds: int(le.config.LeaseDuration / time.Second),
+		RenewTime:            now,
+		AcquireTime:          now,
+	}
+
+	configMaps := le.config.Client.CoreV1().ConfigMaps(le.config.Namespace)
+	cm, err := configMaps.Get(le.config.Name, metav1.GetOptions{})
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			glog.Errorf("Error retrieving lock %s: %v", le.describe(), err)
+			return false
+		}
+		recordBytes, err := json.Marshal(leaderElectionRecord)
+		if err != nil {
+			glog.Errorf("Error encoding lease record: %v", err)
+			return false
+		}
+		_, err = configMaps.Create(&v1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      le.config.Name,
+				Namespace: le.config.Namespace,
+				Annotations: map[string]string{
+					LeaderElectionRecordAnnotationKey: string(recordBytes),
+				},
+			},
+		})
+		if err != nil {
+			glog.Errorf("Error creating lock %s: %v", le.describe(), err)
+			return false
+		}
+		le.observedRecord = leaderElectionRecord
+		le.observedTime = le.clock.Now()
+		return true
+	}
+
+	var oldLeaderElectionRecord LeaderElectionRecord
+	if recordBytes, ok := cm.Annotations[LeaderElectionRecordAnnotationKey]; ok {
+		if err := json.Unmarshal([]byte(recordBytes), &oldLeaderElectionRecord); err != nil {
+			glog.Errorf("Error decoding lease record of lock %s: %v", le.describe(), err)
+			return false
+		}
+	}
+	if !reflect.DeepEqual(le.observedRecord, oldLeaderElectionRecord) {
+		le.observedRecord = oldLeaderElectionRecord
+		le.observedTime = le.clock.Now()
+	}
+	if le.observedTime.Add(le.config.LeaseDuration).After(le.clock.Now()) &&
+		oldLeaderElectionRecord.HolderIdentity != "" &&
+		!le.IsLeader() {
+		glog.V(4).Infof("Lock %s is held by %s and has not yet expired", le.describe(), oldLeaderElectionRecord.HolderIdentity)
+		return false
+	}
+
+	// The lease is ours or it has expired, so we can write it.
+	if le.IsLeader() {
+		leaderElectionRecord.AcquireTime = oldLeaderElectionRecord.AcquireTime
+		leaderElectionRecord.LeaderTransitions = oldLeaderElectionRecord.LeaderTransitions
+	} else {
+		leaderElectionRecord.LeaderTransitions = oldLeaderElectionRecord.LeaderTransitions + 1
+	}
+	recordBytes, err := json.Marshal(leaderElectionRecord)
+	if err != nil {
+		glog.Errorf("Error encoding lease record: %v", err)
+		return false
+	}
+	if cm.Annotations == nil {
+		cm.Annotations = make(map[string]string)
+	}
+	cm.Annotations[LeaderElectionRecordAnnotationKey] = string(recordBytes)
+	if _, err := configMaps.Update(cm); err != nil {
+		glog.Errorf("Failed to update lock %s: %v", le.describe(), err)
+		return false
+	}
+	le.observedRecord = leaderElectionRecord
+	le.observedTime = le.clock.Now()
+	return true
+}
+
+func (le *LeaderElector) describe() string {
+	return le.config.Namespace + "/" + le.config.Name
+}
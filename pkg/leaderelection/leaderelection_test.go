@@ -0,0 +1,169 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package leaderelection
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/clock"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func newTestElector(t *testing.T, client kubernetes.Interface, identity string, fakeClock clock.Clock, callbacks LeaderCallbacks) *LeaderElector {
+	if callbacks.OnStartedLeading == nil {
+		callbacks.OnStartedLeading = func(stop <-chan struct{}) {}
+	}
+	if callbacks.OnStoppedLeading == nil {
+		callbacks.OnStoppedLeading = func() {}
+	}
+	le, err := NewLeaderElector(Config{
+		Client:        client,
+		Namespace:     "kube-system",
+		Name:          "poseidon",
+		Identity:      identity,
+		LeaseDuration: 1500 * time.Millisecond,
+		RenewDeadline: 1000 * time.Millisecond,
+		RetryPeriod:   200 * time.Millisecond,
+		Callbacks:     callbacks,
+	})
+	if err != nil {
+		t.Fatalf("NewLeaderElector failed: %v", err)
+	}
+	le.clock = fakeClock
+	return le
+}
+
+func getLeaderRecord(t *testing.T, client kubernetes.Interface) LeaderElectionRecord {
+	cm, err := client.CoreV1().ConfigMaps("kube-system").Get("poseidon", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Unable to get the lock: %v", err)
+	}
+	var record LeaderElectionRecord
+	if err := json.Unmarshal([]byte(cm.Annotations[LeaderElectionRecordAnnotationKey]), &record); err != nil {
+		t.Fatalf("Unable to decode the lease record: %v", err)
+	}
+	return record
+}
+
+func TestNewLeaderElector(t *testing.T) {
+	_, err := NewLeaderElector(Config{
+		Client:        fake.NewSimpleClientset(),
+		Namespace:     "kube-system",
+		Name:          "poseidon",
+		Identity:      "poseidon-0",
+		LeaseDuration: time.Second,
+		RenewDeadline: 2 * time.Second,
+		RetryPeriod:   time.Second,
+	})
+	if err == nil {
+		t.Error("expected an error for a lease duration shorter than the renew deadline")
+	}
+}
+
+func TestLeaderElector_tryAcquireOrRenew(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	fakeClock := clock.NewFakeClock(time.Now())
+	first := newTestElector(t, client, "poseidon-0", fakeClock, LeaderCallbacks{})
+	second := newTestElector(t, client, "poseidon-1", fakeClock, LeaderCallbacks{})
+
+	// The first candidate creates the lock and becomes the leader.
+	if !first.tryAcquireOrRenew() || !first.IsLeader() {
+		t.Fatal("expected poseidon-0 to acquire the lease")
+	}
+	// The second candidate must stay a standby while the lease is valid.
+	if second.tryAcquireOrRenew() || second.IsLeader() {
+		t.Fatal("expected poseidon-1 to fail acquiring a held lease")
+	}
+	if second.GetLeader() != "poseidon-0" {
+		t.Errorf("expected poseidon-1 to observe poseidon-0 as leader, got %q", second.GetLeader())
+	}
+	// The leader can renew its own lease.
+	fakeClock.Step(time.Second)
+	if !first.tryAcquireOrRenew() {
+		t.Fatal("expected poseidon-0 to renew the lease")
+	}
+
+	// The first candidate stops renewing and the lease expires.
+	second.tryAcquireOrRenew()
+	fakeClock.Step(2 * time.Second)
+	if !second.tryAcquireOrRenew() || !second.IsLeader() {
+		t.Fatal("expected poseidon-1 to take over the expired lease")
+	}
+	record := getLeaderRecord(t, client)
+	if record.HolderIdentity != "poseidon-1" || record.LeaderTransitions != 1 {
+		t.Errorf("unexpected lease record after the takeover %+v", record)
+	}
+	// The former leader observes the loss on its next renewal.
+	if first.tryAcquireOrRenew() || first.IsLeader() {
+		t.Error("expected poseidon-0 to lose the lease")
+	}
+}
+
+func TestLeaderElector_Run(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	started := make(chan struct{})
+	workerStopped := make(chan struct{})
+	stoppedLeading := make(chan struct{})
+	le := newTestElector(t, client, "poseidon-0", clock.RealClock{}, LeaderCallbacks{
+		OnStartedLeading: func(stop <-chan struct{}) {
+			close(started)
+			<-stop
+			close(workerStopped)
+		},
+		OnStoppedLeading: func() {
+			close(stoppedLeading)
+		},
+	})
+	go le.Run(make(chan struct{}))
+
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the leadership to be acquired")
+	}
+
+	// Another replica steals the lock, the elector must stop the leader work.
+	cm, err := client.CoreV1().ConfigMaps("kube-system").Get("poseidon", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Unable to get the lock: %v", err)
+	}
+	stolen, _ := json.Marshal(LeaderElectionRecord{
+		HolderIdentity:       "poseidon-1",
+		LeaseDurationSeconds: 60,
+		AcquireTime:          metav1.Now(),
+		RenewTime:            metav1.Now(),
+	})
+	cm.Annotations[LeaderElectionRecordAnnotationKey] = string(stolen)
+	if _, err := client.CoreV1().ConfigMaps("kube-system").Update(cm); err != nil {
+		t.Fatalf("Unable to update the lock: %v", err)
+	}
+
+	select {
+	case <-stoppedLeading:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the leadership to be lost")
+	}
+	select {
+	case <-workerStopped:
+	default:
+		t.Error("expected the leader work to be stopped before OnStoppedLeading")
+	}
+}
@@ -63,6 +63,30 @@ var (
 			Name:      "total_preemption_attempts",
 			Help:      "Total preemption attempts in the cluster till now",
 		})
+	WatchErrors = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Subsystem: schedulerSubsystem,
+			Name:      "total_watch_errors",
+			Help:      "Total errors of the Kubernetes list and watch calls by resource",
+		}, []string{"resource"})
+	FirmamentRPCs = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Subsystem: schedulerSubsystem,
+			Name:      "total_firmament_rpcs",
+			Help:      "Total calls to Firmament by RPC, reply type and gRPC status code",
+		}, []string{"rpc", "reply", "code"})
+	OldestPendingPodAge = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Subsystem: schedulerSubsystem,
+			Name:      "oldest_pending_pod_age_seconds",
+			Help:      "Age of the oldest pod waiting to be placed, 0 if none is",
+		})
+	StarvedPods = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Subsystem: schedulerSubsystem,
+			Name:      "total_starved_pods",
+			Help:      "Total pods which stayed pending longer than the starvation threshold",
+		})
 )
 
 var registerMetrics sync.Once
@@ -76,6 +100,13 @@ func Register() {
 		prometheus.MustRegister(SchedulingPremptionEvaluationDuration)
 		prometheus.MustRegister(PreemptionVictims)
 		prometheus.MustRegister(PreemptionAttempts)
+		prometheus.MustRegister(WatchErrors)
+		prometheus.MustRegister(FirmamentRPCs)
+		prometheus.MustRegister(WorkQueueProcessed)
+		prometheus.MustRegister(WorkQueueErrors)
+		prometheus.MustRegister(workQueueDepth)
+		prometheus.MustRegister(OldestPendingPodAge)
+		prometheus.MustRegister(StarvedPods)
 	})
 }
 
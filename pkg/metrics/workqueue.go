@@ -0,0 +1,127 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"expvar"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// The statistics of the work queues of the watchers, labelled by queue. They're also published via
+// expvar, on /debug/vars, for the environments without Prometheus.
+var (
+	WorkQueueProcessed = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Subsystem: schedulerSubsystem,
+			Name:      "total_work_queue_processed",
+			Help:      "Total items processed by the watcher workers by queue",
+		}, []string{"queue"})
+	WorkQueueErrors = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Subsystem: schedulerSubsystem,
+			Name:      "total_work_queue_errors",
+			Help:      "Total items the watcher workers failed to process by queue",
+		}, []string{"queue"})
+	workQueueDepth = &workQueueDepthCollector{
+		desc: prometheus.NewDesc(
+			prometheus.BuildFQName("", schedulerSubsystem, "work_queue_depth"),
+			"Number of keys waiting to be processed by queue",
+			[]string{"queue"}, nil),
+	}
+)
+
+// workQueueStats holds the statistics of a work queue published via expvar.
+type workQueueStats struct {
+	depth     func() int
+	processed int64
+	errors    int64
+}
+
+var workQueues = make(map[string]*workQueueStats)
+var workQueuesLock = new(sync.RWMutex)
+
+// RegisterWorkQueue starts reporting the statistics of a work queue, whose depth is read through the
+// given function. Registering a queue again replaces its depth function and keeps its counts.
+func RegisterWorkQueue(queue string, depth func() int) {
+	workQueuesLock.Lock()
+	defer workQueuesLock.Unlock()
+	if stats, ok := workQueues[queue]; ok {
+		stats.depth = depth
+		return
+	}
+	workQueues[queue] = &workQueueStats{depth: depth}
+}
+
+// WorkQueueItemProcessed counts an item processed from a work queue.
+func WorkQueueItemProcessed(queue string) {
+	WorkQueueProcessed.WithLabelValues(queue).Inc()
+	workQueuesLock.Lock()
+	defer workQueuesLock.Unlock()
+	if stats, ok := workQueues[queue]; ok {
+		stats.processed++
+	}
+}
+
+// WorkQueueItemFailed counts an item of a work queue which failed to be processed.
+func WorkQueueItemFailed(queue string) {
+	WorkQueueErrors.WithLabelValues(queue).Inc()
+	workQueuesLock.Lock()
+	defer workQueuesLock.Unlock()
+	if stats, ok := workQueues[queue]; ok {
+		stats.errors++
+	}
+}
+
+// workQueueVars returns the statistics of the work queues as published via expvar.
+func workQueueVars() interface{} {
+	workQueuesLock.RLock()
+	defer workQueuesLock.RUnlock()
+	vars := make(map[string]map[string]int64, len(workQueues))
+	for queue, stats := range workQueues {
+		vars[queue] = map[string]int64{
+			"depth":     int64(stats.depth()),
+			"processed": stats.processed,
+			"errors":    stats.errors,
+		}
+	}
+	return vars
+}
+
+// workQueueDepthCollector reports the depth of the work queues, read when the metrics are collected.
+type workQueueDepthCollector struct {
+	desc *prometheus.Desc
+}
+
+// Describe implements prometheus.Collector.
+func (c *workQueueDepthCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+// Collect implements prometheus.Collector.
+func (c *workQueueDepthCollector) Collect(ch chan<- prometheus.Metric) {
+	workQueuesLock.RLock()
+	defer workQueuesLock.RUnlock()
+	for queue, stats := range workQueues {
+		ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, float64(stats.depth()), queue)
+	}
+}
+
+func init() {
+	expvar.Publish("poseidon_work_queues", expvar.Func(workQueueVars))
+}
@@ -19,18 +19,21 @@ package poseidonhttp
 import (
 	"context"
 	"encoding/json"
+	"expvar"
 	"net/http"
 
 	"github.com/golang/glog"
 	"github.com/kubernetes-sigs/poseidon/pkg/config"
 	"github.com/kubernetes-sigs/poseidon/pkg/debugutil"
 	"github.com/kubernetes-sigs/poseidon/pkg/firmament"
+	"github.com/kubernetes-sigs/poseidon/pkg/k8sclient"
 	"github.com/kubernetes-sigs/poseidon/pkg/metrics"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 const (
 	pathMetrics = "/metrics"
+	pathVars    = "/debug/vars"
 	PathHealth  = "/healthz"
 )
 
@@ -39,6 +42,22 @@ func generateMetricsHandler() map[string]http.Handler {
 	metrics.Register()
 	m := make(map[string]http.Handler)
 	m[pathMetrics] = promhttp.Handler()
+	// The same statistics for the environments without Prometheus.
+	m[pathVars] = expvar.Handler()
+	return m
+}
+
+// generatePodDebugHandler generates the pod debug handlers.
+func generatePodDebugHandler() map[string]http.Handler {
+	m := make(map[string]http.Handler)
+	m[k8sclient.PathDebugPods] = k8sclient.NewPodDebugHandler()
+	return m
+}
+
+// generateAdminHandler generates the admin handlers.
+func generateAdminHandler() map[string]http.Handler {
+	m := make(map[string]http.Handler)
+	m[k8sclient.PathAdminResubmit] = k8sclient.NewPodResubmitHandler()
 	return m
 }
 
@@ -117,6 +136,14 @@ func Serve(fc firmament.FirmamentSchedulerClient) {
 		go debugutil.RuntimeStack()
 		buildAddrMap(cfg.PprofAddress, debugutil.PProfHandlers(), addrMap)
 	}
+	if cfg.EnablePodDebug {
+		glog.Infof("pod debug is enabled under %s", config.GetPprofAddress()+k8sclient.PathDebugPods)
+		buildAddrMap(cfg.PprofAddress, generatePodDebugHandler(), addrMap)
+	}
+	if cfg.EnableAdminEndpoints {
+		glog.Infof("admin endpoints are enabled under %s", config.GetPprofAddress()+k8sclient.PathAdminResubmit)
+		buildAddrMap(cfg.PprofAddress, generateAdminHandler(), addrMap)
+	}
 	// add healthz handler map to addrMap
 	buildAddrMap(cfg.HealthCheckAddress, generateHealthzHandler(fc), addrMap)
 
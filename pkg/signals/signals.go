@@ -0,0 +1,48 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package signals turns the shutdown signals into a stop channel, so that Poseidon stops cleanly when
+// its pod is deleted rather than being killed with its work in progress.
+package signals
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/golang/glog"
+)
+
+// shutdownSignals are the signals stopping Poseidon, SIGTERM is sent by the kubelet.
+var shutdownSignals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+
+// SetupSignalHandler returns a channel closed on the first SIGTERM or SIGINT. A second signal exits
+// right away, e.g. when the clean shutdown is stuck.
+func SetupSignalHandler() <-chan struct{} {
+	stopCh := make(chan struct{})
+	c := make(chan os.Signal, 2)
+	signal.Notify(c, shutdownSignals...)
+	go func() {
+		sig := <-c
+		glog.Infof("Received %v, shutting down", sig)
+		close(stopCh)
+		sig = <-c
+		glog.Errorf("Received %v again, exiting", sig)
+		glog.Flush()
+		os.Exit(1)
+	}()
+	return stopCh
+}
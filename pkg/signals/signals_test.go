@@ -0,0 +1,40 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package signals
+
+import (
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestSetupSignalHandler(t *testing.T) {
+	stopCh := SetupSignalHandler()
+	select {
+	case <-stopCh:
+		t.Fatal("expected the stop channel to stay open until a signal is received")
+	default:
+	}
+	if err := syscall.Kill(syscall.Getpid(), syscall.SIGTERM); err != nil {
+		t.Fatalf("failed to send SIGTERM: %v", err)
+	}
+	select {
+	case <-stopCh:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the stop channel to be closed on SIGTERM")
+	}
+}
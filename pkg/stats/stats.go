@@ -125,10 +125,7 @@ func (s *poseidonStatsServer) ReceivePodStats(stream PoseidonStats_ReceivePodSta
 			return err
 		}
 		taskStats := convertPodStatsToTaskStats(podStats)
-		podIdentifier := k8sclient.PodIdentifier{
-			Name:      podStats.Name,
-			Namespace: podStats.Namespace,
-		}
+		podIdentifier := k8sclient.NewPodIdentifier(podStats.Namespace, podStats.Name)
 		k8sclient.PodMux.RLock()
 		td, ok := k8sclient.PodToTD[podIdentifier]
 		k8sclient.PodMux.RUnlock()
@@ -0,0 +1,204 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tracing
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const (
+	// ServiceName is the name of the service the exported spans are attributed to.
+	ServiceName = "poseidon"
+	// exportInterval is the time between two exports of the finished spans.
+	exportInterval = 5 * time.Second
+	// maxQueuedSpans is the number of finished spans kept until the next export, the later ones are dropped.
+	maxQueuedSpans = 10000
+)
+
+// OTLPExporter is a SpanRecorder exporting the finished spans to an OpenTelemetry collector with the
+// OTLP/HTTP protocol, JSON encoded.
+type OTLPExporter struct {
+	endpoint string
+	client   *http.Client
+
+	lock  sync.Mutex
+	spans []*Span
+}
+
+// NewOTLPExporter returns an exporter of the spans to the OTLP/HTTP traces endpoint, e.g.
+// http://otel-collector:4318/v1/traces.
+func NewOTLPExporter(endpoint string) *OTLPExporter {
+	return &OTLPExporter{
+		endpoint: endpoint,
+		client:   &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// RecordSpan queues the span until the next export.
+func (e *OTLPExporter) RecordSpan(span *Span) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	if len(e.spans) >= maxQueuedSpans {
+		return
+	}
+	e.spans = append(e.spans, span)
+}
+
+// Run exports the finished spans periodically until stopCh is closed, the last ones are exported then.
+func (e *OTLPExporter) Run(stopCh <-chan struct{}) {
+	defer utilruntime.HandleCrash()
+	wait.Until(e.export, exportInterval, stopCh)
+	e.export()
+}
+
+func (e *OTLPExporter) export() {
+	e.lock.Lock()
+	spans := e.spans
+	e.spans = nil
+	e.lock.Unlock()
+	if len(spans) == 0 {
+		return
+	}
+	if err := e.post(spans); err != nil {
+		glog.Errorf("Failed to export %d spans to %s: %v", len(spans), e.endpoint, err)
+	}
+}
+
+func (e *OTLPExporter) post(spans []*Span) error {
+	body, err := json.Marshal(otlpRequest(spans))
+	if err != nil {
+		return err
+	}
+	resp, err := e.client.Post(e.endpoint, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// The OTLP/HTTP JSON encoding of the spans, limited to the fields Poseidon sets.
+type otlpKeyValue struct {
+	Key   string `json:"key"`
+	Value struct {
+		StringValue string `json:"stringValue"`
+	} `json:"value"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              int            `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Status            *otlpStatus    `json:"status,omitempty"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpExportRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+const (
+	// otlpSpanKindInternal is the kind of the spans, Poseidon doesn't tell the client spans apart.
+	otlpSpanKindInternal = 1
+	// otlpStatusCodeError is the status of the spans which ended with an error.
+	otlpStatusCodeError = 2
+)
+
+func otlpAttributes(attributes map[string]string) []otlpKeyValue {
+	keys := make([]string, 0, len(attributes))
+	for key := range attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	keyValues := make([]otlpKeyValue, len(keys))
+	for i, key := range keys {
+		keyValues[i].Key = key
+		keyValues[i].Value.StringValue = attributes[key]
+	}
+	return keyValues
+}
+
+// otlpRequest encodes the spans as an OTLP export request of the Poseidon service.
+func otlpRequest(spans []*Span) *otlpExportRequest {
+	scopeSpans := otlpScopeSpans{Scope: otlpScope{Name: ServiceName}}
+	for _, span := range spans {
+		encoded := otlpSpan{
+			TraceID:           hex.EncodeToString(span.TraceID[:]),
+			SpanID:            hex.EncodeToString(span.SpanID[:]),
+			Name:              span.Name,
+			Kind:              otlpSpanKindInternal,
+			StartTimeUnixNano: strconv.FormatInt(span.Start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(span.End.UnixNano(), 10),
+			Attributes:        otlpAttributes(span.Attributes),
+		}
+		if span.Parent.IsValid() {
+			encoded.ParentSpanID = hex.EncodeToString(span.Parent.SpanID[:])
+		}
+		if span.Err != "" {
+			encoded.Status = &otlpStatus{Code: otlpStatusCodeError, Message: span.Err}
+		}
+		scopeSpans.Spans = append(scopeSpans.Spans, encoded)
+	}
+	return &otlpExportRequest{
+		ResourceSpans: []otlpResourceSpans{{
+			Resource:   otlpResource{Attributes: otlpAttributes(map[string]string{"service.name": ServiceName})},
+			ScopeSpans: []otlpScopeSpans{scopeSpans},
+		}},
+	}
+}
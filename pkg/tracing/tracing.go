@@ -0,0 +1,195 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package tracing records the spans of the scheduling of the pods, e.g. their conversion, the calls
+// to Firmament and their binds, so that they can be followed across the API server, Poseidon and
+// Firmament. The spans follow the OpenTelemetry model and are propagated with the W3C trace context.
+// Nothing is recorded until a SpanRecorder is set.
+package tracing
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// TraceparentHeader is the W3C trace context header the spans are propagated with.
+const TraceparentHeader = "traceparent"
+
+// SpanContext identifies a span and the trace it belongs to.
+type SpanContext struct {
+	TraceID [16]byte
+	SpanID  [8]byte
+}
+
+// IsValid returns true if the span context identifies a span.
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != [16]byte{} && sc.SpanID != [8]byte{}
+}
+
+// Traceparent returns the W3C traceparent header value of the span context, of a sampled span.
+func (sc SpanContext) Traceparent() string {
+	return fmt.Sprintf("00-%s-%s-01", hex.EncodeToString(sc.TraceID[:]), hex.EncodeToString(sc.SpanID[:]))
+}
+
+// Span is a timed operation of a trace.
+type Span struct {
+	Name string
+	SpanContext
+	// Parent is the span context of the parent span, invalid for the root spans.
+	Parent SpanContext
+	Start  time.Time
+	End    time.Time
+	// Attributes describe the operation, e.g. the pod it's about.
+	Attributes map[string]string
+	// Err is the error the operation ended with, empty if it succeeded.
+	Err string
+
+	recorder SpanRecorder
+}
+
+// Context returns the span context of the span, invalid for a nil span.
+func (s *Span) Context() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.SpanContext
+}
+
+// SetAttribute sets an attribute of the span. It's a no-op on a nil span, i.e. when tracing is disabled.
+func (s *Span) SetAttribute(key, value string) {
+	if s == nil {
+		return
+	}
+	if s.Attributes == nil {
+		s.Attributes = make(map[string]string)
+	}
+	s.Attributes[key] = value
+}
+
+// SetError records the error the operation ended with, if any. It's a no-op on a nil span.
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.Err = err.Error()
+}
+
+// Finish ends the span and hands it to the recorder. It's a no-op on a nil span.
+func (s *Span) Finish() {
+	if s == nil {
+		return
+	}
+	s.End = time.Now()
+	s.recorder.RecordSpan(s)
+}
+
+// SpanRecorder receives the finished spans, e.g. to export them. It must be safe for concurrent use.
+type SpanRecorder interface {
+	RecordSpan(span *Span)
+}
+
+var (
+	recorderLock sync.RWMutex
+	// recorder receives the finished spans, no span is started while it's nil.
+	recorder SpanRecorder
+)
+
+// SetRecorder sets the recorder of the finished spans, nil disables the tracing.
+func SetRecorder(r SpanRecorder) {
+	recorderLock.Lock()
+	defer recorderLock.Unlock()
+	recorder = r
+}
+
+func getRecorder() SpanRecorder {
+	recorderLock.RLock()
+	defer recorderLock.RUnlock()
+	return recorder
+}
+
+type spanKey struct{}
+
+// ContextWithSpan returns a context carrying the span, whose children are started from it.
+func ContextWithSpan(ctx context.Context, span *Span) context.Context {
+	if span == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, spanKey{}, span)
+}
+
+// FromContext returns the span the context carries, nil if it carries none.
+func FromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanKey{}).(*Span)
+	return span
+}
+
+// Start starts a span, child of the span the context carries if any, and returns a context carrying
+// the new span. It returns a nil span and the given context if tracing is disabled.
+func Start(ctx context.Context, name string) (context.Context, *Span) {
+	var parent SpanContext
+	if span := FromContext(ctx); span != nil {
+		parent = span.SpanContext
+	}
+	span := StartWithParent(parent, name)
+	return ContextWithSpan(ctx, span), span
+}
+
+// StartWithParent starts a span child of the given span context, or a root span if it's invalid, e.g.
+// to continue a trace across the pod queue. It returns nil if tracing is disabled.
+func StartWithParent(parent SpanContext, name string) *Span {
+	r := getRecorder()
+	if r == nil {
+		return nil
+	}
+	span := &Span{
+		Name:     name,
+		Parent:   parent,
+		Start:    time.Now(),
+		recorder: r,
+	}
+	if parent.IsValid() {
+		span.TraceID = parent.TraceID
+	} else {
+		rand.Read(span.TraceID[:])
+	}
+	rand.Read(span.SpanID[:])
+	return span
+}
+
+// InMemoryRecorder is a SpanRecorder keeping the finished spans in memory, e.g. for the tests.
+type InMemoryRecorder struct {
+	lock  sync.Mutex
+	spans []*Span
+}
+
+// RecordSpan keeps the span.
+func (r *InMemoryRecorder) RecordSpan(span *Span) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.spans = append(r.spans, span)
+}
+
+// Spans returns the finished spans, in the order they finished.
+func (r *InMemoryRecorder) Spans() []*Span {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return append([]*Span(nil), r.spans...)
+}
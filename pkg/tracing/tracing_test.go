@@ -0,0 +1,108 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tracing
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"golang.org/x/net/context"
+)
+
+func TestStart(t *testing.T) {
+	SetRecorder(nil)
+	if _, span := Start(context.Background(), "disabled"); span != nil {
+		t.Fatalf("expected no span while tracing is disabled, got %+v", span)
+	}
+
+	recorder := &InMemoryRecorder{}
+	SetRecorder(recorder)
+	defer SetRecorder(nil)
+	ctx, parent := Start(context.Background(), "parent")
+	_, child := Start(ctx, "child")
+	child.SetAttribute("key", "value")
+	child.SetError(errors.New("failed"))
+	child.Finish()
+	parent.Finish()
+
+	spans := recorder.Spans()
+	if len(spans) != 2 || spans[0].Name != "child" || spans[1].Name != "parent" {
+		t.Fatalf("expected the child and the parent spans, got %+v", spans)
+	}
+	if parent.Parent.IsValid() || !parent.IsValid() {
+		t.Errorf("expected a valid root span, got %+v", parent)
+	}
+	if child.TraceID != parent.TraceID || child.Parent != parent.SpanContext || child.SpanID == parent.SpanID {
+		t.Errorf("expected the child span in the trace of its parent, got %+v", child)
+	}
+	if child.Attributes["key"] != "value" || child.Err != "failed" {
+		t.Errorf("expected the attribute and the error of the child span, got %+v", child)
+	}
+	if !regexp.MustCompile(`^00-[0-9a-f]{32}-[0-9a-f]{16}-01$`).MatchString(child.Traceparent()) {
+		t.Errorf("expected a W3C traceparent, got %q", child.Traceparent())
+	}
+}
+
+func TestOTLPExporter(t *testing.T) {
+	requests := make(chan otlpExportRequest, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		var request otlpExportRequest
+		if err := json.Unmarshal(body, &request); err != nil {
+			t.Errorf("Failed to decode the export request: %v", err)
+		}
+		requests <- request
+	}))
+	defer server.Close()
+
+	exporter := NewOTLPExporter(server.URL)
+	SetRecorder(exporter)
+	defer SetRecorder(nil)
+	ctx, parent := Start(context.Background(), "parent")
+	_, child := Start(ctx, "child")
+	child.SetError(errors.New("failed"))
+	child.Finish()
+	parent.Finish()
+	exporter.export()
+
+	request := <-requests
+	if len(request.ResourceSpans) != 1 || len(request.ResourceSpans[0].ScopeSpans) != 1 {
+		t.Fatalf("expected the spans of a single resource and scope, got %+v", request)
+	}
+	resource := request.ResourceSpans[0].Resource
+	if len(resource.Attributes) != 1 || resource.Attributes[0].Value.StringValue != ServiceName {
+		t.Errorf("expected the spans of the %s service, got %+v", ServiceName, resource)
+	}
+	spans := request.ResourceSpans[0].ScopeSpans[0].Spans
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans, got %+v", spans)
+	}
+	if spans[0].Name != "child" || spans[0].ParentSpanID != spans[1].SpanID || spans[0].TraceID != spans[1].TraceID {
+		t.Errorf("expected the child span in the trace of its parent, got %+v", spans)
+	}
+	if spans[0].Status == nil || spans[0].Status.Code != otlpStatusCodeError || spans[1].Status != nil {
+		t.Errorf("expected only the child span to have an error status, got %+v", spans)
+	}
+	if len(exporter.spans) != 0 {
+		t.Errorf("expected the exported spans to be dropped, got %d", len(exporter.spans))
+	}
+}